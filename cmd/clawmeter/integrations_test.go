@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -118,3 +120,101 @@ func TestSetupClaudeStatuslineIntegration_WritesIsolatedHome(t *testing.T) {
 		t.Fatalf("expected idempotent ok, got %#v", result)
 	}
 }
+
+func TestMergePromptBlock_AppendsThenReplacesInPlace(t *testing.T) {
+	existing := "export EDITOR=vim"
+	block := promptBlockStart + "\nold\n" + promptBlockEnd + "\n"
+	out, changed := mergePromptBlock([]byte(existing), block)
+	if !changed || string(out) != existing+"\n\n"+block {
+		t.Fatalf("append = %v %q", changed, out)
+	}
+
+	withTail := string(out) + "alias ll='ls -l'\n"
+	updated := strings.Replace(block, "old", "new", 1)
+	out, changed = mergePromptBlock([]byte(withTail), updated)
+	if !changed || string(out) != existing+"\n\n"+updated+"alias ll='ls -l'\n" {
+		t.Fatalf("replace = %v %q", changed, out)
+	}
+	if _, changed := mergePromptBlock(out, updated); changed {
+		t.Fatal("expected second merge to be idempotent")
+	}
+}
+
+func TestSetupPromptIntegration_BacksUpAndDryRunDoesNotWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("prompt integrations are not supported on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ZDOTDIR", "")
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	rc := filepath.Join(home, ".zshrc")
+	if err := os.WriteFile(rc, []byte("setopt autocd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	zsh := promptIntegrations[0]
+
+	if result := setupPromptIntegration(zsh, true); result.Status != "would change" {
+		t.Fatalf("dry run = %#v", result)
+	}
+	if data, _ := os.ReadFile(rc); string(data) != "setopt autocd\n" {
+		t.Fatalf("dry run wrote %q", data)
+	}
+
+	if result := setupPromptIntegration(zsh, false); result.Status != "installed" {
+		t.Fatalf("install = %#v", result)
+	}
+	data, err := os.ReadFile(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := filepath.Join(home, ".cache", "clawmeter", "prompt-segment")
+	if !strings.HasPrefix(string(data), "setopt autocd\n") || !strings.Contains(string(data), segment) {
+		t.Fatalf("zshrc = %s", data)
+	}
+	backups, _ := filepath.Glob(rc + ".before-clawmeter-prompt.*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+
+	if result := setupPromptIntegration(zsh, false); result.Status != "ok" {
+		t.Fatalf("expected idempotent ok, got %#v", result)
+	}
+	if result := promptIntegrationStatus(zsh); result.Status != "installed" {
+		t.Fatalf("status = %#v", result)
+	}
+}
+
+func TestPromptSegmentsNeverWaitOnClawmeter(t *testing.T) {
+	for _, p := range promptIntegrations {
+		body := p.Body("/tmp/it's/prompt-segment")
+		if !strings.Contains(body, "clawmeter statusline") {
+			t.Fatalf("%s does not refresh the segment:\n%s", p.Name, body)
+		}
+		for _, line := range strings.Split(body, "\n") {
+			if strings.Contains(line, "clawmeter statusline") && !strings.Contains(line, "&") {
+				t.Fatalf("%s runs clawmeter in the foreground: %s", p.Name, line)
+			}
+		}
+	}
+}
+
+func TestBashPromptHookIsAddedOnce(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	rc := filepath.Join(t.TempDir(), "prompt.bash")
+	if err := os.WriteFile(rc, []byte(bashPromptBody(filepath.Join(t.TempDir(), "segment"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := `PROMPT_COMMAND="history -a"; PS1='$ '; . "$1"; . "$1"; printf '%s\n%s\n' "$PROMPT_COMMAND" "$PS1"`
+	out, err := exec.Command(bash, "--norc", "--noprofile", "-c", script, "bash", rc).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash: %v\n%s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 || lines[0] != "_clawmeter_prompt; history -a" || strings.Count(lines[1], "CLAWMETER_SEGMENT:+") != 1 {
+		t.Fatalf("after sourcing twice:\n%s", out)
+	}
+}
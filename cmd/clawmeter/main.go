@@ -6,19 +6,32 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/tnunamak/clawmeter/internal/autostart"
+	"github.com/tnunamak/clawmeter/internal/cache"
 	"github.com/tnunamak/clawmeter/internal/cli"
 	"github.com/tnunamak/clawmeter/internal/config"
 	"github.com/tnunamak/clawmeter/internal/diagnose"
+	"github.com/tnunamak/clawmeter/internal/engine"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/history"
+	"github.com/tnunamak/clawmeter/internal/metrics"
+	"github.com/tnunamak/clawmeter/internal/notifier"
 	"github.com/tnunamak/clawmeter/internal/provider"
 	"github.com/tnunamak/clawmeter/internal/provider/alibabatoken"
 	"github.com/tnunamak/clawmeter/internal/provider/all"
+	"github.com/tnunamak/clawmeter/internal/server"
 	"github.com/tnunamak/clawmeter/internal/shellpath"
 	"github.com/tnunamak/clawmeter/internal/tray"
 	"github.com/tnunamak/clawmeter/internal/update"
@@ -52,6 +65,18 @@ func run() int {
 		return statusCmd(os.Args[2:])
 	case "statusline":
 		return statuslineCmd(os.Args[2:])
+	case "history":
+		return historyCmd(os.Args[2:])
+	case "serve":
+		return serveCmd(os.Args[2:])
+	case "metrics":
+		return metricsCmd(os.Args[2:])
+	case "watch":
+		return watchCmd(os.Args[2:])
+	case "top":
+		return topCmd(os.Args[2:])
+	case "gate":
+		return gateCmd(os.Args[2:])
 	case "setup":
 		return setupCmd(os.Args[2:])
 	case "doctor":
@@ -63,7 +88,7 @@ func run() int {
 	case "providers":
 		return providersCmd(os.Args[2:])
 	case "update":
-		return updateCmd()
+		return updateCmd(os.Args[2:])
 	case "version", "--version", "-v":
 		fmt.Println("clawmeter " + Version)
 		return 0
@@ -129,8 +154,452 @@ func statusCmd(args []string) int {
 func statuslineCmd(args []string) int {
 	fs := flag.NewFlagSet("statusline", flag.ExitOnError)
 	showAll := fs.Bool("all", false, "include unavailable providers")
+	formatFlag := fs.String("format", "", "preset name or Go template (default: settings.statusline.format)")
+	waybarFlag := fs.Bool("waybar", false, "output a waybar custom module update (JSON)")
+	i3barFlag := fs.Bool("i3bar", false, "output an i3bar block (JSON); with --follow, the i3bar protocol")
+	followFlag := fs.Bool("follow", false, "keep running and print a line after every poll")
+	intervalFlag := fs.Duration("interval", 0, "with --follow, poll interval (default: the configured poll_interval)")
 	fs.Parse(args)
-	return cli.StatusLine(*showAll)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: statusline does not take positional arguments\n")
+		return 1
+	}
+
+	opts := cli.StatusLineOptions{ShowAll: *showAll, Format: *formatFlag, Follow: *followFlag}
+	switch {
+	case *waybarFlag && *i3barFlag:
+		fmt.Fprintln(os.Stderr, "clawmeter: use either --waybar or --i3bar, not both")
+		return 1
+	case (*waybarFlag || *i3barFlag) && *formatFlag != "":
+		fmt.Fprintln(os.Stderr, "clawmeter: --format applies to text output, not --waybar or --i3bar")
+		return 1
+	case *waybarFlag:
+		opts.Mode = cli.StatusLineWaybar
+	case *i3barFlag:
+		opts.Mode = cli.StatusLineI3bar
+	}
+	if *followFlag {
+		interval, err := serveInterval(*intervalFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		opts.Interval = interval
+	} else if *intervalFlag != 0 {
+		fmt.Fprintln(os.Stderr, "clawmeter: --interval requires --follow")
+		return 1
+	}
+	return cli.StatusLine(opts)
+}
+
+func historyCmd(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	jsonMode := fs.Bool("json", false, "output JSON")
+	providerFlag := fs.String("provider", "", "show only a provider or provider:source")
+	windowFlag := fs.String("window", "", "show only the named window or balance (e.g. 5h, 7d)")
+	sinceFlag := fs.String("since", "7d", "show readings newer than a duration (30m, 12h, 7d) or date (2006-01-02)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: history does not take positional arguments\n")
+		return 1
+	}
+
+	q := history.Query{Window: strings.TrimSpace(*windowFlag)}
+	if *providerFlag != "" {
+		name, ok := historyProviderKey(*providerFlag)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "clawmeter: unknown provider %q\n", *providerFlag)
+			return 1
+		}
+		q.Provider = name
+	}
+	if *sinceFlag != "" {
+		since, err := parseSince(*sinceFlag, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		q.Since = since
+	}
+	return cli.History(q, *jsonMode)
+}
+
+// historyProviderKey canonicalizes the family part of a provider or
+// provider:source selector.
+func historyProviderKey(value string) (string, bool) {
+	family, source, hasSource := strings.Cut(strings.TrimSpace(value), ":")
+	canonical, ok := all.CanonicalName(family)
+	if !ok {
+		return "", false
+	}
+	if hasSource {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" || source == "default" {
+			return canonical, true
+		}
+		return canonical + ":" + source, true
+	}
+	return canonical, true
+}
+
+// parseSince accepts a lookback such as 30m, 12h or 7d, or an absolute date.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "d") {
+		var days int
+		if _, err := fmt.Sscanf(value, "%dd", &days); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	} else if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q (use 30m, 12h, 7d, or 2006-01-02)", value)
+}
+
+// serveCmd serves status, diagnostics, and metrics documents on a Unix
+// socket or a loopback HTTP address.
+func serveCmd(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	socketFlag := fs.String("socket", "", "Unix socket path (default: clawmeter.sock in the cache dir)")
+	listenFlag := fs.String("listen", "", "loopback HTTP address such as 127.0.0.1:7878 instead of a socket")
+	intervalFlag := fs.Duration("interval", 0, "poll interval (default: the configured poll_interval)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: serve does not take positional arguments\n")
+		return 1
+	}
+	if *socketFlag != "" && *listenFlag != "" {
+		fmt.Fprintln(os.Stderr, "clawmeter: use either --socket or --listen, not both")
+		return 1
+	}
+	interval, err := serveInterval(*intervalFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+
+	var ln net.Listener
+	var address string
+	if *listenFlag != "" {
+		ln, err = server.ListenLoopback(*listenFlag)
+		address = "http://" + *listenFlag
+	} else {
+		path := *socketFlag
+		if path == "" {
+			if path, err = server.DefaultSocketPath(); err != nil {
+				fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+				return 1
+			}
+		}
+		ln, err = server.ListenUnix(path)
+		address = "unix:" + path
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: listen: %v\n", err)
+		return 1
+	}
+	return runServer(ln, address, interval)
+}
+
+// metricsCmd prints current usage in the Prometheus text format, writes it
+// to a node_exporter textfile, or serves it with --listen.
+func metricsCmd(args []string) int {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	listenFlag := fs.String("listen", "", "serve /metrics on a loopback address such as 127.0.0.1:9797")
+	textfileFlag := fs.String("textfile", "", "write metrics atomically to a node_exporter textfile (*.prom)")
+	intervalFlag := fs.Duration("interval", 0, "with --listen, poll interval (default: the configured poll_interval)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: metrics does not take positional arguments\n")
+		return 1
+	}
+	if *listenFlag != "" && *textfileFlag != "" {
+		fmt.Fprintln(os.Stderr, "clawmeter: use either --listen or --textfile, not both")
+		return 1
+	}
+
+	if *listenFlag != "" {
+		interval, err := serveInterval(*intervalFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		ln, err := server.ListenLoopback(*listenFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: listen: %v\n", err)
+			return 1
+		}
+		return runServer(ln, "http://"+*listenFlag+"/metrics", interval)
+	}
+
+	snapshot, err := cli.CollectStatus(context.Background(), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	if *textfileFlag != "" {
+		if err := metrics.WriteTextfile(*textfileFlag, snapshot.Output.Providers, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: write metrics: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := metrics.Write(os.Stdout, snapshot.Output.Providers, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: write metrics: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// topCmd runs the full-screen terminal dashboard.
+func topCmd(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	showAll := fs.Bool("all", false, "include unavailable and disabled providers")
+	intervalFlag := fs.Duration("interval", 0, "poll interval (default: the configured poll_interval)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: top does not take positional arguments\n")
+		return 1
+	}
+	interval, err := serveInterval(*intervalFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	return cli.Top(interval, *showAll)
+}
+
+// watchCmd polls and delivers alerts in the foreground, for machines
+// without a tray.
+func watchCmd(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	intervalFlag := fs.Duration("interval", 0, "poll interval (default: the configured poll_interval)")
+	onceFlag := fs.Bool("once", false, "poll once, deliver any alerts, and exit")
+	quietFlag := fs.Bool("quiet", false, "do not log a summary line after each poll")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: watch does not take positional arguments\n")
+		return 1
+	}
+	interval, err := serveInterval(*intervalFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+
+	resolver := shellpath.NewSessionEnvironmentResolver()
+	registry := provider.NewRegistry()
+	all.Register(registry, cfg, resolver)
+
+	// Alerts always go to stdout, which systemd and log files collect, as well
+	// as to every configured sink.
+	rules := append([]notifier.Rule{{Sink: notifier.NewWriterSink(os.Stdout)}}, notifier.Rules(cfg, resolver)...)
+	alerts := notifier.NewDispatcher(rules)
+	alerts.ApplyConfig(cfg)
+	if path, err := notifier.DefaultStatePath(); err == nil {
+		if err := alerts.UseStateFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: notification state: %v\n", err)
+		}
+	}
+	eng := engine.New(registry, alerts)
+	eng.Logf = func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "clawmeter: "+format+"\n", args...)
+	}
+	eng.SetForecastMode(cfg.ForecastMode())
+	eng.SetCacheTTLs(cfg)
+	if cached, err := cache.Read(); err == nil && cached != nil {
+		eng.Restore(cached)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer eng.Wait()
+
+	summarize := func(result *provider.MultiFetchResult) {
+		if !*quietFlag {
+			fmt.Fprintf(os.Stderr, "clawmeter: %s\n", watchSummary(result))
+		}
+	}
+	if *onceFlag {
+		eng.RefreshStatus(ctx)
+		if result, ok := eng.Poll(ctx); ok {
+			summarize(result)
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "clawmeter: watching %d providers (poll every %s)\n", len(registry.GetConfigured()), interval)
+
+	// Apply saves to config.yaml without a restart. An explicit --interval
+	// keeps precedence over the configured one.
+	current := interval
+	reload := func() {
+		next, err := config.Load(all.SourceValidator())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: keeping the previous config: %v\n", err)
+			return
+		}
+		registry := provider.NewRegistry()
+		all.Register(registry, next, resolver)
+		eng.SetRegistry(registry)
+		alerts.SetRules(append([]notifier.Rule{{Sink: notifier.NewWriterSink(os.Stdout)}}, notifier.Rules(next, resolver)...))
+		alerts.ApplyConfig(next)
+		eng.SetForecastMode(next.ForecastMode())
+		eng.SetCacheTTLs(next)
+		if *intervalFlag == 0 {
+			if configured := time.Duration(next.Settings.PollInterval) * time.Second; configured >= config.MinimumPollIntervalSeconds*time.Second && configured != current {
+				current = configured
+				eng.SetPollInterval(current)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "clawmeter: config reloaded (%d providers, poll every %s)\n", len(registry.GetConfigured()), current)
+	}
+	if err := config.Watch(ctx, reload); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: config changes need a restart: %v\n", err)
+	}
+	eng.Run(ctx, interval, summarize)
+	return 0
+}
+
+// gateCmd reports through its exit code whether a window has room for a job
+// of the given size.
+func gateCmd(args []string) int {
+	fs := flag.NewFlagSet("gate", flag.ExitOnError)
+	providerFlag := fs.String("provider", "", "provider or provider:source to check, e.g. claude:work")
+	windowFlag := fs.String("window", "", "window to spend from, e.g. 5h")
+	needFlag := fs.String("need", "", "share of the window the job needs, e.g. 8%")
+	marginFlag := fs.Duration("until-reset-margin", 0, "how long past the reset the quota must last at the current pace (a safety buffer)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: gate does not take positional arguments\n")
+		return cli.GateExitError
+	}
+	if *providerFlag == "" || *windowFlag == "" || *needFlag == "" {
+		fmt.Fprintln(os.Stderr, "clawmeter: gate requires --provider, --window, and --need")
+		return cli.GateExitError
+	}
+	need, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(*needFlag), "%"), 64)
+	// ParseFloat accepts NaN and Inf, which would fail every comparison.
+	if err != nil || math.IsNaN(need) || math.IsInf(need, 0) || need < 0 {
+		fmt.Fprintf(os.Stderr, "clawmeter: invalid --need %q (want a finite percentage of 0%% or more, such as 8%%)\n", *needFlag)
+		return cli.GateExitError
+	}
+	if *marginFlag < 0 {
+		fmt.Fprintln(os.Stderr, "clawmeter: --until-reset-margin must not be negative")
+		return cli.GateExitError
+	}
+	return cli.Gate(cli.GateRequest{Source: *providerFlag, Window: *windowFlag, Need: need, Margin: *marginFlag})
+}
+
+// watchSummary describes one poll in a single log line.
+func watchSummary(result *provider.MultiFetchResult) string {
+	names := make([]string, 0, len(result.Results))
+	for name := range result.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		data := result.Results[name]
+		switch {
+		case data == nil:
+			continue
+		case data.IsExpired:
+			parts = append(parts, name+"=expired")
+		case data.Error != "" && !data.HasPresentableUsage():
+			parts = append(parts, name+"=error")
+		default:
+			peak := 0.0
+			for _, window := range data.UsableWindows() {
+				peak = max(peak, window.Utilization)
+			}
+			part := fmt.Sprintf("%s=%.0f%%", name, peak)
+			if data.Stale {
+				part += "(stale)"
+			}
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "polled: no configured providers"
+	}
+	return "polled: " + strings.Join(parts, " ")
+}
+
+// serveInterval resolves a long-running poll interval, defaulting to the
+// configured tray interval and keeping the same five-minute floor.
+func serveInterval(requested time.Duration) (time.Duration, error) {
+	interval := requested
+	if interval == 0 {
+		cfg, err := config.Load(all.SourceValidator())
+		if err != nil {
+			return 0, err
+		}
+		interval = time.Duration(cfg.Settings.PollInterval) * time.Second
+	}
+	if interval < config.MinimumPollIntervalSeconds*time.Second {
+		return 0, fmt.Errorf("poll interval must be >= %ds", config.MinimumPollIntervalSeconds)
+	}
+	return interval, nil
+}
+
+// runServer polls once, then serves the shared poller's documents on ln until
+// interrupted.
+func runServer(ln net.Listener, address string, interval time.Duration) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	poller := server.NewPoller(collectServeSnapshot, interval)
+	if err := poller.Refresh(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: serve: poll failed: %v\n", err)
+	}
+	go poller.Run(ctx)
+
+	fmt.Fprintf(os.Stderr, "clawmeter: serving on %s (poll every %s)\n", address, interval)
+	if err := server.Serve(ctx, ln, server.Handler(poller)); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// collectServeSnapshot is the serve poller's only source of provider data: it
+// goes through the shared usage cache, so a running tray and the server
+// coalesce fetches, and diagnostics summarize the same readings instead of
+// probing again.
+func collectServeSnapshot(ctx context.Context) (*server.Snapshot, error) {
+	snapshot, err := cli.CollectStatus(ctx, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: serve: %v\n", err)
+		return nil, err
+	}
+	readings := make(map[string]*provider.UsageData, len(snapshot.Output.Providers))
+	for _, pf := range snapshot.Output.Providers {
+		readings[pf.Name] = pf.Data
+	}
+	diagnostics := diagnose.Summarize(
+		snapshot.Registry.GetAll(),
+		func(p provider.Provider) *provider.UsageData { return readings[provider.SourceKey(p)] },
+		func(name string) string {
+			p, _ := snapshot.Registry.Get(name)
+			return providerPollingState(p, snapshot.Config)
+		},
+	)
+	return &server.Snapshot{
+		Status:    snapshot.Output.JSONDocument(snapshot.Cache),
+		Diagnose:  diagnostics,
+		Providers: snapshot.Output.Providers,
+	}, nil
 }
 
 func providerCmd(providerName string, args []string) int {
@@ -175,6 +644,10 @@ func setupCmd(args []string) int {
 	allFlag := fs.Bool("all", false, "install supported local integrations")
 	tmuxFlag := fs.Bool("tmux", false, "install tmux status-right integration")
 	claudeFlag := fs.Bool("claude-statusline", false, "install Claude Code statusline integration")
+	promptFlags := make([]*bool, len(promptIntegrations))
+	for i, p := range promptIntegrations {
+		promptFlags[i] = fs.Bool(p.Flag, false, "install cache-only "+p.Name+" segment")
+	}
 	dryRun := fs.Bool("dry-run", false, "show changes without writing files or tmux settings")
 	fs.Parse(args)
 	if fs.NArg() > 0 {
@@ -185,7 +658,11 @@ func setupCmd(args []string) int {
 	if *allFlag {
 		*claudeFlag = true
 	}
-	if *tmuxFlag || *claudeFlag {
+	anyPrompt := false
+	for _, f := range promptFlags {
+		anyPrompt = anyPrompt || *f
+	}
+	if *tmuxFlag || *claudeFlag || anyPrompt {
 		fmt.Println("Clawmeter setup")
 		fmt.Println()
 		if *tmuxFlag {
@@ -194,6 +671,15 @@ func setupCmd(args []string) int {
 		if *claudeFlag {
 			printIntegrationResult(setupClaudeStatuslineIntegration(*dryRun))
 		}
+		for i, p := range promptIntegrations {
+			if *promptFlags[i] {
+				printIntegrationResult(setupPromptIntegration(p, *dryRun))
+			}
+		}
+		if anyPrompt && !*dryRun {
+			fmt.Println()
+			fmt.Println("Open a new shell to load the prompt segment.")
+		}
 		fmt.Println()
 		fmt.Println("Agent pull command: clawmeter status --agent")
 		fmt.Println("Run `clawmeter doctor` to verify provider auth and integrations.")
@@ -208,6 +694,7 @@ func setupCmd(args []string) int {
 	fmt.Println("Install individual or advanced integrations:")
 	fmt.Println("  clawmeter setup --claude-statusline")
 	fmt.Println("  clawmeter setup --tmux")
+	fmt.Println("  clawmeter setup --zsh | --bash | --fish | --starship")
 	fmt.Println()
 	fmt.Println("Start surfaces:")
 	fmt.Println("  clawmeter tray --install")
@@ -233,6 +720,9 @@ func doctorCmd(args []string) int {
 	fmt.Println("Integrations:")
 	printIntegrationResult(tmuxIntegrationStatus())
 	printIntegrationResult(claudeStatuslineStatus())
+	for _, p := range promptIntegrations {
+		printIntegrationResult(promptIntegrationStatus(p))
+	}
 	fmt.Println("  statusline command:      clawmeter statusline")
 	fmt.Println("  agent pull command:      clawmeter status --agent")
 	return 0
@@ -297,17 +787,96 @@ func configShowCmd(args []string) int {
 			}
 			fmt.Printf("    OAuth token: %s\n", show)
 		}
+		if pc.CacheTTL != "" {
+			fmt.Printf("    Cache TTL: %s\n", pc.CacheTTL)
+		}
+		if n := pc.Notifications; n.Warning > 0 || n.Critical > 0 {
+			fmt.Printf("    Notifications: %s\n", describeThresholds(n.Warning, n.Critical))
+		}
+		windows := make([]string, 0, len(pc.Notifications.Windows))
+		for window := range pc.Notifications.Windows {
+			windows = append(windows, window)
+		}
+		sort.Strings(windows)
+		for _, window := range windows {
+			w := pc.Notifications.Windows[window]
+			detail := "never"
+			if !w.Never {
+				detail = describeThresholds(w.Warning, w.Critical)
+			}
+			fmt.Printf("    Notifications (%s): %s\n", window, detail)
+		}
 	}
 
 	fmt.Printf("\nSettings:\n")
 	fmt.Printf("  Poll interval: %d seconds\n", cfg.Settings.PollInterval)
 	fmt.Printf("  Check for updates: %t\n", cfg.ShouldCheckForUpdates())
+	if channel := cfg.Settings.UpdateChannel; channel != "" {
+		fmt.Printf("  Update channel: %s\n", channel)
+	}
+	if pinned := cfg.Settings.PinnedVersion; pinned != "" {
+		fmt.Printf("  Pinned version: %s\n", pinned)
+	}
+	if releaseURL := cfg.Settings.ReleaseURL; releaseURL != "" {
+		fmt.Printf("  Release URL: %s\n", releaseURL)
+	}
 	fmt.Printf("  Warning threshold: %.0f%%\n", cfg.Settings.NotificationThresholds.Warning)
 	fmt.Printf("  Critical threshold: %.0f%%\n", cfg.Settings.NotificationThresholds.Critical)
+	fmt.Printf("  Forecast mode: %s\n", cfg.ForecastMode())
+	fmt.Printf("  Tray icon layout: %s\n", cfg.IconLayout())
+	fmt.Printf("  Tray auto mode: %s\n", cfg.IconAutoMode())
+	if target := cfg.Settings.Tray.IconTarget; target != "" {
+		fmt.Printf("  Tray icon target: %s\n", target)
+	}
+	if format := cfg.Settings.Statusline.Format; format != "" {
+		fmt.Printf("  Statusline format: %s\n", format)
+	}
+	if q := cfg.Settings.QuietHours; q.Start != "" || q.End != "" {
+		fmt.Printf("  Quiet hours: %s-%s\n", q.Start, q.End)
+	}
+	if sinks := cfg.Settings.Notifications.Sinks; len(sinks) > 0 {
+		fmt.Printf("  Notification sinks:\n")
+		for _, sink := range sinks {
+			scope := "all providers"
+			if len(sink.Providers) > 0 {
+				scope = strings.Join(sink.Providers, ", ")
+			}
+			fmt.Printf("    %s (%s): %s\n", sink.Label(), sink.Type, scope)
+		}
+	}
+	if pace := cfg.Settings.Notifications.Pace; len(pace) > 0 {
+		fmt.Printf("  Pace alerts:\n")
+		for _, key := range config.PaceWindowTypes {
+			alert, ok := pace[key]
+			if !ok {
+				continue
+			}
+			var conditions []string
+			if alert.RunsOutEarlyBy != "" {
+				conditions = append(conditions, "runs out "+alert.RunsOutEarlyBy+" early")
+			}
+			if alert.ProjectedPct > 0 {
+				conditions = append(conditions, fmt.Sprintf("projected >= %.0f%%", alert.ProjectedPct))
+			}
+			fmt.Printf("    %s: %s\n", key, strings.Join(conditions, " or "))
+		}
+	}
 
 	return 0
 }
 
+// describeThresholds summarizes a threshold override, naming the fields that
+// inherit.
+func describeThresholds(warning, critical float64) string {
+	describe := func(name string, pct float64) string {
+		if pct == 0 {
+			return name + " inherited"
+		}
+		return fmt.Sprintf("%s %.0f%%", name, pct)
+	}
+	return describe("warning", warning) + ", " + describe("critical", critical)
+}
+
 func configSetCmd(args []string) int {
 	if len(args) < 2 {
 		fmt.Fprintln(os.Stderr, "Usage: clawmeter config set <key> <value>")
@@ -315,6 +884,19 @@ func configSetCmd(args []string) int {
 		fmt.Fprintln(os.Stderr, "  warning_threshold <percent>")
 		fmt.Fprintln(os.Stderr, "  critical_threshold <percent>")
 		fmt.Fprintln(os.Stderr, "  check_for_updates <true|false>")
+		fmt.Fprintln(os.Stderr, "  update_channel <stable|prerelease>")
+		fmt.Fprintln(os.Stderr, "  pinned_version <vX.Y.Z|none>")
+		fmt.Fprintln(os.Stderr, "  release_url <url|default>")
+		fmt.Fprintln(os.Stderr, "  forecast_mode <average|recent>")
+		fmt.Fprintln(os.Stderr, "  statusline_format <preset|template|default>")
+		fmt.Fprintln(os.Stderr, "  icon_layout <single|dual>")
+		fmt.Fprintln(os.Stderr, "  icon_auto_mode <risk|projected|runway>")
+		fmt.Fprintln(os.Stderr, "  icon_target <provider>/<window>|auto")
+		fmt.Fprintln(os.Stderr, "  <provider>.warning_threshold <percent|default>")
+		fmt.Fprintln(os.Stderr, "  <provider>.critical_threshold <percent|default>")
+		fmt.Fprintln(os.Stderr, "  <provider>.<window>.warning_threshold <percent|default>")
+		fmt.Fprintln(os.Stderr, "  <provider>.<window>.critical_threshold <percent|default>")
+		fmt.Fprintln(os.Stderr, "  <provider>.<window>.notify <never|default>")
 		return 1
 	}
 
@@ -370,9 +952,71 @@ func configSetCmd(args []string) int {
 			return 1
 		}
 		cfg.Settings.CheckForUpdates = &enabled
+	case "update_channel":
+		if !slices.Contains(config.UpdateChannels, value) {
+			fmt.Fprintf(os.Stderr, "clawmeter: update_channel must be stable or prerelease\n")
+			return 1
+		}
+		cfg.Settings.UpdateChannel = value
+	case "pinned_version":
+		if value == "none" {
+			value = ""
+		}
+		cfg.Settings.PinnedVersion = value
+	case "release_url":
+		if value == "default" {
+			value = ""
+		}
+		cfg.Settings.ReleaseURL = value
+	case "forecast_mode":
+		mode, ok := forecast.ParseMode(value)
+		if !ok || value == "" {
+			fmt.Fprintf(os.Stderr, "clawmeter: forecast_mode must be average or recent\n")
+			return 1
+		}
+		cfg.Settings.Forecast.Mode = string(mode)
+	case "statusline_format":
+		if value == "default" {
+			value = ""
+		}
+		if _, err := cli.ParseStatusLineFormat(value); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		cfg.Settings.Statusline.Format = value
+	case "icon_layout":
+		if value != config.IconLayoutSingle && value != config.IconLayoutDual {
+			fmt.Fprintf(os.Stderr, "clawmeter: icon_layout must be single or dual\n")
+			return 1
+		}
+		cfg.Settings.Tray.IconLayout = value
+	case "icon_auto_mode":
+		if !slices.Contains(config.IconAutoModes, value) {
+			fmt.Fprintf(os.Stderr, "clawmeter: icon_auto_mode must be one of %s\n", strings.Join(config.IconAutoModes, ", "))
+			return 1
+		}
+		cfg.Settings.Tray.AutoMode = value
+	case "icon_target":
+		if value == "auto" {
+			value = ""
+		} else {
+			target, err := parseIconTarget(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+				return 1
+			}
+			value = target
+		}
+		cfg.Settings.Tray.IconTarget = value
 	default:
-		fmt.Fprintf(os.Stderr, "clawmeter: unknown config key %q\n", key)
-		return 1
+		if !strings.Contains(key, ".") {
+			fmt.Fprintf(os.Stderr, "clawmeter: unknown config key %q\n", key)
+			return 1
+		}
+		if err := setProviderKey(cfg, key, value); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
 	}
 
 	if err := cfg.Save(); err != nil {
@@ -384,6 +1028,112 @@ func configSetCmd(args []string) int {
 	return 0
 }
 
+// parseIconTarget checks a "<provider>[:<source>]/<window>" tray icon target
+// and returns it with the provider's canonical name.
+func parseIconTarget(value string) (string, error) {
+	source, window, ok := strings.Cut(value, "/")
+	if !ok || source == "" || window == "" {
+		return "", fmt.Errorf("icon_target must be <provider>/<window>, e.g. claude/5h, or auto")
+	}
+	family, sourceID, hasID := strings.Cut(source, ":")
+	providerName, ok := all.CanonicalName(family)
+	if !ok {
+		return "", fmt.Errorf("unknown provider %q", family)
+	}
+	if hasID {
+		if sourceID == "" {
+			return "", fmt.Errorf("icon_target source ID is empty")
+		}
+		// The default source's results are keyed by the bare provider name.
+		if sourceID != "default" {
+			providerName += ":" + sourceID
+		}
+	}
+	return providerName + "/" + window, nil
+}
+
+// setProviderKey applies a <provider>[.<window>].<field> key. The provider
+// must already have a config entry, because a new entry without enabled: true
+// would disable it.
+func setProviderKey(cfg *config.Config, key, value string) error {
+	parts := strings.Split(key, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+	providerName, ok := all.CanonicalName(parts[0])
+	if !ok {
+		return fmt.Errorf("unknown provider %q in config key %q", parts[0], key)
+	}
+	field := parts[len(parts)-1]
+	window := strings.Join(parts[1:len(parts)-1], ".")
+
+	pc, exists := cfg.Providers[providerName]
+	if !exists {
+		return fmt.Errorf("%s has no config entry; run `clawmeter config enable %s` first", providerName, providerName)
+	}
+	n := &pc.Notifications
+	var w config.WindowNotifications
+	if window != "" {
+		w = n.Windows[window]
+	}
+
+	switch field {
+	case "cache_ttl":
+		if window != "" {
+			return fmt.Errorf("cache_ttl is set per provider, e.g. %s.cache_ttl 5m", providerName)
+		}
+		pc.CacheTTL = ""
+		if value != "default" {
+			pc.CacheTTL = value
+		}
+	case "warning_threshold", "critical_threshold":
+		pct := 0.0
+		if value != "default" {
+			if _, err := fmt.Sscanf(value, "%f", &pct); err != nil || pct <= 0 || pct > 100 {
+				return fmt.Errorf("%s must be 1-100 or default", field)
+			}
+		}
+		target := &n.Warning
+		switch {
+		case window != "" && field == "warning_threshold":
+			target = &w.Warning
+		case window != "":
+			target = &w.Critical
+		case field == "critical_threshold":
+			target = &n.Critical
+		}
+		*target = pct
+		w.Never = false
+	case "notify":
+		if window == "" {
+			return fmt.Errorf("notify is set per window, e.g. %s.monthly.notify never", providerName)
+		}
+		switch value {
+		case "never":
+			w = config.WindowNotifications{Never: true}
+		case "default":
+			w.Never = false
+		default:
+			return fmt.Errorf("notify must be never or default")
+		}
+	default:
+		return fmt.Errorf("unknown config key %q", key)
+	}
+
+	if window != "" {
+		if n.Windows == nil {
+			n.Windows = make(map[string]config.WindowNotifications)
+		}
+		if w == (config.WindowNotifications{}) {
+			delete(n.Windows, window)
+		} else {
+			n.Windows[window] = w
+		}
+	}
+	cfg.Providers[providerName] = pc
+	return nil
+}
+
 func configEnableCmd(args []string, enable bool) int {
 	action := "enable"
 	if !enable {
@@ -999,33 +1749,146 @@ func describeProviderState(p provider.Provider, cfg *config.Config) string {
 	}
 }
 
-func updateCmd() int {
-	if Version == "dev" {
+// updateCheckOutput is the `update --check --json` document.
+type updateCheckOutput struct {
+	CurrentVersion  string               `json:"current_version"`
+	Channel         string               `json:"channel"`
+	PinnedVersion   string               `json:"pinned_version,omitempty"`
+	UpdateAvailable bool                 `json:"update_available"`
+	Release         *updateReleaseOutput `json:"release,omitempty"`
+}
+
+type updateReleaseOutput struct {
+	Version     string     `json:"version"`
+	Prerelease  bool       `json:"prerelease"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+	URL         string     `json:"url"`
+}
+
+func updateCmd(args []string) int {
+	var rollback, checkOnly, jsonOut bool
+	target := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--rollback":
+			rollback = true
+		case arg == "--check":
+			checkOnly = true
+		case arg == "--json":
+			jsonOut = true
+		case arg == "--to":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "clawmeter: --to requires a version")
+				return 2
+			}
+			target = args[i]
+		case strings.HasPrefix(arg, "--to="):
+			target = strings.TrimPrefix(arg, "--to=")
+		default:
+			fmt.Fprintf(os.Stderr, "clawmeter: unknown update flag %q\n", arg)
+			return 2
+		}
+	}
+	if rollback && (checkOnly || target != "") {
+		fmt.Fprintln(os.Stderr, "clawmeter: --rollback cannot be combined with --check or --to")
+		return 2
+	}
+	if jsonOut && !checkOnly {
+		fmt.Fprintln(os.Stderr, "clawmeter: --json requires --check")
+		return 2
+	}
+	if rollback {
+		exe, err := update.ExecutablePath()
+		if err == nil {
+			err = update.Rollback(exe)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		fmt.Println("Restored the previous version. Restart any running tray instances.")
+		return 0
+	}
+	if Version == "dev" && !checkOnly {
 		fmt.Fprintln(os.Stderr, "clawmeter: self-update is not available for dev builds")
 		return 1
 	}
 
-	fmt.Printf("Current version: %s\n", Version)
-	fmt.Print("Checking for updates... ")
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	opts := updateOptions(cfg)
+	channel := opts.Channel
+	if channel == "" {
+		channel = update.ChannelStable
+	}
+
+	if !jsonOut {
+		fmt.Printf("Current version: %s\n", Version)
+		fmt.Print("Checking for updates... ")
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	rel, err := update.Check(ctx, Version)
+	var rel *update.Release
+	if target != "" {
+		rel, err = update.Find(ctx, Version, target, opts)
+	} else {
+		rel, err = update.Check(ctx, Version, opts)
+	}
 	if err != nil {
-		fmt.Println()
+		if !jsonOut {
+			fmt.Println()
+		}
 		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
 		return 1
 	}
+
+	if jsonOut {
+		out := updateCheckOutput{CurrentVersion: Version, Channel: channel, PinnedVersion: opts.Pinned, UpdateAvailable: rel != nil}
+		if rel != nil {
+			out.Release = &updateReleaseOutput{Version: rel.Version, Prerelease: rel.Prerelease, Notes: rel.Notes, URL: rel.URL}
+			if !rel.PublishedAt.IsZero() {
+				out.Release.PublishedAt = &rel.PublishedAt
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 	if rel == nil {
-		fmt.Println("already up to date.")
+		if opts.Pinned != "" {
+			fmt.Printf("already up to date (pinned to %s).\n", opts.Pinned)
+		} else {
+			fmt.Println("already up to date.")
+		}
 		return 0
 	}
 
 	fmt.Printf("found %s\n", rel.Version)
+	if checkOnly {
+		if notes := strings.TrimSpace(rel.Notes); notes != "" {
+			fmt.Printf("\n%s\n", notes)
+		}
+		return 0
+	}
+	if err := update.CanApply(); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
 	fmt.Printf("Downloading and installing %s... ", rel.Version)
 
-	if err := update.Apply(ctx, rel.URL); err != nil {
+	if err := update.Apply(ctx, rel); err != nil {
 		fmt.Println()
 		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
 		return 1
@@ -1036,12 +1899,24 @@ func updateCmd() int {
 	return 0
 }
 
+// updateOptions selects releases from the configured channel, pin, and
+// mirror.
+func updateOptions(cfg *config.Config) update.Options {
+	return update.Options{Channel: cfg.Settings.UpdateChannel, Pinned: cfg.Settings.PinnedVersion, BaseURL: cfg.Settings.ReleaseURL}
+}
+
 func printHelp(w io.Writer) {
 	fmt.Fprintln(w, `Usage: clawmeter [command] [flags]
 
 Commands:
   status                    Show usage for all configured providers (default)
   statusline                Print a compact statusline segment
+  history                   Show recorded usage history
+  serve                     Serve status JSON to local clients
+  metrics                   Print Prometheus metrics (or --listen/--textfile)
+  watch                     Poll in the foreground and send alerts (headless)
+  top                       Full-screen live dashboard for terminals
+  gate                      Decide whether a job fits a quota window (JSON)
   <provider>                Show usage for a specific provider
   providers                 List, connect, or configure providers
   setup                     Install or show local integrations
@@ -1071,6 +1946,58 @@ Config commands:
   providers connect <provider> [--force]
                             Connect provider quota access (currently token-plan)
 
+Statusline flags:
+  --format <preset|tmpl>    plain, tmux, polybar, waybar (or plain-all,
+                            tmux-all, polybar-all), or a Go text/template
+                            (default: statusline_format setting)
+  --waybar                  Waybar custom module JSON (text, tooltip, class,
+                            percentage); class is the forecast risk tier
+  --i3bar                   i3bar block JSON (i3blocks format=json)
+  --follow                  Keep running, printing after every poll and cache
+                            update; with --i3bar, speaks the i3bar protocol
+  --interval <duration>     With --follow, poll interval (default: poll_interval)
+
+History flags:
+  --provider <name>         Show only a provider or provider:source
+  --window <name>           Show only one window or balance (e.g. 5h, 7d)
+  --since <duration|date>   Lookback such as 12h or 7d (default 7d)
+  --json                    Output as JSON
+
+Serve flags:
+  --socket <path>           Unix socket (default: clawmeter.sock in the cache dir)
+  --listen <addr>           Loopback HTTP instead, e.g. 127.0.0.1:7878
+  --interval <duration>     Poll interval (default: poll_interval)
+
+Metrics flags:
+  --listen <addr>           Serve /metrics on a loopback address
+  --textfile <path>         Atomically write a node_exporter textfile (*.prom)
+  --interval <duration>     With --listen, poll interval (default: poll_interval)
+
+Watch flags:
+  --interval <duration>     Poll interval (default: poll_interval)
+  --once                    Poll once, deliver alerts, and exit
+  --quiet                   Log alerts only, not a line per poll
+
+Top flags:
+  --all                     Include unavailable and disabled providers
+  --interval <duration>     Poll interval (default: poll_interval)
+                            Keys: up/down or j/k select, r refresh the selected
+                            provider, R refresh all, o open its dashboard,
+                            e enable/disable it, a toggle --all, q quit
+
+Gate flags:
+  --provider <name>         Provider or provider:source, e.g. claude:work
+  --window <name>           Window to spend from, e.g. 5h
+  --need <percent>          Share of the window the job needs, e.g. 8%
+  --until-reset-margin <d>  Quota must last this long past reset (default 0)
+                            Exit 0=allow, 3=wait (see wait_until), 4=deny, 1=error
+
+Update flags:
+  --check                   Report the available release without installing
+  --json                    With --check, output JSON including release notes
+  --to <version>            Install a specific newer release
+  --rollback                Restore the binary the last update replaced
+
 Tray flags:
   --install                 Enable launch at login
   --uninstall               Disable launch at login
@@ -1078,9 +2005,16 @@ Tray flags:
 Examples:
   clawmeter                          # Show all providers
   clawmeter statusline               # Compact shell/tmux/statusline segment
+  clawmeter statusline --format tmux-all
+                                     # Every provider with tmux colours
   clawmeter status --agent           # Token-efficient all-quota summary
   clawmeter claude --json            # Show Claude usage as JSON
+  clawmeter history --provider claude --window 7d
+                                     # Claude 7d readings from the last week
   clawmeter --check                  # Exit code for monitoring
+  clawmeter serve                    # One shared poller for local agents
+  clawmeter gate --provider claude --window 5h --need 8%
+                                     # Can a job spend 8% of the 5h window now?
   clawmeter setup --all              # Install mainstream local integrations
   clawmeter codex                    # Show Codex quota
   clawmeter grok                     # Show Grok quota after grok login
@@ -1101,11 +2035,43 @@ Settable keys:
   warning_threshold <%>     Notification warning threshold (default: 80)
   critical_threshold <%>    Notification critical threshold (default: 95)
   check_for_updates <bool>  Automatic GitHub release checks (default: true)
+  update_channel <channel>  stable (default) or prerelease
+  pinned_version <version>  Newest release to offer or install, or none
+  release_url <url>         GitHub-compatible releases API mirror, or default
+  forecast_mode <mode>      average (since window start) or recent
+                            (fitted to recorded history; default: average)
+  statusline_format <preset|template|default>
+                            Statusline output: a preset (plain, tmux,
+                            polybar, waybar; -all variants list every
+                            provider) or a Go text/template
+  icon_layout <layout>      Tray icon: single window (default) or dual,
+                            which adds a bar for a second window
+  icon_auto_mode <mode>     How the tray's Auto icon picks a window: risk
+                            (default), projected (EST), or runway
+  icon_target <target>      Pin the tray icon to <provider>/<window>, e.g.
+                            claude/5h or claude:work/7d, or auto
+  <provider>.warning_threshold <%|default>
+  <provider>.critical_threshold <%|default>
+                            Per-provider notification thresholds
+  <provider>.<window>.warning_threshold <%|default>
+  <provider>.<window>.critical_threshold <%|default>
+                            Per-window thresholds; <window> is a window name
+                            or type (5h, 24h, 7d, monthly)
+  <provider>.<window>.notify <never|default>
+                            Mute or unmute one window's alerts
+  <provider>.cache_ttl <duration|default>
+                            How long readings stay cached, e.g. 30s or 15m
+                            (default: the provider's own, usually 60s)
 
 Examples:
   clawmeter config show
   clawmeter config set poll_interval 600
   clawmeter config set check_for_updates false
+  clawmeter config set forecast_mode recent
+  clawmeter config set statusline_format tmux-all
+  clawmeter config set claude.5h.warning_threshold 60
+  clawmeter config set copilot.monthly.notify never
+  clawmeter config set deepseek.cache_ttl 1h
   clawmeter config enable openrouter
   clawmeter providers enable openrouter
   clawmeter config disable claude`)
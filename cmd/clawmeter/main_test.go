@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 // buildBinary compiles clawmeter into a temp dir and returns the path.
@@ -106,6 +108,197 @@ func TestConfigSetPollIntervalRejectsBelowSafeFloor(t *testing.T) {
 	}
 }
 
+func TestConfigSetProviderAndWindowNotificationThresholds(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "config", "set", "copilot.monthly.notify", "never")
+	if code == 0 || !strings.Contains(stderr, "config enable copilot") {
+		t.Fatalf("override without a provider entry = %d %q, want enable hint", code, stderr)
+	}
+	if _, stderr, code := runWithHome(t, bin, home, "config", "enable", "copilot"); code != 0 {
+		t.Fatalf("enable copilot: %s", stderr)
+	}
+	for _, kv := range [][2]string{
+		{"copilot.warning_threshold", "90"},
+		{"copilot.monthly.notify", "never"},
+		{"copilot.5h.critical_threshold", "99"},
+	} {
+		if _, stderr, code := runWithHome(t, bin, home, "config", "set", kv[0], kv[1]); code != 0 {
+			t.Fatalf("config set %s %s: %s", kv[0], kv[1], stderr)
+		}
+	}
+	if _, _, code := runWithHome(t, bin, home, "config", "set", "copilot.5h.warning_threshold", "99"); code == 0 {
+		t.Fatal("warning at the window's critical threshold was accepted")
+	}
+
+	data, err := os.ReadFile(configPathForHome(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "monthly: never") {
+		t.Fatalf("config.yaml does not use the never shorthand:\n%s", data)
+	}
+	stdout, _, _ := runWithHome(t, bin, home, "config", "show")
+	for _, want := range []string{
+		"Notifications: warning 90%, critical inherited",
+		"Notifications (5h): warning inherited, critical 99%",
+		"Notifications (monthly): never",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("config show missing %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestConfigSetProviderCacheTTL(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	if _, stderr, code := runWithHome(t, bin, home, "config", "enable", "deepseek"); code != 0 {
+		t.Fatalf("enable deepseek: %s", stderr)
+	}
+	if _, stderr, code := runWithHome(t, bin, home, "config", "set", "deepseek.cache_ttl", "1h"); code != 0 {
+		t.Fatalf("config set deepseek.cache_ttl 1h: %s", stderr)
+	}
+	_, stderr, code := runWithHome(t, bin, home, "config", "set", "deepseek.cache_ttl", "1s")
+	if code == 0 || !strings.Contains(stderr, "at least 10s") {
+		t.Fatalf("short cache_ttl = %d %q, want floor", code, stderr)
+	}
+	stdout, _, _ := runWithHome(t, bin, home, "config", "show")
+	if !strings.Contains(stdout, "Cache TTL: 1h") {
+		t.Fatalf("config show missing cache TTL:\n%s", stdout)
+	}
+}
+
+func TestConfigSetTrayIconPreferences(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	for _, args := range [][]string{
+		{"icon_layout", "dual"},
+		{"icon_auto_mode", "runway"},
+		{"icon_target", "Claude:default/5h"},
+	} {
+		if _, stderr, code := runWithHome(t, bin, home, "config", "set", args[0], args[1]); code != 0 {
+			t.Fatalf("config set %s %s: %s", args[0], args[1], stderr)
+		}
+	}
+	stdout, _, _ := runWithHome(t, bin, home, "config", "show")
+	for _, want := range []string{"Tray icon layout: dual", "Tray auto mode: runway", "Tray icon target: claude/5h"} {
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("config show missing %q:\n%s", want, stdout)
+		}
+	}
+	for _, args := range [][]string{
+		{"icon_auto_mode", "est"},
+		{"icon_target", "claude"},
+		{"icon_target", "nope/5h"},
+	} {
+		if _, _, code := runWithHome(t, bin, home, "config", "set", args[0], args[1]); code == 0 {
+			t.Fatalf("config set %s %s succeeded, want refusal", args[0], args[1])
+		}
+	}
+	if _, stderr, code := runWithHome(t, bin, home, "config", "set", "icon_target", "auto"); code != 0 {
+		t.Fatalf("config set icon_target auto: %s", stderr)
+	}
+	stdout, _, _ = runWithHome(t, bin, home, "config", "show")
+	if strings.Contains(stdout, "Tray icon target") {
+		t.Fatalf("icon_target auto did not clear the target:\n%s", stdout)
+	}
+}
+
+func TestStatuslineFormatFromConfigAndFlag(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "config", "set", "statusline_format", "{{.Worst")
+	if code == 0 || !strings.Contains(stderr, "statusline format") {
+		t.Fatalf("malformed statusline_format = %d %q, want refusal", code, stderr)
+	}
+	if _, stderr, code := runWithHome(t, bin, home, "config", "set", "statusline_format", "waybar"); code != 0 {
+		t.Fatalf("config set statusline_format waybar: %s", stderr)
+	}
+	stdout, stderr, code := runWithHome(t, bin, home, "statusline")
+	if code != 0 || !strings.HasPrefix(stdout, `{"text":`) {
+		t.Fatalf("configured statusline = %d %q %q", code, stdout, stderr)
+	}
+	stdout, _, _ = runWithHome(t, bin, home, "statusline", "--format", "plain")
+	if strings.TrimSpace(stdout) != "no quota data" {
+		t.Fatalf("--format plain = %q, want flag to override config", stdout)
+	}
+	stdout, stderr, code = runWithHome(t, bin, home, "statusline", "--waybar")
+	if code != 0 || !strings.Contains(stdout, `"class":"none"`) {
+		t.Fatalf("--waybar = %d %q %q", code, stdout, stderr)
+	}
+	_, stderr, code = runWithHome(t, bin, home, "statusline", "--waybar", "--i3bar")
+	if code == 0 || !strings.Contains(stderr, "not both") {
+		t.Fatalf("--waybar --i3bar = %d %q, want refusal", code, stderr)
+	}
+	_, stderr, code = runWithHome(t, bin, home, "statusline", "--follow", "--interval", "1m")
+	if code == 0 || !strings.Contains(stderr, "must be >= 300s") {
+		t.Fatalf("short follow interval = %d %q, want safe floor", code, stderr)
+	}
+}
+
+func TestTopRequiresTerminalAndSafeInterval(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "top")
+	if code == 0 || !strings.Contains(stderr, "needs a terminal") {
+		t.Fatalf("top without a terminal = %d %q", code, stderr)
+	}
+	_, stderr, code = runWithHome(t, bin, home, "top", "--interval", "1m")
+	if code == 0 || !strings.Contains(stderr, "must be >= 300s") {
+		t.Fatalf("short interval = %d %q, want safe floor", code, stderr)
+	}
+}
+
+func TestServeRejectsPublicAddressAndShortInterval(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "serve", "--listen", "0.0.0.0:0")
+	if code == 0 || !strings.Contains(stderr, "non-loopback") {
+		t.Fatalf("public listen address = %d %q, want refusal", code, stderr)
+	}
+	_, stderr, code = runWithHome(t, bin, home, "serve", "--listen", "127.0.0.1:0", "--interval", "10s")
+	if code == 0 || !strings.Contains(stderr, "must be >= 300s") {
+		t.Fatalf("short interval = %d %q, want safe floor", code, stderr)
+	}
+}
+
+func TestWatchRejectsShortIntervalAndArguments(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "watch", "--interval", "1m")
+	if code == 0 || !strings.Contains(stderr, "must be >= 300s") {
+		t.Fatalf("short interval = %d %q, want safe floor", code, stderr)
+	}
+	_, stderr, code = runWithHome(t, bin, home, "watch", "claude")
+	if code == 0 || !strings.Contains(stderr, "positional arguments") {
+		t.Fatalf("positional argument = %d %q, want refusal", code, stderr)
+	}
+}
+
+func TestGateRejectsMissingAndInvalidFlags(t *testing.T) {
+	bin := buildBinary(t)
+	home := t.TempDir()
+
+	_, stderr, code := runWithHome(t, bin, home, "gate", "--provider", "claude", "--window", "5h")
+	if code != 1 || !strings.Contains(stderr, "requires --provider, --window, and --need") {
+		t.Fatalf("missing --need = %d %q", code, stderr)
+	}
+	for _, need := range []string{"lots", "NaN", "Inf", "-Inf%", "-1%"} {
+		_, stderr, code = runWithHome(t, bin, home, "gate", "--provider", "claude", "--window", "5h", "--need", need)
+		if code != 1 || !strings.Contains(stderr, fmt.Sprintf("invalid --need %q", need)) {
+			t.Fatalf("--need %s = %d %q", need, code, stderr)
+		}
+	}
+}
+
 func TestConfigDisable_RejectsUnknownProvider(t *testing.T) {
 	bin := buildBinary(t)
 	home := t.TempDir()
@@ -449,3 +642,45 @@ func TestTopLevelAllIsStatusShortcut(t *testing.T) {
 		t.Fatalf("--all should include unavailable providers in status output: %s", stdout)
 	}
 }
+
+func TestParseSinceAcceptsDaysDurationsAndDates(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	cases := map[string]time.Time{
+		"7d":         now.AddDate(0, 0, -7),
+		"12h":        now.Add(-12 * time.Hour),
+		"30m":        now.Add(-30 * time.Minute),
+		"2026-10-01": time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+	}
+	for value, want := range cases {
+		got, err := parseSince(value, now)
+		if err != nil {
+			t.Fatalf("parseSince(%q): %v", value, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("parseSince(%q) = %v, want %v", value, got, want)
+		}
+	}
+	for _, value := range []string{"soon", "-2h", "1.5d"} {
+		if _, err := parseSince(value, now); err == nil {
+			t.Fatalf("parseSince(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestHistoryProviderKeyCanonicalizesFamilyAndSource(t *testing.T) {
+	cases := map[string]string{
+		"codex":          "openai",
+		"claude":         "claude",
+		"Claude:Work":    "claude:work",
+		"claude:default": "claude",
+	}
+	for value, want := range cases {
+		got, ok := historyProviderKey(value)
+		if !ok || got != want {
+			t.Fatalf("historyProviderKey(%q) = %q, %v; want %q", value, got, ok, want)
+		}
+	}
+	if _, ok := historyProviderKey("nope:work"); ok {
+		t.Fatal("unknown family should be rejected")
+	}
+}
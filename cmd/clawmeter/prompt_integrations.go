@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+)
+
+// Prompt integrations add a marked block to a shell or prompt config file.
+// The block shows the last `clawmeter statusline` output from a segment file
+// and refreshes that file in the background, so drawing a prompt never waits
+// on clawmeter, let alone on a provider. The statusline command itself only
+// reads the usage cache.
+const (
+	promptBlockStart = "# >>> clawmeter prompt >>>"
+	promptBlockEnd   = "# <<< clawmeter prompt <<<"
+)
+
+type promptIntegration struct {
+	Name string
+	// Flag is the setup flag that installs it.
+	Flag string
+	// Binary must be on PATH for the integration to be useful.
+	Binary string
+	Path   func() (string, error)
+	// Body renders the block contents for a segment file path.
+	Body func(segmentFile string) string
+}
+
+var promptIntegrations = []promptIntegration{
+	{Name: "zsh prompt", Flag: "zsh", Binary: "zsh", Path: zshrcPath, Body: zshPromptBody},
+	{Name: "bash prompt", Flag: "bash", Binary: "bash", Path: homeFile(".bashrc"), Body: bashPromptBody},
+	{Name: "fish prompt", Flag: "fish", Binary: "fish", Path: fishConfPath, Body: fishPromptBody},
+	{Name: "starship", Flag: "starship", Binary: "starship", Path: starshipConfigPath, Body: starshipPromptBody},
+}
+
+func setupPromptIntegration(p promptIntegration, dryRun bool) integrationResult {
+	if runtime.GOOS == "windows" {
+		return integrationResult{Name: p.Name, Status: "skipped", Detail: "prompt integrations are not supported on Windows"}
+	}
+	path, block, err := promptIntegrationBlock(p)
+	if err != nil {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+
+	var data []byte
+	if existing, err := os.ReadFile(path); err == nil {
+		data = existing
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+
+	next, changed := mergePromptBlock(data, block)
+	if !changed {
+		return integrationResult{Name: p.Name, Status: "ok", Detail: path}
+	}
+	if dryRun {
+		return integrationResult{Name: p.Name, Status: "would change", Detail: path, Changed: true}
+	}
+
+	if len(data) > 0 {
+		if backup, err := backupFile(path, "before-clawmeter-prompt"); err == nil {
+			fmt.Printf("%s backup: %s\n", p.Name, backup)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+	if err := os.WriteFile(path, next, 0o644); err != nil {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+	detail := path
+	if _, err := exec.LookPath(p.Binary); err != nil {
+		detail += fmt.Sprintf(" (%s not found on PATH)", p.Binary)
+	}
+	return integrationResult{Name: p.Name, Status: "installed", Detail: detail, Changed: true}
+}
+
+func promptIntegrationStatus(p promptIntegration) integrationResult {
+	if runtime.GOOS == "windows" {
+		return integrationResult{Name: p.Name, Status: "skipped", Detail: "not supported on Windows"}
+	}
+	path, block, err := promptIntegrationBlock(p)
+	if err != nil {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return integrationResult{Name: p.Name, Status: "error", Detail: err.Error()}
+	}
+	hasBlock := strings.Contains(string(data), promptBlockStart)
+	if _, changed := mergePromptBlock(data, block); hasBlock && !changed {
+		return integrationResult{Name: p.Name, Status: "installed", Detail: path}
+	} else if hasBlock {
+		return integrationResult{Name: p.Name, Status: "outdated", Detail: "run clawmeter setup --" + p.Flag}
+	}
+	if _, err := exec.LookPath(p.Binary); err != nil {
+		return integrationResult{Name: p.Name, Status: "not found", Detail: p.Binary + " not found on PATH"}
+	}
+	return integrationResult{Name: p.Name, Status: "available", Detail: "run clawmeter setup --" + p.Flag}
+}
+
+func promptIntegrationBlock(p promptIntegration) (path, block string, err error) {
+	path, err = p.Path()
+	if err != nil {
+		return "", "", err
+	}
+	segmentFile, err := promptSegmentPath()
+	if err != nil {
+		return "", "", err
+	}
+	return path, promptBlockStart + "\n" + p.Body(segmentFile) + promptBlockEnd + "\n", nil
+}
+
+// mergePromptBlock replaces an existing clawmeter block in data with block,
+// or appends block when there is none.
+func mergePromptBlock(data []byte, block string) ([]byte, bool) {
+	text := string(data)
+	if start := strings.Index(text, promptBlockStart); start >= 0 {
+		end := strings.Index(text[start:], promptBlockEnd)
+		if end >= 0 {
+			end += start + len(promptBlockEnd)
+			if end < len(text) && text[end] == '\n' {
+				end++
+			}
+			next := text[:start] + block + text[end:]
+			return []byte(next), next != text
+		}
+	}
+	var b strings.Builder
+	b.WriteString(text)
+	if text != "" {
+		if !strings.HasSuffix(text, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(block)
+	return []byte(b.String()), true
+}
+
+// promptSegmentPath is where prompt integrations keep the last statusline
+// output. Every shell shares it, since the output does not depend on the
+// shell.
+func promptSegmentPath() (string, error) {
+	dir, err := cache.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "prompt-segment"), nil
+}
+
+// refreshSegmentCommand is the POSIX shell command that rewrites the segment
+// file in the background. The rename keeps a prompt from reading a partial
+// write, and closing stdout lets callers that wait for it return at once.
+func refreshSegmentCommand(segmentFile string) string {
+	q := shellQuote(segmentFile)
+	return fmt.Sprintf(`(clawmeter statusline > %s.$$ 2>/dev/null && mv -f %s.$$ %s) >/dev/null 2>&1 </dev/null &`, q, q, q)
+}
+
+func zshPromptBody(segmentFile string) string {
+	return fmt.Sprintf(`# Cache-only quota segment; refreshed in the background, never blocks.
+typeset -g _clawmeter_segment_file=%s
+typeset -g CLAWMETER_SEGMENT=''
+_clawmeter_precmd() {
+  [[ -r $_clawmeter_segment_file ]] && CLAWMETER_SEGMENT="$(<$_clawmeter_segment_file)"
+  { clawmeter statusline >| "$_clawmeter_segment_file.$$" 2>/dev/null && mv -f "$_clawmeter_segment_file.$$" "$_clawmeter_segment_file" } >/dev/null 2>&1 </dev/null &!
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd _clawmeter_precmd
+setopt prompt_subst
+[[ $RPROMPT == *CLAWMETER_SEGMENT* ]] || RPROMPT='${CLAWMETER_SEGMENT}'"${RPROMPT:+ $RPROMPT}"
+`, shellQuote(segmentFile))
+}
+
+func bashPromptBody(segmentFile string) string {
+	return fmt.Sprintf(`# Cache-only quota segment; refreshed in the background, never blocks.
+_clawmeter_segment_file=%s
+CLAWMETER_SEGMENT=''
+_clawmeter_prompt() {
+  CLAWMETER_SEGMENT=''
+  [[ -r $_clawmeter_segment_file ]] && IFS= read -r CLAWMETER_SEGMENT < "$_clawmeter_segment_file"
+  (clawmeter statusline > "$_clawmeter_segment_file.$$" 2>/dev/null && mv -f "$_clawmeter_segment_file.$$" "$_clawmeter_segment_file" &) >/dev/null 2>&1 </dev/null
+}
+# Sourcing the rc file again must not stack another copy of the hook.
+case ";$PROMPT_COMMAND;" in
+  *";_clawmeter_prompt;"*) ;;
+  *) PROMPT_COMMAND="_clawmeter_prompt${PROMPT_COMMAND:+; $PROMPT_COMMAND}" ;;
+esac
+[[ $PS1 == *CLAWMETER_SEGMENT* ]] || PS1='${CLAWMETER_SEGMENT:+[$CLAWMETER_SEGMENT] }'"$PS1"
+`, shellQuote(segmentFile))
+}
+
+func fishPromptBody(segmentFile string) string {
+	return fmt.Sprintf(`# Cache-only quota segment; refreshed in the background, never blocks.
+set -g _clawmeter_segment_file %s
+set -g CLAWMETER_SEGMENT ''
+function _clawmeter_prompt --on-event fish_prompt
+    set -g CLAWMETER_SEGMENT ''
+    test -r $_clawmeter_segment_file; and read -g CLAWMETER_SEGMENT < $_clawmeter_segment_file
+    command sh -c %s
+end
+if not functions -q fish_right_prompt
+    function fish_right_prompt
+        echo -n $CLAWMETER_SEGMENT
+    end
+end
+`, fishQuote(segmentFile), fishQuote(refreshSegmentCommand(segmentFile)))
+}
+
+func starshipPromptBody(segmentFile string) string {
+	command := "cat " + shellQuote(segmentFile) + " 2>/dev/null; " + refreshSegmentCommand(segmentFile)
+	return fmt.Sprintf(`# Cache-only quota segment; refreshed in the background, never blocks.
+[custom.clawmeter]
+description = "Clawmeter quota"
+command = %s
+when = true
+shell = ["sh"]
+format = "[$output]($style) "
+style = "green"
+`, strconv.Quote(command))
+}
+
+func zshrcPath() (string, error) {
+	if dir := os.Getenv("ZDOTDIR"); dir != "" {
+		return filepath.Join(dir, ".zshrc"), nil
+	}
+	return homeFile(".zshrc")()
+}
+
+func fishConfPath() (string, error) {
+	dir, err := xdgConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fish", "conf.d", "clawmeter.fish"), nil
+}
+
+func starshipConfigPath() (string, error) {
+	if path := os.Getenv("STARSHIP_CONFIG"); path != "" {
+		return path, nil
+	}
+	return homeFile(".config", "starship.toml")()
+}
+
+func homeFile(parts ...string) func() (string, error) {
+	return func() (string, error) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(append([]string{home}, parts...)...), nil
+	}
+}
+
+func xdgConfigHome() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+	return homeFile(".config")()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
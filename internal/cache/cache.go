@@ -8,10 +8,27 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/tnunamak/clawmeter/internal/config"
 	"github.com/tnunamak/clawmeter/internal/provider"
 )
 
-const defaultTTL = 60 * time.Second
+// DefaultTTL is how long a reading stays fresh when neither the provider nor
+// the config sets its own TTL.
+const DefaultTTL = 60 * time.Second
+
+// SourceTTL returns how long p's readings stay fresh: the config override for
+// its family, else the provider's own TTL, else DefaultTTL. cfg may be nil.
+func SourceTTL(p provider.Provider, cfg *config.Config) time.Duration {
+	if cfg != nil {
+		if ttl := cfg.CacheTTL(p.Name()); ttl > 0 {
+			return ttl
+		}
+	}
+	if ttl := provider.CacheTTL(p); ttl > 0 {
+		return ttl
+	}
+	return DefaultTTL
+}
 
 // Entry represents cached usage data for all providers.
 type Entry struct {
@@ -19,14 +36,86 @@ type Entry struct {
 	// key remains the default Claude source.
 	ProviderData    map[string]*provider.UsageData `json:"provider_data"`
 	SourceRevisions map[string]string              `json:"source_revisions,omitempty"`
-	FetchedAt       time.Time                      `json:"fetched_at"`
+	// SourceFetchedAt records when each source was last fetched, successful
+	// or not, so sources expire independently. Entries written before it
+	// existed fall back to FetchedAt.
+	SourceFetchedAt map[string]time.Time `json:"source_fetched_at,omitempty"`
+	FetchedAt       time.Time            `json:"fetched_at"`
+}
+
+// NewEntry returns an entry holding every source in result, fetched at
+// result.FetchedAt.
+func NewEntry(result *provider.MultiFetchResult) *Entry {
+	entry := &Entry{
+		ProviderData:    make(map[string]*provider.UsageData, len(result.Results)),
+		SourceRevisions: make(map[string]string, len(result.SourceRevisions)),
+		SourceFetchedAt: make(map[string]time.Time, len(result.Results)),
+		FetchedAt:       result.FetchedAt,
+	}
+	for name, data := range result.Results {
+		entry.ProviderData[name] = data
+		entry.SourceFetchedAt[name] = result.FetchedAt
+	}
+	for name, revision := range result.SourceRevisions {
+		entry.SourceRevisions[name] = revision
+	}
+	return entry
+}
+
+// Merge returns an entry holding the sources in result, fetched at
+// result.FetchedAt, plus the keep sources from e with their own fetch times.
+// Sources in neither are dropped. e may be nil.
+func (e *Entry) Merge(result *provider.MultiFetchResult, keep []string) *Entry {
+	merged := NewEntry(result)
+	if e == nil {
+		return merged
+	}
+	for _, name := range keep {
+		if _, refreshed := result.Results[name]; refreshed {
+			continue
+		}
+		data, ok := e.ProviderData[name]
+		if !ok {
+			continue
+		}
+		merged.ProviderData[name] = data
+		merged.SourceFetchedAt[name] = e.SourceFetched(name)
+		if revision := e.SourceRevisions[name]; revision != "" {
+			merged.SourceRevisions[name] = revision
+		}
+	}
+	return merged
+}
+
+// SourceFetched returns when name was last fetched.
+func (e *Entry) SourceFetched(name string) time.Time {
+	if at, ok := e.SourceFetchedAt[name]; ok {
+		return at
+	}
+	return e.FetchedAt
+}
+
+// Expired returns the sources in want that are missing from the cache or
+// were fetched longer ago than ttl allows for them.
+func (e *Entry) Expired(want []string, ttl func(name string) time.Duration) []string {
+	var expired []string
+	for _, name := range want {
+		if e == nil {
+			expired = append(expired, name)
+			continue
+		}
+		if _, ok := e.ProviderData[name]; !ok || time.Since(e.SourceFetched(name)) >= ttl(name) {
+			expired = append(expired, name)
+		}
+	}
+	return expired
 }
 
 // cachePath returns the path to the cache file: the platform's user cache
 // dir plus clawmeter/usage.json. On Linux this is $XDG_CACHE_HOME (typically
 // ~/.cache); on macOS, ~/Library/Caches; on Windows, %LOCALAPPDATA%.
 func cachePath() (string, error) {
-	dir, err := cacheDir()
+	dir, err := Dir()
 	if err != nil {
 		return "", err
 	}
@@ -50,9 +139,9 @@ func Read() (*Entry, error) {
 	return &entry, nil
 }
 
-// IsValid returns true if the cache entry is fresh (within TTL).
+// IsValid returns true if the cache entry as a whole is within DefaultTTL.
 func (e *Entry) IsValid() bool {
-	return time.Since(e.FetchedAt) < defaultTTL
+	return time.Since(e.FetchedAt) < DefaultTTL
 }
 
 // Covers reports whether the cache contains an entry — error or data — for
@@ -109,9 +198,14 @@ func (e *Entry) GetProvider(name string) (*provider.UsageData, bool) {
 	return data, ok
 }
 
-// Write saves usage data to the cache.
+// Write replaces the cache with result.
 func Write(result *provider.MultiFetchResult) error {
-	dir, err := cacheDir()
+	return WriteEntry(NewEntry(result))
+}
+
+// WriteEntry replaces the cache with entry.
+func WriteEntry(entry *Entry) error {
+	dir, err := Dir()
 	if err != nil {
 		return err
 	}
@@ -119,10 +213,6 @@ func Write(result *provider.MultiFetchResult) error {
 		return fmt.Errorf("create cache dir: %w", err)
 	}
 
-	entry := Entry{
-		ProviderData: result.Results, SourceRevisions: result.SourceRevisions,
-		FetchedAt: result.FetchedAt,
-	}
 	data, err := json.Marshal(entry)
 	if err != nil {
 		return err
@@ -133,15 +223,26 @@ func Write(result *provider.MultiFetchResult) error {
 		return err
 	}
 
-	// Atomic write
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, data, 0600); err != nil {
+	// Atomic write. Each writer gets its own temp file, so concurrent
+	// processes never rename another's partial write into place.
+	tmp, err := os.CreateTemp(dir, "usage.json.*.tmp")
+	if err != nil {
+		return fmt.Errorf("write temp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("write temp: %w", err)
 	}
-	return os.Rename(tmp, path)
+	return os.Rename(tmp.Name(), path)
 }
 
-func cacheDir() (string, error) {
+// Dir returns Clawmeter's per-user cache directory. Other local stores, such
+// as usage history, live beside usage.json.
+func Dir() (string, error) {
 	dir, err := os.UserCacheDir()
 	if err != nil {
 		return "", err
@@ -186,3 +186,56 @@ func TestHasStaleData(t *testing.T) {
 		t.Fatal("HasStaleData(missing) = true, want false")
 	}
 }
+
+func TestMergeKeepsCachedSourcesWithTheirOwnFetchTimes(t *testing.T) {
+	old := time.Now().Add(-5 * time.Minute)
+	prev := &Entry{
+		ProviderData: map[string]*provider.UsageData{
+			"deepseek": {Provider: "deepseek"},
+			"claude":   {Provider: "claude", Error: "old"},
+			"removed":  {Provider: "removed"},
+		},
+		SourceRevisions: map[string]string{"deepseek": "rev"},
+		FetchedAt:       old,
+	}
+	now := time.Now()
+	merged := prev.Merge(&provider.MultiFetchResult{
+		Results:   map[string]*provider.UsageData{"claude": {Provider: "claude"}},
+		FetchedAt: now,
+	}, []string{"claude", "deepseek"})
+
+	if len(merged.ProviderData) != 2 || merged.ProviderData["claude"].Error != "" || merged.ProviderData["removed"] != nil {
+		t.Fatalf("merged data = %#v", merged.ProviderData)
+	}
+	if !merged.SourceFetched("claude").Equal(now) || !merged.SourceFetched("deepseek").Equal(old) {
+		t.Fatalf("fetch times = %v", merged.SourceFetchedAt)
+	}
+	if merged.SourceRevisions["deepseek"] != "rev" {
+		t.Fatalf("revisions = %v", merged.SourceRevisions)
+	}
+}
+
+func TestExpiredUsesPerSourceTTLAndLegacyFetchedAt(t *testing.T) {
+	now := time.Now()
+	entry := &Entry{
+		ProviderData: map[string]*provider.UsageData{"claude": {}, "deepseek": {}, "legacy": {}},
+		SourceFetchedAt: map[string]time.Time{
+			"claude":   now.Add(-90 * time.Second),
+			"deepseek": now.Add(-90 * time.Second),
+		},
+		FetchedAt: now.Add(-30 * time.Second),
+	}
+	ttl := func(name string) time.Duration {
+		if name == "deepseek" {
+			return 10 * time.Minute
+		}
+		return DefaultTTL
+	}
+	got := entry.Expired([]string{"claude", "deepseek", "legacy", "missing"}, ttl)
+	if strings.Join(got, ",") != "claude,missing" {
+		t.Fatalf("Expired = %v", got)
+	}
+	if got := (*Entry)(nil).Expired([]string{"claude"}, ttl); len(got) != 1 {
+		t.Fatalf("nil entry Expired = %v", got)
+	}
+}
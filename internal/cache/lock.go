@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RefreshWait bounds how long a process waits for another one's refresh
+// before fetching on its own. It covers one round of provider requests.
+const RefreshWait = 35 * time.Second
+
+const lockPollInterval = 100 * time.Millisecond
+
+// errLocked reports that another process holds the refresh lock.
+var errLocked = errors.New("cache refresh lock is held")
+
+// RefreshLock is the advisory lock held by the process refreshing the cache.
+// The operating system releases it if that process dies.
+type RefreshLock struct {
+	f *os.File
+}
+
+// Refresher identifies the process holding the refresh lock.
+type Refresher struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+func lockPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.lock"), nil
+}
+
+// tryLockPath opens path, creating it, and locks it without waiting. It
+// returns nil and no error while another process holds the lock.
+func tryLockPath(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// waitFor retries try every lockPollInterval until it returns a lock or an
+// error, wait runs out, or ctx ends.
+func waitFor[L any](ctx context.Context, wait time.Duration, try func() (*L, error)) (*L, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		lock, err := try()
+		if lock != nil || err != nil {
+			return lock, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// TryLockRefresh takes the refresh lock without waiting. It returns nil and
+// no error while another process holds it.
+func TryLockRefresh() (*RefreshLock, error) {
+	path, err := lockPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := tryLockPath(path)
+	if f == nil {
+		return nil, err
+	}
+	// Record the holder so other processes can tell who they are waiting on.
+	data, _ := json.Marshal(Refresher{PID: os.Getpid(), Started: time.Now()})
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt(data, 0)
+	}
+	return &RefreshLock{f: f}, nil
+}
+
+// LockRefresh waits up to wait for the refresh lock. It returns nil and no
+// error when the wait runs out or ctx ends first.
+func LockRefresh(ctx context.Context, wait time.Duration) (*RefreshLock, error) {
+	return waitFor(ctx, wait, TryLockRefresh)
+}
+
+// Unlock clears the holder record and releases the lock. It is safe to call
+// on a nil lock.
+func (l *RefreshLock) Unlock() {
+	if l == nil || l.f == nil {
+		return
+	}
+	_ = l.f.Truncate(0)
+	_ = unlockFile(l.f)
+	_ = l.f.Close()
+	l.f = nil
+}
+
+// FileLock is an advisory lock on a file of its own, held while a process
+// reads, changes, and rewrites a file other processes also update. The
+// operating system releases it if that process dies.
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile waits up to wait for the lock at path, creating the file. It
+// returns nil and no error when the wait runs out or ctx ends first.
+func LockFile(ctx context.Context, path string, wait time.Duration) (*FileLock, error) {
+	return waitFor(ctx, wait, func() (*FileLock, error) {
+		f, err := tryLockPath(path)
+		if f == nil {
+			return nil, err
+		}
+		return &FileLock{f: f}, nil
+	})
+}
+
+// Unlock releases the lock. It is safe to call on a nil lock.
+func (l *FileLock) Unlock() {
+	if l == nil || l.f == nil {
+		return
+	}
+	_ = unlockFile(l.f)
+	_ = l.f.Close()
+	l.f = nil
+}
+
+// Refreshing returns the process currently refreshing the cache, if any.
+func Refreshing() (Refresher, bool) {
+	lock, err := TryLockRefresh()
+	if err != nil {
+		return Refresher{}, false
+	}
+	if lock != nil {
+		lock.Unlock()
+		return Refresher{}, false
+	}
+	path, err := lockPath()
+	if err != nil {
+		return Refresher{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Refresher{}, false
+	}
+	var holder Refresher
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return Refresher{}, false
+	}
+	return holder, true
+}
+
+// Coalesce runs refresh, which must write the cache, so that concurrent
+// processes share one round of provider requests. When another process is
+// already refreshing, Coalesce waits up to wait for it and returns the entry
+// it wrote if usable accepts it; refresh does not run. usable also sees
+// whether the entry was written while this process waited, in which case it
+// is as current as a refresh of its own would be. If the other refresh does
+// not finish in time, refresh runs without the lock.
+func Coalesce(ctx context.Context, wait time.Duration, usable func(entry *Entry, justWritten bool) bool, refresh func()) *Entry {
+	started := time.Now()
+	lock, _ := LockRefresh(ctx, wait)
+	defer lock.Unlock()
+
+	// Whoever held the lock may have refreshed the cache in the meantime.
+	if entry, err := Read(); err == nil && usable(entry, WrittenSince(started)) {
+		return entry
+	}
+	refresh()
+	return nil
+}
+
+// WrittenSince reports whether the cache file was written at or after t.
+func WrittenSince(t time.Time) bool {
+	path, err := cachePath()
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.ModTime().Before(t)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func useTempCacheDir(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+}
+
+func TestRefreshLockIsExclusiveAndRecordsHolder(t *testing.T) {
+	useTempCacheDir(t)
+
+	lock, err := TryLockRefresh()
+	if err != nil || lock == nil {
+		t.Fatalf("first lock = %v, %v", lock, err)
+	}
+	if other, err := TryLockRefresh(); other != nil || err != nil {
+		t.Fatalf("second lock = %v, %v; want held elsewhere", other, err)
+	}
+	holder, ok := Refreshing()
+	if !ok || holder.PID != os.Getpid() || holder.Started.IsZero() {
+		t.Fatalf("Refreshing = %#v, %v", holder, ok)
+	}
+
+	lock.Unlock()
+	if _, ok := Refreshing(); ok {
+		t.Fatal("Refreshing reported a holder after unlock")
+	}
+	again, err := TryLockRefresh()
+	if err != nil || again == nil {
+		t.Fatalf("lock after unlock = %v, %v", again, err)
+	}
+	again.Unlock()
+}
+
+func TestLockFileWaitsForTheHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "notifications.json.lock")
+	lock, err := LockFile(context.Background(), path, 0)
+	if err != nil || lock == nil {
+		t.Fatalf("first lock = %v, %v", lock, err)
+	}
+	if other, err := LockFile(context.Background(), path, 50*time.Millisecond); other != nil || err != nil {
+		t.Fatalf("second lock = %v, %v; want the wait to run out", other, err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		lock.Unlock()
+		close(released)
+	}()
+	again, err := LockFile(context.Background(), path, 5*time.Second)
+	if err != nil || again == nil {
+		t.Fatalf("lock after release = %v, %v", again, err)
+	}
+	<-released
+	again.Unlock()
+}
+
+func TestCoalesceServesTheRefreshOfTheLockHolder(t *testing.T) {
+	useTempCacheDir(t)
+
+	holder, err := TryLockRefresh()
+	if err != nil || holder == nil {
+		t.Fatalf("lock = %v, %v", holder, err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = Write(&provider.MultiFetchResult{
+			Results:   map[string]*provider.UsageData{"claude": {Provider: "claude", FetchedAt: time.Now()}},
+			FetchedAt: time.Now(),
+		})
+		holder.Unlock()
+	}()
+
+	refreshed := false
+	entry := Coalesce(context.Background(), 5*time.Second, func(entry *Entry, justWritten bool) bool {
+		return justWritten && entry.IsValid() && entry.Covers([]string{"claude"})
+	}, func() { refreshed = true })
+	if refreshed || entry == nil {
+		t.Fatalf("Coalesce = %v, refreshed %v; want the holder's entry", entry, refreshed)
+	}
+}
+
+func TestCoalesceRefreshesItselfWhenTheHolderTakesTooLong(t *testing.T) {
+	useTempCacheDir(t)
+
+	holder, err := TryLockRefresh()
+	if err != nil || holder == nil {
+		t.Fatalf("lock = %v, %v", holder, err)
+	}
+	defer holder.Unlock()
+
+	refreshed := false
+	entry := Coalesce(context.Background(), 150*time.Millisecond, func(*Entry, bool) bool { return true }, func() { refreshed = true })
+	if !refreshed || entry != nil {
+		t.Fatalf("Coalesce = %v, refreshed %v; want its own refresh", entry, refreshed)
+	}
+}
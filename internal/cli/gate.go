@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/provider/all"
+)
+
+// GateSchemaVersion identifies the `clawmeter gate` output contract.
+const GateSchemaVersion = 1
+
+// Gate decisions.
+const (
+	GateAllow = "allow"
+	GateWait  = "wait"
+	GateDeny  = "deny"
+)
+
+// Gate exit codes. Errors exit 1, and flag parsing errors exit 2.
+const (
+	GateExitAllow = 0
+	GateExitError = 1
+	GateExitWait  = 3
+	GateExitDeny  = 4
+)
+
+// GateRequest asks whether a job can spend part of one quota window.
+type GateRequest struct {
+	// Source is a provider family, optionally with a source: "claude" or
+	// "claude:work".
+	Source string
+	// Window is the window name, matched case-insensitively.
+	Window string
+	// Need is the share of the window, in percentage points, the job expects
+	// to use.
+	Need float64
+	// Margin is how long past the reset the quota must last, at the current
+	// pace, once the job has run; a larger margin allows for the pace picking
+	// up.
+	Margin time.Duration
+}
+
+// GateDecision is the JSON output of `clawmeter gate`.
+type GateDecision struct {
+	SchemaVersion int     `json:"schema_version"`
+	Decision      string  `json:"decision"`
+	Source        string  `json:"source"`
+	Window        string  `json:"window"`
+	Utilization   float64 `json:"utilization"`
+	Need          float64 `json:"need"`
+	// ProjectedPct is the window's projected use at reset with the job
+	// included; omitted when the window has no reset time.
+	ProjectedPct *float64  `json:"projected_pct,omitempty"`
+	ResetsAt     time.Time `json:"resets_at,omitzero"`
+	// WaitUntil is set for wait decisions: the window reset, after which the
+	// job fits.
+	WaitUntil time.Time `json:"wait_until,omitzero"`
+	Reason    string    `json:"reason"`
+	Stale     bool      `json:"stale,omitempty"`
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+}
+
+// ExitCode maps the decision to the gate's exit code.
+func (g GateDecision) ExitCode() int {
+	switch g.Decision {
+	case GateAllow:
+		return GateExitAllow
+	case GateWait:
+		return GateExitWait
+	default:
+		return GateExitDeny
+	}
+}
+
+// Gate prints a JSON decision on whether req fits its window and returns the
+// matching exit code.
+func Gate(req GateRequest) int {
+	snapshot, err := CollectStatus(context.Background(), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return GateExitError
+	}
+	pf, err := findGateSource(snapshot.Output.Providers, req.Source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return GateExitError
+	}
+	data := pf.Data
+	switch {
+	case data == nil:
+		fmt.Fprintf(os.Stderr, "clawmeter: %s has no usage data\n", pf.Name)
+		return GateExitError
+	case data.IsExpired:
+		fmt.Fprintf(os.Stderr, "clawmeter: %s credentials expired\n", pf.Name)
+		return GateExitError
+	case data.Error != "" && !data.HasPresentableUsage():
+		fmt.Fprintf(os.Stderr, "clawmeter: %s: %s\n", pf.Name, data.Error)
+		return GateExitError
+	}
+	window, ok := findGateWindow(data.UsableWindows(), req.Window)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "clawmeter: %s has no %q window (have: %s)\n", pf.Name, req.Window, windowNames(data.UsableWindows()))
+		return GateExitError
+	}
+
+	var proj forecast.Projection
+	if !window.ResetsAt.IsZero() {
+		proj = pf.Project(window)
+	}
+	decision := decideGate(window, proj, req, time.Now())
+	decision.Source = pf.Name
+	decision.Stale = data.Stale
+	decision.FetchedAt = data.FetchedAt
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(decision); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return GateExitError
+	}
+	return decision.ExitCode()
+}
+
+// decideGate decides whether a job needing req.Need points of window can run
+// now. It waits for the reset when the job does not fit in what is left, or
+// when the current pace plus the job would use the window up before
+// req.Margin past its reset.
+func decideGate(window provider.UsageWindow, proj forecast.Projection, req GateRequest, now time.Time) GateDecision {
+	d := GateDecision{
+		SchemaVersion: GateSchemaVersion,
+		Window:        window.Name,
+		Utilization:   roundPct(window.Utilization),
+		Need:          req.Need,
+		ResetsAt:      window.ResetsAt,
+	}
+	remaining := max(100-window.Utilization, 0)
+	after := window.Utilization + req.Need
+
+	if req.Need > 100 {
+		d.Decision = GateDeny
+		d.Reason = fmt.Sprintf("needs %s, more than a whole window", formatPrecisePct(req.Need))
+		return d
+	}
+	if window.ResetsAt.IsZero() {
+		if after <= 100 {
+			d.Decision = GateAllow
+			d.Reason = fmt.Sprintf("fits in the %s remaining; reset time unknown, so pace is not checked", formatPrecisePct(remaining))
+		} else {
+			d.Decision = GateDeny
+			d.Reason = fmt.Sprintf("needs %s but only %s remains and the reset time is unknown", formatPrecisePct(req.Need), formatPrecisePct(remaining))
+		}
+		return d
+	}
+	if !window.ResetsAt.After(now) {
+		// The reading predates the reset, so the window has started over.
+		d.Decision = GateAllow
+		d.Reason = "the window has reset since the last reading"
+		return d
+	}
+
+	projected := roundPct(proj.ProjectedPct + req.Need)
+	d.ProjectedPct = &projected
+	if after > 100 {
+		d.Decision = GateWait
+		d.WaitUntil = window.ResetsAt
+		d.Reason = fmt.Sprintf("needs %s but only %s remains", formatPrecisePct(req.Need), formatPrecisePct(remaining))
+		return d
+	}
+	deadline := window.ResetsAt.Add(req.Margin)
+	if proj.RatePerHour > 0 {
+		lasts := time.Duration((100 - after) / proj.RatePerHour * float64(time.Hour))
+		if runsOut := now.Add(lasts); runsOut.Before(deadline) {
+			d.Decision = GateWait
+			d.WaitUntil = window.ResetsAt
+			if runsOut.Before(window.ResetsAt) {
+				d.Reason = fmt.Sprintf("at the current pace the window runs out %s before reset with this job", formatExactDuration(window.ResetsAt.Sub(runsOut)))
+			} else {
+				d.Reason = fmt.Sprintf("at the current pace the window lasts only %s past reset with this job, inside the %s margin", formatExactDuration(runsOut.Sub(window.ResetsAt)), formatExactDuration(req.Margin))
+			}
+			return d
+		}
+	}
+	d.Decision = GateAllow
+	d.Reason = fmt.Sprintf("fits in the %s remaining and lasts to reset at the current pace", formatPrecisePct(remaining))
+	return d
+}
+
+// findGateSource returns the source named by key. A bare family matches its
+// default source, or its only source.
+func findGateSource(providers []ProviderFormatter, key string) (*ProviderFormatter, error) {
+	family, sourceID, _ := strings.Cut(strings.TrimSpace(key), ":")
+	canonical, ok := all.CanonicalName(family)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", family)
+	}
+	var matches []*ProviderFormatter
+	for i := range providers {
+		pf := &providers[i]
+		if pf.Family != canonical {
+			continue
+		}
+		if sourceID != "" && pf.SourceID != sourceID {
+			continue
+		}
+		if sourceID == "" && pf.Name == canonical {
+			return pf, nil
+		}
+		matches = append(matches, pf)
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%s is not configured or has no data", key)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, pf := range matches {
+			names[i] = pf.Name
+		}
+		return nil, fmt.Errorf("%s has several sources; choose one of %s", key, strings.Join(names, ", "))
+	}
+}
+
+func findGateWindow(windows []provider.UsageWindow, name string) (provider.UsageWindow, bool) {
+	for _, w := range windows {
+		if strings.EqualFold(w.Name, name) || (w.DisplayName != "" && strings.EqualFold(w.DisplayName, name)) {
+			return w, true
+		}
+	}
+	return provider.UsageWindow{}, false
+}
+
+func windowNames(windows []provider.UsageWindow) string {
+	if len(windows) == 0 {
+		return "none"
+	}
+	names := make([]string, len(windows))
+	for i, w := range windows {
+		names[i] = w.Name
+	}
+	return strings.Join(names, ", ")
+}
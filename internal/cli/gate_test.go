@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func TestDecideGate(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	resetsAt := now.Add(3 * time.Hour)
+	for _, tt := range []struct {
+		name     string
+		window   provider.UsageWindow
+		rate     float64 // percentage points per hour
+		req      GateRequest
+		decision string
+		reason   string
+	}{
+		{
+			name:     "fits and lasts",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 40, ResetsAt: resetsAt},
+			rate:     10,
+			req:      GateRequest{Need: 8},
+			decision: GateAllow,
+			reason:   "fits in the 60% remaining",
+		},
+		{
+			name:     "does not fit",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 95, ResetsAt: resetsAt},
+			rate:     10,
+			req:      GateRequest{Need: 8},
+			decision: GateWait,
+			reason:   "only 5% remains",
+		},
+		{
+			// 100-(60+8) = 32 points at 12/h lasts 2h40m, 20m before reset.
+			name:     "runs out before reset",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 60, ResetsAt: resetsAt},
+			rate:     12,
+			req:      GateRequest{Need: 8},
+			decision: GateWait,
+			reason:   "runs out 20m before reset",
+		},
+		{
+			// 32 points at 10/h lasts 3h12m, 12m past reset.
+			name:     "lasts past reset without a margin",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 60, ResetsAt: resetsAt},
+			rate:     10,
+			req:      GateRequest{Need: 8},
+			decision: GateAllow,
+		},
+		{
+			name:     "lasts past reset but inside the margin",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 60, ResetsAt: resetsAt},
+			rate:     10,
+			req:      GateRequest{Need: 8, Margin: 30 * time.Minute},
+			decision: GateWait,
+			reason:   "lasts only 12m past reset with this job, inside the 30m margin",
+		},
+		{
+			name:     "lasts past the margin",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 60, ResetsAt: resetsAt},
+			rate:     10,
+			req:      GateRequest{Need: 8, Margin: 10 * time.Minute},
+			decision: GateAllow,
+		},
+		{
+			name:     "unknown reset fits",
+			window:   provider.UsageWindow{Name: "monthly", Utilization: 50},
+			req:      GateRequest{Need: 8},
+			decision: GateAllow,
+		},
+		{
+			name:     "unknown reset does not fit",
+			window:   provider.UsageWindow{Name: "monthly", Utilization: 95},
+			req:      GateRequest{Need: 8},
+			decision: GateDeny,
+		},
+		{
+			name:     "more than a window",
+			window:   provider.UsageWindow{Name: "5h", Utilization: 0, ResetsAt: resetsAt},
+			req:      GateRequest{Need: 120},
+			decision: GateDeny,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			proj := forecast.Projection{RatePerHour: tt.rate, ProjectedPct: tt.window.Utilization + tt.rate*3}
+			got := decideGate(tt.window, proj, tt.req, now)
+			if got.Decision != tt.decision || !strings.Contains(got.Reason, tt.reason) {
+				t.Fatalf("decision = %s (%s), want %s containing %q", got.Decision, got.Reason, tt.decision, tt.reason)
+			}
+			if (got.Decision == GateWait) != !got.WaitUntil.IsZero() {
+				t.Fatalf("wait_until = %v for %s", got.WaitUntil, got.Decision)
+			}
+		})
+	}
+}
+
+func TestFindGateSourcePrefersDefaultAndRequiresChoiceOtherwise(t *testing.T) {
+	providers := []ProviderFormatter{
+		{Name: "claude:work", Family: "claude", SourceID: "work"},
+		{Name: "claude:home", Family: "claude", SourceID: "home"},
+		{Name: "openai", Family: "openai", SourceID: "default"},
+	}
+	if pf, err := findGateSource(providers, "claude:home"); err != nil || pf.Name != "claude:home" {
+		t.Fatalf("claude:home = %v, %v", pf, err)
+	}
+	if pf, err := findGateSource(providers, "codex"); err != nil || pf.Name != "openai" {
+		t.Fatalf("codex = %v, %v", pf, err)
+	}
+	if _, err := findGateSource(providers, "claude"); err == nil || !strings.Contains(err.Error(), "claude:work, claude:home") {
+		t.Fatalf("ambiguous family error = %v", err)
+	}
+	if _, err := findGateSource(providers, "nope"); err == nil {
+		t.Fatal("unknown provider matched")
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/history"
+)
+
+// HistorySchemaVersion identifies the `history --json` output contract.
+const HistorySchemaVersion = 1
+
+// HistoryJSONOutput is the JSON structure for `clawmeter history --json`.
+type HistoryJSONOutput struct {
+	SchemaVersion int              `json:"schema_version"`
+	Since         time.Time        `json:"since,omitzero"`
+	Samples       []history.Sample `json:"samples"`
+}
+
+// History prints recorded quota readings matching q.
+func History(q history.Query, jsonMode bool) int {
+	store, err := history.Default()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	samples, err := store.Query(q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	if jsonMode {
+		if err := writeHistoryJSON(os.Stdout, q, samples); err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: json error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	writeHistoryTable(os.Stdout, samples)
+	return 0
+}
+
+func writeHistoryJSON(w io.Writer, q history.Query, samples []history.Sample) error {
+	out := HistoryJSONOutput{SchemaVersion: HistorySchemaVersion, Since: q.Since, Samples: samples}
+	if out.Samples == nil {
+		out.Samples = []history.Sample{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func writeHistoryTable(w io.Writer, samples []history.Sample) {
+	if len(samples) == 0 {
+		fmt.Fprintln(w, "no recorded usage history")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSOURCE\tWINDOW\tUSAGE\tRESETS")
+	for _, sample := range samples {
+		fetched := sample.FetchedAt.Local().Format("2006-01-02 15:04")
+		if sample.Kind == history.SampleKindBalance {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f remaining\t-\n", fetched, sample.Source, sample.Name, sample.Remaining)
+			continue
+		}
+		resets := "unknown"
+		if !sample.ResetsAt.IsZero() {
+			resets = sample.ResetsAt.Local().Format("Jan 2 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f%%\t%s\n", fetched, sample.Source, sample.Name, sample.Utilization, resets)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/history"
+)
+
+func TestWriteHistoryTableShowsWindowsAndBalances(t *testing.T) {
+	at := time.Date(2026, 10, 12, 9, 0, 0, 0, time.Local)
+	var buf bytes.Buffer
+	writeHistoryTable(&buf, []history.Sample{
+		{Source: "claude", Provider: "claude", Kind: history.SampleKindWindow, Name: "7d", FetchedAt: at, Utilization: 41.5, ResetsAt: at.Add(48 * time.Hour)},
+		{Source: "deepseek", Provider: "deepseek", Kind: history.SampleKindBalance, Name: "CNY", FetchedAt: at, Remaining: 7.5},
+	})
+	out := buf.String()
+	for _, want := range []string{"TIME", "2026-10-12 09:00", "claude", "41.5%", "Oct 14 09:00", "deepseek", "7.50 remaining"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("history table missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteHistoryJSONEmitsEmptySampleList(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHistoryJSON(&buf, history.Query{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["schema_version"] != float64(HistorySchemaVersion) {
+		t.Fatalf("schema_version = %v", decoded["schema_version"])
+	}
+	if samples, ok := decoded["samples"].([]any); !ok || len(samples) != 0 {
+		t.Fatalf("samples = %#v, want empty array", decoded["samples"])
+	}
+	if _, ok := decoded["since"]; ok {
+		t.Fatalf("unset since should be omitted: %s", buf.String())
+	}
+}
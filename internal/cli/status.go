@@ -16,6 +16,7 @@ import (
 	"github.com/tnunamak/clawmeter/internal/config"
 	"github.com/tnunamak/clawmeter/internal/forecast"
 	"github.com/tnunamak/clawmeter/internal/format"
+	"github.com/tnunamak/clawmeter/internal/history"
 	"github.com/tnunamak/clawmeter/internal/provider"
 	"github.com/tnunamak/clawmeter/internal/provider/all"
 	"github.com/tnunamak/clawmeter/internal/status"
@@ -58,6 +59,19 @@ type ProviderFormatter struct {
 	Data              *provider.UsageData
 	Status            *status.ProviderStatus
 	ExplicitlyEnabled bool
+	// Estimator projects windows in the configured forecast mode; nil
+	// projects with the window's average rate.
+	Estimator *forecast.Estimator
+}
+
+// Project estimates window usage at reset for this source in the configured
+// forecast mode.
+func (pf *ProviderFormatter) Project(window provider.UsageWindow) forecast.Projection {
+	current := forecast.Reading{Pct: window.Utilization, ResetsAt: window.ResetsAt}
+	if pf.Data != nil {
+		current.At = pf.Data.FetchedAt
+	}
+	return pf.Estimator.Project(pf.Name, window.Name, current, forecast.GuessWindowType(window.Name))
 }
 
 // FormatColor returns colorized multi-line output for a provider (legacy, unaligned).
@@ -116,7 +130,7 @@ func (pf *ProviderFormatter) FormatColorAligned(providerWidth, windowWidth int)
 		indicator := "reset unknown"
 		colorPct := window.Utilization
 		if !window.ResetsAt.IsZero() {
-			proj = forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+			proj = pf.Project(window)
 			resetStr = format.FormatDuration(time.Until(window.ResetsAt))
 			indicator = proj.ColorIndicator()
 			colorPct = proj.ProjectedPct
@@ -183,7 +197,7 @@ func (pf *ProviderFormatter) FormatPlain() string {
 	for _, window := range windows {
 		resetStr, indicator := "unknown", "reset unknown"
 		if !window.ResetsAt.IsZero() {
-			proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+			proj := pf.Project(window)
 			resetStr, indicator = format.FormatDuration(time.Until(window.ResetsAt)), proj.PaceIndicator()
 		} else if window.ResetPolicy != "" {
 			indicator = window.ResetPolicy
@@ -326,24 +340,7 @@ func (m *MultiProviderOutput) PrintPlain() {
 // StatusLineSummary returns a compact, human-facing status segment for shell,
 // tmux, terminal title, and harness statusline integrations.
 func (m *MultiProviderOutput) StatusLineSummary() string {
-	pf, window, proj, ok := m.worstReadableWindow()
-	if !ok {
-		return "CM no quota data"
-	}
-
-	prefix := "CM"
-	if proj.ProjectedPct >= 100 {
-		prefix = "CM!"
-	} else if proj.ProjectedPct >= 90 {
-		prefix = "CM~"
-	}
-
-	resetIn := time.Until(window.ResetsAt)
-	line := fmt.Sprintf("%s %s %s est. %.0f%% reset %s",
-		prefix, pf.Display, window.Name, proj.ProjectedPct, format.FormatDuration(resetIn))
-	if !proj.WillLastToReset && proj.RunsOutIn > 0 {
-		line += " out " + format.FormatDuration(proj.RunsOutIn)
-	}
+	line, _ := m.RenderStatusLine(defaultStatusLine)
 	return line
 }
 
@@ -363,10 +360,13 @@ func (m *MultiProviderOutput) AgentSummary() string {
 		fmt.Sprintf("Quota: worst=%s %s", pf.Display, window.Name),
 		fmt.Sprintf("current=%s", formatPrecisePct(window.Utilization)),
 		fmt.Sprintf("projected_at_reset=%s", formatPrecisePct(proj.ProjectedPct)),
+	}
+	parts = append(parts, agentForecastFields(proj)...)
+	parts = append(parts,
 		fmt.Sprintf("reset_in_seconds=%d", int64(resetIn.Seconds())),
 		fmt.Sprintf("reset_in=%s", formatExactDuration(resetIn)),
-		"status=" + status,
-	}
+		"status="+status,
+	)
 	if !proj.WillLastToReset {
 		if proj.RunsOutIn > 0 {
 			runsOutIn := clampDuration(proj.RunsOutIn)
@@ -416,7 +416,7 @@ func (m *MultiProviderOutput) agentQuotaSummaries() []string {
 		}
 		tier := classifyProvider(pf).tier
 		for _, window := range pf.Data.UsableWindows() {
-			proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+			proj := pf.Project(window)
 			quotas = append(quotas, agentQuotaSummary{
 				Provider: pf.Display,
 				Window:   window,
@@ -448,9 +448,12 @@ func (m *MultiProviderOutput) agentQuotaSummaries() []string {
 		fields := []string{
 			fmt.Sprintf("current=%s", formatPrecisePct(quota.Window.Utilization)),
 			fmt.Sprintf("projected_at_reset=%s", formatPrecisePct(quota.Proj.ProjectedPct)),
-			fmt.Sprintf("reset_in=%s", formatExactDuration(resetIn)),
-			"status=" + quota.Status,
 		}
+		fields = append(fields, agentForecastFields(quota.Proj)...)
+		fields = append(fields,
+			fmt.Sprintf("reset_in=%s", formatExactDuration(resetIn)),
+			"status="+quota.Status,
+		)
 		if !quota.Proj.WillLastToReset {
 			if quota.Proj.RunsOutIn > 0 {
 				runsOutIn := clampDuration(quota.Proj.RunsOutIn)
@@ -535,6 +538,20 @@ func (m *MultiProviderOutput) agentResetCreditSummaries() []string {
 	return out
 }
 
+// agentForecastFields describes a recent-rate projection's burn rate and
+// confidence band. Average projections add nothing, keeping the default
+// output unchanged.
+func agentForecastFields(proj forecast.Projection) []string {
+	if proj.Method != forecast.ModeRecent {
+		return nil
+	}
+	return []string{
+		"forecast=recent",
+		fmt.Sprintf("burn_rate_per_hour=%s", formatPrecisePct(proj.RatePerHour)),
+		fmt.Sprintf("projected_range=%s-%s", formatPrecisePct(proj.LowPct), formatPrecisePct(proj.HighPct)),
+	}
+}
+
 func agentStatus(proj forecast.Projection) string {
 	if proj.ProjectedPct >= 100 {
 		return "at_risk"
@@ -563,7 +580,7 @@ func (m *MultiProviderOutput) worstReadableWindow() (*ProviderFormatter, provide
 		}
 		tier := classifyProvider(pf).tier
 		for _, window := range pf.Data.UsableWindows() {
-			proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+			proj := pf.Project(window)
 			if bestPF == nil || tier < bestTier || (tier == bestTier && forecast.CompareRisk(proj, bestProj) < 0) {
 				bestPF = pf
 				bestWindow = window
@@ -656,6 +673,18 @@ type JSONForecast struct {
 type JSONProjection struct {
 	ProjectedPct float64 `json:"projected_pct"`
 	Indicator    string  `json:"indicator"`
+	// Method is "average" or "recent"; recent projections fall back to
+	// average when there is not yet enough recorded history.
+	Method      string              `json:"method,omitempty"`
+	RatePerHour float64             `json:"rate_per_hour,omitempty"`
+	Band        *JSONProjectionBand `json:"band,omitempty"`
+	Samples     int                 `json:"samples,omitempty"`
+}
+
+// JSONProjectionBand is the 95% confidence band of a recent-rate projection.
+type JSONProjectionBand struct {
+	LowPct  float64 `json:"low_pct"`
+	HighPct float64 `json:"high_pct"`
 }
 
 // CacheInfo contains cache metadata.
@@ -666,6 +695,17 @@ type CacheInfo struct {
 
 // PrintJSON prints JSON output for all providers.
 func (m *MultiProviderOutput) PrintJSON(cacheEntry *cache.Entry) {
+	data, err := json.MarshalIndent(m.JSONDocument(cacheEntry), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: json error: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// JSONDocument builds the status-v1 document for all providers. cacheEntry is
+// the cache the output was read from, or nil for a fresh fetch.
+func (m *MultiProviderOutput) JSONDocument(cacheEntry *cache.Entry) JSONOutput {
 	out := JSONOutput{
 		SchemaVersion: JSONSchemaVersion,
 		Providers:     make(map[string]*ProviderJSONOutput),
@@ -696,7 +736,7 @@ func (m *MultiProviderOutput) PrintJSON(cacheEntry *cache.Entry) {
 			for _, pf := range group {
 				base.Sources = append(base.Sources, makeJSONSource(pf))
 				if pf.SourceID == "default" {
-					base.Usage, base.Forecast, base.Status = legacyUsage(pf.Data), forecastFor(pf.Data), pf.Status
+					base.Usage, base.Forecast, base.Status = legacyUsage(pf.Data), forecastFor(&pf), pf.Status
 				}
 			}
 			out.Providers[family] = base
@@ -713,19 +753,7 @@ func (m *MultiProviderOutput) PrintJSON(cacheEntry *cache.Entry) {
 		}
 
 		// Add forecasts for each window
-		windows := pf.Data.UsableWindows()
-		if len(windows) > 0 {
-			providerOut.Forecast = &JSONForecast{
-				Windows: make(map[string]JSONProjection),
-			}
-			for _, window := range windows {
-				proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
-				providerOut.Forecast.Windows[window.Name] = JSONProjection{
-					ProjectedPct: roundPct(proj.ProjectedPct),
-					Indicator:    proj.Indicator(),
-				}
-			}
-		}
+		providerOut.Forecast = forecastFor(&pf)
 
 		if pf.Status != nil {
 			providerOut.Status = pf.Status
@@ -733,17 +761,11 @@ func (m *MultiProviderOutput) PrintJSON(cacheEntry *cache.Entry) {
 
 		out.Providers[family] = providerOut
 	}
-
-	data, err := json.MarshalIndent(out, "", "  ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "clawmeter: json error: %v\n", err)
-		return
-	}
-	fmt.Println(string(data))
+	return out
 }
 
 func makeJSONSource(pf ProviderFormatter) JSONSourceOutput {
-	return JSONSourceOutput{Source: JSONSourceIdentity{ID: pf.SourceID, Label: pf.SourceLabel}, Usage: pf.Data, Forecast: forecastFor(pf.Data), Status: pf.Status}
+	return JSONSourceOutput{Source: JSONSourceIdentity{ID: pf.SourceID, Label: pf.SourceLabel}, Usage: pf.Data, Forecast: forecastFor(&pf), Status: pf.Status}
 }
 
 func legacyUsage(data *provider.UsageData) *provider.UsageData {
@@ -758,22 +780,35 @@ func legacyUsage(data *provider.UsageData) *provider.UsageData {
 	return copy
 }
 
-func forecastFor(data *provider.UsageData) *JSONForecast {
-	if data == nil {
+func forecastFor(pf *ProviderFormatter) *JSONForecast {
+	if pf.Data == nil {
 		return nil
 	}
-	windows := data.UsableWindows()
+	windows := pf.Data.UsableWindows()
 	if len(windows) == 0 {
 		return nil
 	}
 	result := &JSONForecast{Windows: make(map[string]JSONProjection)}
 	for _, window := range windows {
-		proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
-		result.Windows[window.Name] = JSONProjection{ProjectedPct: roundPct(proj.ProjectedPct), Indicator: proj.Indicator()}
+		result.Windows[window.Name] = makeJSONProjection(pf.Project(window))
 	}
 	return result
 }
 
+func makeJSONProjection(proj forecast.Projection) JSONProjection {
+	out := JSONProjection{
+		ProjectedPct: roundPct(proj.ProjectedPct),
+		Indicator:    proj.Indicator(),
+		Method:       string(proj.Method),
+		RatePerHour:  roundPct(proj.RatePerHour),
+	}
+	if proj.Method == forecast.ModeRecent {
+		out.Band = &JSONProjectionBand{LowPct: roundPct(proj.LowPct), HighPct: roundPct(proj.HighPct)}
+		out.Samples = proj.Samples
+	}
+	return out
+}
+
 // Status fetches and displays usage status for all configured providers.
 func Status(jsonMode, plainMode, showAll bool) int {
 	output, cacheEntry, code := loadStatusOutput(showAll)
@@ -784,16 +819,6 @@ func Status(jsonMode, plainMode, showAll bool) int {
 	return 0
 }
 
-// StatusLine prints one compact line for statusline/prompt/tmux integrations.
-func StatusLine(showAll bool) int {
-	output, code := loadCachedStatusOutput(showAll)
-	if code != 0 {
-		return code
-	}
-	fmt.Println(output.StatusLineSummary())
-	return 0
-}
-
 // StatusAgent prints one precise, token-efficient line for AI agents.
 func StatusAgent(showAll bool) int {
 	output, _, code := loadStatusOutput(showAll)
@@ -805,90 +830,186 @@ func StatusAgent(showAll bool) int {
 }
 
 func loadStatusOutput(showAll bool) (*MultiProviderOutput, *cache.Entry, int) {
-	cfg, err := config.Load(all.SourceValidator())
+	snapshot, err := CollectStatus(context.Background(), showAll)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
 		return nil, nil, 1
 	}
+	return snapshot.Output, snapshot.Cache, 0
+}
+
+// StatusSnapshot is one collected view of every configured provider.
+type StatusSnapshot struct {
+	Output *MultiProviderOutput
+	// Cache is the entry Output was read from, or nil after a fresh fetch.
+	Cache    *cache.Entry
+	Registry *provider.Registry
+	Config   *config.Config
+	// Statuses are the status pages checked while collecting, keyed by
+	// family, or nil when none were.
+	Statuses map[string]*status.ProviderStatus
+}
+
+// CollectStatus returns current usage for every configured provider. Like
+// `clawmeter --json`, it serves the shared cache for sources still within
+// their cache TTL and fetches the rest, plus status pages, once, falling back
+// to cached readings for providers that fail.
+func CollectStatus(ctx context.Context, showAll bool) (*StatusSnapshot, error) {
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		return nil, err
+	}
 
 	// Create registry and register providers
 	registry := provider.NewRegistry()
 
 	all.Register(registry, cfg)
 
-	// Try cache first — but only if it covers everything currently
-	// configured. Otherwise (e.g., a provider became configured via
-	// `codex login` after the last fetch) we'd return stale-by-membership
-	// data and the user would see nothing for ~60s.
-	configuredNames := registry.ConfiguredNames()
-	if cacheEntry, err := cache.Read(); err == nil && cacheEntry.IsValid() && cacheEntry.CoversCurrent(configuredNames, sourceRevisions(registry.GetConfigured())) && !cacheEntry.HasStaleData(configuredNames) {
-		output := buildOutputFromCache(registry, cfg, cacheEntry)
+	finish := func(output *MultiProviderOutput, cacheEntry *cache.Entry, statuses map[string]*status.ProviderStatus) *StatusSnapshot {
 		if showAll {
 			output.IncludeAllProviders(registry, cfg)
 		} else {
 			output.HideUnavailable()
 		}
-		return output, cacheEntry, 0
+		output.UseForecastMode(cfg)
+		return &StatusSnapshot{Output: output, Cache: cacheEntry, Registry: registry, Config: cfg, Statuses: statuses}
 	}
 
-	// Fetch fresh data from all configured providers
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Serve cached readings while every source is within its cache TTL, and
+	// otherwise fetch only the sources that are due. A source missing from
+	// the cache (e.g., one that became configured via `codex login` after
+	// the last fetch) is always due, so it never sits empty for a TTL.
+	due := dueSources(registry, cfg)
+	fresh := func(entry *cache.Entry, justWritten bool) bool { return len(due(entry, justWritten)) == 0 }
+	if cacheEntry, err := cache.Read(); err == nil && fresh(cacheEntry, false) {
+		return finish(buildOutputFromCache(registry, cfg, cacheEntry), cacheEntry, nil), nil
+	}
 
-	// Fetch usage and status in parallel
-	var result *provider.MultiFetchResult
+	// Another process may already be fetching; if its result arrives in
+	// time, use it instead.
+	var entry *cache.Entry
 	var statuses map[string]*status.ProviderStatus
-	done := make(chan struct{}, 2)
+	shared := cache.Coalesce(ctx, cache.RefreshWait, fresh, func() {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
 
-	go func() {
-		result = provider.FetchAllParallel(ctx, registry)
-
-		// For providers that errored, fall back to cached data if available
-		if cacheEntry, err := cache.Read(); err == nil && cacheEntry != nil {
-			for name, data := range result.Results {
-				if data != nil && data.Error != "" && !data.HasPresentableUsage() {
-					if cached, ok := staleFallback(cacheEntry, name, data, result.SourceRevisions[name]); ok {
-						result.Results[name] = cached
-					}
+		// Fetch usage and status in parallel
+		done := make(chan struct{}, 2)
+		go func() {
+			entry = refreshSources(ctx, registry, due)
+			done <- struct{}{}
+		}()
+		go func() {
+			seen := make(map[string]struct{})
+			var names []string
+			for _, p := range registry.GetConfigured() {
+				if _, ok := seen[p.Name()]; ok {
+					continue
 				}
+				seen[p.Name()] = struct{}{}
+				names = append(names, p.Name())
+			}
+			statuses = status.FetchAll(ctx, names)
+			done <- struct{}{}
+		}()
+		<-done
+		<-done
+	})
+	if shared != nil {
+		return finish(buildOutputFromCache(registry, cfg, shared), shared, nil), nil
+	}
+
+	// Build output
+	return finish(buildOutputFromResult(registry, cfg, entryResult(entry), statuses), nil, statuses), nil
+}
+
+// dueSources returns a function listing the configured sources that a cache
+// entry cannot serve: those missing from it, cached under a different
+// credential, or past their TTL. A stale or errored reading is due within
+// its TTL too, unless another process has just written the entry, since a
+// fetch of our own would fail the same way. A nil entry makes every source
+// due.
+func dueSources(registry *provider.Registry, cfg *config.Config) func(entry *cache.Entry, justWritten bool) []provider.Provider {
+	configured := registry.GetConfigured()
+	ttls := make(map[string]time.Duration, len(configured))
+	keys := make([]string, 0, len(configured))
+	for _, p := range configured {
+		key := provider.SourceKey(p)
+		ttls[key] = cache.SourceTTL(p, cfg)
+		keys = append(keys, key)
+	}
+	return func(entry *cache.Entry, justWritten bool) []provider.Provider {
+		if entry == nil {
+			return configured
+		}
+		expired := make(map[string]bool)
+		for _, key := range entry.Expired(keys, func(name string) time.Duration { return ttls[name] }) {
+			expired[key] = true
+		}
+		var due []provider.Provider
+		for _, p := range configured {
+			key := provider.SourceKey(p)
+			failed := false
+			if !justWritten {
+				data := entry.ProviderData[key]
+				failed = entry.HasStaleData([]string{key}) || (data != nil && data.Error != "")
+			}
+			if expired[key] || failed || !cache.SourceRevisionMatches(entry.SourceRevisions, key, provider.SourceRevision(p)) {
+				due = append(due, p)
 			}
 		}
+		return due
+	}
+}
 
-		_ = cache.Write(result)
-		done <- struct{}{}
-	}()
-	go func() {
-		seen := make(map[string]struct{})
-		var names []string
-		for _, p := range registry.GetConfigured() {
-			if _, ok := seen[p.Name()]; ok {
-				continue
+// refreshSources fetches the sources that are due, falls back to cached
+// readings for those that fail, and records them in history and in the cache
+// beside the cached sources that are still fresh. It returns the entry it
+// wrote.
+func refreshSources(ctx context.Context, registry *provider.Registry, due func(*cache.Entry, bool) []provider.Provider) *cache.Entry {
+	// Re-read under the refresh lock, which another process may have
+	// released just after writing.
+	prev, _ := cache.Read()
+	result := provider.FetchProvidersParallel(ctx, due(prev, false))
+	if prev != nil {
+		for name, data := range result.Results {
+			if data != nil && data.Error != "" && !data.HasPresentableUsage() {
+				if cached, ok := staleFallback(prev, name, data, result.SourceRevisions[name]); ok {
+					result.Results[name] = cached
+				}
 			}
-			seen[p.Name()] = struct{}{}
-			names = append(names, p.Name())
 		}
-		statuses = status.FetchAll(ctx, names)
-		done <- struct{}{}
-	}()
-	<-done
-	<-done
+	}
+	_ = history.Record(result)
+	entry := prev.Merge(result, registry.ConfiguredNames())
+	_ = cache.WriteEntry(entry)
+	return entry
+}
 
-	// Build output
-	output := buildOutputFromResult(registry, cfg, result, statuses)
-	if showAll {
-		output.IncludeAllProviders(registry, cfg)
-	} else {
-		output.HideUnavailable()
+// entryResult presents a cache entry as fetch results.
+func entryResult(entry *cache.Entry) *provider.MultiFetchResult {
+	return &provider.MultiFetchResult{
+		Results:         entry.ProviderData,
+		SourceRevisions: entry.SourceRevisions,
+		FetchedAt:       entry.FetchedAt,
 	}
+}
 
-	return output, nil, 0
+func loadCachedStatusOutput(showAll bool) (*MultiProviderOutput, *config.Config, int) {
+	snapshot, err := cachedStatus(showAll)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return nil, nil, 1
+	}
+	return snapshot.Output, snapshot.Config, 0
 }
 
-func loadCachedStatusOutput(showAll bool) (*MultiProviderOutput, int) {
+// cachedStatus is CollectStatus without fetching: every source shows its
+// cached reading, however old.
+func cachedStatus(showAll bool) (*StatusSnapshot, error) {
 	cfg, err := config.Load(all.SourceValidator())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
-		return nil, 1
+		return nil, err
 	}
 
 	registry := provider.NewRegistry()
@@ -896,7 +1017,7 @@ func loadCachedStatusOutput(showAll bool) (*MultiProviderOutput, int) {
 
 	cacheEntry, err := cache.Read()
 	if err != nil || cacheEntry == nil {
-		return &MultiProviderOutput{}, 0
+		return &StatusSnapshot{Output: &MultiProviderOutput{}, Registry: registry, Config: cfg}, nil
 	}
 
 	output := buildOutputFromCache(registry, cfg, cacheEntry)
@@ -905,7 +1026,40 @@ func loadCachedStatusOutput(showAll bool) (*MultiProviderOutput, int) {
 	} else {
 		output.HideUnavailable()
 	}
-	return output, 0
+	output.UseForecastMode(cfg)
+	return &StatusSnapshot{Output: output, Cache: cacheEntry, Registry: registry, Config: cfg}, nil
+}
+
+// RefreshSource fetches one source now, whatever its cache TTL, and merges
+// the reading into the shared cache.
+func RefreshSource(ctx context.Context, key string) error {
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		return err
+	}
+	registry := provider.NewRegistry()
+	all.Register(registry, cfg)
+
+	var target provider.Provider
+	for _, p := range registry.GetConfigured() {
+		if provider.SourceKey(p) == key {
+			target = p
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%s is not configured", key)
+	}
+
+	lock, err := cache.LockRefresh(ctx, cache.RefreshWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	refreshSources(ctx, registry, func(*cache.Entry, bool) []provider.Provider { return []provider.Provider{target} })
+	return nil
 }
 
 // IncludeAllProviders appends registered providers that were not fetched
@@ -930,6 +1084,19 @@ func (m *MultiProviderOutput) IncludeAllProviders(registry *provider.Registry, c
 	}
 }
 
+// UseForecastMode projects every provider in cfg's forecast mode. Recent-rate
+// forecasts read recorded history; if it cannot be read, projections fall
+// back to the average rate rather than failing the command.
+func (m *MultiProviderOutput) UseForecastMode(cfg *config.Config) {
+	estimator, err := history.LoadEstimator(cfg.ForecastMode())
+	if err != nil {
+		estimator = nil
+	}
+	for i := range m.Providers {
+		m.Providers[i].Estimator = estimator
+	}
+}
+
 func staleFallback(cacheEntry *cache.Entry, name string, current *provider.UsageData, revisions ...string) (*provider.UsageData, bool) {
 	if current == nil || current.InvalidatesPriorUsage {
 		return nil, false
@@ -979,33 +1146,32 @@ func Check() int {
 		return 2
 	}
 
-	// Try cache first — but skip if a newly-configured provider has no
-	// cached entry yet (same stale-by-membership concern as Status()).
-	configuredNames := registry.ConfiguredNames()
+	// Try cache first, fetching only the sources it cannot serve (same
+	// rules as CollectStatus).
+	due := dueSources(registry, cfg)
+	fresh := func(entry *cache.Entry, justWritten bool) bool { return len(due(entry, justWritten)) == 0 }
 	var output *MultiProviderOutput
-	if cacheEntry, err := cache.Read(); err == nil && cacheEntry.IsValid() && cacheEntry.CoversCurrent(configuredNames, sourceRevisions(registry.GetConfigured())) && !cacheEntry.HasStaleData(configuredNames) {
+	if cacheEntry, err := cache.Read(); err == nil && fresh(cacheEntry, false) {
 		output = buildOutputFromCache(registry, cfg, cacheEntry)
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		result := provider.FetchAllParallel(ctx, registry)
-		if cacheEntry, err := cache.Read(); err == nil && cacheEntry != nil {
-			for name, data := range result.Results {
-				if data != nil && data.Error != "" && !data.HasPresentableUsage() {
-					if cached, ok := staleFallback(cacheEntry, name, data, result.SourceRevisions[name]); ok {
-						result.Results[name] = cached
-					}
-				}
-			}
+		var entry *cache.Entry
+		shared := cache.Coalesce(context.Background(), cache.RefreshWait, fresh, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			entry = refreshSources(ctx, registry, due)
+		})
+		if shared != nil {
+			output = buildOutputFromCache(registry, cfg, shared)
+		} else {
+			output = buildOutputFromResult(registry, cfg, entryResult(entry), nil)
 		}
-		_ = cache.Write(result)
-		output = buildOutputFromResult(registry, cfg, result, nil)
 	}
 	output.HideUnavailable()
 	if len(output.Providers) == 0 {
 		fmt.Fprintf(os.Stderr, "clawmeter: no active providers\n")
 		return 2
 	}
+	output.UseForecastMode(cfg)
 
 	worstTier := 4
 	for i := range output.Providers {
@@ -1138,7 +1304,7 @@ func classifyProvider(pf *ProviderFormatter) providerUrgency {
 	var runsOutIn time.Duration
 	var runsOutEarlyBy time.Duration
 	for _, w := range pf.Data.UsableWindows() {
-		proj := forecast.Project(w.Utilization, w.ResetsAt, forecast.GuessWindowType(w.Name))
+		proj := pf.Project(w)
 		if proj.ProjectedPct > maxPct {
 			maxPct = proj.ProjectedPct
 		}
@@ -1404,6 +1570,7 @@ func SingleProviderStatusSource(providerName, sourceID string, jsonMode, plainMo
 	for _, p := range providers {
 		output.Providers = append(output.Providers, ProviderFormatter{Name: provider.SourceKey(p), Family: family, SourceID: provider.SourceID(p), SourceLabel: provider.SourceLabel(p), Display: sourceDisplay(p, counts), Data: result.Results[provider.SourceKey(p)], Status: ps})
 	}
+	output.UseForecastMode(cfg)
 
 	if jsonMode {
 		output.PrintJSON(nil)
@@ -12,6 +12,7 @@ import (
 
 	"github.com/tnunamak/clawmeter/internal/cache"
 	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/forecast"
 	"github.com/tnunamak/clawmeter/internal/provider"
 )
 
@@ -797,3 +798,124 @@ func TestBuildOutputFromCacheRejectsRotatedSourceCredential(t *testing.T) {
 		t.Fatalf("rotated source reused cached account data: %#v", output.Providers)
 	}
 }
+
+func TestRecentForecastAddsBandToJSONAndAgentSummary(t *testing.T) {
+	now := time.Now()
+	resetsAt := now.Add(3 * time.Hour)
+	estimator := &forecast.Estimator{Mode: forecast.ModeRecent, Readings: map[string][]forecast.Reading{
+		forecast.ReadingKey("claude", "5h"): {
+			{At: now.Add(-60 * time.Minute), Pct: 10, ResetsAt: resetsAt},
+			{At: now.Add(-40 * time.Minute), Pct: 15, ResetsAt: resetsAt},
+			{At: now.Add(-20 * time.Minute), Pct: 24, ResetsAt: resetsAt},
+		},
+	}}
+	pf := ProviderFormatter{
+		Name:      "claude",
+		Display:   "Claude",
+		Estimator: estimator,
+		Data: &provider.UsageData{Provider: "claude", FetchedAt: now, Windows: []provider.UsageWindow{
+			{Name: "5h", Utilization: 30, ResetsAt: resetsAt},
+		}},
+	}
+
+	got := forecastFor(&pf).Windows["5h"]
+	if got.Method != "recent" || got.Band == nil || got.RatePerHour <= 0 || got.Samples != 4 {
+		t.Fatalf("forecast = %#v, want a recent projection with a band", got)
+	}
+	if !(got.Band.LowPct <= got.ProjectedPct && got.ProjectedPct <= got.Band.HighPct) {
+		t.Fatalf("band %#v does not bracket %.2f", got.Band, got.ProjectedPct)
+	}
+
+	summary := (&MultiProviderOutput{Providers: []ProviderFormatter{pf}}).AgentSummary()
+	for _, want := range []string{"forecast=recent", "burn_rate_per_hour=", "projected_range="} {
+		if !strings.Contains(summary, want) {
+			t.Fatalf("AgentSummary() = %q, missing %q", summary, want)
+		}
+	}
+
+	pf.Estimator = nil
+	if got := forecastFor(&pf).Windows["5h"]; got.Method != "average" || got.Band != nil {
+		t.Fatalf("average forecast = %#v, want no band", got)
+	}
+	if summary := (&MultiProviderOutput{Providers: []ProviderFormatter{pf}}).AgentSummary(); strings.Contains(summary, "forecast=") {
+		t.Fatalf("average AgentSummary() should be unchanged, got %q", summary)
+	}
+}
+
+type ttlStubProvider struct {
+	cliStubProvider
+	ttl time.Duration
+}
+
+func (p ttlStubProvider) CacheTTL() time.Duration { return p.ttl }
+
+func TestDueSourcesExpireEachSourceByItsOwnTTL(t *testing.T) {
+	registry := provider.NewRegistry()
+	for _, p := range []provider.Provider{
+		cliStubProvider{name: "claude"},
+		ttlStubProvider{cliStubProvider: cliStubProvider{name: "deepseek"}, ttl: 10 * time.Minute},
+		ttlStubProvider{cliStubProvider: cliStubProvider{name: "openrouter"}, ttl: 10 * time.Minute},
+		cliStubProvider{name: "new"},
+	} {
+		if err := registry.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Providers["openrouter"] = config.ProviderConfig{Enabled: true, CacheTTL: "1m"}
+
+	now := time.Now()
+	entry := &cache.Entry{
+		ProviderData: map[string]*provider.UsageData{"claude": {}, "deepseek": {}, "openrouter": {}},
+		SourceFetchedAt: map[string]time.Time{
+			"claude":     now.Add(-2 * time.Minute),
+			"deepseek":   now.Add(-2 * time.Minute),
+			"openrouter": now.Add(-2 * time.Minute),
+		},
+		FetchedAt: now,
+	}
+	var names []string
+	for _, p := range dueSources(registry, cfg)(entry, false) {
+		names = append(names, p.Name())
+	}
+	// claude is past the 60s default, openrouter past its 1m override, and
+	// new is not cached; deepseek's 10m TTL keeps it fresh.
+	if got := strings.Join(names, ","); got != "claude,new,openrouter" {
+		t.Fatalf("due = %s", got)
+	}
+	if got := len(dueSources(registry, cfg)(nil, false)); got != 4 {
+		t.Fatalf("due without a cache = %d, want every source", got)
+	}
+}
+
+func TestDueSourcesRefetchFailedReadingsWithinTheirTTL(t *testing.T) {
+	registry := provider.NewRegistry()
+	for _, name := range []string{"deepseek", "openrouter", "zai"} {
+		p := ttlStubProvider{cliStubProvider: cliStubProvider{name: name}, ttl: 10 * time.Minute}
+		if err := registry.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	entry := &cache.Entry{
+		ProviderData: map[string]*provider.UsageData{
+			"deepseek":   {Stale: true, Error: "HTTP 503"},
+			"openrouter": {Error: "HTTP 500"},
+			"zai":        {},
+		},
+		SourceFetchedAt: map[string]time.Time{"deepseek": now, "openrouter": now, "zai": now},
+		FetchedAt:       now,
+	}
+	due := dueSources(registry, config.DefaultConfig())
+	var names []string
+	for _, p := range due(entry, false) {
+		names = append(names, p.Name())
+	}
+	if got := strings.Join(names, ","); got != "deepseek,openrouter" {
+		t.Fatalf("due = %s, want the stale and errored sources", got)
+	}
+	// Another process's fetch that just failed the same way is served.
+	if got := due(entry, true); len(got) != 0 {
+		t.Fatalf("due after another process's refresh = %d sources, want none", len(got))
+	}
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/format"
+)
+
+// StatusLineData is the model a statusline format template renders. Only
+// sources with readable usage windows appear; setup problems belong to
+// `clawmeter status`, not a one-line segment.
+type StatusLineData struct {
+	// Worst is the most at-risk window, or nil when there is no quota data.
+	Worst *StatusLineWindow
+	// Windows lists every readable window, most at-risk first.
+	Windows []StatusLineWindow
+	// Providers lists sources in urgency order, each with its windows.
+	Providers []StatusLineProvider
+}
+
+// StatusLineProvider is one source in a statusline template.
+type StatusLineProvider struct {
+	// Name is the source key, e.g. "claude" or "claude:work".
+	Name    string
+	Display string
+	// Status is the status of the source's worst window.
+	Status    string
+	Stale     bool
+	FetchedAt time.Time
+	Windows   []StatusLineWindow
+	// ResetCredits is how many banked resets are available; zero when the
+	// provider reports none.
+	ResetCredits int
+	// ResetCreditsExpire is when the earliest reset credit expires; zero when
+	// unknown.
+	ResetCreditsExpire time.Time
+}
+
+// StatusLineWindow is one usage window in a statusline template.
+type StatusLineWindow struct {
+	// Provider is the source's display name; Source is its key.
+	Provider    string
+	Source      string
+	Name        string
+	Utilization float64
+	// ResetsAt is zero when the provider does not report a reset time; so is
+	// ResetIn.
+	ResetsAt time.Time
+	ResetIn  time.Duration
+	// ProjectedPct and the fields after it come from the configured forecast.
+	ProjectedPct    float64
+	RatePerHour     float64
+	WillLastToReset bool
+	RunsOutIn       time.Duration
+	RunsOutEarlyBy  time.Duration
+	// Status is "on_track", "tight" (projected 90% or more), or "at_risk"
+	// (projected to reach the limit).
+	Status string
+	// Risk is the same tier as a CSS-friendly class: "on-track", "tight", or
+	// "critical".
+	Risk  string
+	Stale bool
+}
+
+// String summarizes the window on one line, e.g. for a tooltip.
+func (w StatusLineWindow) String() string {
+	line := fmt.Sprintf("%s %s %.0f%%", w.Provider, w.Name, w.Utilization)
+	if !w.ResetsAt.IsZero() {
+		line += fmt.Sprintf(", est. %.0f%% at reset in %s", w.ProjectedPct, format.FormatDuration(w.ResetIn))
+	}
+	if !w.WillLastToReset && w.RunsOutIn > 0 {
+		line += ", out in " + format.FormatDuration(w.RunsOutIn)
+	}
+	if w.Stale {
+		line += " (stale)"
+	}
+	return line
+}
+
+// statusLinePresets are the built-in formats, by name. The -all variants list
+// every source instead of the worst window only.
+var statusLinePresets = map[string]string{
+	"default": `{{with .Worst}}{{byStatus .Status "CM" "CM~" "CM!"}} {{.Provider}} {{.Name}} est. {{printf "%.0f" .ProjectedPct}}% reset {{duration .ResetIn}}` +
+		`{{if and (not .WillLastToReset) (gt .RunsOutIn 0)}} out {{duration .RunsOutIn}}{{end}}{{else}}CM no quota data{{end}}`,
+	"plain": `{{with .Worst}}{{.}}{{else}}no quota data{{end}}`,
+	"plain-all": `{{range $i, $p := .Providers}}{{if $i}} | {{end}}{{$p.Display}}{{range $p.Windows}} {{.Name}} {{pct .Utilization}}{{end}}` +
+		`{{if $p.Stale}} (stale){{end}}{{else}}no quota data{{end}}`,
+	"tmux": `{{with .Worst}}#[fg={{byStatus .Status "green" "yellow" "red"}}]{{.Provider}} {{.Name}} {{pct .Utilization}} est. {{pct .ProjectedPct}}` +
+		`{{if .Stale}} (stale){{end}}#[default]{{else}}CM no quota data{{end}}`,
+	"tmux-all": `{{range $i, $p := .Providers}}{{if $i}} {{end}}{{$p.Display}}` +
+		`{{range $p.Windows}} #[fg={{byStatus .Status "green" "yellow" "red"}}]{{.Name}} {{pct .Utilization}}#[default]{{end}}` +
+		`{{if $p.Stale}} (stale){{end}}{{else}}CM no quota data{{end}}`,
+	"polybar": `{{with .Worst}}%{F{{byStatus .Status "#50fa7b" "#f1fa8c" "#ff5555"}}}{{.Provider}} {{.Name}} {{pct .Utilization}} est. {{pct .ProjectedPct}}` +
+		`{{if .Stale}} (stale){{end}}%{F-}{{else}}CM no quota data{{end}}`,
+	"polybar-all": `{{range $i, $p := .Providers}}{{if $i}} {{end}}{{$p.Display}}` +
+		`{{range $p.Windows}} %{F{{byStatus .Status "#50fa7b" "#f1fa8c" "#ff5555"}}}{{.Name}} {{pct .Utilization}}%{F-}{{end}}` +
+		`{{if $p.Stale}} (stale){{end}}{{else}}CM no quota data{{end}}`,
+	"waybar": `{{with .Worst}}{"text":{{json (printf "%s %s %s" .Provider .Name (pct .Utilization))}},"tooltip":{{json (lines $.Windows)}},` +
+		`"class":{{json .Risk}},"percentage":{{printf "%.0f" .Utilization}}}{{else}}{"text":"CM no quota data","class":"none"}{{end}}`,
+}
+
+var defaultStatusLine = template.Must(ParseStatusLineFormat(""))
+
+// StatusLinePresets returns the names of the built-in statusline formats.
+func StatusLinePresets() []string {
+	names := make([]string, 0, len(statusLinePresets))
+	for name := range statusLinePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var statusLineFuncs = template.FuncMap{
+	// pct formats a percentage without decimals: 42%.
+	"pct": func(pct float64) string { return fmt.Sprintf("%.0f%%", pct) },
+	// duration formats a duration compactly: 2h05m, 3d4h.
+	"duration": format.FormatDuration,
+	// byStatus picks one of three values by window status.
+	"byStatus": func(status, onTrack, tight, atRisk string) string {
+		switch status {
+		case "at_risk":
+			return atRisk
+		case "tight":
+			return tight
+		default:
+			return onTrack
+		}
+	},
+	// json encodes a value, e.g. to quote a string inside JSON output.
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// lines joins window summaries with newlines.
+	"lines": func(windows []StatusLineWindow) string {
+		out := make([]string, len(windows))
+		for i, w := range windows {
+			out[i] = w.String()
+		}
+		return strings.Join(out, "\n")
+	},
+}
+
+// ParseStatusLineFormat returns the template for a preset name or, failing
+// that, parses format as a text/template over StatusLineData. An empty
+// format is the default preset.
+func ParseStatusLineFormat(format string) (*template.Template, error) {
+	name, text := "statusline", format
+	if format == "" {
+		name, text = "default", statusLinePresets["default"]
+	} else if preset, ok := statusLinePresets[format]; ok {
+		name, text = format, preset
+	}
+	tmpl, err := template.New(name).Funcs(statusLineFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("statusline format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// RenderStatusLine executes tmpl over the statusline model. Trailing newlines
+// are dropped so a multi-line template still ends in exactly one.
+func (m *MultiProviderOutput) RenderStatusLine(tmpl *template.Template) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, m.StatusLineData(time.Now())); err != nil {
+		return "", fmt.Errorf("statusline format: %w", err)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// StatusLineData builds the statusline template model.
+func (m *MultiProviderOutput) StatusLineData(now time.Time) StatusLineData {
+	sortProvidersByUrgency(m.Providers)
+
+	type ranked struct {
+		window StatusLineWindow
+		proj   forecast.Projection
+		tier   int
+	}
+	var byRisk []ranked
+	var data StatusLineData
+	for i := range m.Providers {
+		pf := &m.Providers[i]
+		if pf.Data == nil || pf.Data.IsExpired || (pf.Data.Error != "" && !pf.Data.HasUsageWindows()) {
+			continue
+		}
+		windows := pf.Data.UsableWindows()
+		if len(windows) == 0 {
+			continue
+		}
+		tier := classifyProvider(pf).tier
+		p := StatusLineProvider{
+			Name:      pf.Name,
+			Display:   pf.Display,
+			Stale:     pf.Data.Stale,
+			FetchedAt: pf.Data.FetchedAt,
+		}
+		var worst forecast.Projection
+		for j, window := range windows {
+			proj := pf.Project(window)
+			w := StatusLineWindow{
+				Provider:        pf.Display,
+				Source:          pf.Name,
+				Name:            window.Name,
+				Utilization:     window.Utilization,
+				ResetsAt:        window.ResetsAt,
+				ProjectedPct:    proj.ProjectedPct,
+				RatePerHour:     proj.RatePerHour,
+				WillLastToReset: proj.WillLastToReset,
+				RunsOutIn:       proj.RunsOutIn,
+				RunsOutEarlyBy:  proj.RunsOutEarlyBy,
+				Status:          agentStatus(proj),
+				Risk:            proj.RiskClass(),
+				Stale:           pf.Data.Stale,
+			}
+			if !window.ResetsAt.IsZero() {
+				w.ResetIn = window.ResetsAt.Sub(now)
+			}
+			if j == 0 || forecast.CompareRisk(proj, worst) < 0 {
+				worst, p.Status = proj, w.Status
+			}
+			p.Windows = append(p.Windows, w)
+			byRisk = append(byRisk, ranked{window: w, proj: proj, tier: tier})
+		}
+		if !pf.Data.Stale && pf.Data.ResetCredits != nil {
+			p.ResetCredits = pf.Data.ResetCredits.DisplayCount(now)
+			if p.ResetCredits > 0 {
+				p.ResetCreditsExpire, _ = pf.Data.ResetCredits.EarliestExpiry(now)
+			}
+		}
+		data.Providers = append(data.Providers, p)
+	}
+
+	sort.SliceStable(byRisk, func(i, j int) bool {
+		if byRisk[i].tier != byRisk[j].tier {
+			return byRisk[i].tier < byRisk[j].tier
+		}
+		return forecast.CompareRisk(byRisk[i].proj, byRisk[j].proj) < 0
+	})
+	for _, r := range byRisk {
+		data.Windows = append(data.Windows, r.window)
+	}
+	if len(data.Windows) > 0 {
+		data.Worst = &data.Windows[0]
+	}
+	return data
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider/all"
+)
+
+// Statusline output modes besides templated text.
+const (
+	StatusLineWaybar = "waybar"
+	StatusLineI3bar  = "i3bar"
+)
+
+// followCacheCheck is how often a following statusline looks for cache
+// writes by other processes between its own polls.
+const followCacheCheck = 5 * time.Second
+
+// StatusLineOptions configures `clawmeter statusline`.
+type StatusLineOptions struct {
+	ShowAll bool
+	// Format is a preset name or template for text output; empty uses the
+	// configured format.
+	Format string
+	// Mode is "" for text, or StatusLineWaybar or StatusLineI3bar.
+	Mode string
+	// Follow keeps running, emitting after every poll and whenever another
+	// process refreshes the cache.
+	Follow bool
+	// Interval is how often Follow polls providers.
+	Interval time.Duration
+}
+
+// WaybarModule is a waybar custom module update (return-type json). Class
+// and Alt carry the forecast risk class of the worst window, or "none".
+type WaybarModule struct {
+	Text       string `json:"text"`
+	Tooltip    string `json:"tooltip"`
+	Class      string `json:"class"`
+	Alt        string `json:"alt"`
+	Percentage int    `json:"percentage"`
+}
+
+// I3barBlock is one block of the i3bar protocol, also read by i3blocks with
+// format=json.
+type I3barBlock struct {
+	Name      string `json:"name"`
+	FullText  string `json:"full_text"`
+	ShortText string `json:"short_text,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Urgent    bool   `json:"urgent,omitempty"`
+}
+
+var riskColors = map[string]string{
+	forecast.RiskOnTrack:  "#50fa7b",
+	forecast.RiskTight:    "#f1fa8c",
+	forecast.RiskCritical: "#ff5555",
+}
+
+// barSummary is what every bar shows: the worst window in the text, and every
+// window, plus reset credits, in the tooltip.
+type barSummary struct {
+	Text      string
+	ShortText string
+	Tooltip   string
+	Class     string
+	Pct       float64
+}
+
+func (m *MultiProviderOutput) barSummary() barSummary {
+	pf, window, proj, ok := m.worstReadableWindow()
+	if !ok {
+		return barSummary{Text: "CM no quota data", ShortText: "CM", Class: "none"}
+	}
+	b := barSummary{
+		Text:      fmt.Sprintf("%s %s %.0f%%", pf.Display, window.Name, window.Utilization),
+		ShortText: fmt.Sprintf("%.0f%%", window.Utilization),
+		Class:     proj.RiskClass(),
+		Pct:       window.Utilization,
+	}
+	if pf.Data.Stale {
+		b.Text += " (stale)"
+	}
+
+	data := m.StatusLineData(time.Now())
+	lines := make([]string, 0, len(data.Windows))
+	for _, w := range data.Windows {
+		lines = append(lines, w.String())
+	}
+	for i := range m.Providers {
+		if summary := resetCreditCompactSummary(m.Providers[i].Data, time.Now()); summary != "" {
+			lines = append(lines, m.Providers[i].Display+": "+summary)
+		}
+	}
+	b.Tooltip = strings.Join(lines, "\n")
+	return b
+}
+
+// Waybar returns the waybar module update for the worst window.
+func (m *MultiProviderOutput) Waybar() WaybarModule {
+	b := m.barSummary()
+	return WaybarModule{Text: b.Text, Tooltip: b.Tooltip, Class: b.Class, Alt: b.Class, Percentage: int(b.Pct + 0.5)}
+}
+
+// I3bar returns the i3bar block for the worst window.
+func (m *MultiProviderOutput) I3bar() I3barBlock {
+	b := m.barSummary()
+	return I3barBlock{
+		Name:      "clawmeter",
+		FullText:  b.Text,
+		ShortText: b.ShortText,
+		Color:     riskColors[b.Class],
+		Urgent:    b.Class == forecast.RiskCritical,
+	}
+}
+
+// StatusLine prints one compact line for statusline/prompt/tmux/bar
+// integrations, or keeps printing them with Follow.
+func StatusLine(opts StatusLineOptions) int {
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	render, err := statusLineRenderer(opts, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	if opts.Follow {
+		return followStatusLine(context.Background(), opts, render)
+	}
+
+	output, _, code := loadCachedStatusOutput(opts.ShowAll)
+	if code != 0 {
+		return code
+	}
+	line, err := render(output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	fmt.Println(line)
+	return 0
+}
+
+func statusLineRenderer(opts StatusLineOptions, cfg *config.Config) (func(*MultiProviderOutput) (string, error), error) {
+	switch opts.Mode {
+	case StatusLineWaybar:
+		return func(m *MultiProviderOutput) (string, error) {
+			data, err := json.Marshal(m.Waybar())
+			return string(data), err
+		}, nil
+	case StatusLineI3bar:
+		return func(m *MultiProviderOutput) (string, error) {
+			data, err := json.Marshal(m.I3bar())
+			return string(data), err
+		}, nil
+	}
+	format := opts.Format
+	if format == "" {
+		format = cfg.Settings.Statusline.Format
+	}
+	tmpl, err := ParseStatusLineFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return func(m *MultiProviderOutput) (string, error) { return m.RenderStatusLine(tmpl) }, nil
+}
+
+// followStatusLine polls every opts.Interval, cache first like `clawmeter
+// status`, and prints a line after each poll. Between polls it re-renders
+// from the cache whenever another process writes it, so a bar stays as fresh
+// as the tray or a shared poller without fetching more itself. In i3bar mode
+// the lines form the i3bar protocol: a header, then an endless array of
+// block arrays.
+func followStatusLine(ctx context.Context, opts StatusLineOptions, render func(*MultiProviderOutput) (string, error)) int {
+	first := true
+	emit := func(output *MultiProviderOutput) {
+		line, err := render(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return
+		}
+		if opts.Mode == StatusLineI3bar {
+			line = "[" + line + "]"
+			if !first {
+				line = "," + line
+			}
+		}
+		first = false
+		fmt.Println(line)
+	}
+	poll := func() {
+		snapshot, err := CollectStatus(ctx, opts.ShowAll)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+			return
+		}
+		emit(snapshot.Output)
+	}
+
+	if opts.Mode == StatusLineI3bar {
+		fmt.Println(`{"version":1}`)
+		fmt.Println("[")
+	}
+	poll()
+	checked := time.Now()
+	nextPoll := checked.Add(opts.Interval)
+
+	ticker := time.NewTicker(followCacheCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case now := <-ticker.C:
+			if !now.Before(nextPoll) {
+				poll()
+				nextPoll = now.Add(opts.Interval)
+			} else if cache.WrittenSince(checked) {
+				if output, _, code := loadCachedStatusOutput(opts.ShowAll); code == 0 {
+					emit(output)
+				}
+			}
+			checked = time.Now()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func statusLineFixture(now time.Time) *MultiProviderOutput {
+	return &MultiProviderOutput{Providers: []ProviderFormatter{
+		{
+			Name:    "openai",
+			Display: "Codex",
+			Data: &provider.UsageData{FetchedAt: now, Windows: []provider.UsageWindow{
+				{Name: "5h", Utilization: 10, ResetsAt: now.Add(4 * time.Hour)},
+			}},
+		},
+		{
+			Name:    "claude",
+			Display: "Claude",
+			Data: &provider.UsageData{FetchedAt: now, Stale: true, Windows: []provider.UsageWindow{
+				{Name: "5h", Utilization: 60, ResetsAt: now.Add(2*time.Hour + 30*time.Minute)},
+				{Name: "7d", Utilization: 20, ResetsAt: now.Add(5 * 24 * time.Hour)},
+			}},
+		},
+		{Name: "gemini", Display: "Gemini", Data: &provider.UsageData{Error: "token expired"}},
+	}}
+}
+
+func renderStatusLine(t *testing.T, output *MultiProviderOutput, format string) string {
+	t.Helper()
+	tmpl, err := ParseStatusLineFormat(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := output.RenderStatusLine(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestStatusLineDataRanksWindowsAndSkipsUnreadableSources(t *testing.T) {
+	data := statusLineFixture(time.Now()).StatusLineData(time.Now())
+	if len(data.Providers) != 2 {
+		t.Fatalf("providers = %+v, want claude and codex only", data.Providers)
+	}
+	if data.Worst == nil || data.Worst.Provider != "Claude" || data.Worst.Name != "5h" {
+		t.Fatalf("worst = %+v", data.Worst)
+	}
+	if data.Worst.Status != "at_risk" || !data.Worst.Stale {
+		t.Fatalf("worst status = %s stale %v", data.Worst.Status, data.Worst.Stale)
+	}
+	if len(data.Windows) != 3 {
+		t.Fatalf("windows = %d, want 3", len(data.Windows))
+	}
+}
+
+func TestStatusLinePresetsRender(t *testing.T) {
+	output := statusLineFixture(time.Now())
+	for _, name := range StatusLinePresets() {
+		line := renderStatusLine(t, output, name)
+		if !strings.Contains(line, "Claude") {
+			t.Fatalf("%s = %q, missing worst provider", name, line)
+		}
+		if strings.HasSuffix(name, "-all") && !strings.Contains(line, "Codex") {
+			t.Fatalf("%s = %q, missing other providers", name, line)
+		}
+		empty := renderStatusLine(t, &MultiProviderOutput{}, name)
+		if !strings.Contains(empty, "no quota data") {
+			t.Fatalf("%s without data = %q", name, empty)
+		}
+	}
+}
+
+func TestStatusLineDefaultPresetMatchesCompactSummary(t *testing.T) {
+	got := renderStatusLine(t, statusLineFixture(time.Now()), "")
+	if !strings.HasPrefix(got, "CM! Claude 5h est. ") || !strings.Contains(got, " reset 2h") {
+		t.Fatalf("default = %q", got)
+	}
+}
+
+func TestStatusLineWaybarPresetIsJSON(t *testing.T) {
+	line := renderStatusLine(t, statusLineFixture(time.Now()), "waybar")
+	var out struct {
+		Text       string `json:"text"`
+		Tooltip    string `json:"tooltip"`
+		Class      string `json:"class"`
+		Percentage int    `json:"percentage"`
+	}
+	if err := json.Unmarshal([]byte(line), &out); err != nil {
+		t.Fatalf("waybar output is not JSON: %v\n%s", err, line)
+	}
+	if out.Text != "Claude 5h 60%" || out.Class != "critical" || out.Percentage != 60 {
+		t.Fatalf("waybar = %+v", out)
+	}
+	if strings.Count(out.Tooltip, "\n") != 2 || !strings.Contains(out.Tooltip, "(stale)") {
+		t.Fatalf("tooltip = %q", out.Tooltip)
+	}
+}
+
+func TestStatusLineCustomTemplate(t *testing.T) {
+	format := `{{range .Providers}}{{.Display}}={{range .Windows}}{{.Name}}:{{pct .Utilization}};{{end}} {{end}}` + "\n"
+	got := renderStatusLine(t, statusLineFixture(time.Now()), format)
+	if got != "Claude=5h:60%;7d:20%; Codex=5h:10%; " {
+		t.Fatalf("custom = %q", got)
+	}
+	if _, err := ParseStatusLineFormat("{{.Worst"); err == nil {
+		t.Fatal("malformed template parsed")
+	}
+}
+
+func TestWaybarAndI3barShowWorstWindowWithRiskClass(t *testing.T) {
+	output := statusLineFixture(time.Now())
+	output.Providers[1].Data.ResetCredits = nil
+
+	waybar := output.Waybar()
+	if waybar.Text != "Claude 5h 60% (stale)" || waybar.Class != "critical" || waybar.Alt != "critical" || waybar.Percentage != 60 {
+		t.Fatalf("waybar = %+v", waybar)
+	}
+	if lines := strings.Split(waybar.Tooltip, "\n"); len(lines) != 3 || !strings.HasPrefix(lines[2], "Codex 5h 10%") {
+		t.Fatalf("tooltip = %q", waybar.Tooltip)
+	}
+
+	block := output.I3bar()
+	if block.FullText != waybar.Text || block.ShortText != "60%" || block.Color != riskColors["critical"] || !block.Urgent {
+		t.Fatalf("i3bar = %+v", block)
+	}
+
+	empty := (&MultiProviderOutput{}).Waybar()
+	if empty.Class != "none" || empty.Text != "CM no quota data" {
+		t.Fatalf("empty waybar = %+v", empty)
+	}
+	if block := (&MultiProviderOutput{}).I3bar(); block.Color != "" || block.Urgent {
+		t.Fatalf("empty i3bar = %+v", block)
+	}
+}
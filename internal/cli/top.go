@@ -0,0 +1,502 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/browser"
+	"golang.org/x/term"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/format"
+	"github.com/tnunamak/clawmeter/internal/provider/all"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+// topStatusInterval is how often top checks status pages itself when its
+// polls are served from the cache, which checks none. They change slowly.
+const topStatusInterval = 15 * time.Minute
+
+const topHelp = "↑/↓ select  r refresh  R refresh all  o dashboard  e enable/disable  a all  q quit"
+
+// Terminal control sequences for the dashboard: the alternate screen keeps
+// the user's scrollback intact, and disabling line wrap clips long lines
+// instead of scrolling the screen.
+const (
+	enterTopScreen = "\033[?1049h\033[?25l\033[?7l"
+	leaveTopScreen = "\033[?7h\033[?25h\033[?1049l"
+)
+
+// topAction is what a key asks the dashboard to do.
+type topAction int
+
+const (
+	topNone topAction = iota
+	topQuit
+	topRefreshOne
+	topRefreshAll
+	topOpenDashboard
+	topToggleEnabled
+	topToggleAll
+)
+
+// topModel is the dashboard state. Only the event loop touches it.
+type topModel struct {
+	snapshot *StatusSnapshot
+	statuses map[string]*status.ProviderStatus
+	selected int
+	showAll  bool
+	// refreshing holds the sources being refreshed; "" is a full poll.
+	refreshing map[string]bool
+	message    string
+	polledAt   time.Time
+	nextPoll   time.Time
+	// statusAt is when the status pages were last checked.
+	statusAt time.Time
+}
+
+// topResult is a finished poll or single-source refresh.
+type topResult struct {
+	key      string
+	snapshot *StatusSnapshot
+	statuses map[string]*status.ProviderStatus
+	err      error
+}
+
+// Top runs a full-screen dashboard until the user quits, polling providers
+// every interval. It needs a terminal on stdin and stdout.
+func Top(interval time.Duration, showAll bool) int {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		fmt.Fprintln(os.Stderr, "clawmeter: top needs a terminal; use `clawmeter status` or `clawmeter watch` instead")
+		return 1
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: %v\n", err)
+		return 1
+	}
+	defer term.Restore(in, state)
+	fmt.Print(enterTopScreen)
+	defer fmt.Print(leaveTopScreen)
+
+	// Browser launchers print to stdout, which would scribble on the screen.
+	browser.Stdout, browser.Stderr = io.Discard, io.Discard
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	keys := make(chan string)
+	go readTopKeys(os.Stdin, keys)
+	// Polls still running when the dashboard quits give up on sending.
+	results := make(chan topResult)
+	send := func(r topResult) {
+		select {
+		case results <- r:
+		case <-ctx.Done():
+		}
+	}
+
+	m := &topModel{showAll: showAll, refreshing: map[string]bool{}}
+	// Show cached readings at once, then poll.
+	if snapshot, err := cachedStatus(showAll); err == nil {
+		m.setSnapshot(snapshot)
+	}
+	poll := func() {
+		m.refreshing[""] = true
+		m.nextPoll = time.Now().Add(interval)
+		go func(showAll bool, statusAt time.Time) {
+			snapshot, err := CollectStatus(ctx, showAll)
+			if err != nil {
+				send(topResult{err: err})
+				return
+			}
+			send(topResult{snapshot: snapshot, statuses: pollStatuses(ctx, snapshot, statusAt, status.FetchAll)})
+		}(m.showAll, m.statusAt)
+	}
+	poll()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+		fmt.Print(strings.Join(m.render(time.Now(), width, height), ""))
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+			if !m.refreshing[""] && !time.Now().Before(m.nextPoll) {
+				poll()
+			}
+		case r := <-results:
+			m.apply(r)
+		case key := <-keys:
+			switch m.key(key) {
+			case topQuit:
+				return 0
+			case topRefreshAll:
+				if !m.refreshing[""] {
+					poll()
+				}
+			case topRefreshOne:
+				pf := m.selectedProvider()
+				if pf == nil || m.refreshing[pf.Name] {
+					break
+				}
+				m.refreshing[pf.Name] = true
+				go func(key string, showAll bool) {
+					err := RefreshSource(ctx, key)
+					snapshot, cacheErr := cachedStatus(showAll)
+					if err == nil {
+						err = cacheErr
+					}
+					send(topResult{key: key, snapshot: snapshot, err: err})
+				}(pf.Name, m.showAll)
+			case topOpenDashboard:
+				m.openDashboard()
+			case topToggleEnabled:
+				if m.toggleEnabled() && !m.refreshing[""] {
+					poll()
+				}
+			case topToggleAll:
+				m.showAll = !m.showAll
+				if snapshot, err := cachedStatus(m.showAll); err == nil {
+					m.setSnapshot(snapshot)
+				}
+			}
+		}
+	}
+}
+
+// readTopKeys decodes terminal input into key names: printable characters
+// as themselves, arrows as "up" and "down", Ctrl-C as "ctrl-c".
+func readTopKeys(r io.Reader, keys chan<- string) {
+	buf := make([]byte, 32)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for i := 0; i < n; i++ {
+			switch {
+			case buf[i] == 3:
+				keys <- "ctrl-c"
+			case buf[i] == 0x1b && i+2 < n && (buf[i+1] == '[' || buf[i+1] == 'O'):
+				switch buf[i+2] {
+				case 'A':
+					keys <- "up"
+				case 'B':
+					keys <- "down"
+				}
+				i += 2
+			default:
+				keys <- string(buf[i])
+			}
+		}
+	}
+}
+
+// key maps a key to an action, moving the selection itself.
+func (m *topModel) key(key string) topAction {
+	switch key {
+	case "q", "ctrl-c":
+		return topQuit
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "down", "j":
+		if m.selected < m.providerCount()-1 {
+			m.selected++
+		}
+	case "r":
+		return topRefreshOne
+	case "R":
+		return topRefreshAll
+	case "o":
+		return topOpenDashboard
+	case "e":
+		return topToggleEnabled
+	case "a":
+		return topToggleAll
+	}
+	return topNone
+}
+
+func (m *topModel) apply(r topResult) {
+	delete(m.refreshing, r.key)
+	if r.err != nil {
+		m.message = "refresh failed: " + r.err.Error()
+	} else if r.key != "" {
+		m.message = "refreshed " + r.key
+	}
+	if r.snapshot != nil {
+		m.setSnapshot(r.snapshot)
+	}
+	if r.statuses != nil {
+		m.statuses = r.statuses
+		m.statusAt = time.Now()
+	}
+	if r.key == "" {
+		m.polledAt = time.Now()
+	}
+}
+
+// setSnapshot shows snapshot in urgency order, keeping the selection on the
+// same source.
+func (m *topModel) setSnapshot(snapshot *StatusSnapshot) {
+	selected := ""
+	if pf := m.selectedProvider(); pf != nil {
+		selected = pf.Name
+	}
+	m.snapshot = snapshot
+	sortProvidersByUrgency(m.snapshot.Output.Providers)
+	for i, pf := range m.snapshot.Output.Providers {
+		if pf.Name == selected {
+			m.selected = i
+		}
+	}
+	m.selected = min(m.selected, max(m.providerCount()-1, 0))
+}
+
+// pollStatuses returns the status pages to show after a poll: those the poll
+// checked, else a check of its own when the last was topStatusInterval ago,
+// else nil to keep showing the last.
+func pollStatuses(ctx context.Context, snapshot *StatusSnapshot, statusAt time.Time, fetch func(context.Context, []string) map[string]*status.ProviderStatus) map[string]*status.ProviderStatus {
+	if snapshot.Statuses != nil {
+		return snapshot.Statuses
+	}
+	if time.Since(statusAt) < topStatusInterval {
+		return nil
+	}
+	return fetch(ctx, snapshotFamilies(snapshot))
+}
+
+func snapshotFamilies(snapshot *StatusSnapshot) []string {
+	seen := map[string]bool{}
+	var families []string
+	for _, pf := range snapshot.Output.Providers {
+		if !seen[pf.Family] {
+			seen[pf.Family] = true
+			families = append(families, pf.Family)
+		}
+	}
+	return families
+}
+
+func (m *topModel) providerCount() int {
+	if m.snapshot == nil || m.snapshot.Output == nil {
+		return 0
+	}
+	return len(m.snapshot.Output.Providers)
+}
+
+func (m *topModel) selectedProvider() *ProviderFormatter {
+	if m.selected < 0 || m.selected >= m.providerCount() {
+		return nil
+	}
+	return &m.snapshot.Output.Providers[m.selected]
+}
+
+func (m *topModel) openDashboard() {
+	pf := m.selectedProvider()
+	if pf == nil {
+		return
+	}
+	p, ok := m.snapshot.Registry.Get(pf.Name)
+	if !ok || p.DashboardURL() == "" {
+		m.message = pf.Display + " has no dashboard"
+		return
+	}
+	if err := browser.OpenURL(p.DashboardURL()); err != nil {
+		m.message = "could not open " + p.DashboardURL()
+		return
+	}
+	m.message = "opened " + p.DashboardURL()
+}
+
+// toggleEnabled enables or disables the selected provider's family in the
+// config, reporting whether it changed.
+func (m *topModel) toggleEnabled() bool {
+	pf := m.selectedProvider()
+	if pf == nil {
+		return false
+	}
+	cfg, err := config.Load(all.SourceValidator())
+	if err != nil {
+		m.message = err.Error()
+		return false
+	}
+	enable := cfg.IsProviderDisabled(pf.Family)
+	cfg.EnsureProvider(pf.Family, enable)
+	if err := cfg.Save(); err != nil {
+		m.message = err.Error()
+		return false
+	}
+	if enable {
+		m.message = "enabled " + pf.Family
+	} else {
+		m.message = "disabled " + pf.Family
+		if !m.showAll {
+			m.message += "; press a to list it again"
+		}
+	}
+	return true
+}
+
+// render draws the whole screen for a terminal of width by height cells.
+func (m *topModel) render(now time.Time, width, height int) []string {
+	header := "clawmeter top"
+	if !m.polledAt.IsZero() {
+		header += " · updated " + m.polledAt.Local().Format("15:04:05")
+	}
+	if m.refreshing[""] {
+		header += " · polling…"
+	} else if !m.nextPoll.IsZero() {
+		header += " · next poll in " + formatCountdown(m.nextPoll.Sub(now))
+	}
+	if m.showAll {
+		header += " · all providers"
+	}
+
+	var body []string
+	selectedLine := 0
+	if m.providerCount() == 0 {
+		body = append(body, "  No providers with usage data yet. Press a to list every provider.")
+	}
+	for i := range m.providerCount() {
+		pf := &m.snapshot.Output.Providers[i]
+		if i == m.selected {
+			selectedLine = len(body)
+		}
+		body = append(body, m.renderProvider(pf, i == m.selected, now)...)
+		body = append(body, "")
+	}
+
+	// Scroll so the selected provider stays in view.
+	room := max(height-4, 1)
+	offset := 0
+	if selectedLine >= room {
+		offset = selectedLine - room + 1
+	}
+	body = body[offset:]
+	if len(body) > room {
+		body = body[:room]
+	}
+
+	lines := make([]string, 0, height)
+	lines = append(lines, "\033[H\033[1m"+header+reset+"\033[K\r\n", "\033[K\r\n")
+	for _, line := range body {
+		lines = append(lines, line+"\033[K\r\n")
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "\033[K\r\n")
+	}
+	lines = append(lines, m.message+"\033[K\r\n")
+	help := topHelp
+	if len([]rune(help)) > width {
+		help = string([]rune(help)[:width])
+	}
+	lines = append(lines, "\033[2m"+help+reset+"\033[K")
+	return lines
+}
+
+func (m *topModel) renderProvider(pf *ProviderFormatter, selected bool, now time.Time) []string {
+	title := "  " + pf.Display
+	if selected {
+		title = "\033[7m▶ " + pf.Display + reset
+	}
+	var notes []string
+	if m.refreshing[pf.Name] {
+		notes = append(notes, "refreshing…")
+	}
+	if st := pf.Status; st != nil || m.statuses[pf.Family] != nil {
+		if st == nil {
+			st = m.statuses[pf.Family]
+		}
+		if st.Indicator.HasIssue() {
+			notes = append(notes, st.FormatCLI())
+		} else if st.Indicator == status.None {
+			notes = append(notes, "\033[2m✓ operational"+reset)
+		}
+	}
+	if m.snapshot.Config != nil && m.snapshot.Config.IsProviderDisabled(pf.Family) {
+		notes = append(notes, "disabled")
+	}
+
+	data := pf.Data
+	switch {
+	case data == nil:
+		notes = append(notes, "no data")
+	case data.IsExpired:
+		notes = append(notes, color(100)+"expired"+reset)
+	case data.Error != "" && !data.HasPresentableUsage():
+		notes = append(notes, color(100)+format.HumanizeError(data.Error)+reset)
+	case data.Stale:
+		notes = append(notes, "\033[33m"+staleSummary(data)+reset)
+	}
+	lines := []string{strings.Join(append([]string{title}, notes...), "  ")}
+	if data == nil || data.IsExpired || (data.Error != "" && !data.HasPresentableUsage()) {
+		return lines
+	}
+
+	windows := data.PresentationWindows()
+	nameWidth := 2
+	for _, w := range windows {
+		nameWidth = max(nameWidth, len(w.Name))
+	}
+	for _, w := range windows {
+		line := fmt.Sprintf("    %-*s %s%s%s %3.0f%%", nameWidth, w.Name, color(w.Utilization), bar(w.Utilization), reset, w.Utilization)
+		if w.ResetsAt.IsZero() {
+			if w.ResetPolicy != "" {
+				line += "  " + w.ResetPolicy
+			}
+			lines = append(lines, line)
+			continue
+		}
+		proj := pf.Project(w)
+		line = fmt.Sprintf("    %-*s %s%s%s %3.0f%%  resets in %-10s %s%s%s",
+			nameWidth, w.Name, color(proj.ProjectedPct), bar(w.Utilization), reset, w.Utilization,
+			formatCountdown(w.ResetsAt.Sub(now)), color(proj.ProjectedPct), proj.PaceIndicator(), reset)
+		lines = append(lines, line)
+	}
+	for _, balance := range data.Balances {
+		label := balance.DisplayName
+		if label == "" {
+			label = balance.Name
+		}
+		lines = append(lines, fmt.Sprintf("    %s: %.2f remaining", label, balance.Remaining))
+	}
+	if summary := resetCreditCompactSummary(data, now); summary != "" {
+		lines = append(lines, "    "+summary)
+	}
+	return lines
+}
+
+// formatCountdown formats a duration to the second for live countdowns:
+// 42m05s, 2h10m05s, or 3d04h10m beyond a day.
+func formatCountdown(d time.Duration) string {
+	d = clampDuration(d)
+	days := d / (24 * time.Hour)
+	hours := (d % (24 * time.Hour)) / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	seconds := (d % time.Minute) / time.Second
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%02dh%02dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh%02dm%02ds", hours, minutes, seconds)
+	default:
+		return fmt.Sprintf("%dm%02ds", minutes, seconds)
+	}
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+func topFixture(now time.Time) *topModel {
+	m := &topModel{refreshing: map[string]bool{}, polledAt: now, nextPoll: now.Add(4*time.Minute + 5*time.Second)}
+	output := statusLineFixture(now)
+	for i := range output.Providers {
+		output.Providers[i].Family = output.Providers[i].Name
+	}
+	m.setSnapshot(&StatusSnapshot{
+		Output: output,
+		Config: &config.Config{Providers: map[string]config.ProviderConfig{"gemini": {Enabled: false}}},
+	})
+	m.statuses = map[string]*status.ProviderStatus{"openai": {Indicator: status.Minor, Description: "Elevated errors"}}
+	return m
+}
+
+func TestTopRendersWindowsCountdownsAndStatus(t *testing.T) {
+	now := time.Now()
+	m := topFixture(now)
+	screen := strings.Join(m.render(now, 120, 40), "")
+
+	for _, want := range []string{
+		"next poll in 4m05s",
+		"▶ Gemini",
+		"token expired",
+		"resets in 2h30m00s",
+		"est. ",
+		"Elevated errors",
+		"Gemini",
+		"disabled",
+		topHelp,
+	} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("screen missing %q:\n%s", want, screen)
+		}
+	}
+	if got := len(m.render(now, 120, 40)); got != 40 {
+		t.Fatalf("rendered %d lines, want the terminal height", got)
+	}
+}
+
+func TestTopKeysMoveSelectionAndMapActions(t *testing.T) {
+	m := topFixture(time.Now())
+	if m.selectedProvider().Name != "gemini" {
+		t.Fatalf("first selection = %s, want the source with an error", m.selectedProvider().Name)
+	}
+	m.key("up")
+	if m.selected != 0 {
+		t.Fatalf("up at the top moved to %d", m.selected)
+	}
+	for range 5 {
+		m.key("j")
+	}
+	if m.selected != m.providerCount()-1 {
+		t.Fatalf("selection = %d, want clamped to the last source", m.selected)
+	}
+	for key, want := range map[string]topAction{
+		"r": topRefreshOne, "R": topRefreshAll, "o": topOpenDashboard,
+		"e": topToggleEnabled, "a": topToggleAll, "q": topQuit, "ctrl-c": topQuit, "x": topNone,
+	} {
+		if got := m.key(key); got != want {
+			t.Fatalf("key %q = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestTopKeepsSelectionAcrossReorders(t *testing.T) {
+	now := time.Now()
+	m := topFixture(now)
+	m.key("down")
+	selected := m.selectedProvider().Name
+
+	output := statusLineFixture(now)
+	output.Providers = append(output.Providers[2:], output.Providers[:2]...)
+	m.apply(topResult{snapshot: &StatusSnapshot{Output: output, Config: &config.Config{}}})
+	if m.selectedProvider().Name != selected {
+		t.Fatalf("selection moved from %s to %s", selected, m.selectedProvider().Name)
+	}
+
+	m.apply(topResult{key: "claude", snapshot: &StatusSnapshot{Output: &MultiProviderOutput{Providers: []ProviderFormatter{
+		{Name: "claude", Display: "Claude", Family: "claude", Data: &provider.UsageData{}},
+	}}}})
+	if m.selected != 0 || m.message != "refreshed claude" {
+		t.Fatalf("after shrinking: selected %d, message %q", m.selected, m.message)
+	}
+}
+
+func TestReadTopKeysDecodesArrows(t *testing.T) {
+	keys := make(chan string, 8)
+	readTopKeys(strings.NewReader("j\x1b[A\x1b[Bq\x03"), keys)
+	close(keys)
+	var got []string
+	for key := range keys {
+		got = append(got, key)
+	}
+	if strings.Join(got, ",") != "j,up,down,q,ctrl-c" {
+		t.Fatalf("keys = %v", got)
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		-time.Second:                                  "0m00s",
+		42*time.Minute + 5*time.Second:                "42m05s",
+		2*time.Hour + 5*time.Second:                   "2h00m05s",
+		3*24*time.Hour + 4*time.Hour + 10*time.Minute: "3d04h10m",
+	} {
+		if got := formatCountdown(d); got != want {
+			t.Errorf("formatCountdown(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestTopPollsReuseCollectedStatusPages(t *testing.T) {
+	checks := 0
+	fetch := func(context.Context, []string) map[string]*status.ProviderStatus {
+		checks++
+		return map[string]*status.ProviderStatus{"openai": {Indicator: status.None}}
+	}
+	fetched := &StatusSnapshot{Output: &MultiProviderOutput{}, Statuses: map[string]*status.ProviderStatus{"openai": {Indicator: status.Minor}}}
+	if got := pollStatuses(context.Background(), fetched, time.Time{}, fetch); got["openai"].Indicator != status.Minor || checks != 0 {
+		t.Fatalf("statuses = %v after %d checks, want the snapshot's", got, checks)
+	}
+
+	cached := &StatusSnapshot{Output: &MultiProviderOutput{}}
+	if got := pollStatuses(context.Background(), cached, time.Now().Add(-time.Minute), fetch); got != nil || checks != 0 {
+		t.Fatalf("statuses = %v after %d checks, want the last check kept", got, checks)
+	}
+	if got := pollStatuses(context.Background(), cached, time.Now().Add(-topStatusInterval), fetch); got == nil || checks != 1 {
+		t.Fatalf("statuses = %v after %d checks, want a new check", got, checks)
+	}
+}
@@ -4,20 +4,31 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
 )
 
 // MinimumPollIntervalSeconds bounds automatic tray polling. Manual refreshes
 // remain available when the user needs an immediate reading.
 const MinimumPollIntervalSeconds = 300
 
+// MinimumCacheTTL bounds cache_ttl overrides so that frequent status calls
+// cannot turn into a provider request each.
+const MinimumCacheTTL = 10 * time.Second
+
 // Config holds the application configuration.
 type Config struct {
 	// Providers configuration - keys are provider names (claude, openai, etc.)
@@ -46,6 +57,97 @@ type ProviderConfig struct {
 	// The credential reference is opaque to the core and interpreted by the
 	// provider adapter that owns it.
 	Sources []SourceConfig `yaml:"sources,omitempty"`
+
+	// Notifications overrides the global notification thresholds for this
+	// provider and its windows.
+	Notifications ProviderNotifications `yaml:"notifications,omitempty"`
+
+	// CacheTTL overrides how long this provider's readings stay fresh in the
+	// shared cache, e.g. "30s", "15m", or "1d". Empty keeps the provider's
+	// own TTL.
+	CacheTTL string `yaml:"cache_ttl,omitempty"`
+
+	// Endpoints declares, by source ID, where the custom provider reads
+	// usage. Other providers ignore it.
+	Endpoints map[string]CustomEndpoint `yaml:"endpoints,omitempty"`
+
+	// Plugins configures, by source ID, how the plugin provider runs each
+	// plugin executable. Other providers ignore it.
+	Plugins map[string]PluginConfig `yaml:"plugins,omitempty"`
+
+	// Budgets sets, by source ID, the monthly spend limit in US dollars that
+	// spend-reporting providers such as anthropic_api measure against. The
+	// providers cannot read an organization's limit, so it is declared here.
+	Budgets map[string]float64 `yaml:"budgets,omitempty"`
+}
+
+// CacheTTL returns the configured cache TTL override for family, or zero when
+// it has none.
+func (c *Config) CacheTTL(family string) time.Duration {
+	d, _ := parseDayDuration(c.Providers[family].CacheTTL)
+	return d
+}
+
+// ValidateCacheTTLs checks every provider's cache_ttl override.
+func (c *Config) ValidateCacheTTLs() error {
+	for family, pc := range c.Providers {
+		if pc.CacheTTL == "" {
+			continue
+		}
+		d, err := parseDayDuration(pc.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("providers.%s.cache_ttl: %w", family, err)
+		}
+		if d < MinimumCacheTTL {
+			return fmt.Errorf("providers.%s.cache_ttl must be at least %s", family, MinimumCacheTTL)
+		}
+	}
+	return nil
+}
+
+// ProviderNotifications holds one provider's threshold overrides. Zero
+// thresholds inherit the global ones.
+type ProviderNotifications struct {
+	Warning  float64 `yaml:"warning,omitempty"`
+	Critical float64 `yaml:"critical,omitempty"`
+	// Windows overrides thresholds by window name ("Premium", "7d Sonnet") or
+	// window type ("5h", "24h", "7d", "monthly"). Names win over types.
+	Windows map[string]WindowNotifications `yaml:"windows,omitempty"`
+}
+
+// WindowNotifications overrides thresholds for one window. Zero thresholds
+// inherit the provider's. In YAML, the scalar "never" sets Never.
+type WindowNotifications struct {
+	Warning  float64 `yaml:"warning,omitempty"`
+	Critical float64 `yaml:"critical,omitempty"`
+	// Never mutes threshold and pace alerts for the window.
+	Never bool `yaml:"never,omitempty"`
+}
+
+// UnmarshalYAML accepts "never" as shorthand for {never: true}.
+func (w *WindowNotifications) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if strings.EqualFold(strings.TrimSpace(node.Value), "never") {
+			*w = WindowNotifications{Never: true}
+			return nil
+		}
+		return fmt.Errorf("line %d: window notifications must be \"never\" or a mapping", node.Line)
+	}
+	type plain WindowNotifications
+	return node.Decode((*plain)(w))
+}
+
+// MarshalYAML writes a muted window as "never".
+func (w WindowNotifications) MarshalYAML() (any, error) {
+	if w.Never {
+		return "never", nil
+	}
+	type plain WindowNotifications
+	return plain(w), nil
+}
+
+func (n ProviderNotifications) isZero() bool {
+	return n.Warning == 0 && n.Critical == 0 && len(n.Windows) == 0
 }
 
 type CredentialRef struct {
@@ -60,6 +162,55 @@ type SourceConfig struct {
 	Credential CredentialRef `yaml:"credential"`
 }
 
+// CustomEndpoint declares the usage endpoint behind one custom provider
+// source. Window and balance fields are path expressions into the JSON
+// response, such as "data.spend" or "budgets.#(name==team).max".
+type CustomEndpoint struct {
+	DisplayName  string `yaml:"display_name,omitempty"`
+	URL          string `yaml:"url"`
+	DashboardURL string `yaml:"dashboard_url,omitempty"`
+	// AuthHeader carries the source credential and defaults to Authorization.
+	// AuthScheme prefixes the credential; it defaults to "Bearer" for the
+	// Authorization header, and "none" sends the bare credential.
+	AuthHeader string          `yaml:"auth_header,omitempty"`
+	AuthScheme string          `yaml:"auth_scheme,omitempty"`
+	Windows    []CustomWindow  `yaml:"windows,omitempty"`
+	Balances   []CustomBalance `yaml:"balances,omitempty"`
+}
+
+// CustomWindow maps part of a custom response to a usage window.
+// Utilization is a 0-100 percentage; without it, Used and Limit give one.
+// ResetsAt reads an RFC 3339 or Unix timestamp, and ResetPolicy (e.g.
+// "monthly") is shown when there is no timestamp.
+type CustomWindow struct {
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name,omitempty"`
+	Utilization string `yaml:"utilization,omitempty"`
+	Used        string `yaml:"used,omitempty"`
+	Limit       string `yaml:"limit,omitempty"`
+	ResetsAt    string `yaml:"resets_at,omitempty"`
+	ResetPolicy string `yaml:"reset_policy,omitempty"`
+}
+
+// CustomBalance maps part of a custom response to a balance. Any two of
+// Total, Used, and Remaining determine the third.
+type CustomBalance struct {
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name,omitempty"`
+	Total       string `yaml:"total,omitempty"`
+	Used        string `yaml:"used,omitempty"`
+	Remaining   string `yaml:"remaining,omitempty"`
+}
+
+// PluginConfig configures one plugin provider source.
+type PluginConfig struct {
+	// Env names the environment variables the plugin receives. Everything
+	// else is withheld apart from a minimal base such as PATH and HOME.
+	Env []string `yaml:"env,omitempty"`
+	// Timeout bounds one usage read, e.g. "10s". Empty uses the default.
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
 // SourceValidator applies provider-owned selector rules without coupling the
 // neutral config package to provider implementations.
 type SourceValidator func(family string, sources []SourceConfig) error
@@ -161,8 +312,207 @@ type GlobalSettings struct {
 	// CheckForUpdates controls automatic GitHub release checks from the tray.
 	CheckForUpdates *bool `yaml:"check_for_updates,omitempty"`
 
+	// UpdateChannel is "stable" (the default) or "prerelease".
+	UpdateChannel string `yaml:"update_channel,omitempty"`
+
+	// PinnedVersion, e.g. "v1.4.2", is the newest release that updates will
+	// offer or install.
+	PinnedVersion string `yaml:"pinned_version,omitempty"`
+
+	// ReleaseURL is a GitHub-compatible releases API base for an internal
+	// mirror. Empty uses GitHub.
+	ReleaseURL string `yaml:"release_url,omitempty"`
+
 	// NotificationThresholds for usage warnings
 	NotificationThresholds NotificationConfig `yaml:"notification_thresholds,omitempty"`
+
+	// Forecast selects how usage is projected to reset.
+	Forecast ForecastConfig `yaml:"forecast,omitempty"`
+
+	// Notifications routes alerts to sinks beyond the tray's desktop
+	// notifications.
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+
+	// QuietHours mutes every alert daily between two local times.
+	QuietHours QuietHoursConfig `yaml:"quiet_hours,omitempty"`
+
+	// Statusline customizes `clawmeter statusline` output.
+	Statusline StatuslineConfig `yaml:"statusline,omitempty"`
+
+	// Tray holds the tray icon's display preferences. The tray saves them as
+	// they are changed from its menu.
+	Tray TrayConfig `yaml:"tray,omitempty"`
+}
+
+// TrayConfig holds tray icon settings.
+type TrayConfig struct {
+	// IconLayout is "single" (the default), which draws the selected window,
+	// or "dual", which adds a bar for a second window of the same provider.
+	IconLayout string `yaml:"icon_layout,omitempty"`
+
+	// IconTarget pins the icon to one window as "<source>/<window>", e.g.
+	// "claude/5h" or "claude:work/7d". Empty lets AutoMode choose.
+	IconTarget string `yaml:"icon_target,omitempty"`
+
+	// AutoMode ranks windows for the automatic icon: "risk" (the default),
+	// "projected", or "runway".
+	AutoMode string `yaml:"auto_mode,omitempty"`
+}
+
+// IconAutoModes are the accepted settings.tray.auto_mode values.
+var IconAutoModes = []string{"risk", "projected", "runway"}
+
+// IconTargetParts splits IconTarget into its source key and window name.
+// Both are empty when no target is pinned or the value is malformed.
+func (t TrayConfig) IconTargetParts() (source, window string) {
+	source, window, ok := strings.Cut(t.IconTarget, "/")
+	if !ok || source == "" || window == "" {
+		return "", ""
+	}
+	return source, window
+}
+
+// Tray icon layouts accepted by settings.tray.icon_layout.
+const (
+	IconLayoutSingle = "single"
+	IconLayoutDual   = "dual"
+)
+
+// StatuslineConfig holds statusline settings.
+type StatuslineConfig struct {
+	// Format is a preset name (e.g. "tmux" or "waybar") or a Go text/template.
+	// Empty keeps the default one-line summary.
+	Format string `yaml:"format,omitempty"`
+}
+
+// QuietHoursConfig is a daily span in local 24-hour "HH:MM" time. A span whose
+// end is before its start crosses midnight, e.g. 22:00 to 07:00.
+type QuietHoursConfig struct {
+	Start string `yaml:"start,omitempty"`
+	End   string `yaml:"end,omitempty"`
+}
+
+// Span returns the quiet hours as offsets from midnight. ok is false when
+// quiet hours are unset or invalid.
+func (q QuietHoursConfig) Span() (start, end time.Duration, ok bool) {
+	if q.Start == "" && q.End == "" {
+		return 0, 0, false
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err = parseClock(q.End)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// NotificationsConfig lists the notification sinks and pace alerts.
+type NotificationsConfig struct {
+	Sinks []NotificationSink `yaml:"sinks,omitempty"`
+
+	// Pace raises alerts from usage projections, keyed by window type: "5h",
+	// "24h", "7d", "30d", or "default" for any type without its own entry.
+	Pace map[string]PaceAlert `yaml:"pace,omitempty"`
+}
+
+// PaceWindowTypes are the keys accepted under notifications.pace.
+var PaceWindowTypes = []string{"5h", "24h", "7d", "30d", "default"}
+
+// PaceAlert configures projection-based alerts for one window type. Either
+// condition raises the alert.
+type PaceAlert struct {
+	// RunsOutEarlyBy alerts when the window is projected to run out at least
+	// this long before it resets, e.g. "30m", "12h", or "1d".
+	RunsOutEarlyBy string `yaml:"runs_out_early_by,omitempty"`
+	// ProjectedPct alerts when projected usage at reset reaches this percent.
+	ProjectedPct float64 `yaml:"projected_pct,omitempty"`
+	// RearmPct is how far the projection must fall below ProjectedPct before
+	// the alert can fire again in the same window. Default: 10.
+	RearmPct float64 `yaml:"rearm_pct,omitempty"`
+}
+
+// EarlyBy returns RunsOutEarlyBy as a duration, or zero when unset or invalid.
+func (p PaceAlert) EarlyBy() time.Duration {
+	d, _ := parseDayDuration(p.RunsOutEarlyBy)
+	return d
+}
+
+// parseDayDuration accepts Go durations plus a whole-day "d" suffix.
+func parseDayDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// Notification sink types.
+const (
+	SinkWebhook = "webhook" // generic JSON POST of the event
+	SinkSlack   = "slack"   // Slack-compatible incoming webhook
+	SinkNtfy    = "ntfy"    // ntfy-style topic POST
+	SinkCommand = "command" // shell command with the event on stdin
+)
+
+// NotificationSink configures one alert destination. Zero thresholds fall back
+// to NotificationThresholds; an empty Providers list matches every provider.
+type NotificationSink struct {
+	Name string `yaml:"name,omitempty"`
+	Type string `yaml:"type"`
+
+	// URL is the webhook or topic URL. URLEnv names an environment variable
+	// holding it instead, for URLs that embed a secret.
+	URL    string `yaml:"url,omitempty"`
+	URLEnv string `yaml:"url_env,omitempty"`
+	// TokenEnv names an environment variable sent as a bearer token.
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// Command is run by the platform shell for command sinks.
+	Command string `yaml:"command,omitempty"`
+
+	Warning  float64 `yaml:"warning,omitempty"`
+	Critical float64 `yaml:"critical,omitempty"`
+
+	// Providers filters alerts to provider families ("claude") or sources
+	// ("claude:work").
+	Providers []string `yaml:"providers,omitempty"`
+}
+
+// Label identifies the sink in logs and errors without exposing its URL.
+func (s NotificationSink) Label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
+}
+
+// ForecastConfig holds projection settings.
+type ForecastConfig struct {
+	// Mode is "average" (the default: the window's average rate so far) or
+	// "recent" (the rate fitted to recently recorded history).
+	Mode string `yaml:"mode,omitempty"`
 }
 
 // NotificationConfig holds notification settings.
@@ -221,6 +571,207 @@ func (c *Config) ShouldCheckForUpdates() bool {
 	return c.Settings.CheckForUpdates == nil || *c.Settings.CheckForUpdates
 }
 
+// UpdateChannels are the accepted settings.update_channel values.
+var UpdateChannels = []string{"stable", "prerelease"}
+
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// ValidateUpdateSettings checks the update channel, pinned version, and
+// release mirror URL.
+func (c *Config) ValidateUpdateSettings() error {
+	s := c.Settings
+	if s.UpdateChannel != "" && !slices.Contains(UpdateChannels, s.UpdateChannel) {
+		return fmt.Errorf("update_channel must be one of %s", strings.Join(UpdateChannels, ", "))
+	}
+	if s.PinnedVersion != "" && !semverPattern.MatchString(s.PinnedVersion) {
+		return fmt.Errorf("pinned_version %q is not a version like v1.2.3", s.PinnedVersion)
+	}
+	if s.ReleaseURL != "" {
+		u, err := url.Parse(s.ReleaseURL)
+		if err != nil || u.Host == "" || u.User != nil || u.RawQuery != "" {
+			return fmt.Errorf("release_url must be an http(s) URL without credentials or query")
+		}
+		host := u.Hostname()
+		loopback := host == "localhost" || net.ParseIP(host).IsLoopback()
+		if u.Scheme != "https" && !(u.Scheme == "http" && loopback) {
+			return fmt.Errorf("release_url must use https unless the host is loopback")
+		}
+	}
+	return nil
+}
+
+// IconLayout returns the configured tray icon layout, treating an empty or
+// unrecognized value as the single-window default.
+func (c *Config) IconLayout() string {
+	if c.Settings.Tray.IconLayout == IconLayoutDual {
+		return IconLayoutDual
+	}
+	return IconLayoutSingle
+}
+
+// IconAutoMode returns the configured tray auto mode, treating an empty or
+// unrecognized value as the default risk mode.
+func (c *Config) IconAutoMode() string {
+	if slices.Contains(IconAutoModes, c.Settings.Tray.AutoMode) {
+		return c.Settings.Tray.AutoMode
+	}
+	return IconAutoModes[0]
+}
+
+// ForecastMode returns the configured projection mode, treating an empty or
+// unrecognized value as the default average mode.
+func (c *Config) ForecastMode() forecast.Mode {
+	mode, ok := forecast.ParseMode(c.Settings.Forecast.Mode)
+	if !ok {
+		return forecast.ModeAverage
+	}
+	return mode
+}
+
+// WindowThresholds returns the notification thresholds for one provider
+// window, resolving each field from the window override, then the provider
+// override, then the global thresholds. never reports a muted window.
+func (c *Config) WindowThresholds(family, window string) (thresholds NotificationConfig, never bool) {
+	thresholds = c.Settings.NotificationThresholds
+	pc, ok := c.Providers[family]
+	if !ok {
+		return thresholds, false
+	}
+	n := pc.Notifications
+	if n.Warning > 0 {
+		thresholds.Warning = n.Warning
+	}
+	if n.Critical > 0 {
+		thresholds.Critical = n.Critical
+	}
+	if w, ok := n.window(window); ok {
+		if w.Never {
+			return thresholds, true
+		}
+		if w.Warning > 0 {
+			thresholds.Warning = w.Warning
+		}
+		if w.Critical > 0 {
+			thresholds.Critical = w.Critical
+		}
+	}
+	return thresholds, false
+}
+
+// window finds the override for a window by its name, then by its type.
+func (n ProviderNotifications) window(name string) (WindowNotifications, bool) {
+	if len(n.Windows) == 0 {
+		return WindowNotifications{}, false
+	}
+	for key, w := range n.Windows {
+		if strings.EqualFold(strings.TrimSpace(key), strings.TrimSpace(name)) {
+			return w, true
+		}
+	}
+	for _, key := range windowTypeKeys(forecast.GuessWindowType(name)) {
+		if w, ok := n.Windows[key]; ok {
+			return w, true
+		}
+	}
+	return WindowNotifications{}, false
+}
+
+// windowTypeKeys names a window length as override keys may spell it.
+func windowTypeKeys(windowLen time.Duration) []string {
+	switch windowLen {
+	case forecast.FiveHourWindow:
+		return []string{"5h"}
+	case forecast.SevenDayWindow:
+		return []string{"7d", "weekly"}
+	case forecast.MonthlyWindow:
+		return []string{"monthly", "30d"}
+	default:
+		return []string{"24h", "daily"}
+	}
+}
+
+// ValidateNotifications rejects sinks that could never deliver, pace alerts
+// that could never fire, unreadable quiet hours, and inverted provider
+// thresholds.
+func (c *Config) ValidateNotifications() error {
+	for family, pc := range c.Providers {
+		n := pc.Notifications
+		if n.isZero() {
+			continue
+		}
+		if err := validateThresholds(n.Warning, n.Critical); err != nil {
+			return fmt.Errorf("providers.%s.notifications: %w", family, err)
+		}
+		for window, w := range n.Windows {
+			if err := validateThresholds(w.Warning, w.Critical); err != nil {
+				return fmt.Errorf("providers.%s.notifications.windows.%s: %w", family, window, err)
+			}
+		}
+	}
+	if q := c.Settings.QuietHours; q.Start != "" || q.End != "" {
+		for _, value := range []string{q.Start, q.End} {
+			if _, err := parseClock(value); err != nil {
+				return fmt.Errorf("quiet_hours: %w", err)
+			}
+		}
+	}
+	for key, pace := range c.Settings.Notifications.Pace {
+		if !slices.Contains(PaceWindowTypes, key) {
+			return fmt.Errorf("notification pace window %q is not one of %s", key, strings.Join(PaceWindowTypes, ", "))
+		}
+		if _, err := parseDayDuration(pace.RunsOutEarlyBy); err != nil {
+			return fmt.Errorf("notification pace %q runs_out_early_by: %w", key, err)
+		}
+		if pace.ProjectedPct < 0 || pace.RearmPct < 0 {
+			return fmt.Errorf("notification pace %q percentages must not be negative", key)
+		}
+	}
+	labels := make(map[string]bool)
+	for i, sink := range c.Settings.Notifications.Sinks {
+		label := sink.Label()
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		// Sent alerts are remembered per sink, so two sinks cannot share a name.
+		if labels[label] {
+			return fmt.Errorf("notification sink name %q is used twice; give each sink a distinct name", label)
+		}
+		labels[label] = true
+		switch sink.Type {
+		case SinkWebhook, SinkSlack, SinkNtfy:
+			if sink.URL == "" && sink.URLEnv == "" {
+				return fmt.Errorf("notification sink %q needs url or url_env", label)
+			}
+			if sink.URL != "" && !strings.HasPrefix(sink.URL, "https://") && !strings.HasPrefix(sink.URL, "http://") {
+				return fmt.Errorf("notification sink %q url must be http or https", label)
+			}
+		case SinkCommand:
+			if strings.TrimSpace(sink.Command) == "" {
+				return fmt.Errorf("notification sink %q needs a command", label)
+			}
+		default:
+			return fmt.Errorf("notification sink %q has unknown type %q (want webhook, slack, ntfy, or command)", label, sink.Type)
+		}
+		if sink.Warning < 0 || sink.Warning > 100 || sink.Critical < 0 || sink.Critical > 100 {
+			return fmt.Errorf("notification sink %q thresholds must be between 0 and 100", label)
+		}
+		if sink.Warning > 0 && sink.Critical > 0 && sink.Critical <= sink.Warning {
+			return fmt.Errorf("notification sink %q critical threshold must be greater than warning", label)
+		}
+	}
+	return nil
+}
+
+func validateThresholds(warning, critical float64) error {
+	if warning < 0 || warning > 100 || critical < 0 || critical > 100 {
+		return errors.New("thresholds must be between 0 and 100")
+	}
+	if warning > 0 && critical > 0 && critical <= warning {
+		return errors.New("critical threshold must be greater than warning")
+	}
+	return nil
+}
+
 func configPath() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
@@ -229,6 +780,16 @@ func configPath() (string, error) {
 	return filepath.Join(dir, "clawmeter", "config.yaml"), nil
 }
 
+// PluginDir is the directory searched for plugin executables by name,
+// besides PATH.
+func PluginDir() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "plugins"), nil
+}
+
 // legacyConfigPath returns the path clawmeter used before it adopted the
 // platform-native config dir: ~/.config/clawmeter/config.yaml on every OS.
 // On Linux this is identical to configPath(); on macOS/Windows it is not,
@@ -278,6 +839,15 @@ func Load(validators ...SourceValidator) (*Config, error) {
 	if err := cfg.ValidateSources(validators...); err != nil {
 		return nil, err
 	}
+	if err := cfg.ValidateNotifications(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateCacheTTLs(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateUpdateSettings(); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
@@ -315,6 +885,15 @@ func (c *Config) Save(validators ...SourceValidator) error {
 	if err := c.ValidateSources(validators...); err != nil {
 		return err
 	}
+	if err := c.ValidateNotifications(); err != nil {
+		return err
+	}
+	if err := c.ValidateCacheTTLs(); err != nil {
+		return err
+	}
+	if err := c.ValidateUpdateSettings(); err != nil {
+		return err
+	}
 	path, err := configPath()
 	if err != nil {
 		return err
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle coalesces the several events one save produces (truncate,
+// write, rename) into a single reload.
+const watchSettle = 250 * time.Millisecond
+
+// Watch calls onChange, from its own goroutine, after the config file is
+// written, replaced, or removed, until ctx is cancelled. It returns once the
+// watch is in place. The directory is watched rather than the file because
+// editors commonly replace the file, and it is created if missing so the
+// first save is seen too.
+func Watch(ctx context.Context, onChange func()) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	return watchFile(ctx, path, watchSettle, onChange)
+}
+
+func watchFile(ctx context.Context, path string, settle time.Duration, onChange func()) error {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch config: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch config: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(settle)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || event.Op == fsnotify.Chmod {
+					continue
+				}
+				timer.Reset(settle)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-timer.C:
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
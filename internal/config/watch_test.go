@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFileReportsSavesOfTheConfigOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clawmeter")
+	path := filepath.Join(dir, "config.yaml")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 8)
+	if err := watchFile(ctx, path, 20*time.Millisecond, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("a write to another file was reported")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// An editor-style save: write a temporary file and rename it over the
+	// config. The burst of events is reported once.
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	for i := 0; i < 2; i++ {
+		if err := os.WriteFile(tmp, []byte("settings:\n  poll_interval: 600\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("saving the config was not reported")
+	}
+	select {
+	case <-changes:
+		t.Fatal("one save was reported twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
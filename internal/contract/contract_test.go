@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -13,10 +15,11 @@ import (
 	"github.com/tnunamak/clawmeter/internal/cli"
 	"github.com/tnunamak/clawmeter/internal/diagnose"
 	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/server"
 )
 
 func TestPublishedSchemasAreJSON(t *testing.T) {
-	for _, name := range []string{"status-v1.schema.json", "diagnose-v1.schema.json"} {
+	for _, name := range []string{"status-v1.schema.json", "diagnose-v1.schema.json", "gate-v1.schema.json"} {
 		data := readRepoFile(t, "docs", "schemas", name)
 		var schema map[string]any
 		if err := json.Unmarshal(data, &schema); err != nil {
@@ -70,6 +73,38 @@ func TestDiagnoseV1FixturesMatchGoContract(t *testing.T) {
 	}
 }
 
+func TestGateV1FixturesMatchGoContract(t *testing.T) {
+	schema := compileSchema(t, "gate-v1.schema.json")
+	for _, name := range []string{"gate-v1-allow.json", "gate-v1-wait.json"} {
+		data := readRepoFile(t, "testdata", "contracts", name)
+		var raw any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := schema.Validate(raw); err != nil {
+			t.Fatalf("%s does not match published schema: %v", name, err)
+		}
+		var output cli.GateDecision
+		if err := json.Unmarshal(data, &output); err != nil {
+			t.Fatal(err)
+		}
+		if output.SchemaVersion != cli.GateSchemaVersion || output.Decision == "" {
+			t.Fatalf("%s: invalid contract spine: %#v", name, output)
+		}
+		if output.Decision == cli.GateWait && output.WaitUntil.IsZero() {
+			t.Fatalf("%s: wait decision without wait_until", name)
+		}
+	}
+
+	var missingWait any
+	if err := json.Unmarshal([]byte(`{"schema_version":1,"decision":"wait","source":"claude","window":"5h","utilization":95,"need":8,"reason":"x"}`), &missingWait); err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(missingWait); err == nil {
+		t.Fatal("schema accepted a wait decision without wait_until")
+	}
+}
+
 func TestEmittedDiagnosticsMatchPublishedSchema(t *testing.T) {
 	now := time.Date(2026, 7, 16, 18, 0, 0, 0, time.UTC)
 	providers := []provider.Provider{
@@ -98,6 +133,63 @@ func TestEmittedDiagnosticsMatchPublishedSchema(t *testing.T) {
 	}
 }
 
+func TestServedDocumentsMatchPublishedSchemas(t *testing.T) {
+	now := time.Now().UTC()
+	usage := func(name, id string, pct float64) *provider.UsageData {
+		return &provider.UsageData{
+			Provider: name, SourceID: id, FetchedAt: now,
+			Windows: []provider.UsageWindow{{Name: "7d", Utilization: pct, ResetsAt: now.Add(time.Hour)}},
+		}
+	}
+	output := &cli.MultiProviderOutput{Providers: []cli.ProviderFormatter{
+		{Name: "openai", Family: "openai", SourceID: "default", Data: usage("openai", "default", 40)},
+		{Name: "claude", Family: "claude", SourceID: "default", Data: usage("claude", "default", 20)},
+		{Name: "claude:work", Family: "claude", SourceID: "work", SourceLabel: "Work", Data: usage("claude", "work", 70)},
+		{Name: "gemini", Family: "gemini", SourceID: "default", Data: &provider.UsageData{Provider: "gemini", FetchedAt: now, Error: "Authentication failed."}},
+	}}
+	providers := []provider.Provider{
+		&contractProvider{name: "openai", ready: true},
+		&contractProvider{name: "gemini", ready: true},
+		&contractProvider{name: "skipped", ready: false},
+	}
+	readings := map[string]*provider.UsageData{"openai": output.Providers[0].Data, "gemini": output.Providers[3].Data}
+	snapshot := &server.Snapshot{
+		Status: output.JSONDocument(nil),
+		Diagnose: diagnose.Summarize(providers,
+			func(p provider.Provider) *provider.UsageData { return readings[p.Name()] },
+			func(string) string { return "detected" },
+		),
+	}
+	poller := server.NewPoller(func(context.Context) (*server.Snapshot, error) { return snapshot, nil }, time.Minute)
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler := server.Handler(poller)
+
+	statusSchema := compileSchema(t, "status-v1.schema.json")
+	diagnoseSchema := compileSchema(t, "diagnose-v1.schema.json")
+	for path, schema := range map[string]*jsonschema.Schema{
+		"/status":                statusSchema,
+		"/providers/openai":      statusSchema,
+		"/providers/claude":      statusSchema,
+		"/providers/claude:work": statusSchema,
+		"/diagnose":              diagnoseSchema,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body.String())
+		}
+		var raw any
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if err := schema.Validate(raw); err != nil {
+			t.Fatalf("%s does not match published schema: %v\n%s", path, err, rec.Body.String())
+		}
+	}
+}
+
 func TestDiagnoseSchemaRejectsBrokenSpineButAllowsExtensions(t *testing.T) {
 	schema := compileSchema(t, "diagnose-v1.schema.json")
 	base := map[string]any{
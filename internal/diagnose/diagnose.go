@@ -118,6 +118,66 @@ func runOne(
 	return diagnostic
 }
 
+// Summarize diagnoses providers from readings a shared poller already fetched
+// instead of probing them again. usage returns the latest reading for a
+// provider source, or nil when that source was not polled.
+func Summarize(
+	providers []provider.Provider,
+	usage func(provider.Provider) *provider.UsageData,
+	pollingState func(string) string,
+) Output {
+	out := Output{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now(),
+		Diagnostics:   make([]Diagnostic, len(providers)),
+	}
+	for i, p := range providers {
+		setup := provider.GetSetupStatus(p)
+		diagnostic := Diagnostic{
+			Provider:     p.Name(),
+			Maturity:     provider.GetMaturity(p.Name()),
+			Setup:        Setup{State: setup.State, Detail: safeSetupDetail(setup.State)},
+			PollingState: pollingState(p.Name()),
+			Probe:        Probe{Outcome: "skipped"},
+		}
+		data := usage(p)
+		switch {
+		case !setup.IsReady():
+			diagnostic.Probe.Message = "Provider setup is not ready."
+		case data == nil:
+			diagnostic.Probe.Message = "Provider is not enabled for polling."
+		default:
+			diagnostic.Probe, diagnostic.Usage = summarizeReading(data)
+		}
+		out.Diagnostics[i] = diagnostic
+	}
+	return out
+}
+
+func summarizeReading(data *provider.UsageData) (Probe, *UsageSummary) {
+	result := Probe{Attempted: true}
+	if data.IsExpired {
+		result.Outcome = "error"
+		result.ErrorCategory = "auth"
+		result.Message = safeMessage("auth")
+		return result, nil
+	}
+	if data.Error != "" && !data.HasPresentableUsage() {
+		result.Outcome = "error"
+		result.ErrorCategory, result.Message = safeError(data.Error)
+		return result, nil
+	}
+	// Stale readings are the last good data after a failed refresh; report
+	// the failure but keep the summary, which is marked stale.
+	if data.Stale {
+		result.Outcome = "error"
+		result.ErrorCategory, result.Message = safeError(data.Warning)
+		return result, summarizeUsage(data)
+	}
+	result.Outcome = "success"
+	return result, summarizeUsage(data)
+}
+
 func safeSetupDetail(state provider.SetupState) string {
 	switch state {
 	case provider.SetupReady:
@@ -153,3 +153,39 @@ func TestSafeErrorCategories(t *testing.T) {
 		}
 	}
 }
+
+func TestSummarizeUsesPolledReadingsWithoutProbing(t *testing.T) {
+	reset := time.Date(2026, 7, 20, 12, 0, 0, 0, time.UTC)
+	healthy := &fakeProvider{name: "openai", setup: provider.SetupStatus{State: provider.SetupReady}}
+	stale := &fakeProvider{name: "claude", setup: provider.SetupStatus{State: provider.SetupReady}}
+	unpolled := &fakeProvider{name: "gemini", setup: provider.SetupStatus{State: provider.SetupReady}}
+	readings := map[string]*provider.UsageData{
+		"openai": {Provider: "openai", Windows: []provider.UsageWindow{{Name: "7d", Utilization: 40, ResetsAt: reset}}},
+		"claude": {Provider: "claude", Stale: true, Warning: "HTTP 429 for user@example.com", Windows: []provider.UsageWindow{{Name: "5h", Utilization: 12}}},
+	}
+
+	out := Summarize(
+		[]provider.Provider{healthy, stale, unpolled},
+		func(p provider.Provider) *provider.UsageData { return readings[p.Name()] },
+		func(string) string { return "detected" },
+	)
+	if healthy.fetchCalls+stale.fetchCalls+unpolled.fetchCalls != 0 {
+		t.Fatal("Summarize must not probe providers")
+	}
+	if got := out.Diagnostics[0]; got.Probe.Outcome != "success" || got.Usage == nil || got.Usage.Windows[0].Utilization != 40 {
+		t.Fatalf("healthy diagnostic = %#v", got)
+	}
+	if got := out.Diagnostics[1]; got.Probe.Outcome != "error" || got.Probe.ErrorCategory != "rate_limited" || got.Usage == nil || !got.Usage.Stale {
+		t.Fatalf("stale diagnostic = %#v", got)
+	}
+	if got := out.Diagnostics[2]; got.Probe.Attempted || got.Probe.Outcome != "skipped" {
+		t.Fatalf("unpolled diagnostic = %#v", got)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "user@example.com") {
+		t.Fatalf("summary leaked raw warning: %s", data)
+	}
+}
@@ -0,0 +1,552 @@
+// Package engine runs Clawmeter's background polling independently of any
+// frontend. It fetches configured providers, honors FailureGate backoff,
+// falls back to last good data on transient failures, writes the usage cache
+// and history, and hands each refresh to the alert dispatcher.
+//
+// The tray and `clawmeter watch` are both frontends of one Engine.
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/history"
+	"github.com/tnunamak/clawmeter/internal/notifier"
+	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+const (
+	// FetchTimeout bounds one round of provider requests.
+	FetchTimeout = 30 * time.Second
+	// StatusInterval is how often status pages are checked. They change
+	// slowly and are not worth a request every poll.
+	StatusInterval = 15 * time.Minute
+	statusTimeout  = 15 * time.Second
+	sendTimeout    = 30 * time.Second
+)
+
+// PollInterval converts a configured poll_interval to a duration, enforcing
+// the minimum automatic polling interval.
+func PollInterval(seconds int) time.Duration {
+	interval := time.Duration(seconds) * time.Second
+	minimum := time.Duration(config.MinimumPollIntervalSeconds) * time.Second
+	if interval < minimum {
+		return minimum
+	}
+	return interval
+}
+
+// Engine owns provider polling state shared across refreshes.
+type Engine struct {
+	gate   *provider.FailureGate
+	alerts *notifier.Dispatcher
+
+	// Logf reports provider and delivery failures. It defaults to log.Printf.
+	Logf func(format string, args ...any)
+
+	deliveries   sync.WaitGroup
+	refreshMu    sync.Mutex // one refresh at a time
+	mu           sync.Mutex
+	registry     *provider.Registry
+	intervals    chan time.Duration
+	results      map[string]*provider.UsageData
+	revisions    map[string]string
+	statuses     map[string]*status.ProviderStatus
+	refreshedAt  time.Time
+	forecastMode atomic.Value // forecast.Mode
+	estimator    atomic.Pointer[forecast.Estimator]
+	cfg          atomic.Pointer[config.Config] // for cache TTL overrides
+}
+
+// New returns an engine polling registry and reporting to alerts, which may be
+// nil when the frontend does not notify.
+func New(registry *provider.Registry, alerts *notifier.Dispatcher) *Engine {
+	e := &Engine{
+		registry:  registry,
+		gate:      provider.NewFailureGate(),
+		alerts:    alerts,
+		intervals: make(chan time.Duration, 1),
+		Logf:      log.Printf,
+	}
+	e.forecastMode.Store(forecast.ModeAverage)
+	return e
+}
+
+// SetForecastMode selects the projection mode used for alerts and by
+// Estimator. It takes effect at the next refresh.
+func (e *Engine) SetForecastMode(mode forecast.Mode) {
+	e.forecastMode.Store(mode)
+}
+
+// SetCacheTTLs takes the per-provider cache_ttl overrides from cfg, which
+// decide whether another process's cached readings are fresh enough to use.
+func (e *Engine) SetCacheTTLs(cfg *config.Config) {
+	e.cfg.Store(cfg)
+}
+
+// Registry returns the registry the engine polls.
+func (e *Engine) Registry() *provider.Registry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.registry
+}
+
+// SetRegistry replaces the polled registry after a config change. Backoff and
+// last good results are keyed by source, so unchanged sources keep both;
+// results of sources no longer registered are dropped, and a source whose
+// revision changed starts afresh at the next refresh as usual.
+func (e *Engine) SetRegistry(registry *provider.Registry) {
+	keys := make(map[string]bool)
+	for _, p := range registry.GetAll() {
+		keys[provider.SourceKey(p)] = true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.registry = registry
+	results := make(map[string]*provider.UsageData, len(e.results))
+	for name, data := range e.results {
+		if keys[name] {
+			results[name] = data
+		}
+	}
+	e.results = results
+}
+
+// SetPollInterval changes the interval of a running Run loop, which restarts
+// its wait from the change.
+func (e *Engine) SetPollInterval(interval time.Duration) {
+	select {
+	case <-e.intervals:
+	default:
+	}
+	e.intervals <- interval
+}
+
+// Estimator returns the forecast estimator loaded at the last refresh. A nil
+// engine or average mode returns nil, which projects with the average rate.
+func (e *Engine) Estimator() *forecast.Estimator {
+	if e == nil {
+		return nil
+	}
+	return e.estimator.Load()
+}
+
+// Restore seeds the engine from a cache entry so the first refresh can fall
+// back to it, and returns the cached results that still belong to the
+// registered sources. It only uses registered names, so it never probes
+// credentials.
+func (e *Engine) Restore(entry *cache.Entry) map[string]*provider.UsageData {
+	providers := e.Registry().GetAll()
+	restored := CachedResultsForCurrentSources(entry, providers)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.results = restored
+	e.revisions = SourceRevisions(providers)
+	e.refreshedAt = entry.FetchedAt
+	return restored
+}
+
+// Refresh fetches every configured provider except those in backoff (unless
+// force is set), then writes the cache and history. It returns false without
+// fetching when another refresh is already running.
+func (e *Engine) Refresh(ctx context.Context, force bool) (*provider.MultiFetchResult, bool) {
+	if !e.refreshMu.TryLock() {
+		return nil, false
+	}
+	defer e.refreshMu.Unlock()
+
+	configured := e.Registry().GetConfigured()
+	currentRevisions := SourceRevisions(configured)
+
+	// Hold the shared refresh lock so CLI invocations wait for this round of
+	// provider requests instead of starting their own. If another process
+	// refreshed while this one waited, use its result, unless the user asked
+	// for a fetch of our own.
+	waitStart := time.Now()
+	lock, _ := cache.LockRefresh(ctx, cache.RefreshWait)
+	defer lock.Unlock()
+
+	e.mu.Lock()
+	priorResults := resultsMatchingSourceRevisions(e.results, e.revisions, currentRevisions)
+	toFetch, skipped := splitProvidersForRefresh(configured, e.gate, priorResults, force)
+	priorRevisions := cloneSourceRevisions(e.revisions)
+	e.mu.Unlock()
+
+	if !force {
+		if shared := e.adoptSharedRefresh(configured, currentRevisions, waitStart); shared != nil {
+			e.applyFailureGate(shared, nil, priorResults, priorRevisions)
+			e.loadEstimator()
+			e.setResults(shared)
+			return shared, true
+		}
+	}
+
+	// Credential discovery may recover allowlisted variables through a login
+	// shell. Start the network deadline afterward so discovery latency cannot
+	// leave every provider with an already-expired context.
+	fetchCtx, cancel := context.WithTimeout(ctx, FetchTimeout)
+	defer cancel()
+
+	result := provider.FetchProvidersParallel(fetchCtx, toFetch)
+
+	// Merge in cached data for backed-off providers
+	for name, cached := range skipped {
+		result.Results[name] = cached
+		if revision := priorRevisions[name]; revision != "" {
+			result.SourceRevisions[name] = revision
+		}
+	}
+
+	e.applyFailureGate(result, skipped, priorResults, priorRevisions)
+
+	_ = cache.WriteEntry(cacheEntry(result, skipped))
+	_ = history.Record(result)
+	e.loadEstimator()
+	e.setResults(result)
+	return result, true
+}
+
+// applyFailureGate records each fetched source's success or failure with the
+// FailureGate and, where a failure should not surface yet, keeps showing the
+// source's prior reading marked stale. Sources in skipped were not fetched.
+func (e *Engine) applyFailureGate(result *provider.MultiFetchResult, skipped, priorResults map[string]*provider.UsageData, priorRevisions map[string]string) {
+	for name, data := range result.Results {
+		if _, wasSkipped := skipped[name]; wasSkipped {
+			continue // already using cached data
+		}
+		if data == nil {
+			continue
+		}
+		if data.Error != "" {
+			e.Logf("provider refresh failed: provider=%s error=%s", name, data.Error)
+		}
+
+		if data.Error == "" && !data.IsExpired {
+			e.gate.RecordSuccess(name)
+			continue
+		}
+		// Provider errored — keep showing last good windows, but label them
+		// stale so a frontend never turns unavailable data into a clean 0%.
+		hasPrior := false
+		if prev, ok := priorResults[name]; ok && prev != nil && prev.HasPresentableUsage() && cache.SourceRevisionMatches(priorRevisions, name, result.SourceRevisions[name]) {
+			hasPrior = true
+		}
+		if data.InvalidatesPriorUsage {
+			_ = e.gate.ShouldSurfaceError(name, hasPrior)
+		} else if hasPrior && !data.HasPresentableUsage() {
+			prev := priorResults[name].Clone()
+			prev.MarkStale(data.Error)
+			result.Results[name] = prev
+			_ = e.gate.ShouldSurfaceError(name, true)
+		} else if !e.gate.ShouldSurfaceError(name, hasPrior) {
+			// First failure with prior data — keep showing cache silently.
+			if prev, ok := priorResults[name]; ok && prev != nil && cache.SourceRevisionMatches(priorRevisions, name, result.SourceRevisions[name]) {
+				cached := prev.Clone()
+				cached.MarkStale(data.Error)
+				result.Results[name] = cached
+			}
+		}
+	}
+}
+
+// cacheEntry returns the cache entry for result. Sources in skipped were not
+// fetched this round, so they keep the reading and fetch time already cached
+// for them; only a source the cache lacks is written from skipped, with its
+// reading's own fetch time.
+func cacheEntry(result *provider.MultiFetchResult, skipped map[string]*provider.UsageData) *cache.Entry {
+	if len(skipped) == 0 {
+		return cache.NewEntry(result)
+	}
+	fetched := *result
+	fetched.Results = make(map[string]*provider.UsageData, len(result.Results))
+	for name, data := range result.Results {
+		if _, ok := skipped[name]; !ok {
+			fetched.Results[name] = data
+		}
+	}
+	prev, _ := cache.Read()
+	var keep []string
+	for name := range skipped {
+		if prev != nil && cache.SourceRevisionMatches(prev.SourceRevisions, name, result.SourceRevisions[name]) {
+			keep = append(keep, name)
+		}
+	}
+	entry := prev.Merge(&fetched, keep)
+	for name, data := range skipped {
+		if _, ok := entry.ProviderData[name]; ok {
+			continue
+		}
+		entry.ProviderData[name] = data
+		entry.SourceFetchedAt[name] = data.FetchedAt
+		if data.FetchedAt.IsZero() {
+			entry.SourceFetchedAt[name] = result.FetchedAt
+		}
+	}
+	return entry
+}
+
+func (e *Engine) setResults(result *provider.MultiFetchResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.results = result.Results
+	e.revisions = result.SourceRevisions
+	e.refreshedAt = time.Now()
+}
+
+// adoptSharedRefresh returns the cache another process wrote since waitStart
+// as this refresh's result, provided it holds a reading of every configured
+// source as currently enrolled, each within its own TTL and none of them
+// stale fallback data.
+func (e *Engine) adoptSharedRefresh(configured []provider.Provider, revisions map[string]string, waitStart time.Time) *provider.MultiFetchResult {
+	if !cache.WrittenSince(waitStart) {
+		return nil
+	}
+	entry, err := cache.Read()
+	keys := ProviderKeys(configured)
+	if err != nil || !entry.CoversCurrent(keys, revisions) || entry.HasStaleData(keys) {
+		return nil
+	}
+	cfg := e.cfg.Load()
+	ttls := make(map[string]time.Duration, len(configured))
+	for _, p := range configured {
+		ttls[provider.SourceKey(p)] = cache.SourceTTL(p, cfg)
+	}
+	if expired := entry.Expired(keys, func(name string) time.Duration { return ttls[name] }); len(expired) > 0 {
+		return nil
+	}
+	return &provider.MultiFetchResult{
+		Results:         CachedResultsForCurrentSources(entry, configured),
+		SourceRevisions: revisions,
+		Errors:          map[string]error{},
+		FetchedAt:       entry.FetchedAt,
+	}
+}
+
+// RefreshStatus checks status pages for the configured providers.
+func (e *Engine) RefreshStatus(ctx context.Context) map[string]*status.ProviderStatus {
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+	statuses := status.FetchAll(ctx, ProviderNames(e.Registry().GetConfigured()))
+	e.mu.Lock()
+	e.statuses = statuses
+	e.mu.Unlock()
+	return statuses
+}
+
+// Results returns the latest results and when they were fetched.
+func (e *Engine) Results() (map[string]*provider.UsageData, time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.results, e.refreshedAt
+}
+
+// Statuses returns the last status-page check, or nil before the first.
+func (e *Engine) Statuses() map[string]*status.ProviderStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.statuses
+}
+
+// Notify hands an observation to the alert dispatcher and delivers whatever
+// it triggers in the background, so a slow sink never delays a frontend.
+func (e *Engine) Notify(obs notifier.Observation) {
+	if e.alerts == nil {
+		return
+	}
+	if obs.Estimator == nil {
+		obs.Estimator = e.Estimator()
+	}
+	alerts := e.alerts.Observe(obs)
+	if len(alerts) == 0 {
+		return
+	}
+	e.deliveries.Add(1)
+	go func() {
+		defer e.deliveries.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := e.alerts.Send(ctx, alerts); err != nil {
+			e.Logf("notification delivery failed: %v", err)
+		}
+	}()
+}
+
+// Wait blocks until alerts handed off by Notify have been delivered.
+func (e *Engine) Wait() {
+	e.deliveries.Wait()
+}
+
+// Poll refreshes and notifies on every result, naming sources as
+// DisplayNames does. Frontends that hide some sources call Refresh and Notify
+// themselves.
+func (e *Engine) Poll(ctx context.Context) (*provider.MultiFetchResult, bool) {
+	result, ok := e.Refresh(ctx, false)
+	if !ok {
+		return nil, false
+	}
+	e.Notify(notifier.Observation{
+		Results:      result.Results,
+		Statuses:     e.Statuses(),
+		DisplayNames: DisplayNames(e.Registry().GetAll()),
+	})
+	return result, true
+}
+
+// Run checks status pages and polls now, then polls every interval and checks
+// status pages every StatusInterval until ctx is cancelled. onRefresh, if set,
+// is called after each poll. SetPollInterval changes the interval.
+func (e *Engine) Run(ctx context.Context, interval time.Duration, onRefresh func(*provider.MultiFetchResult)) {
+	poll := func() {
+		if result, ok := e.Poll(ctx); ok && onRefresh != nil {
+			onRefresh(result)
+		}
+	}
+
+	e.RefreshStatus(ctx)
+	poll()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	statusTicker := time.NewTicker(StatusInterval)
+	defer statusTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			poll()
+		case interval := <-e.intervals:
+			ticker.Reset(interval)
+		case <-statusTicker.C:
+			e.RefreshStatus(ctx)
+		}
+	}
+}
+
+// loadEstimator reloads recorded history for the configured forecast mode.
+// Unreadable history degrades to average-rate projections.
+func (e *Engine) loadEstimator() {
+	mode, _ := e.forecastMode.Load().(forecast.Mode)
+	estimator, err := history.LoadEstimator(mode)
+	if err != nil {
+		e.Logf("forecast history: %v", err)
+		estimator = nil
+	}
+	e.estimator.Store(estimator)
+}
+
+// DisplayNames maps each provider's source key to the name shown to users,
+// adding the source label when a family has several sources.
+func DisplayNames(providers []provider.Provider) map[string]string {
+	counts := make(map[string]int)
+	for _, p := range providers {
+		counts[p.Name()]++
+	}
+	names := make(map[string]string, len(providers))
+	for _, p := range providers {
+		names[provider.SourceKey(p)] = DisplayName(p, counts[p.Name()] > 1)
+	}
+	return names
+}
+
+// DisplayName returns p's display name, qualified by its source label or ID
+// when repeated is set.
+func DisplayName(p provider.Provider, repeated bool) string {
+	displayName := p.DisplayName()
+	label := provider.SourceLabel(p)
+	if label == "" {
+		label = provider.SourceID(p)
+	}
+	if repeated && label != "" {
+		displayName += " · " + label
+	}
+	return displayName
+}
+
+// ProviderNames returns each provider's family name.
+func ProviderNames(providers []provider.Provider) []string {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// ProviderKeys returns the source key of each provider.
+func ProviderKeys(providers []provider.Provider) []string {
+	keys := make([]string, 0, len(providers))
+	for _, p := range providers {
+		keys = append(keys, provider.SourceKey(p))
+	}
+	return keys
+}
+
+// SourceRevisions returns the source-revision fingerprint of each provider
+// that has one, keyed by source key.
+func SourceRevisions(providers []provider.Provider) map[string]string {
+	revisions := make(map[string]string)
+	for _, p := range providers {
+		if revision := provider.SourceRevision(p); revision != "" {
+			revisions[provider.SourceKey(p)] = revision
+		}
+	}
+	return revisions
+}
+
+// CachedResultsForCurrentSources returns the cached results whose source
+// revision still matches the registered provider, so cached data is never
+// shown for a different account.
+func CachedResultsForCurrentSources(entry *cache.Entry, providers []provider.Provider) map[string]*provider.UsageData {
+	current := SourceRevisions(providers)
+	results := make(map[string]*provider.UsageData)
+	for _, p := range providers {
+		name := provider.SourceKey(p)
+		if !cache.SourceRevisionMatches(entry.SourceRevisions, name, current[name]) {
+			continue
+		}
+		if data, ok := entry.ProviderData[name]; ok {
+			results[name] = data
+		}
+	}
+	return results
+}
+
+func cloneSourceRevisions(revisions map[string]string) map[string]string {
+	cloned := make(map[string]string, len(revisions))
+	for name, revision := range revisions {
+		cloned[name] = revision
+	}
+	return cloned
+}
+
+func resultsMatchingSourceRevisions(results map[string]*provider.UsageData, previous, current map[string]string) map[string]*provider.UsageData {
+	matched := make(map[string]*provider.UsageData, len(results))
+	for name, data := range results {
+		if cache.SourceRevisionMatches(previous, name, current[name]) {
+			matched[name] = data
+		}
+	}
+	return matched
+}
+
+func splitProvidersForRefresh(providers []provider.Provider, gate *provider.FailureGate, lastResults map[string]*provider.UsageData, force bool) ([]provider.Provider, map[string]*provider.UsageData) {
+	toFetch := make([]provider.Provider, 0, len(providers))
+	skipped := make(map[string]*provider.UsageData)
+	for _, p := range providers {
+		name := provider.SourceKey(p)
+		prev := lastResults[name]
+		if !force && gate != nil && gate.InBackoff(name) && prev != nil && prev.EstablishesPrimaryUIHistory() {
+			skipped[name] = prev.Clone()
+			continue
+		}
+		toFetch = append(toFetch, p)
+	}
+	return toFetch, skipped
+}
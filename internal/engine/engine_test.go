@@ -0,0 +1,433 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/notifier"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+type sourceTestProvider struct{ id, revision string }
+
+func (p sourceTestProvider) Name() string           { return "claude" }
+func (p sourceTestProvider) DisplayName() string    { return "Claude" }
+func (p sourceTestProvider) Description() string    { return "" }
+func (p sourceTestProvider) DashboardURL() string   { return "" }
+func (p sourceTestProvider) IsConfigured() bool     { return true }
+func (p sourceTestProvider) SourceID() string       { return p.id }
+func (p sourceTestProvider) SourceLabel() string    { return p.id }
+func (p sourceTestProvider) SourceRevision() string { return p.revision }
+func (p sourceTestProvider) FetchUsage(context.Context) (*provider.UsageData, error) {
+	return nil, nil
+}
+
+type stubProvider struct {
+	name string
+}
+
+func (p stubProvider) Name() string         { return p.name }
+func (p stubProvider) DisplayName() string  { return p.name }
+func (p stubProvider) Description() string  { return "" }
+func (p stubProvider) DashboardURL() string { return "" }
+func (p stubProvider) IsConfigured() bool   { return true }
+func (p stubProvider) FetchUsage(context.Context) (*provider.UsageData, error) {
+	return &provider.UsageData{Provider: p.name}, nil
+}
+
+func TestCacheAndPriorResultsRequireMatchingSourceRevision(t *testing.T) {
+	data := &provider.UsageData{Provider: "claude", SourceID: "default", Windows: []provider.UsageWindow{{Name: "5h", ResetsAt: time.Now().Add(time.Hour)}}}
+	entry := &cache.Entry{
+		ProviderData:    map[string]*provider.UsageData{"claude": data},
+		SourceRevisions: map[string]string{"claude": "old-profile"},
+	}
+
+	if got := CachedResultsForCurrentSources(entry, []provider.Provider{sourceTestProvider{id: "default", revision: "new-profile"}}); len(got) != 0 {
+		t.Fatalf("startup cache crossed profile revisions: %#v", got)
+	}
+	if got := CachedResultsForCurrentSources(entry, []provider.Provider{sourceTestProvider{id: "default"}}); len(got) != 0 {
+		t.Fatalf("revisioned explicit cache survived switch to native default: %#v", got)
+	}
+	if got := CachedResultsForCurrentSources(entry, []provider.Provider{sourceTestProvider{id: "default", revision: "old-profile"}}); got["claude"] != data {
+		t.Fatalf("matching source revision was not restored: %#v", got)
+	}
+
+	prior := map[string]*provider.UsageData{"claude": data}
+	if got := resultsMatchingSourceRevisions(prior, map[string]string{"claude": "old-profile"}, map[string]string{"claude": "new-profile"}); len(got) != 0 {
+		t.Fatalf("refresh prior data crossed profile revisions: %#v", got)
+	}
+}
+
+func TestBackedOffProviderWithoutPriorWindowsStillFetches(t *testing.T) {
+	gate := provider.NewFailureGate()
+	_ = gate.ShouldSurfaceError("openai", false)
+
+	toFetch, skipped := splitProvidersForRefresh(
+		[]provider.Provider{stubProvider{name: "openai"}},
+		gate,
+		map[string]*provider.UsageData{},
+		false,
+	)
+
+	if len(skipped) != 0 {
+		t.Fatalf("skipped = %v, want none", skipped)
+	}
+	if got := ProviderNames(toFetch); len(got) != 1 || got[0] != "openai" {
+		t.Fatalf("toFetch = %v, want [openai]", got)
+	}
+}
+
+func TestBackedOffProviderWithPriorWindowsUsesClone(t *testing.T) {
+	gate := provider.NewFailureGate()
+	_ = gate.ShouldSurfaceError("openai", true)
+	prev := &provider.UsageData{
+		Provider: "openai",
+		Windows: []provider.UsageWindow{
+			{Name: "7d", Utilization: 25, ResetsAt: time.Now().Add(24 * time.Hour)},
+		},
+	}
+
+	toFetch, skipped := splitProvidersForRefresh(
+		[]provider.Provider{stubProvider{name: "openai"}},
+		gate,
+		map[string]*provider.UsageData{"openai": prev},
+		false,
+	)
+
+	if len(toFetch) != 0 {
+		t.Fatalf("toFetch = %v, want none", ProviderNames(toFetch))
+	}
+	got := skipped["openai"]
+	if got == nil {
+		t.Fatal("skipped[openai] is nil, want cached usage")
+	}
+	if got == prev {
+		t.Fatal("skipped data aliases prior result, want clone")
+	}
+	got.Windows[0].Utilization = 99
+	if prev.Windows[0].Utilization != 25 {
+		t.Fatalf("mutating skipped clone changed prior result to %.0f", prev.Windows[0].Utilization)
+	}
+}
+
+func TestForceRefreshIgnoresBackoff(t *testing.T) {
+	gate := provider.NewFailureGate()
+	_ = gate.ShouldSurfaceError("openai", true)
+
+	toFetch, skipped := splitProvidersForRefresh(
+		[]provider.Provider{stubProvider{name: "openai"}},
+		gate,
+		map[string]*provider.UsageData{
+			"openai": {
+				Provider: "openai",
+				Windows:  []provider.UsageWindow{{Name: "7d", ResetsAt: time.Now().Add(24 * time.Hour)}},
+			},
+		},
+		true,
+	)
+
+	if len(skipped) != 0 {
+		t.Fatalf("skipped = %v, want none", skipped)
+	}
+	if got := ProviderNames(toFetch); len(got) != 1 || got[0] != "openai" {
+		t.Fatalf("toFetch = %v, want [openai]", got)
+	}
+}
+
+func TestPollIntervalEnforcesFiveMinuteFloor(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:   5 * time.Minute,
+		60:  5 * time.Minute,
+		299: 5 * time.Minute,
+		300: 5 * time.Minute,
+		600: 10 * time.Minute,
+	}
+	for configured, want := range tests {
+		if got := PollInterval(configured); got != want {
+			t.Fatalf("PollInterval(%d) = %s, want %s", configured, got, want)
+		}
+	}
+}
+
+type flakyProvider struct {
+	stubProvider
+	calls int
+}
+
+func (p *flakyProvider) FetchUsage(context.Context) (*provider.UsageData, error) {
+	p.calls++
+	if p.calls > 1 {
+		return nil, errors.New("HTTP 502")
+	}
+	return &provider.UsageData{
+		Provider:  p.name,
+		FetchedAt: time.Now(),
+		Windows:   []provider.UsageWindow{{Name: "7d", Utilization: 85, ResetsAt: time.Now().Add(24 * time.Hour)}},
+	}, nil
+}
+
+func TestRefreshFallsBackToLastGoodDataAndNotifiesOnce(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	registry := provider.NewRegistry()
+	flaky := &flakyProvider{stubProvider: stubProvider{name: "openai"}}
+	if err := registry.Register(flaky); err != nil {
+		t.Fatal(err)
+	}
+	sink := &countingSink{sent: make(chan notifier.Event, 4)}
+	e := New(registry, notifier.NewDispatcher([]notifier.Rule{{Sink: sink, Thresholds: notifier.Thresholds{Warning: 80, Critical: 95}}}))
+	e.Logf = t.Logf
+
+	var refreshes []*provider.MultiFetchResult
+	for range 2 {
+		result, ok := e.Refresh(context.Background(), false)
+		if !ok {
+			t.Fatal("Refresh reported a concurrent refresh")
+		}
+		e.Notify(notifier.Observation{Results: result.Results})
+		refreshes = append(refreshes, result)
+	}
+
+	if got := refreshes[0].Results["openai"]; got.Stale || got.Windows[0].Utilization != 85 {
+		t.Fatalf("first refresh = %#v", got)
+	}
+	got := refreshes[1].Results["openai"]
+	if !got.Stale || len(got.Windows) != 1 || got.Windows[0].Utilization != 85 {
+		t.Fatalf("failed refresh = %#v, want stale last good data", got)
+	}
+	select {
+	case event := <-sink.sent:
+		if event.Kind != notifier.KindWarning {
+			t.Fatalf("event = %#v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("warning was not delivered")
+	}
+	select {
+	case event := <-sink.sent:
+		t.Fatalf("stale fallback alerted again: %#v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if entry, err := cache.Read(); err != nil || entry == nil || entry.ProviderData["openai"] == nil {
+		t.Fatalf("cache was not written: %v", err)
+	}
+}
+
+func TestSetRegistryKeepsBackoffAndLastGoodResults(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	flaky := &flakyProvider{stubProvider: stubProvider{name: "openai"}}
+	registry := func(providers ...provider.Provider) *provider.Registry {
+		r := provider.NewRegistry()
+		for _, p := range providers {
+			if err := r.Register(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return r
+	}
+	e := New(registry(flaky, stubProvider{name: "gemini"}), nil)
+	e.Logf = t.Logf
+	if _, ok := e.Refresh(context.Background(), false); !ok {
+		t.Fatal("Refresh reported a concurrent refresh")
+	}
+
+	// gemini is removed from the config and xai added.
+	e.SetRegistry(registry(flaky, stubProvider{name: "xai"}))
+	if results, _ := e.Results(); results["gemini"] != nil || results["openai"] == nil {
+		t.Fatalf("results after SetRegistry = %v, want openai kept and gemini dropped", results)
+	}
+	result, _ := e.Refresh(context.Background(), false)
+	if got := result.Results["openai"]; got == nil || !got.Stale || got.Windows[0].Utilization != 85 {
+		t.Fatalf("openai after reload = %#v, want stale last good data", got)
+	}
+	if result.Results["xai"] == nil || result.Results["gemini"] != nil {
+		t.Fatalf("results = %v, want xai polled and gemini gone", result.Results)
+	}
+
+	// The failure put openai in backoff; a second reload keeps it there.
+	e.SetRegistry(registry(flaky))
+	if _, ok := e.Refresh(context.Background(), false); !ok {
+		t.Fatal("Refresh reported a concurrent refresh")
+	}
+	if flaky.calls != 2 {
+		t.Fatalf("openai fetched %d times, want backoff kept across reloads", flaky.calls)
+	}
+}
+
+type countingSink struct {
+	sent chan notifier.Event
+}
+
+func (s *countingSink) Name() string { return "counting" }
+
+func (s *countingSink) Send(_ context.Context, event notifier.Event) error {
+	s.sent <- event
+	return nil
+}
+
+type countingProvider struct {
+	stubProvider
+	calls atomic.Int32
+}
+
+func (p *countingProvider) FetchUsage(context.Context) (*provider.UsageData, error) {
+	p.calls.Add(1)
+	return &provider.UsageData{
+		Provider:  p.name,
+		FetchedAt: time.Now(),
+		Windows:   []provider.UsageWindow{{Name: "5h", Utilization: 10, ResetsAt: time.Now().Add(time.Hour)}},
+	}, nil
+}
+
+// refreshWhileAnotherProcessWrites runs e.Refresh while the test holds the
+// refresh lock, standing in for another process that writes shared to the
+// cache and then releases the lock.
+func refreshWhileAnotherProcessWrites(t *testing.T, e *Engine, force bool, shared *cache.Entry) *provider.MultiFetchResult {
+	t.Helper()
+	lock, err := cache.LockRefresh(context.Background(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *provider.MultiFetchResult)
+	go func() {
+		result, _ := e.Refresh(context.Background(), force)
+		done <- result
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := cache.WriteEntry(shared); err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	return <-done
+}
+
+func TestForcedRefreshFetchesEvenWhenAnotherProcessJustDid(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	p := &countingProvider{stubProvider: stubProvider{name: "openai"}}
+	registry := provider.NewRegistry()
+	if err := registry.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	e := New(registry, nil)
+	e.Logf = t.Logf
+	shared := func() *cache.Entry {
+		return cache.NewEntry(&provider.MultiFetchResult{Results: sharedReadings("openai"), FetchedAt: time.Now()})
+	}
+
+	if result := refreshWhileAnotherProcessWrites(t, e, false, shared()); p.calls.Load() != 0 || result.Results["openai"].Windows[0].Utilization != 50 {
+		t.Fatalf("calls = %d, result = %#v; want the other process's reading adopted", p.calls.Load(), result.Results["openai"])
+	}
+	if result := refreshWhileAnotherProcessWrites(t, e, true, shared()); p.calls.Load() != 1 || result.Results["openai"].Windows[0].Utilization != 10 {
+		t.Fatalf("calls = %d, result = %#v; want a forced refresh to fetch", p.calls.Load(), result.Results["openai"])
+	}
+}
+
+// sharedReadings returns a 50% reading of each named source, as another
+// process would have cached it.
+func sharedReadings(names ...string) map[string]*provider.UsageData {
+	results := make(map[string]*provider.UsageData, len(names))
+	for _, name := range names {
+		results[name] = &provider.UsageData{
+			Provider: name, FetchedAt: time.Now(),
+			Windows: []provider.UsageWindow{{Name: "5h", Utilization: 50, ResetsAt: time.Now().Add(time.Hour)}},
+		}
+	}
+	return results
+}
+
+func TestSharedRefreshIsAdoptedOnlyWhenEverySourceIsFresh(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	openai := &countingProvider{stubProvider: stubProvider{name: "openai"}}
+	gemini := &countingProvider{stubProvider: stubProvider{name: "gemini"}}
+	registry := provider.NewRegistry()
+	for _, p := range []provider.Provider{openai, gemini} {
+		if err := registry.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := New(registry, nil)
+	e.Logf = t.Logf
+
+	// A partial CLI refresh wrote openai just now but kept gemini from
+	// before its TTL ran out.
+	partial := cache.NewEntry(&provider.MultiFetchResult{Results: sharedReadings("openai", "gemini"), FetchedAt: time.Now()})
+	partial.SourceFetchedAt["gemini"] = time.Now().Add(-2 * cache.DefaultTTL)
+	refreshWhileAnotherProcessWrites(t, e, false, partial)
+	if openai.calls.Load() != 1 || gemini.calls.Load() != 1 {
+		t.Fatalf("calls = %d, %d; want an expired source to force a fetch", openai.calls.Load(), gemini.calls.Load())
+	}
+
+	// Adopting another process's good reading ends this engine's backoff,
+	// as a successful fetch of its own would.
+	_ = e.gate.ShouldSurfaceError("openai", true)
+	fresh := cache.NewEntry(&provider.MultiFetchResult{Results: sharedReadings("openai", "gemini"), FetchedAt: time.Now()})
+	result := refreshWhileAnotherProcessWrites(t, e, false, fresh)
+	if openai.calls.Load() != 1 || result.Results["openai"].Windows[0].Utilization != 50 {
+		t.Fatalf("calls = %d, result = %#v; want the shared reading adopted", openai.calls.Load(), result.Results["openai"])
+	}
+	if e.gate.InBackoff("openai") {
+		t.Fatal("backoff kept after adopting a good reading")
+	}
+}
+
+func TestBackedOffSourcesKeepTheirCachedFetchTime(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	flaky := &flakyProvider{stubProvider: stubProvider{name: "openai"}}
+	steady := &countingProvider{stubProvider: stubProvider{name: "gemini"}}
+	registry := provider.NewRegistry()
+	for _, p := range []provider.Provider{flaky, steady} {
+		if err := registry.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := New(registry, nil)
+	e.Logf = t.Logf
+
+	// The second round's failure puts openai in backoff, so the third round
+	// fetches only gemini.
+	var fetchedAt []time.Time
+	for range 3 {
+		if _, ok := e.Refresh(context.Background(), false); !ok {
+			t.Fatal("Refresh reported a concurrent refresh")
+		}
+		entry, err := cache.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetchedAt = append(fetchedAt, entry.SourceFetched("openai"))
+		if !entry.SourceFetched("gemini").Equal(entry.FetchedAt) {
+			t.Fatalf("gemini fetched at %v, want the round's %v", entry.SourceFetched("gemini"), entry.FetchedAt)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if flaky.calls != 2 || steady.calls.Load() != 3 {
+		t.Fatalf("calls = %d, %d; want openai backed off in the last round", flaky.calls, steady.calls.Load())
+	}
+	if !fetchedAt[2].Equal(fetchedAt[1]) || !fetchedAt[1].After(fetchedAt[0]) {
+		t.Fatalf("openai fetch times = %v, want the backed-off round to keep the last attempt's", fetchedAt)
+	}
+}
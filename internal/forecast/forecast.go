@@ -29,6 +29,17 @@ type Projection struct {
 	RunsOutIn time.Duration
 	// RunsOutEarlyBy is how long before reset the quota is exhausted at current rate.
 	RunsOutEarlyBy time.Duration
+	// Method is the Mode that produced the estimate. ProjectRecent reports
+	// ModeAverage when it fell back for lack of recent readings.
+	Method Mode
+	// RatePerHour is the estimated burn rate in percentage points per hour.
+	RatePerHour float64
+	// LowPct and HighPct bound ProjectedPct with a 95% confidence band. The
+	// average method has no spread, so both equal ProjectedPct.
+	LowPct  float64
+	HighPct float64
+	// Samples is how many readings the recent method fitted (zero otherwise).
+	Samples int
 }
 
 // CompareRisk orders two projections from most quota-sensitive to least.
@@ -76,6 +87,26 @@ func CompareRisk(a, b Projection) int {
 	return 0
 }
 
+// Risk classes name the tiers CompareRisk orders projections by.
+const (
+	RiskCritical = "critical"
+	RiskTight    = "tight"
+	RiskOnTrack  = "on-track"
+)
+
+// RiskClass names the projection's risk tier: critical when it is projected
+// to reach the limit, tight at 90% or more, and on-track otherwise.
+func (p Projection) RiskClass() string {
+	switch riskTier(p) {
+	case 0:
+		return RiskCritical
+	case 1:
+		return RiskTight
+	default:
+		return RiskOnTrack
+	}
+}
+
 func riskTier(p Projection) int {
 	switch {
 	case p.ProjectedPct >= 100:
@@ -101,7 +132,11 @@ func runOutRank(p Projection) (time.Duration, bool) {
 // currentPct is 0-100, resetsAt is when the window resets,
 // windowLen is the total window duration (5h or 7d).
 func Project(currentPct float64, resetsAt time.Time, windowLen time.Duration) Projection {
-	remaining := time.Until(resetsAt)
+	return projectAt(time.Now(), currentPct, resetsAt, windowLen)
+}
+
+func projectAt(now time.Time, currentPct float64, resetsAt time.Time, windowLen time.Duration) Projection {
+	remaining := resetsAt.Sub(now)
 	elapsed := windowLen - remaining
 
 	if elapsed <= 0 || currentPct <= 0 {
@@ -109,11 +144,24 @@ func Project(currentPct float64, resetsAt time.Time, windowLen time.Duration) Pr
 			ProjectedPct:    currentPct,
 			OnTrack:         true,
 			WillLastToReset: true,
+			Method:          ModeAverage,
+			LowPct:          currentPct,
+			HighPct:         currentPct,
 		}
 	}
 
 	rate := currentPct / elapsed.Seconds()
-	projected := rate * windowLen.Seconds()
+	proj := projectionFromRate(currentPct, rate, remaining)
+	proj.Method = ModeAverage
+	proj.LowPct = proj.ProjectedPct
+	proj.HighPct = proj.ProjectedPct
+	return proj
+}
+
+// projectionFromRate extrapolates currentPct at rate (percentage points per
+// second) over the time remaining until reset.
+func projectionFromRate(currentPct, rate float64, remaining time.Duration) Projection {
+	projected := currentPct + rate*remaining.Seconds()
 
 	// ETA: how long until 100% at current rate
 	willLast := true
@@ -137,6 +185,7 @@ func Project(currentPct float64, resetsAt time.Time, windowLen time.Duration) Pr
 		WillLastToReset: willLast,
 		RunsOutIn:       runsOutIn,
 		RunsOutEarlyBy:  runsOutEarlyBy,
+		RatePerHour:     rate * time.Hour.Seconds(),
 	}
 }
 
@@ -224,6 +224,23 @@ func TestCompareRiskPrefersSoonerRunoutOverHigherProjectedPct(t *testing.T) {
 	}
 }
 
+func TestProjection_RiskClass(t *testing.T) {
+	for _, tt := range []struct {
+		projected float64
+		want      string
+	}{
+		{50, RiskOnTrack},
+		{89.9, RiskOnTrack},
+		{90, RiskTight},
+		{100, RiskCritical},
+		{140, RiskCritical},
+	} {
+		if got := (Projection{ProjectedPct: tt.projected}).RiskClass(); got != tt.want {
+			t.Errorf("RiskClass(%.1f) = %q, want %q", tt.projected, got, tt.want)
+		}
+	}
+}
+
 func TestProjection_Indicator(t *testing.T) {
 	tests := []struct {
 		projected float64
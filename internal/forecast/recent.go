@@ -0,0 +1,177 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Mode selects how projections estimate the rate of use.
+type Mode string
+
+const (
+	// ModeAverage assumes use has been spread evenly since the window opened.
+	ModeAverage Mode = "average"
+	// ModeRecent fits the rate to recent recorded readings so a burst shows up
+	// immediately instead of being diluted across the whole window.
+	ModeRecent Mode = "recent"
+
+	// minRecentReadings is the fewest points (including the live reading) that
+	// produce a recent-rate fit; fewer falls back to the average rate.
+	minRecentReadings = 3
+	// maxRecentReadings caps how many of the newest readings are fitted.
+	maxRecentReadings = 24
+	// minRecentSpan is the shortest time span that produces a usable slope.
+	minRecentSpan = 10 * time.Minute
+	// cycleTolerance absorbs providers that jitter ResetsAt between polls.
+	cycleTolerance = 10 * time.Minute
+	// bandZ is the two-sided 95% normal quantile used for the confidence band.
+	bandZ = 1.96
+)
+
+// ParseMode returns the mode named by value. Empty selects ModeAverage.
+func ParseMode(value string) (Mode, bool) {
+	switch Mode(value) {
+	case "", ModeAverage:
+		return ModeAverage, true
+	case ModeRecent:
+		return ModeRecent, true
+	default:
+		return "", false
+	}
+}
+
+// Reading is one recorded utilization sample for a window.
+type Reading struct {
+	At       time.Time
+	Pct      float64
+	ResetsAt time.Time
+}
+
+// ReadingKey identifies a source's window in an Estimator's readings.
+func ReadingKey(source, window string) string {
+	return source + "\x00" + window
+}
+
+// Estimator projects windows in the configured mode. A nil Estimator, or one
+// in ModeAverage, behaves exactly like Project.
+type Estimator struct {
+	Mode Mode
+	// Readings holds recorded samples keyed by ReadingKey.
+	Readings map[string][]Reading
+}
+
+// Project estimates usage at reset for one source's window. current is the
+// live reading; a zero current.At means it was observed now.
+func (e *Estimator) Project(source, window string, current Reading, windowLen time.Duration) Projection {
+	if e == nil || e.Mode != ModeRecent {
+		return Project(current.Pct, current.ResetsAt, windowLen)
+	}
+	return ProjectRecent(current, windowLen, e.Readings[ReadingKey(source, window)])
+}
+
+// ProjectRecent estimates usage at reset from the slope of recent readings in
+// the current reset cycle. Newer readings weigh more (exponential decay), and
+// the slope's standard error produces a 95% band on the projected percentage.
+// Without enough recent readings it falls back to Project.
+func ProjectRecent(current Reading, windowLen time.Duration, readings []Reading) Projection {
+	return projectRecentAt(time.Now(), current, windowLen, readings)
+}
+
+func projectRecentAt(now time.Time, current Reading, windowLen time.Duration, readings []Reading) Projection {
+	if current.At.IsZero() || current.At.After(now) {
+		current.At = now
+	}
+	currentPct, resetsAt := current.Pct, current.ResetsAt
+	remaining := resetsAt.Sub(now)
+	points := recentPoints(now, current, windowLen, readings)
+	if remaining <= 0 || len(points) < minRecentReadings || current.At.Sub(points[0].At) < minRecentSpan {
+		return projectAt(now, currentPct, resetsAt, windowLen)
+	}
+
+	lookback := recentLookback(windowLen)
+	halfLife := lookback.Seconds() / 2
+	var sumW, sumX, sumY float64
+	xs := make([]float64, len(points))
+	ws := make([]float64, len(points))
+	for i, point := range points {
+		x := point.At.Sub(now).Seconds() // <= 0; readings are in the past
+		w := math.Exp2(x / halfLife)
+		xs[i], ws[i] = x, w
+		sumW += w
+		sumX += w * x
+		sumY += w * point.Pct
+	}
+	meanX, meanY := sumX/sumW, sumY/sumW
+	var sxx, sxy float64
+	for i, point := range points {
+		dx := xs[i] - meanX
+		sxx += ws[i] * dx * dx
+		sxy += ws[i] * dx * (point.Pct - meanY)
+	}
+	if sxx <= 0 {
+		return projectAt(now, currentPct, resetsAt, windowLen)
+	}
+	slope := sxy / sxx // percentage points per second
+
+	var sse float64
+	for i, point := range points {
+		fit := meanY + slope*(xs[i]-meanX)
+		sse += ws[i] * (point.Pct - fit) * (point.Pct - fit)
+	}
+	stderr := 0.0
+	if len(points) > 2 {
+		stderr = math.Sqrt(sse / float64(len(points)-2) / sxx)
+	}
+
+	// Utilization within one reset cycle never decreases; a negative fit is
+	// measurement noise, not returned quota.
+	rate := math.Max(slope, 0)
+	lowRate := math.Max(slope-bandZ*stderr, 0)
+	highRate := math.Max(slope+bandZ*stderr, 0)
+
+	// Extrapolate from the live reading rather than the fitted line so the
+	// projection never sits below usage that has already happened.
+	proj := projectionFromRate(currentPct, rate, remaining)
+	proj.Method = ModeRecent
+	proj.LowPct = currentPct + lowRate*remaining.Seconds()
+	proj.HighPct = currentPct + highRate*remaining.Seconds()
+	proj.Samples = len(points)
+	return proj
+}
+
+// recentLookback is how far back readings still describe the current pace:
+// a quarter of the window, so 75 minutes of a 5h window or 42 hours of a 7d one.
+func recentLookback(windowLen time.Duration) time.Duration {
+	return windowLen / 4
+}
+
+// recentPoints returns the newest recorded readings from the same reset cycle
+// that precede the live reading, followed by the live reading itself. A
+// recorded copy of the live reading (same fetch) is dropped so cached data is
+// not counted twice.
+func recentPoints(now time.Time, current Reading, windowLen time.Duration, readings []Reading) []Reading {
+	cutoff := now.Add(-recentLookback(windowLen))
+	points := make([]Reading, 0, len(readings)+1)
+	for _, reading := range readings {
+		if reading.At.Before(cutoff) || !reading.At.Before(current.At) {
+			continue
+		}
+		if !reading.ResetsAt.IsZero() && absDuration(reading.ResetsAt.Sub(current.ResetsAt)) > cycleTolerance {
+			continue
+		}
+		points = append(points, reading)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].At.Before(points[j].At) })
+	if len(points) > maxRecentReadings-1 {
+		points = points[len(points)-(maxRecentReadings-1):]
+	}
+	return append(points, current)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
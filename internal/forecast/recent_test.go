@@ -0,0 +1,146 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProjectRecentFollowsBurstInsteadOfWindowAverage(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	resetsAt := now.Add(3 * time.Hour)
+	// 2h into a 5h window at 30%, but 20 points of that arrived in the last hour.
+	readings := []Reading{
+		{At: now.Add(-60 * time.Minute), Pct: 10, ResetsAt: resetsAt},
+		{At: now.Add(-40 * time.Minute), Pct: 10 + 20.0/3, ResetsAt: resetsAt},
+		{At: now.Add(-20 * time.Minute), Pct: 10 + 40.0/3, ResetsAt: resetsAt},
+	}
+
+	average := projectAt(now, 30, resetsAt, FiveHourWindow)
+	recent := projectRecentAt(now, Reading{At: now, Pct: 30, ResetsAt: resetsAt}, FiveHourWindow, readings)
+
+	if average.Method != ModeAverage || math.Abs(average.ProjectedPct-75) > 0.01 {
+		t.Fatalf("average projection = %#v, want 75%%", average)
+	}
+	if recent.Method != ModeRecent || recent.Samples != 4 {
+		t.Fatalf("recent projection = %#v, want a 4-point recent fit", recent)
+	}
+	if math.Abs(recent.ProjectedPct-90) > 0.01 || math.Abs(recent.RatePerHour-20) > 0.01 {
+		t.Fatalf("recent projection = %.2f%% at %.2f/h, want 90%% at 20/h", recent.ProjectedPct, recent.RatePerHour)
+	}
+	if math.Abs(recent.LowPct-recent.HighPct) > 0.01 {
+		t.Fatalf("perfectly linear readings should have no spread, got %.2f-%.2f", recent.LowPct, recent.HighPct)
+	}
+}
+
+func TestProjectRecentBandWidensWithNoisyReadings(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	resetsAt := now.Add(3 * time.Hour)
+	readings := []Reading{
+		{At: now.Add(-60 * time.Minute), Pct: 12, ResetsAt: resetsAt},
+		{At: now.Add(-45 * time.Minute), Pct: 13, ResetsAt: resetsAt},
+		{At: now.Add(-30 * time.Minute), Pct: 22, ResetsAt: resetsAt},
+		{At: now.Add(-15 * time.Minute), Pct: 23, ResetsAt: resetsAt},
+	}
+
+	proj := projectRecentAt(now, Reading{At: now, Pct: 30, ResetsAt: resetsAt}, FiveHourWindow, readings)
+	if proj.Method != ModeRecent {
+		t.Fatalf("Method = %q, want recent", proj.Method)
+	}
+	if !(proj.LowPct < proj.ProjectedPct && proj.ProjectedPct < proj.HighPct) {
+		t.Fatalf("band %.2f-%.2f does not bracket %.2f", proj.LowPct, proj.HighPct, proj.ProjectedPct)
+	}
+	if proj.LowPct < 30 {
+		t.Fatalf("LowPct = %.2f, must not fall below current usage", proj.LowPct)
+	}
+}
+
+func TestProjectRecentFallsBackWithoutUsableHistory(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	resetsAt := now.Add(3 * time.Hour)
+	current := Reading{At: now, Pct: 30, ResetsAt: resetsAt}
+	want := projectAt(now, 30, resetsAt, FiveHourWindow)
+
+	tests := []struct {
+		name     string
+		readings []Reading
+	}{
+		{name: "no readings"},
+		{name: "too few readings", readings: []Reading{{At: now.Add(-30 * time.Minute), Pct: 20, ResetsAt: resetsAt}}},
+		{name: "span too short", readings: []Reading{
+			{At: now.Add(-4 * time.Minute), Pct: 28, ResetsAt: resetsAt},
+			{At: now.Add(-2 * time.Minute), Pct: 29, ResetsAt: resetsAt},
+		}},
+		{name: "previous reset cycle", readings: []Reading{
+			{At: now.Add(-60 * time.Minute), Pct: 80, ResetsAt: resetsAt.Add(-5 * time.Hour)},
+			{At: now.Add(-30 * time.Minute), Pct: 90, ResetsAt: resetsAt.Add(-5 * time.Hour)},
+		}},
+		{name: "outside lookback", readings: []Reading{
+			{At: now.Add(-100 * time.Minute), Pct: 5, ResetsAt: resetsAt},
+			{At: now.Add(-90 * time.Minute), Pct: 6, ResetsAt: resetsAt},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := projectRecentAt(now, current, FiveHourWindow, tt.readings)
+			if got != want {
+				t.Fatalf("projectRecentAt() = %#v, want average fallback %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestProjectRecentDropsRecordedCopyOfLiveReading(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	fetchedAt := now.Add(-4 * time.Minute)
+	resetsAt := now.Add(3 * time.Hour)
+	current := Reading{At: fetchedAt, Pct: 30, ResetsAt: resetsAt}
+	readings := []Reading{
+		{At: fetchedAt.Add(-40 * time.Minute), Pct: 20, ResetsAt: resetsAt},
+		{At: fetchedAt.Add(-20 * time.Minute), Pct: 25, ResetsAt: resetsAt},
+		current,
+	}
+
+	proj := projectRecentAt(now, current, FiveHourWindow, readings)
+	if proj.Samples != 3 {
+		t.Fatalf("Samples = %d, want the live reading counted once", proj.Samples)
+	}
+	if math.Abs(proj.RatePerHour-15) > 0.01 {
+		t.Fatalf("RatePerHour = %.2f, want 15", proj.RatePerHour)
+	}
+}
+
+func TestEstimatorProjectUsesModeAndSourceKey(t *testing.T) {
+	resetsAt := time.Now().Add(3 * time.Hour)
+	current := Reading{Pct: 30, ResetsAt: resetsAt}
+
+	var nilEstimator *Estimator
+	if got := nilEstimator.Project("claude", "5h", current, FiveHourWindow); got.Method != ModeAverage {
+		t.Fatalf("nil Estimator Method = %q, want average", got.Method)
+	}
+
+	now := time.Now()
+	estimator := &Estimator{Mode: ModeRecent, Readings: map[string][]Reading{
+		ReadingKey("claude:work", "5h"): {
+			{At: now.Add(-60 * time.Minute), Pct: 10, ResetsAt: resetsAt},
+			{At: now.Add(-30 * time.Minute), Pct: 20, ResetsAt: resetsAt},
+		},
+	}}
+	if got := estimator.Project("claude:work", "5h", current, FiveHourWindow); got.Method != ModeRecent {
+		t.Fatalf("claude:work Method = %q, want recent", got.Method)
+	}
+	if got := estimator.Project("claude", "5h", current, FiveHourWindow); got.Method != ModeAverage {
+		t.Fatalf("claude Method = %q, want average fallback for a source without history", got.Method)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for value, want := range map[string]Mode{"": ModeAverage, "average": ModeAverage, "recent": ModeRecent} {
+		if got, ok := ParseMode(value); !ok || got != want {
+			t.Fatalf("ParseMode(%q) = %q, %v; want %q", value, got, ok, want)
+		}
+	}
+	if _, ok := ParseMode("ewma"); ok {
+		t.Fatal("ParseMode accepted an unknown mode")
+	}
+}
@@ -0,0 +1,374 @@
+// Package history keeps an append-only local record of quota readings.
+//
+// The usage cache holds only the latest reading per source. History appends
+// every fresh window and balance reading to monthly JSON Lines segments under
+// the cache directory so past burn rates can be inspected later. Samples carry
+// the same derived, non-secret data as the cache: source keys, window names,
+// percentages, counts, and reset times.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const (
+	// SampleKindWindow marks a resetting quota window reading.
+	SampleKindWindow = "window"
+	// SampleKindBalance marks a non-resetting balance reading.
+	SampleKindBalance = "balance"
+
+	// DefaultRetention bounds how long segments are kept on disk.
+	DefaultRetention = 90 * 24 * time.Hour
+
+	segmentLayout = "2006-01"
+	segmentSuffix = ".jsonl"
+)
+
+// Sample is one recorded window or balance reading for one source.
+type Sample struct {
+	// Source is the canonical source key (e.g. "claude" or "claude:work").
+	Source      string    `json:"source"`
+	Provider    string    `json:"provider"`
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Utilization float64   `json:"utilization,omitempty"`
+	ResetsAt    time.Time `json:"resets_at,omitzero"`
+	Used        float64   `json:"used,omitempty"`
+	Limit       float64   `json:"limit,omitempty"`
+	Total       float64   `json:"total,omitempty"`
+	Remaining   float64   `json:"remaining,omitempty"`
+}
+
+// Query selects samples from the store. Zero fields match everything.
+type Query struct {
+	// Provider matches either a provider family ("claude") or a full source
+	// key ("claude:work").
+	Provider string
+	Window   string
+	Since    time.Time
+	Until    time.Time
+}
+
+// Matches reports whether sample satisfies q.
+func (q Query) Matches(sample Sample) bool {
+	if q.Provider != "" && sample.Source != q.Provider && sample.Provider != q.Provider {
+		return false
+	}
+	if q.Window != "" && !strings.EqualFold(sample.Name, q.Window) {
+		return false
+	}
+	if !q.Since.IsZero() && sample.FetchedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && sample.FetchedAt.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Store reads and appends history segments in one directory.
+type Store struct {
+	dir       string
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Open returns a store rooted at dir. The directory is created on first write.
+func Open(dir string) *Store {
+	return &Store{dir: dir, retention: DefaultRetention, now: time.Now}
+}
+
+// Default returns the store beside the usage cache.
+func Default() (*Store, error) {
+	dir, err := cache.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return Open(filepath.Join(dir, "history")), nil
+}
+
+// Record appends the fresh readings from a fetch result to the default store.
+func Record(result *provider.MultiFetchResult) error {
+	store, err := Default()
+	if err != nil {
+		return err
+	}
+	return store.Append(SamplesFromResult(result))
+}
+
+// SamplesFromResult converts fresh, healthy readings into samples. Stale
+// fallbacks and readings carried over from an earlier refresh (for example a
+// provider in failure backoff) were already recorded when first fetched, so
+// they are skipped rather than duplicated.
+func SamplesFromResult(result *provider.MultiFetchResult) []Sample {
+	if result == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(result.Results))
+	for key := range result.Results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]Sample, 0)
+	for _, key := range keys {
+		data := result.Results[key]
+		if data == nil || data.Stale || data.IsExpired || data.Error != "" {
+			continue
+		}
+		fetchedAt := data.FetchedAt
+		if fetchedAt.IsZero() {
+			fetchedAt = result.FetchedAt
+		}
+		if !result.FetchedAt.IsZero() && fetchedAt.Before(result.FetchedAt) {
+			continue
+		}
+		for _, window := range data.Windows {
+			samples = append(samples, Sample{
+				Source:      key,
+				Provider:    data.Provider,
+				Kind:        SampleKindWindow,
+				Name:        window.Name,
+				FetchedAt:   fetchedAt,
+				Utilization: window.Utilization,
+				ResetsAt:    window.ResetsAt,
+				Used:        float64(window.Used),
+				Limit:       float64(window.Limit),
+			})
+		}
+		for _, balance := range data.Balances {
+			samples = append(samples, Sample{
+				Source:    key,
+				Provider:  data.Provider,
+				Kind:      SampleKindBalance,
+				Name:      balance.Name,
+				FetchedAt: fetchedAt,
+				Used:      balance.Used,
+				Total:     balance.Total,
+				Remaining: balance.Remaining,
+			})
+		}
+	}
+	return samples
+}
+
+// Append writes samples to their monthly segments and prunes segments older
+// than the retention period. Each segment is written with a single append so
+// concurrent Clawmeter processes do not interleave partial lines.
+func (s *Store) Append(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("create history dir: %w", err)
+	}
+
+	bySegment := make(map[string]*bytes.Buffer)
+	for _, sample := range samples {
+		name := segmentName(sample.FetchedAt)
+		buf := bySegment[name]
+		if buf == nil {
+			buf = &bytes.Buffer{}
+			bySegment[name] = buf
+		}
+		line, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	for name, buf := range bySegment {
+		if err := appendFile(filepath.Join(s.dir, name), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.prune()
+}
+
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open history segment: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write history segment: %w", err)
+	}
+	return f.Close()
+}
+
+// Query returns matching samples ordered by fetch time, then source and name.
+// Malformed lines (for example a write cut short by a crash) are skipped.
+func (s *Store) Query(q Query) ([]Sample, error) {
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]Sample, 0)
+	for _, segment := range segments {
+		if !q.Since.IsZero() && segment.end.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && segment.start.After(q.Until) {
+			continue
+		}
+		found, err := readSegment(filepath.Join(s.dir, segment.name), q)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, found...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		a, b := samples[i], samples[j]
+		if !a.FetchedAt.Equal(b.FetchedAt) {
+			return a.FetchedAt.Before(b.FetchedAt)
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Name < b.Name
+	})
+	return samples, nil
+}
+
+func readSegment(path string, q Query) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open history segment: %w", err)
+	}
+	defer f.Close()
+
+	samples := make([]Sample, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue
+		}
+		if q.Matches(sample) {
+			samples = append(samples, sample)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history segment: %w", err)
+	}
+	return samples, nil
+}
+
+type segment struct {
+	name       string
+	start, end time.Time
+}
+
+func (s *Store) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read history dir: %w", err)
+	}
+	segments := make([]segment, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		start, err := time.Parse(segmentLayout, strings.TrimSuffix(name, segmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{name: name, start: start, end: start.AddDate(0, 1, 0)})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start.Before(segments[j].start) })
+	return segments, nil
+}
+
+// prune removes whole segments whose month ended before the retention cutoff.
+func (s *Store) prune() error {
+	if s.retention <= 0 {
+		return nil
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	cutoff := s.now().Add(-s.retention)
+	for _, segment := range segments {
+		if segment.end.Before(cutoff) {
+			if err := os.Remove(filepath.Join(s.dir, segment.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("prune history segment: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func segmentName(t time.Time) string {
+	return t.UTC().Format(segmentLayout) + segmentSuffix
+}
+
+// estimatorLookback covers the longest recent-rate lookback forecast uses,
+// a quarter of a monthly window.
+const estimatorLookback = forecast.MonthlyWindow / 4
+
+// LoadEstimator returns a forecast estimator for mode backed by the default
+// store. ModeAverage needs no history and returns a nil Estimator, which
+// projects with the plain average rate.
+func LoadEstimator(mode forecast.Mode) (*forecast.Estimator, error) {
+	if mode != forecast.ModeRecent {
+		return nil, nil
+	}
+	store, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return store.Estimator(mode)
+}
+
+// Estimator returns a forecast estimator for mode loaded with the store's
+// recent window samples.
+func (s *Store) Estimator(mode forecast.Mode) (*forecast.Estimator, error) {
+	samples, err := s.Query(Query{Since: s.now().Add(-estimatorLookback)})
+	if err != nil {
+		return nil, err
+	}
+	return &forecast.Estimator{Mode: mode, Readings: Readings(samples)}, nil
+}
+
+// Readings groups window samples into forecast readings keyed by
+// forecast.ReadingKey. Balance samples carry no utilization and are skipped.
+func Readings(samples []Sample) map[string][]forecast.Reading {
+	readings := make(map[string][]forecast.Reading)
+	for _, sample := range samples {
+		if sample.Kind != SampleKindWindow {
+			continue
+		}
+		key := forecast.ReadingKey(sample.Source, sample.Name)
+		readings[key] = append(readings[key], forecast.Reading{
+			At:       sample.FetchedAt,
+			Pct:      sample.Utilization,
+			ResetsAt: sample.ResetsAt,
+		})
+	}
+	return readings
+}
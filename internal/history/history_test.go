@@ -0,0 +1,168 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func TestSamplesFromResultSkipsStaleErroredAndCarriedOverReadings(t *testing.T) {
+	fetchedAt := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+	resetsAt := fetchedAt.Add(3 * time.Hour)
+	result := &provider.MultiFetchResult{
+		FetchedAt: fetchedAt,
+		Results: map[string]*provider.UsageData{
+			"claude": {
+				Provider:  "claude",
+				FetchedAt: fetchedAt.Add(time.Second),
+				Windows:   []provider.UsageWindow{{Name: "5h", Utilization: 42, ResetsAt: resetsAt}},
+			},
+			"deepseek": {
+				Provider:  "deepseek",
+				FetchedAt: fetchedAt.Add(time.Second),
+				Balances:  []provider.UsageBalance{{Name: "CNY", Total: 10, Remaining: 7.5}},
+			},
+			"claude:work": {Provider: "claude", FetchedAt: fetchedAt, Stale: true, Windows: []provider.UsageWindow{{Name: "5h", Utilization: 10}}},
+			"openai":      {Provider: "openai", FetchedAt: fetchedAt, Error: "rate limited"},
+			"gemini": {
+				Provider:  "gemini",
+				FetchedAt: fetchedAt.Add(-10 * time.Minute),
+				Windows:   []provider.UsageWindow{{Name: "24h Pro", Utilization: 5}},
+			},
+		},
+	}
+
+	samples := SamplesFromResult(result)
+	if len(samples) != 2 {
+		t.Fatalf("samples = %#v, want claude window and deepseek balance", samples)
+	}
+	if got := samples[0]; got.Source != "claude" || got.Kind != SampleKindWindow || got.Utilization != 42 || !got.ResetsAt.Equal(resetsAt) {
+		t.Fatalf("window sample = %#v", got)
+	}
+	if got := samples[1]; got.Source != "deepseek" || got.Kind != SampleKindBalance || got.Remaining != 7.5 || got.Total != 10 {
+		t.Fatalf("balance sample = %#v", got)
+	}
+}
+
+func TestStoreAppendAndQuery(t *testing.T) {
+	store := Open(t.TempDir())
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return base.Add(24 * time.Hour) }
+
+	samples := []Sample{
+		{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: base.Add(-48 * time.Hour), Utilization: 10},
+		{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "7d", FetchedAt: base, Utilization: 30},
+		{Source: "claude:work", Provider: "claude", Kind: SampleKindWindow, Name: "7d", FetchedAt: base.Add(time.Hour), Utilization: 50},
+		{Source: "openai", Provider: "openai", Kind: SampleKindWindow, Name: "5h", FetchedAt: base.Add(2 * time.Hour), Utilization: 70},
+	}
+	if err := store.Append(samples); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "2026-09.jsonl")); err != nil {
+		t.Fatalf("September segment missing: %v", err)
+	}
+
+	all, err := store.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].Name != "5h" || all[3].Source != "openai" {
+		t.Fatalf("Query(all) = %#v", all)
+	}
+
+	family, err := store.Query(Query{Provider: "claude", Window: "7D"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(family) != 2 || family[0].Source != "claude" || family[1].Source != "claude:work" {
+		t.Fatalf("Query(claude 7d) = %#v", family)
+	}
+
+	source, err := store.Query(Query{Provider: "claude:work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(source) != 1 || source[0].Utilization != 50 {
+		t.Fatalf("Query(claude:work) = %#v", source)
+	}
+
+	recent, err := store.Query(Query{Since: base.Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 3 {
+		t.Fatalf("Query(since) = %#v, want 3 samples", recent)
+	}
+}
+
+func TestStoreSkipsMalformedLines(t *testing.T) {
+	store := Open(t.TempDir())
+	at := time.Date(2026, 10, 5, 8, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return at }
+	if err := store.Append([]Sample{{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: at}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendFile(filepath.Join(store.dir, "2026-10.jsonl"), []byte("{\"source\":\"cla")); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := store.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("Query() = %#v, want only the complete sample", samples)
+	}
+}
+
+func TestStorePrunesSegmentsOutsideRetention(t *testing.T) {
+	store := Open(t.TempDir())
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	old := Sample{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now.AddDate(0, -6, 0)}
+	recent := Sample{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now}
+	if err := store.Append([]Sample{old, recent}); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := store.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || !samples[0].FetchedAt.Equal(now) {
+		t.Fatalf("Query() after prune = %#v", samples)
+	}
+}
+
+func TestStoreEstimatorGroupsWindowSamplesBySourceAndWindow(t *testing.T) {
+	store := Open(t.TempDir())
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	resetsAt := now.Add(3 * time.Hour)
+	if err := store.Append([]Sample{
+		{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now.Add(-time.Hour), Utilization: 10, ResetsAt: resetsAt},
+		{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now.Add(-30 * time.Minute), Utilization: 20, ResetsAt: resetsAt},
+		{Source: "claude:work", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now.Add(-30 * time.Minute), Utilization: 50},
+		{Source: "deepseek", Provider: "deepseek", Kind: SampleKindBalance, Name: "CNY", FetchedAt: now, Remaining: 7},
+		{Source: "claude", Provider: "claude", Kind: SampleKindWindow, Name: "5h", FetchedAt: now.Add(-10 * 24 * time.Hour), Utilization: 90},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	estimator, err := store.Estimator(forecast.ModeRecent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimator.Mode != forecast.ModeRecent || len(estimator.Readings) != 2 {
+		t.Fatalf("Estimator() = %#v, want two window series", estimator)
+	}
+	claude := estimator.Readings[forecast.ReadingKey("claude", "5h")]
+	if len(claude) != 2 || claude[0].Pct != 10 || claude[1].Pct != 20 || !claude[1].ResetsAt.Equal(resetsAt) {
+		t.Fatalf("claude 5h readings = %#v", claude)
+	}
+}
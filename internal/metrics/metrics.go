@@ -0,0 +1,169 @@
+// Package metrics renders usage as Prometheus text exposition format for a
+// scrape endpoint or node_exporter's textfile collector.
+//
+// Labels are limited to the source key, provider family, and window or
+// balance name. Errors, source display labels, and account details never
+// become label values, so scraped series carry nothing SafeFetchError would
+// strip.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cli"
+)
+
+// ContentType is the exposition format served from /metrics.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	labels []label
+	value  float64
+}
+
+type gauge struct {
+	name    string
+	help    string
+	samples []sample
+}
+
+// Write renders one gauge family per metric for the given providers. now is
+// the reference time for seconds-until-reset.
+func Write(w io.Writer, providers []cli.ProviderFormatter, now time.Time) error {
+	utilization := &gauge{name: "clawmeter_window_utilization_percent", help: "Quota window utilization (0-100)."}
+	resetSeconds := &gauge{name: "clawmeter_window_reset_seconds", help: "Seconds until the quota window resets."}
+	projected := &gauge{name: "clawmeter_window_projected_percent", help: "Projected quota window utilization at reset."}
+	balance := &gauge{name: "clawmeter_balance_remaining", help: "Remaining non-resetting balance, in the provider's unit."}
+	resetCredits := &gauge{name: "clawmeter_reset_credits_available", help: "Banked usage-limit resets available."}
+	success := &gauge{name: "clawmeter_fetch_success", help: "1 if the latest fetch for the source succeeded."}
+	stale := &gauge{name: "clawmeter_fetch_stale", help: "1 if the source is showing last good data after a failed refresh."}
+	fetchedAt := &gauge{name: "clawmeter_fetch_timestamp_seconds", help: "Unix time of the reading being reported."}
+
+	sorted := append([]cli.ProviderFormatter(nil), providers...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for i := range sorted {
+		pf := &sorted[i]
+		source := []label{{"source", pf.Name}, {"provider", family(pf)}}
+		data := pf.Data
+
+		ok, isStale := 0.0, 0.0
+		if data != nil && !data.IsExpired && !data.Stale && data.Error == "" {
+			ok = 1
+		}
+		if data != nil && data.Stale {
+			isStale = 1
+		}
+		success.add(source, ok)
+		stale.add(source, isStale)
+		if data == nil || data.IsExpired {
+			continue
+		}
+		if !data.FetchedAt.IsZero() {
+			fetchedAt.add(source, float64(data.FetchedAt.Unix()))
+		}
+
+		for _, window := range data.PresentationWindows() {
+			labels := withLabel(source, "window", window.Name)
+			utilization.add(labels, window.Utilization)
+			if window.ResetsAt.IsZero() {
+				continue
+			}
+			resetSeconds.add(labels, math.Max(window.ResetsAt.Sub(now).Seconds(), 0))
+			projected.add(labels, pf.Project(window).ProjectedPct)
+		}
+		for _, b := range data.Balances {
+			balance.add(withLabel(source, "balance", b.Name), b.Remaining)
+		}
+		if data.ResetCredits != nil {
+			resetCredits.add(source, float64(data.ResetCredits.DisplayCount(now)))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, g := range []*gauge{utilization, resetSeconds, projected, balance, resetCredits, success, stale, fetchedAt} {
+		g.write(bw)
+	}
+	return bw.Flush()
+}
+
+// WriteTextfile atomically replaces path with the rendered metrics, as the
+// textfile collector requires: it must never read a partial file.
+func WriteTextfile(path string, providers []cli.ProviderFormatter, now time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := Write(tmp, providers, now); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func family(pf *cli.ProviderFormatter) string {
+	if pf.Family != "" {
+		return pf.Family
+	}
+	if pf.Data != nil && pf.Data.Provider != "" {
+		return pf.Data.Provider
+	}
+	name, _, _ := strings.Cut(pf.Name, ":")
+	return name
+}
+
+func withLabel(labels []label, name, value string) []label {
+	return append(append([]label(nil), labels...), label{name, value})
+}
+
+func (g *gauge) add(labels []label, value float64) {
+	g.samples = append(g.samples, sample{labels: labels, value: value})
+}
+
+func (g *gauge) write(w *bufio.Writer) {
+	if len(g.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, s := range g.samples {
+		w.WriteString(g.name)
+		w.WriteByte('{')
+		for i, l := range s.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l.name, escapeLabel(l.value))
+		}
+		w.WriteByte('}')
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(s.value, 'f', -1, 64))
+		w.WriteByte('\n')
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cli"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func TestWriteRendersGaugesWithSourceAndWindowLabelsOnly(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	providers := []cli.ProviderFormatter{
+		{
+			Name: "claude:work", Family: "claude", SourceLabel: "alice@example.com",
+			Data: &provider.UsageData{
+				Provider: "claude", SourceID: "work", FetchedAt: now,
+				Windows: []provider.UsageWindow{
+					{Name: "5h", Utilization: 40, ResetsAt: now.Add(90 * time.Minute)},
+					{Name: "monthly", Utilization: 12},
+				},
+				ResetCredits: &provider.UsageResetCredits{AvailableCount: 2},
+			},
+		},
+		{
+			Name: "deepseek", Family: "deepseek",
+			Data: &provider.UsageData{Provider: "deepseek", FetchedAt: now, Balances: []provider.UsageBalance{{Name: "CNY", Remaining: 7.5}}},
+		},
+		{
+			Name: "openai", Family: "openai",
+			Data: &provider.UsageData{Provider: "openai", FetchedAt: now, Stale: true, Warning: "HTTP 401 for alice@example.com", Windows: []provider.UsageWindow{{Name: "7d", Utilization: 20}}},
+		},
+		{Name: "gemini", Family: "gemini", Data: &provider.UsageData{Provider: "gemini", Error: "token expired for alice@example.com"}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, providers, now); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE clawmeter_window_utilization_percent gauge\n",
+		`clawmeter_window_utilization_percent{source="claude:work",provider="claude",window="5h"} 40`,
+		`clawmeter_window_utilization_percent{source="claude:work",provider="claude",window="monthly"} 12`,
+		`clawmeter_window_reset_seconds{source="claude:work",provider="claude",window="5h"} 5400`,
+		`clawmeter_window_projected_percent{source="claude:work",provider="claude",window="5h"} `,
+		`clawmeter_balance_remaining{source="deepseek",provider="deepseek",balance="CNY"} 7.5`,
+		`clawmeter_reset_credits_available{source="claude:work",provider="claude"} 2`,
+		`clawmeter_fetch_success{source="claude:work",provider="claude"} 1`,
+		`clawmeter_fetch_success{source="gemini",provider="gemini"} 0`,
+		`clawmeter_fetch_success{source="openai",provider="openai"} 0`,
+		`clawmeter_fetch_stale{source="openai",provider="openai"} 1`,
+		`clawmeter_fetch_timestamp_seconds{source="deepseek",provider="deepseek"} 1792324800`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `clawmeter_window_reset_seconds{source="claude:work",provider="claude",window="monthly"}`) {
+		t.Fatalf("window without a reset should have no countdown:\n%s", out)
+	}
+	if strings.Contains(out, "alice@example.com") || strings.Contains(out, "401") {
+		t.Fatalf("metrics leaked labels or errors:\n%s", out)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Fatalf("escapeLabel = %q", got)
+	}
+}
+
+func TestWriteTextfileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clawmeter.prom")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	providers := []cli.ProviderFormatter{{Name: "claude", Family: "claude", Data: &provider.UsageData{Provider: "claude"}}}
+	if err := WriteTextfile(path, providers, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `clawmeter_fetch_success{source="claude",provider="claude"} 1`) {
+		t.Fatalf("textfile = %q", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,489 @@
+// Package notifier turns successive usage readings into alerts and delivers
+// them to the tray and to configured sinks.
+//
+// A Dispatcher remembers the last observation so each threshold crossing,
+// pace projection, credential expiry, or status-page outage is reported once
+// when it begins, not on every poll while it lasts.
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/format"
+	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+// Kind classifies an Event.
+type Kind string
+
+const (
+	KindWarning  Kind = "warning"  // a window crossed the warning threshold
+	KindCritical Kind = "critical" // a window crossed the critical threshold
+	KindPace     Kind = "pace"     // a window is projected to run out early
+	KindExpired  Kind = "expired"  // credentials expired
+	KindOutage   Kind = "outage"   // the provider's status page reports an issue
+)
+
+// Event is one alert, also the JSON body posted by webhook sinks. ProjectedPct
+// and RunsOutAt are set on pace alerts.
+type Event struct {
+	Kind         Kind      `json:"kind"`
+	Provider     string    `json:"provider"`
+	Source       string    `json:"source,omitempty"`
+	DisplayName  string    `json:"display_name"`
+	Window       string    `json:"window,omitempty"`
+	Utilization  float64   `json:"utilization,omitempty"`
+	Threshold    float64   `json:"threshold,omitempty"`
+	ResetsAt     time.Time `json:"resets_at,omitzero"`
+	ProjectedPct float64   `json:"projected_pct,omitempty"`
+	RunsOutAt    time.Time `json:"runs_out_at,omitzero"`
+	Status       string    `json:"status,omitempty"`
+	Title        string    `json:"title"`
+	Message      string    `json:"message"`
+	At           time.Time `json:"at"`
+}
+
+// Urgent reports whether the event deserves the most intrusive delivery a
+// sink offers.
+func (e Event) Urgent() bool {
+	return e.Kind == KindCritical || e.Kind == KindExpired ||
+		(e.Kind == KindOutage && (e.Status == string(status.Major) || e.Status == string(status.Critical)))
+}
+
+// Thresholds are utilization percentages that raise warning and critical
+// alerts when a window crosses them.
+type Thresholds struct {
+	Warning  float64
+	Critical float64
+}
+
+// Sink delivers events somewhere.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+}
+
+// Rule pairs a sink with the events it wants.
+type Rule struct {
+	Sink Sink
+	// ID keys the alerts already sent to this rule's sink in the shared
+	// state. Empty uses the sink's name, which built-in sinks keep unique;
+	// Rules sets it for configured sinks, whose names may repeat.
+	ID string
+	// Thresholds set here override the per-window thresholds the dispatcher
+	// resolves from config; zero fields inherit them.
+	Thresholds Thresholds
+	// Providers limits the rule to provider families or family:source keys.
+	// Empty matches everything.
+	Providers []string
+	// Kinds limits the rule to some event kinds. Empty accepts every kind.
+	Kinds []Kind
+}
+
+// Alert is an event bound for one sink.
+type Alert struct {
+	Sink  Sink
+	Event Event
+	// fired is the state key a threshold alert is recorded under once its
+	// sink accepts it.
+	fired string
+}
+
+// Observation is one poll's worth of state.
+type Observation struct {
+	// Results are keyed by source key, as in provider.MultiFetchResult.
+	Results map[string]*provider.UsageData
+	// Statuses are keyed by provider family. Nil means status pages were not
+	// checked, and the previous statuses are kept.
+	Statuses map[string]*status.ProviderStatus
+	// DisplayNames maps source keys and families to human-readable names.
+	DisplayNames map[string]string
+	// Estimator projects windows for alert messages; nil uses the average.
+	Estimator *forecast.Estimator
+}
+
+// Dispatcher detects transitions between observations. It is safe for
+// concurrent use.
+type Dispatcher struct {
+	mu    sync.Mutex
+	rules []Rule
+	pace  Pace
+	quiet QuietHours
+	// limits resolves a provider window's thresholds and whether it is
+	// muted. Nil uses defaultThresholds everywhere.
+	limits  func(family, window string) (Thresholds, bool)
+	path    string
+	modTime time.Time // of the state file when last read or written
+	state   state
+}
+
+// NewDispatcher returns a dispatcher for rules.
+func NewDispatcher(rules []Rule) *Dispatcher {
+	return &Dispatcher{
+		rules: rules,
+		state: newState(),
+	}
+}
+
+// SetRules replaces the rules, keeping what has already been observed so a
+// config reload does not repeat alerts.
+func (d *Dispatcher) SetRules(rules []Rule) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rules = rules
+}
+
+// SetPace replaces the pace conditions shared by every rule. Nil turns pace
+// alerts off.
+func (d *Dispatcher) SetPace(pace Pace) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pace = pace
+}
+
+// Observe records obs and returns the alerts it triggers, which the caller
+// delivers with Send. Each sink hears about a window's warning and critical
+// levels once per reset cycle; usage already above a threshold counts as a
+// crossing if that sink has not been told. While snoozed or in quiet hours
+// nothing is returned or recorded, so the first observation afterwards
+// reports what is still true then, each window at its current level, once.
+func (d *Dispatcher) Observe(obs Observation) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.lockStateLocked().Unlock()
+
+	now := time.Now()
+	_ = d.loadLocked()
+	if now.Before(d.state.SnoozedUntil) || d.quiet.Contains(now) {
+		return nil
+	}
+	for key, pending := range d.state.Sending {
+		if now.Sub(pending.At) >= claimTimeout {
+			delete(d.state.Sending, key)
+		}
+	}
+	names := make([]string, 0, len(obs.Results))
+	for name := range obs.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Pace state is shared by every rule, so evaluate it once per reading.
+	paces := make(map[string][]Event)
+	for _, name := range names {
+		paces[name] = d.paceEvents(name, obs.Results[name], obs, now)
+	}
+
+	var alerts []Alert
+	for _, rule := range d.rules {
+		for _, name := range names {
+			data := obs.Results[name]
+			if data == nil || !rule.matches(name, false) {
+				continue
+			}
+			if data.IsExpired {
+				if !d.state.Expired[name] {
+					alerts = rule.add(alerts, expiredEvent(name, data, obs, now))
+				}
+				continue
+			}
+			if data.Error != "" || data.Stale {
+				continue
+			}
+			for _, window := range data.UsableWindows() {
+				if event, key, ok := d.crossing(rule, name, data, window, obs, now); ok {
+					alerts = append(alerts, Alert{Sink: rule.Sink, Event: event, fired: key})
+				}
+			}
+			for _, event := range paces[name] {
+				alerts = rule.add(alerts, event)
+			}
+		}
+		for _, family := range sortedKeys(obs.Statuses) {
+			ps := obs.Statuses[family]
+			if ps == nil || !rule.matches(family, true) || !worsened(d.state.Statuses[family], ps.Indicator) {
+				continue
+			}
+			alerts = rule.add(alerts, outageEvent(family, ps, obs, now))
+		}
+	}
+
+	for _, name := range names {
+		if data := obs.Results[name]; data != nil {
+			d.state.Expired[name] = data.IsExpired
+		}
+	}
+	if obs.Statuses != nil {
+		for family, ps := range obs.Statuses {
+			if ps != nil && ps.Indicator != status.Unknown {
+				d.state.Statuses[family] = ps.Indicator
+			}
+		}
+	}
+	_ = d.saveLocked()
+	return alerts
+}
+
+// Send delivers alerts from Observe in order, continuing past failures. A
+// threshold alert counts as sent only once its sink accepts it, so one that
+// fails is raised again by the next observation.
+func (d *Dispatcher) Send(ctx context.Context, alerts []Alert) error {
+	var errs []error
+	delivered := make([]bool, len(alerts))
+	for i, alert := range alerts {
+		if err := alert.Sink.Send(ctx, alert.Event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", alert.Sink.Name(), err))
+			continue
+		}
+		delivered[i] = true
+	}
+	d.settle(alerts, delivered)
+	return errors.Join(errs...)
+}
+
+// settle records the threshold alerts that were delivered and releases the
+// claims of those that were not.
+func (d *Dispatcher) settle(alerts []Alert, delivered []bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.lockStateLocked().Unlock()
+	_ = d.loadLocked()
+	changed := false
+	for i, alert := range alerts {
+		if alert.fired == "" {
+			continue
+		}
+		changed = true
+		event := alert.Event
+		if pending, ok := d.state.Sending[alert.fired]; ok && pending.Kind == event.Kind {
+			delete(d.state.Sending, alert.fired)
+		}
+		if !delivered[i] {
+			continue
+		}
+		fired, ok := d.state.Fired[alert.fired]
+		newer := !ok || (!sameCycle(fired.ResetsAt, event.ResetsAt, forecast.GuessWindowType(event.Window)) && event.ResetsAt.After(fired.ResetsAt))
+		if newer || levelRank[event.Kind] > levelRank[fired.Kind] {
+			d.state.Fired[alert.fired] = firedLevel{Kind: event.Kind, ResetsAt: event.ResetsAt}
+		}
+	}
+	if changed {
+		_ = d.saveLocked()
+	}
+}
+
+// matches reports whether key passes the provider filter. Outages are
+// reported per family, and a source filter still wants its family's outages.
+func (r Rule) matches(key string, outage bool) bool {
+	if len(r.Providers) == 0 {
+		return true
+	}
+	family, _, _ := strings.Cut(key, ":")
+	for _, want := range r.Providers {
+		want = strings.ToLower(strings.TrimSpace(want))
+		wantFamily, _, _ := strings.Cut(want, ":")
+		if want == key || want == family || (outage && wantFamily == family) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) add(alerts []Alert, event Event) []Alert {
+	if !r.accepts(event.Kind) {
+		return alerts
+	}
+	return append(alerts, Alert{Sink: r.Sink, Event: event})
+}
+
+func (r Rule) accepts(kind Kind) bool {
+	if len(r.Kinds) == 0 {
+		return true
+	}
+	for _, want := range r.Kinds {
+		if want == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) stateID() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Sink.Name()
+}
+
+// crossing returns the threshold alert a window owes rule's sink and the key
+// Send records it under, claiming it so that no other observation raises it
+// while it is being delivered. Failed and stale readings never reach here, so
+// a recovery at the same level is not a fresh crossing.
+func (d *Dispatcher) crossing(rule Rule, name string, data *provider.UsageData, window provider.UsageWindow, obs Observation, now time.Time) (Event, string, bool) {
+	thresholds, ok := d.thresholds(rule, family(name, data), window.Name)
+	if !ok {
+		return Event{}, "", false
+	}
+	pct := window.Utilization
+	var kind Kind
+	var threshold float64
+	switch {
+	case thresholds.Critical > 0 && pct >= thresholds.Critical:
+		kind, threshold = KindCritical, thresholds.Critical
+	case thresholds.Warning > 0 && pct >= thresholds.Warning:
+		kind, threshold = KindWarning, thresholds.Warning
+	}
+
+	windowLen := forecast.GuessWindowType(window.Name)
+	key := firedKey(rule.stateID(), name, window.Name)
+	fired, ok := d.state.Fired[key]
+	if ok && !sameCycle(fired.ResetsAt, window.ResetsAt, windowLen) {
+		fired = firedLevel{}
+	}
+	if levelRank[kind] <= levelRank[fired.Kind] {
+		// Usage that fell back, as at a reset the provider did not report,
+		// lowers the record so the next crossing alerts again.
+		if levelRank[kind] < levelRank[fired.Kind] {
+			fired.Kind = kind
+			d.state.Fired[key] = fired
+		}
+		if kind == "" {
+			delete(d.state.Fired, key)
+		}
+		return Event{}, "", false
+	}
+	if !rule.accepts(kind) {
+		return Event{}, "", false
+	}
+	if pending, ok := d.state.Sending[key]; ok && sameCycle(pending.ResetsAt, window.ResetsAt, windowLen) && levelRank[kind] <= levelRank[pending.Kind] {
+		return Event{}, "", false
+	}
+	d.state.Sending[key] = claim{Kind: kind, ResetsAt: window.ResetsAt, At: now}
+
+	display := displayName(obs, name)
+	message := fmt.Sprintf("%s window at %.0f%%", window.Name, pct)
+	if !window.ResetsAt.IsZero() {
+		current := forecast.Reading{At: data.FetchedAt, Pct: pct, ResetsAt: window.ResetsAt}
+		proj := obs.Estimator.Project(name, window.Name, current, forecast.GuessWindowType(window.Name))
+		message += " — " + proj.PaceIndicator()
+	}
+	return Event{
+		Kind:        kind,
+		Provider:    family(name, data),
+		Source:      name,
+		DisplayName: display,
+		Window:      window.Name,
+		Utilization: pct,
+		Threshold:   threshold,
+		ResetsAt:    window.ResetsAt,
+		Title:       fmt.Sprintf("%s usage %s", display, kind),
+		Message:     message,
+		At:          now,
+	}, key, true
+}
+
+func expiredEvent(name string, data *provider.UsageData, obs Observation, now time.Time) Event {
+	display := displayName(obs, name)
+	message := "Credentials expired — sign in again to resume usage updates"
+	if data.Error != "" {
+		message = format.HumanizeError(data.Error)
+	}
+	return Event{
+		Kind:        KindExpired,
+		Provider:    family(name, data),
+		Source:      name,
+		DisplayName: display,
+		Title:       fmt.Sprintf("%s sign-in expired", display),
+		Message:     message,
+		At:          now,
+	}
+}
+
+func outageEvent(family string, ps *status.ProviderStatus, obs Observation, now time.Time) Event {
+	display := displayName(obs, family)
+	message := ps.Indicator.Label()
+	if ps.Description != "" {
+		message = ps.Description
+	}
+	return Event{
+		Kind:        KindOutage,
+		Provider:    family,
+		DisplayName: display,
+		Status:      string(ps.Indicator),
+		Title:       fmt.Sprintf("%s status: %s", display, ps.Indicator.Label()),
+		Message:     message,
+		At:          now,
+	}
+}
+
+var defaultThresholds = Thresholds{Warning: 80, Critical: 95}
+
+// thresholds resolves rule's thresholds for one provider window: the rule's
+// own values, then the configured window and provider overrides, then the
+// defaults. ok is false when the window is muted.
+func (d *Dispatcher) thresholds(rule Rule, family, window string) (Thresholds, bool) {
+	resolved := defaultThresholds
+	if d.limits != nil {
+		var never bool
+		if resolved, never = d.limits(family, window); never {
+			return Thresholds{}, false
+		}
+	}
+	if rule.Thresholds.Warning > 0 {
+		resolved.Warning = rule.Thresholds.Warning
+	}
+	if rule.Thresholds.Critical > 0 {
+		resolved.Critical = rule.Thresholds.Critical
+	}
+	return resolved, true
+}
+
+// levelRank orders threshold alerts; the empty kind is below every threshold.
+var levelRank = map[Kind]int{
+	KindWarning:  1,
+	KindCritical: 2,
+}
+
+// severity orders status indicators so only a worsening status alerts.
+var severity = map[status.Indicator]int{
+	status.Maintenance: 1,
+	status.Minor:       2,
+	status.Major:       3,
+	status.Critical:    4,
+}
+
+func worsened(previous, current status.Indicator) bool {
+	return current.HasIssue() && severity[current] > severity[previous]
+}
+
+func displayName(obs Observation, key string) string {
+	if name := obs.DisplayNames[key]; name != "" {
+		return name
+	}
+	return key
+}
+
+func family(name string, data *provider.UsageData) string {
+	if data != nil && data.Provider != "" {
+		return data.Provider
+	}
+	family, _, _ := strings.Cut(name, ":")
+	return family
+}
+
+func sortedKeys(m map[string]*status.ProviderStatus) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
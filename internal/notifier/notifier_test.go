@@ -0,0 +1,175 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+type recordingSink struct {
+	name   string
+	events []Event
+	err    error
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Send(_ context.Context, event Event) error {
+	s.events = append(s.events, event)
+	return s.err
+}
+
+func usage(family, source string, pct float64) *provider.UsageData {
+	return &provider.UsageData{
+		Provider: family, SourceID: source, FetchedAt: time.Now(),
+		Windows: []provider.UsageWindow{{Name: "5h", Utilization: pct, ResetsAt: time.Now().Add(2 * time.Hour)}},
+	}
+}
+
+func kinds(alerts []Alert) []string {
+	out := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		out = append(out, alert.Sink.Name()+":"+alert.Event.Source+":"+string(alert.Event.Kind))
+	}
+	return out
+}
+
+func TestObserveReportsEachCrossingOncePerRuleThresholds(t *testing.T) {
+	desktop := &recordingSink{name: "desktop"}
+	slack := &recordingSink{name: "slack"}
+	d := NewDispatcher([]Rule{
+		{Sink: desktop, Thresholds: Thresholds{Warning: 80, Critical: 95}},
+		{Sink: slack, Thresholds: Thresholds{Warning: 50, Critical: 90}, Providers: []string{"claude:work"}},
+	})
+
+	observe := func(personal, work float64) []string {
+		return kinds(d.Observe(Observation{Results: map[string]*provider.UsageData{
+			"claude":      usage("claude", "", personal),
+			"claude:work": usage("claude", "work", work),
+		}}))
+	}
+
+	if got := observe(10, 60); strings.Join(got, ",") != "slack:claude:work:warning" {
+		t.Fatalf("first observation = %v", got)
+	}
+	if got := observe(10, 65); len(got) != 0 {
+		t.Fatalf("no new crossing should be silent, got %v", got)
+	}
+	if got := observe(85, 92); strings.Join(got, ",") != "desktop:claude:warning,desktop:claude:work:warning,slack:claude:work:critical" {
+		t.Fatalf("second crossing = %v", got)
+	}
+}
+
+func TestObserveKeepsLastGoodUsageAcrossFailures(t *testing.T) {
+	d := NewDispatcher([]Rule{{Sink: &recordingSink{name: "hook"}, Thresholds: Thresholds{Warning: 80, Critical: 95}}})
+	results := func(data *provider.UsageData) Observation {
+		return Observation{Results: map[string]*provider.UsageData{"openai": data}}
+	}
+
+	if got := d.Observe(results(usage("openai", "", 85))); len(got) != 1 {
+		t.Fatalf("initial crossing = %v", kinds(got))
+	}
+	failed := &provider.UsageData{Provider: "openai", Error: "HTTP 502"}
+	if got := d.Observe(results(failed)); len(got) != 0 {
+		t.Fatalf("failed fetch alerted: %v", kinds(got))
+	}
+	if got := d.Observe(results(usage("openai", "", 86))); len(got) != 0 {
+		t.Fatalf("recovery at the same level repeated the warning: %v", kinds(got))
+	}
+}
+
+func TestObserveReportsExpiryAndWorseningOutages(t *testing.T) {
+	sink := &recordingSink{name: "ntfy"}
+	d := NewDispatcher([]Rule{{Sink: sink, Thresholds: Thresholds{Warning: 80, Critical: 95}, Providers: []string{"claude:work"}}})
+	expired := &provider.UsageData{Provider: "claude", SourceID: "work", IsExpired: true}
+
+	obs := Observation{
+		Results:      map[string]*provider.UsageData{"claude:work": expired, "openai": usage("openai", "", 99)},
+		Statuses:     map[string]*status.ProviderStatus{"claude": {Indicator: status.Minor, Description: "Claude Code: Partial outage"}, "openai": {Indicator: status.Major}},
+		DisplayNames: map[string]string{"claude:work": "Claude (Work)", "claude": "Claude"},
+	}
+	alerts := d.Observe(obs)
+	if got := strings.Join(kinds(alerts), ","); got != "ntfy:claude:work:expired,ntfy::outage" {
+		t.Fatalf("alerts = %s", got)
+	}
+	if alerts[0].Event.Title != "Claude (Work) sign-in expired" || alerts[1].Event.Message != "Claude Code: Partial outage" {
+		t.Fatalf("events = %#v", alerts)
+	}
+
+	if got := d.Observe(obs); len(got) != 0 {
+		t.Fatalf("unchanged state alerted again: %v", kinds(got))
+	}
+	obs.Statuses = nil
+	if got := d.Observe(obs); len(got) != 0 {
+		t.Fatalf("skipped status check alerted: %v", kinds(got))
+	}
+	obs.Statuses = map[string]*status.ProviderStatus{"claude": {Indicator: status.Major}}
+	if got := d.Observe(obs); len(got) != 1 || !got[0].Event.Urgent() {
+		t.Fatalf("escalation = %v", kinds(got))
+	}
+}
+
+func TestRuleKindsAndSendJoinsErrors(t *testing.T) {
+	failing := &recordingSink{name: "broken", err: errors.New("HTTP 500")}
+	d := NewDispatcher([]Rule{{Sink: failing, Thresholds: Thresholds{Warning: 80, Critical: 95}, Kinds: []Kind{KindCritical}}})
+
+	alerts := d.Observe(Observation{Results: map[string]*provider.UsageData{
+		"claude": usage("claude", "", 85),
+		"openai": usage("openai", "", 97),
+	}})
+	if got := strings.Join(kinds(alerts), ","); got != "broken:openai:critical" {
+		t.Fatalf("alerts = %s", got)
+	}
+	if err := d.Send(context.Background(), alerts); err == nil || !strings.Contains(err.Error(), "broken: HTTP 500") {
+		t.Fatalf("Send error = %v", err)
+	}
+}
+
+func TestFailedDeliveryIsRetriedOnTheNextObservation(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer srv.Close()
+	sink := NewSink(config.NotificationSink{Type: config.SinkWebhook, URL: srv.URL}, nil)
+	d := NewDispatcher([]Rule{{Sink: sink, Thresholds: Thresholds{Warning: 80, Critical: 95}}})
+	obs := Observation{Results: map[string]*provider.UsageData{"claude": usage("claude", "", 97)}}
+
+	alerts := d.Observe(obs)
+	if got := strings.Join(kinds(alerts), ","); got != "webhook:claude:critical" {
+		t.Fatalf("alerts = %s", got)
+	}
+	if err := d.Send(context.Background(), alerts); err == nil || !strings.Contains(err.Error(), "HTTP 502") {
+		t.Fatalf("Send error = %v", err)
+	}
+
+	fail.Store(false)
+	alerts = d.Observe(obs)
+	if got := strings.Join(kinds(alerts), ","); got != "webhook:claude:critical" {
+		t.Fatalf("retry = %s, want the critical alert again", got)
+	}
+	if err := d.Send(context.Background(), alerts); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Observe(obs); len(got) != 0 {
+		t.Fatalf("delivered alert repeated: %v", kinds(got))
+	}
+	if got := received.Load(); got != 1 {
+		t.Fatalf("deliveries = %d, want 1", got)
+	}
+}
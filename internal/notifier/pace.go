@@ -0,0 +1,171 @@
+package notifier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const defaultRearmPct = 10
+
+// PaceCondition raises a pace alert when a window's projection reaches either
+// limit. Zero limits are off.
+type PaceCondition struct {
+	RunsOutEarlyBy time.Duration
+	ProjectedPct   float64
+	// RearmPct is how far the projection must fall below ProjectedPct before
+	// the alert can fire again in the same reset cycle.
+	RearmPct float64
+}
+
+// Pace holds pace conditions by window length, as returned by
+// forecast.GuessWindowType. The zero key applies to lengths without their own
+// condition.
+type Pace map[time.Duration]PaceCondition
+
+// paceWindowLengths maps notifications.pace keys to window lengths.
+var paceWindowLengths = map[string]time.Duration{
+	"5h":      forecast.FiveHourWindow,
+	"24h":     24 * time.Hour,
+	"7d":      forecast.SevenDayWindow,
+	"30d":     forecast.MonthlyWindow,
+	"default": 0,
+}
+
+// PaceFromConfig returns the configured pace conditions, or nil when none are
+// set.
+func PaceFromConfig(cfg *config.Config) Pace {
+	if cfg == nil || len(cfg.Settings.Notifications.Pace) == 0 {
+		return nil
+	}
+	pace := make(Pace, len(cfg.Settings.Notifications.Pace))
+	for key, alert := range cfg.Settings.Notifications.Pace {
+		windowLen, ok := paceWindowLengths[key]
+		if !ok {
+			continue
+		}
+		condition := PaceCondition{
+			RunsOutEarlyBy: alert.EarlyBy(),
+			ProjectedPct:   alert.ProjectedPct,
+			RearmPct:       alert.RearmPct,
+		}
+		if condition.RearmPct == 0 {
+			condition.RearmPct = defaultRearmPct
+		}
+		if condition.RunsOutEarlyBy > 0 || condition.ProjectedPct > 0 {
+			pace[windowLen] = condition
+		}
+	}
+	return pace
+}
+
+func (p Pace) condition(windowLen time.Duration) (PaceCondition, bool) {
+	if c, ok := p[windowLen]; ok {
+		return c, true
+	}
+	c, ok := p[0]
+	return c, ok
+}
+
+func (c PaceCondition) triggered(proj forecast.Projection) bool {
+	return (c.ProjectedPct > 0 && proj.ProjectedPct >= c.ProjectedPct) ||
+		(c.RunsOutEarlyBy > 0 && !proj.WillLastToReset && proj.RunsOutEarlyBy >= c.RunsOutEarlyBy)
+}
+
+// cleared reports whether the projection has recovered far enough to re-arm
+// the alert. The margin keeps a projection hovering at the limit from
+// alerting on every other poll.
+func (c PaceCondition) cleared(proj forecast.Projection) bool {
+	pctClear := c.ProjectedPct <= 0 || proj.ProjectedPct < c.ProjectedPct-c.RearmPct
+	earlyClear := c.RunsOutEarlyBy <= 0 || proj.WillLastToReset || proj.RunsOutEarlyBy < c.RunsOutEarlyBy/2
+	return pctClear && earlyClear
+}
+
+// paceState tracks whether a source's window has an active pace alert in its
+// current reset cycle.
+type paceState struct {
+	Active   bool      `json:"active"`
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// paceEvents evaluates pace conditions for one reading and returns the alerts
+// that begin with it. It must be called with d.mu held.
+func (d *Dispatcher) paceEvents(name string, data *provider.UsageData, obs Observation, now time.Time) []Event {
+	if len(d.pace) == 0 || data == nil || data.IsExpired || data.Error != "" || data.Stale {
+		return nil
+	}
+	var events []Event
+	for _, window := range data.UsableWindows() {
+		if window.ResetsAt.IsZero() {
+			continue
+		}
+		windowLen := forecast.GuessWindowType(window.Name)
+		condition, ok := d.pace.condition(windowLen)
+		if !ok {
+			continue
+		}
+		if d.limits != nil {
+			if _, never := d.limits(family(name, data), window.Name); never {
+				continue
+			}
+		}
+		key := forecast.ReadingKey(name, window.Name)
+		state := d.state.Pace[key]
+		if !sameCycle(window.ResetsAt, state.ResetsAt, windowLen) {
+			state.Active = false
+		}
+		state.ResetsAt = window.ResetsAt
+
+		current := forecast.Reading{At: data.FetchedAt, Pct: window.Utilization, ResetsAt: window.ResetsAt}
+		proj := obs.Estimator.Project(name, window.Name, current, windowLen)
+		switch {
+		case state.Active:
+			state.Active = !condition.cleared(proj)
+		case window.Utilization < 100 && condition.triggered(proj):
+			// Quota already used up is the critical alert's job.
+			state.Active = true
+			events = append(events, paceEvent(name, data, window, proj, condition, obs, now))
+		}
+		d.state.Pace[key] = state
+	}
+	return events
+}
+
+func paceEvent(name string, data *provider.UsageData, window provider.UsageWindow, proj forecast.Projection, condition PaceCondition, obs Observation, now time.Time) Event {
+	display := displayName(obs, name)
+	title := fmt.Sprintf("%s on pace to run out", display)
+	if proj.WillLastToReset {
+		title = fmt.Sprintf("%s on pace for %.0f%%", display, proj.ProjectedPct)
+	}
+	message := fmt.Sprintf("%s window at %.0f%% — %s", window.Name, window.Utilization, forecast.PaceLabel(proj.ProjectedPct))
+	if note := proj.RunOutNote(); note != "" {
+		message += " · " + note
+	}
+	event := Event{
+		Kind:         KindPace,
+		Provider:     family(name, data),
+		Source:       name,
+		DisplayName:  display,
+		Window:       window.Name,
+		Utilization:  window.Utilization,
+		ProjectedPct: proj.ProjectedPct,
+		ResetsAt:     window.ResetsAt,
+		Title:        title,
+		Message:      message,
+		At:           now,
+	}
+	if condition.ProjectedPct > 0 && proj.ProjectedPct >= condition.ProjectedPct {
+		event.Threshold = condition.ProjectedPct
+	}
+	if !proj.WillLastToReset && proj.RunsOutIn > 0 {
+		at := data.FetchedAt
+		if at.IsZero() {
+			at = now
+		}
+		event.RunsOutAt = at.Add(proj.RunsOutIn)
+	}
+	return event
+}
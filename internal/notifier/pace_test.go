@@ -0,0 +1,83 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/forecast"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func TestPaceAlertsFireOnceWithHysteresisAndRearmAtReset(t *testing.T) {
+	sink := &recordingSink{name: "desktop"}
+	d := NewDispatcher([]Rule{{Sink: sink, Thresholds: Thresholds{Warning: 80, Critical: 95}}})
+	d.SetPace(Pace{forecast.FiveHourWindow: {ProjectedPct: 100, RearmPct: 10}})
+
+	// Two hours into a five-hour window, the average projection is 2.5x the
+	// current usage.
+	resetsAt := time.Now().Add(3 * time.Hour)
+	observe := func(pct float64, resetsAt time.Time) []Alert {
+		return d.Observe(Observation{Results: map[string]*provider.UsageData{"claude": {
+			Provider: "claude", FetchedAt: time.Now(),
+			Windows: []provider.UsageWindow{{Name: "5h", Utilization: pct, ResetsAt: resetsAt}},
+		}}})
+	}
+
+	alerts := observe(41, resetsAt)
+	if got := strings.Join(kinds(alerts), ","); got != "desktop:claude:pace" {
+		t.Fatalf("first projection over 100%% = %s", got)
+	}
+	event := alerts[0].Event
+	if event.Title != "claude on pace to run out" || event.Threshold != 100 || event.ProjectedPct < 100 || event.RunsOutAt.IsZero() {
+		t.Fatalf("pace event = %#v", event)
+	}
+	if got := observe(39, resetsAt); len(got) != 0 {
+		t.Fatalf("projection inside the rearm margin alerted: %v", kinds(got))
+	}
+	if got := observe(41, resetsAt); len(got) != 0 {
+		t.Fatalf("flapping back over the limit alerted again: %v", kinds(got))
+	}
+	if got := observe(30, resetsAt); len(got) != 0 {
+		t.Fatalf("recovery alerted: %v", kinds(got))
+	}
+	if got := observe(41, resetsAt); len(got) != 1 {
+		t.Fatalf("crossing after recovery = %v, want one alert", kinds(got))
+	}
+	if got := observe(41, resetsAt.Add(5*time.Hour)); len(got) != 0 {
+		t.Fatalf("fresh window alerted: %v", kinds(got))
+	}
+}
+
+func TestPaceRunsOutEarlyByUsesWindowTypeOrDefault(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Settings.Notifications.Pace = map[string]config.PaceAlert{
+		"5h":      {RunsOutEarlyBy: "1h"},
+		"default": {RunsOutEarlyBy: "1d"},
+	}
+	pace := PaceFromConfig(cfg)
+	if c, _ := pace.condition(forecast.FiveHourWindow); c.RunsOutEarlyBy != time.Hour || c.RearmPct != defaultRearmPct {
+		t.Fatalf("5h condition = %#v", c)
+	}
+	if c, _ := pace.condition(forecast.SevenDayWindow); c.RunsOutEarlyBy != 24*time.Hour {
+		t.Fatalf("7d falls back to default = %#v", c)
+	}
+
+	d := NewDispatcher([]Rule{{Sink: &recordingSink{name: "hook"}, Kinds: []Kind{KindPace}}})
+	d.SetPace(pace)
+	now := time.Now()
+	results := map[string]*provider.UsageData{
+		// Runs out in 30m, 2h30m before reset.
+		"claude": {Provider: "claude", FetchedAt: now, Windows: []provider.UsageWindow{{Name: "5h", Utilization: 80, ResetsAt: now.Add(3 * time.Hour)}}},
+		// Projects 56% at reset, so no alert.
+		"codex": {Provider: "codex", FetchedAt: now, Windows: []provider.UsageWindow{{Name: "7d", Utilization: 40, ResetsAt: now.Add(2 * 24 * time.Hour)}}},
+	}
+	alerts := d.Observe(Observation{Results: results})
+	if got := strings.Join(kinds(alerts), ","); got != "hook:claude:pace" {
+		t.Fatalf("alerts = %s", got)
+	}
+	if !strings.Contains(alerts[0].Event.Message, "before reset") {
+		t.Fatalf("message = %q", alerts[0].Event.Message)
+	}
+}
@@ -0,0 +1,255 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const (
+	sendTimeout    = 10 * time.Second
+	commandTimeout = 15 * time.Second
+)
+
+// Rules builds one rule per configured sink. Thresholds a sink leaves unset
+// are resolved per window by the dispatcher. resolver, when set, recovers
+// url_env and token_env values a GUI session did not inherit. Each rule's ID
+// is the sink's type and name with a hash of its destination, so sinks
+// sharing a name, or a name with a built-in sink, keep their own record of
+// sent alerts, and reordering sinks in the config keeps every record.
+func Rules(cfg *config.Config, resolver provider.SessionEnvironmentResolver) []Rule {
+	if cfg == nil {
+		return nil
+	}
+	rules := make([]Rule, 0, len(cfg.Settings.Notifications.Sinks))
+	for _, sc := range cfg.Settings.Notifications.Sinks {
+		destination := sha256.Sum256([]byte(sc.URL + "\x00" + sc.URLEnv + "\x00" + sc.Command))
+		rules = append(rules, Rule{
+			Sink:       NewSink(sc, resolver),
+			ID:         fmt.Sprintf("sink:%s:%s:%x", sc.Type, sc.Label(), destination[:8]),
+			Thresholds: Thresholds{Warning: sc.Warning, Critical: sc.Critical},
+			Providers:  sc.Providers,
+		})
+	}
+	return rules
+}
+
+// NewSink returns the sink for one configured destination.
+func NewSink(sc config.NotificationSink, resolver provider.SessionEnvironmentResolver) Sink {
+	base := httpSink{
+		label:    sc.Label(),
+		url:      sc.URL,
+		urlEnv:   sc.URLEnv,
+		tokenEnv: sc.TokenEnv,
+		resolver: resolver,
+		client:   &http.Client{Timeout: sendTimeout},
+	}
+	switch sc.Type {
+	case config.SinkSlack:
+		return &slackSink{base}
+	case config.SinkNtfy:
+		return &ntfySink{base}
+	case config.SinkCommand:
+		return &commandSink{label: sc.Label(), command: sc.Command}
+	default:
+		return &webhookSink{base}
+	}
+}
+
+// httpSink holds what the HTTP-based sinks share. Its errors never include
+// the URL, which for Slack and ntfy is itself the secret.
+type httpSink struct {
+	label    string
+	url      string
+	urlEnv   string
+	tokenEnv string
+	resolver provider.SessionEnvironmentResolver
+	client   *http.Client
+}
+
+func (s *httpSink) Name() string { return s.label }
+
+func (s *httpSink) post(ctx context.Context, contentType string, body []byte, headers map[string]string) error {
+	target := s.url
+	if target == "" {
+		target = s.env(s.urlEnv)
+		if target == "" {
+			return fmt.Errorf("%s is not set", s.urlEnv)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid sink URL")
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "clawmeter")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if s.tokenEnv != "" {
+		token := s.env(s.tokenEnv)
+		if token == "" {
+			return fmt.Errorf("%s is not set", s.tokenEnv)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) env(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if s.resolver == nil {
+		return ""
+	}
+	return s.resolver.ResolveSessionEnvironment(provider.SessionEnvironmentRequest{
+		EnvNames:                        []string{name},
+		AllowSessionEnvironmentFallback: true,
+	})[name]
+}
+
+// webhookSink posts the Event as JSON.
+type webhookSink struct{ httpSink }
+
+func (s *webhookSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, "application/json", body, nil)
+}
+
+// slackSink posts a Slack incoming-webhook message. Mattermost, Discord's
+// /slack endpoint, and other Slack-compatible receivers accept the same shape.
+type slackSink struct{ httpSink }
+
+func (s *slackSink) Send(ctx context.Context, event Event) error {
+	text := fmt.Sprintf("*%s*\n%s", event.Title, event.Message)
+	if event.Urgent() {
+		text = ":rotating_light: " + text
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, "application/json", body, nil)
+}
+
+// ntfySink publishes to an ntfy topic URL: the message is the body and the
+// title, priority, and tags travel as headers.
+type ntfySink struct{ httpSink }
+
+func (s *ntfySink) Send(ctx context.Context, event Event) error {
+	priority := "default"
+	if event.Urgent() {
+		priority = "urgent"
+	} else if event.Kind == KindWarning || event.Kind == KindPace || event.Kind == KindOutage {
+		priority = "high"
+	}
+	headers := map[string]string{
+		"Title":    event.Title,
+		"Priority": priority,
+		"Tags":     "clawmeter," + string(event.Kind),
+	}
+	return s.post(ctx, "text/plain; charset=utf-8", []byte(event.Message), headers)
+}
+
+// writerSink writes one line per event.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink that writes each event as a line of text, for
+// headless frontends whose output is collected by systemd or a log file.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Name() string { return "log" }
+
+func (s *writerSink) Send(_ context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subject := event.Source
+	if subject == "" {
+		subject = event.Provider
+	}
+	_, err := fmt.Fprintf(s.w, "%s %s %s: %s — %s\n", event.At.Format(time.RFC3339), event.Kind, subject, event.Title, event.Message)
+	return err
+}
+
+// commandSink runs a shell command with the event as JSON on stdin and its
+// main fields in CLAWMETER_* environment variables.
+type commandSink struct {
+	label   string
+	command string
+}
+
+func (s *commandSink) Name() string { return s.label }
+
+func (s *commandSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", s.command)
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"CLAWMETER_EVENT="+string(event.Kind),
+		"CLAWMETER_PROVIDER="+event.Provider,
+		"CLAWMETER_SOURCE="+event.Source,
+		"CLAWMETER_WINDOW="+event.Window,
+		"CLAWMETER_UTILIZATION="+strconv.FormatFloat(event.Utilization, 'f', -1, 64),
+		"CLAWMETER_TITLE="+event.Title,
+		"CLAWMETER_MESSAGE="+event.Message,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			if len(detail) > 200 {
+				detail = detail[:200]
+			}
+			return fmt.Errorf("command failed: %w: %s", err, detail)
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+type capturedRequest struct {
+	header http.Header
+	body   string
+}
+
+func captureServer(t *testing.T, code int) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- capturedRequest{header: r.Header.Clone(), body: string(body)}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func testEvent() Event {
+	return Event{
+		Kind: KindCritical, Provider: "claude", Source: "claude:work", DisplayName: "Claude (Work)",
+		Window: "5h", Utilization: 96, Threshold: 95,
+		Title: "Claude (Work) usage critical", Message: "5h window at 96%",
+		At: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookSinkPostsEventJSON(t *testing.T) {
+	srv, requests := captureServer(t, http.StatusNoContent)
+	t.Setenv("CLAWMETER_TEST_TOKEN", "secret-token")
+	sink := NewSink(config.NotificationSink{Type: config.SinkWebhook, URL: srv.URL + "/hook", TokenEnv: "CLAWMETER_TEST_TOKEN"}, nil)
+
+	if err := sink.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	var got Event
+	if err := json.Unmarshal([]byte(req.body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != KindCritical || got.Source != "claude:work" || got.Utilization != 96 {
+		t.Fatalf("posted event = %#v", got)
+	}
+	if req.header.Get("Authorization") != "Bearer secret-token" || req.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("headers = %v", req.header)
+	}
+}
+
+func TestSlackAndNtfySinksFormatForTheirReceivers(t *testing.T) {
+	srv, requests := captureServer(t, http.StatusOK)
+	t.Setenv("CLAWMETER_TEST_SLACK_URL", srv.URL+"/services/T000/B000/XXXX")
+
+	slack := NewSink(config.NotificationSink{Type: config.SinkSlack, URLEnv: "CLAWMETER_TEST_SLACK_URL"}, nil)
+	if err := slack.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]string
+	if err := json.Unmarshal([]byte((<-requests).body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message["text"], "*Claude (Work) usage critical*\n5h window at 96%") {
+		t.Fatalf("slack text = %q", message["text"])
+	}
+
+	ntfy := NewSink(config.NotificationSink{Type: config.SinkNtfy, URL: srv.URL + "/clawmeter"}, nil)
+	if err := ntfy.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.body != "5h window at 96%" || req.header.Get("Title") != "Claude (Work) usage critical" || req.header.Get("Priority") != "urgent" {
+		t.Fatalf("ntfy request = %q %v", req.body, req.header)
+	}
+}
+
+func TestHTTPSinkErrorsDoNotRevealURL(t *testing.T) {
+	srv, _ := captureServer(t, http.StatusForbidden)
+	secretURL := srv.URL + "/services/T000/B000/SECRETPATH"
+	sink := NewSink(config.NotificationSink{Name: "team", Type: config.SinkSlack, URL: secretURL}, nil)
+
+	err := sink.Send(context.Background(), testEvent())
+	if err == nil || err.Error() != "HTTP 403" {
+		t.Fatalf("error = %v, want HTTP 403", err)
+	}
+
+	srv.Close()
+	err = sink.Send(context.Background(), testEvent())
+	if err == nil || strings.Contains(err.Error(), "SECRETPATH") {
+		t.Fatalf("transport error leaked the URL: %v", err)
+	}
+
+	missing := NewSink(config.NotificationSink{Type: config.SinkWebhook, URLEnv: "CLAWMETER_TEST_UNSET_URL"}, nil)
+	if err := missing.Send(context.Background(), testEvent()); err == nil || !strings.Contains(err.Error(), "CLAWMETER_TEST_UNSET_URL is not set") {
+		t.Fatalf("missing env error = %v", err)
+	}
+}
+
+func TestCommandSinkPassesEventOnStdinAndEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "event")
+	sink := NewSink(config.NotificationSink{Type: config.SinkCommand, Command: `{ printf '%s|%s\n' "$CLAWMETER_EVENT" "$CLAWMETER_SOURCE"; cat; } > "` + out + `"`}, nil)
+
+	if err := sink.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, body, _ := strings.Cut(string(data), "\n")
+	if first != "critical|claude:work" || !strings.Contains(body, `"kind":"critical"`) {
+		t.Fatalf("command saw %q", data)
+	}
+
+	failing := NewSink(config.NotificationSink{Type: config.SinkCommand, Command: "echo nope >&2; exit 3"}, nil)
+	if err := failing.Send(context.Background(), testEvent()); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("failing command error = %v", err)
+	}
+}
+
+func TestWriterSinkWritesOneLinePerEvent(t *testing.T) {
+	var buf strings.Builder
+	sink := NewWriterSink(&buf)
+	if err := sink.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-10-18T12:00:00Z critical claude:work: Claude (Work) usage critical — 5h window at 96%\n"
+	if buf.String() != want {
+		t.Fatalf("line = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRulesKeepSeparateStateForSinksWithTheSameName(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Settings.Notifications.Sinks = []config.NotificationSink{
+		{Type: config.SinkWebhook, URL: "https://example.com/a"},
+		{Type: config.SinkWebhook, URL: "https://example.com/b"},
+		{Name: "desktop", Type: config.SinkWebhook, URL: "https://example.com/c"},
+	}
+	desktop := &recordingSink{name: "desktop"}
+	rules := append([]Rule{{Sink: desktop}}, Rules(cfg, nil)...)
+	d := NewDispatcher(rules)
+	d.ApplyConfig(cfg)
+
+	alerts := d.Observe(Observation{Results: map[string]*provider.UsageData{"claude": usage("claude", "", 90)}})
+	if len(alerts) != 4 {
+		t.Fatalf("alerts = %v, want one per sink", kinds(alerts))
+	}
+	seen := make(map[Sink]bool)
+	for _, alert := range alerts {
+		seen[alert.Sink] = true
+	}
+	for _, rule := range rules {
+		if !seen[rule.Sink] {
+			t.Fatalf("sink %s got no alert: %v", rule.Sink.Name(), kinds(alerts))
+		}
+	}
+}
+
+func TestRulesKeepTheirStateWhenSinksMove(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Settings.Notifications.Sinks = []config.NotificationSink{
+		{Name: "team", Type: config.SinkSlack, URLEnv: "TEAM_SLACK_URL"},
+		{Type: config.SinkCommand, Command: "notify-send clawmeter"},
+	}
+	before := make(map[string]bool)
+	for _, rule := range Rules(cfg, nil) {
+		before[rule.ID] = true
+	}
+
+	sinks := cfg.Settings.Notifications.Sinks
+	cfg.Settings.Notifications.Sinks = []config.NotificationSink{
+		{Type: config.SinkWebhook, URL: "https://example.com/new"},
+		sinks[1],
+		sinks[0],
+	}
+	rules := Rules(cfg, nil)
+	if before[rules[0].ID] {
+		t.Fatalf("new sink reused ID %q", rules[0].ID)
+	}
+	for _, rule := range rules[1:] {
+		if !before[rule.ID] {
+			t.Fatalf("moved sink %s was re-keyed as %q (had %v)", rule.Sink.Name(), rule.ID, before)
+		}
+	}
+}
+
+func TestRulesAndDispatcherResolveThresholdsPerWindow(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Settings.NotificationThresholds = config.NotificationConfig{Warning: 70, Critical: 90}
+	cfg.Settings.Notifications.Sinks = []config.NotificationSink{
+		{Type: config.SinkWebhook, URL: "https://example.com/a"},
+		{Name: "team", Type: config.SinkSlack, URL: "https://example.com/b", Critical: 99, Providers: []string{"claude"}},
+	}
+	cfg.Providers["copilot"] = config.ProviderConfig{Enabled: true, Notifications: config.ProviderNotifications{
+		Warning: 90,
+		Windows: map[string]config.WindowNotifications{"premium": {Never: true}, "monthly": {Critical: 98}},
+	}}
+
+	rules := Rules(cfg, nil)
+	if len(rules) != 2 {
+		t.Fatalf("rules = %d, want 2", len(rules))
+	}
+	if rules[0].Thresholds != (Thresholds{}) || rules[0].Sink.Name() != "webhook" {
+		t.Fatalf("rule 0 = %#v", rules[0])
+	}
+	if rules[1].Thresholds != (Thresholds{Critical: 99}) || rules[1].Sink.Name() != "team" || rules[1].Providers[0] != "claude" {
+		t.Fatalf("rule 1 = %#v", rules[1])
+	}
+
+	d := NewDispatcher(rules)
+	d.ApplyConfig(cfg)
+	for _, tt := range []struct {
+		rule           int
+		family, window string
+		want           Thresholds
+		ok             bool
+	}{
+		{rule: 0, family: "claude", window: "5h", want: Thresholds{Warning: 70, Critical: 90}, ok: true},
+		{rule: 1, family: "claude", window: "5h", want: Thresholds{Warning: 70, Critical: 99}, ok: true},
+		{rule: 0, family: "copilot", window: "Monthly", want: Thresholds{Warning: 90, Critical: 98}, ok: true},
+		{rule: 0, family: "copilot", window: "Premium"},
+	} {
+		got, ok := d.thresholds(rules[tt.rule], tt.family, tt.window)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("thresholds(rule %d, %s %s) = %v, %v; want %v, %v", tt.rule, tt.family, tt.window, got, ok, tt.want, tt.ok)
+		}
+	}
+}
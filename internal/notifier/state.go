@@ -0,0 +1,252 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/status"
+)
+
+// state is what a Dispatcher has already reported. With a state file it
+// survives restarts and is shared by every frontend using the same file, so
+// the tray and `clawmeter watch` do not repeat each other's sink alerts.
+type state struct {
+	// Fired records the highest threshold alert sent to a sink for a
+	// source's window in its current reset cycle, keyed by firedKey.
+	Fired map[string]firedLevel `json:"fired,omitempty"`
+	// Sending records threshold alerts handed to Send but not yet delivered,
+	// keyed like Fired, so that they are not raised twice meanwhile.
+	Sending map[string]claim `json:"sending,omitempty"`
+	// Pace records active pace alerts, keyed by forecast.ReadingKey.
+	Pace     map[string]paceState        `json:"pace,omitempty"`
+	Expired  map[string]bool             `json:"expired,omitempty"`
+	Statuses map[string]status.Indicator `json:"statuses,omitempty"`
+	// SnoozedUntil mutes every alert until then.
+	SnoozedUntil time.Time `json:"snoozed_until,omitzero"`
+}
+
+type firedLevel struct {
+	Kind     Kind      `json:"kind"`
+	ResetsAt time.Time `json:"resets_at,omitzero"`
+}
+
+// claim is a threshold alert on its way to a sink.
+type claim struct {
+	Kind     Kind      `json:"kind"`
+	ResetsAt time.Time `json:"resets_at,omitzero"`
+	At       time.Time `json:"at"`
+}
+
+// claimTimeout is how long a claimed alert waits for its delivery to settle
+// before another observation may raise it again, as after a crash mid-send.
+// It outlasts every frontend's delivery deadline.
+const claimTimeout = 2 * time.Minute
+
+func newState() state {
+	return state{
+		Fired:    make(map[string]firedLevel),
+		Sending:  make(map[string]claim),
+		Pace:     make(map[string]paceState),
+		Expired:  make(map[string]bool),
+		Statuses: make(map[string]status.Indicator),
+	}
+}
+
+func firedKey(sink, source, window string) string {
+	return sink + "\x00" + source + "\x00" + window
+}
+
+// sameCycle reports whether two reset times belong to one reset cycle. Reset
+// times can drift by seconds between polls, so only a jump of half a window
+// means a new cycle.
+func sameCycle(a, b time.Time, windowLen time.Duration) bool {
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	return d <= windowLen/2
+}
+
+// stateLockWait bounds how long a dispatcher waits for another process to
+// finish updating the state file. Past it, the update goes ahead unlocked.
+const stateLockWait = 5 * time.Second
+
+// DefaultStatePath returns the shared notification state file beside the
+// usage cache.
+func DefaultStatePath() (string, error) {
+	dir, err := cache.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "notifications.json"), nil
+}
+
+// UseStateFile loads the dispatcher's state from path and keeps it there. The
+// file is re-read before each observation, so dispatchers in separate
+// processes see each other's alerts and snoozes. A missing file starts empty.
+func (d *Dispatcher) UseStateFile(path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.path = path
+	return d.loadLocked()
+}
+
+// lockStateLocked takes the state file's lock, so that another process's
+// read, change, and write of the state cannot interleave with this one's and
+// drop the alerts it recorded. It returns nil without a state file.
+func (d *Dispatcher) lockStateLocked() *cache.FileLock {
+	if d.path == "" {
+		return nil
+	}
+	lock, _ := cache.LockFile(context.Background(), d.path+".lock", stateLockWait)
+	// Another process may have written within the file system's timestamp
+	// granularity of this one's last write, so re-read regardless.
+	d.modTime = time.Time{}
+	return lock
+}
+
+// loadLocked re-reads the state file when another process has changed it
+// since this dispatcher last read or wrote it.
+func (d *Dispatcher) loadLocked() error {
+	if d.path == "" {
+		return nil
+	}
+	info, err := os.Stat(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(d.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	// Unmarshal into made maps so fields the file omits stay usable.
+	loaded := newState()
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	d.state = loaded
+	d.modTime = info.ModTime()
+	return nil
+}
+
+func (d *Dispatcher) saveLocked() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(d.path); err == nil {
+		d.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Snooze mutes every alert until until; a zero time resumes alerts. When the
+// snooze ends, each alert still due arrives once, at its current level.
+func (d *Dispatcher) Snooze(until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.lockStateLocked().Unlock()
+	_ = d.loadLocked()
+	d.state.SnoozedUntil = until
+	return d.saveLocked()
+}
+
+// SnoozedUntil returns when the current snooze ends, or zero when alerts are
+// not snoozed.
+func (d *Dispatcher) SnoozedUntil() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_ = d.loadLocked()
+	if !d.state.SnoozedUntil.After(time.Now()) {
+		return time.Time{}
+	}
+	return d.state.SnoozedUntil
+}
+
+// ApplyConfig takes the per-window thresholds, pace alerts, and quiet hours
+// from cfg.
+func (d *Dispatcher) ApplyConfig(cfg *config.Config) {
+	d.SetPace(PaceFromConfig(cfg))
+	d.SetQuietHours(QuietHoursFromConfig(cfg))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.limits = nil
+	if cfg != nil {
+		d.limits = func(family, window string) (Thresholds, bool) {
+			t, never := cfg.WindowThresholds(family, window)
+			return Thresholds{Warning: t.Warning, Critical: t.Critical}, never
+		}
+	}
+}
+
+// SetQuietHours replaces the daily quiet hours. The zero value has none.
+func (d *Dispatcher) SetQuietHours(quiet QuietHours) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.quiet = quiet
+}
+
+// QuietHours is a daily span, in local time, when alerts are muted. Start and
+// End are offsets from midnight; a span with End before Start crosses
+// midnight.
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// QuietHoursFromConfig returns the configured quiet hours.
+func QuietHoursFromConfig(cfg *config.Config) QuietHours {
+	if cfg == nil {
+		return QuietHours{}
+	}
+	start, end, ok := cfg.Settings.QuietHours.Span()
+	if !ok {
+		return QuietHours{}
+	}
+	return QuietHours{Start: start, End: end}
+}
+
+// Contains reports whether t falls within the quiet hours.
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == q.End {
+		return false
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.Start < q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
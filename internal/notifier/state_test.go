@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func windowUsage(pct float64, resetsAt time.Time) Observation {
+	return Observation{Results: map[string]*provider.UsageData{"claude": {
+		Provider: "claude", FetchedAt: time.Now(),
+		Windows: []provider.UsageWindow{{Name: "5h", Utilization: pct, ResetsAt: resetsAt}},
+	}}}
+}
+
+func TestStateFileDedupsAcrossRestartsUntilTheWindowResets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.json")
+	rules := []Rule{{Sink: &recordingSink{name: "desktop"}, Thresholds: Thresholds{Warning: 80, Critical: 95}}}
+	resetsAt := time.Now().Add(2 * time.Hour)
+
+	first := NewDispatcher(rules)
+	if err := first.UseStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := first.Observe(windowUsage(85, resetsAt)); len(got) != 1 {
+		t.Fatalf("first warning = %v", kinds(got))
+	}
+
+	restarted := NewDispatcher(rules)
+	if err := restarted.UseStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.Observe(windowUsage(86, resetsAt.Add(time.Minute))); len(got) != 0 {
+		t.Fatalf("restart repeated the warning: %v", kinds(got))
+	}
+	if got := restarted.Observe(windowUsage(96, resetsAt)); strings.Join(kinds(got), ",") != "desktop:claude:critical" {
+		t.Fatalf("escalation = %v", kinds(got))
+	}
+	if got := restarted.Observe(windowUsage(85, resetsAt.Add(5*time.Hour))); strings.Join(kinds(got), ",") != "desktop:claude:warning" {
+		t.Fatalf("next reset cycle = %v", kinds(got))
+	}
+}
+
+func TestDispatchersSharingAStateFileAlertOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.json")
+	resetsAt := time.Now().Add(2 * time.Hour)
+	var sent atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		// Each dispatcher stands in for a separate tray, watch, or serve
+		// process; the state file is all they share.
+		d := NewDispatcher([]Rule{{Sink: &recordingSink{name: "desktop"}, Thresholds: Thresholds{Warning: 80}}})
+		if err := d.UseStateFile(path); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			sent.Add(int32(len(d.Observe(windowUsage(85, resetsAt)))))
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if got := sent.Load(); got != 1 {
+		t.Fatalf("alerts sent = %d, want 1", got)
+	}
+}
+
+func TestSnoozeAndQuietHoursDeferAlertsUntilTheyEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.json")
+	rules := []Rule{{Sink: &recordingSink{name: "desktop"}, Thresholds: Thresholds{Warning: 80, Critical: 95}}}
+	resetsAt := time.Now().Add(2 * time.Hour)
+
+	d := NewDispatcher(rules)
+	if err := d.UseStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour)
+	if err := d.Snooze(until); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second process sharing the state file honors the snooze.
+	other := NewDispatcher(rules)
+	if err := other.UseStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.SnoozedUntil(); !got.Equal(until) {
+		t.Fatalf("SnoozedUntil = %v, want %v", got, until)
+	}
+	if got := other.Observe(windowUsage(85, resetsAt)); len(got) != 0 {
+		t.Fatalf("snoozed observation alerted: %v", kinds(got))
+	}
+	if got := other.Observe(windowUsage(96, resetsAt)); len(got) != 0 {
+		t.Fatalf("snoozed observation alerted: %v", kinds(got))
+	}
+	if err := other.Snooze(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	alerts := d.Observe(windowUsage(96, resetsAt))
+	if got := strings.Join(kinds(alerts), ","); got != "desktop:claude:critical" {
+		t.Fatalf("after the snooze = %v, want the current level once", kinds(alerts))
+	}
+	if err := d.Send(context.Background(), alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	since := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	// Quiet from this minute until a minute before it tomorrow.
+	d.SetQuietHours(QuietHours{Start: since, End: since - time.Minute})
+	expired := Observation{Results: map[string]*provider.UsageData{"claude": {Provider: "claude", IsExpired: true}}}
+	if got := d.Observe(expired); len(got) != 0 {
+		t.Fatalf("quiet hours alerted: %v", kinds(got))
+	}
+	d.SetQuietHours(QuietHours{})
+	if got := strings.Join(kinds(d.Observe(expired)), ","); got != "desktop:claude:expired" {
+		t.Fatalf("after quiet hours = %v, want the expiry", got)
+	}
+}
+
+func TestQuietHoursCrossMidnight(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Settings.QuietHours = config.QuietHoursConfig{Start: "22:00", End: "07:30"}
+	quiet := QuietHoursFromConfig(cfg)
+
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	for clock, want := range map[string]bool{"21:59": false, "22:00": true, "03:00": true, "07:29": true, "07:30": false, "12:00": false} {
+		at, _ := time.ParseInLocation("15:04", clock, time.Local)
+		at = day.Add(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+		if got := quiet.Contains(at); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", clock, got, want)
+		}
+	}
+	if (QuietHours{}).Contains(day) {
+		t.Fatal("zero quiet hours muted alerts")
+	}
+}
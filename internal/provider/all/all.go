@@ -12,15 +12,19 @@ import (
 	"github.com/tnunamak/clawmeter/internal/provider/alibaba"
 	"github.com/tnunamak/clawmeter/internal/provider/alibabatoken"
 	"github.com/tnunamak/clawmeter/internal/provider/anthropic"
+	"github.com/tnunamak/clawmeter/internal/provider/anthropicapi"
 	"github.com/tnunamak/clawmeter/internal/provider/antigravity"
 	"github.com/tnunamak/clawmeter/internal/provider/copilot"
+	"github.com/tnunamak/clawmeter/internal/provider/custom"
 	"github.com/tnunamak/clawmeter/internal/provider/deepseek"
 	"github.com/tnunamak/clawmeter/internal/provider/gemini"
 	"github.com/tnunamak/clawmeter/internal/provider/jetbrains"
 	"github.com/tnunamak/clawmeter/internal/provider/kimi"
 	"github.com/tnunamak/clawmeter/internal/provider/kimik2"
+	"github.com/tnunamak/clawmeter/internal/provider/litellm"
 	"github.com/tnunamak/clawmeter/internal/provider/openai"
 	"github.com/tnunamak/clawmeter/internal/provider/openrouter"
+	"github.com/tnunamak/clawmeter/internal/provider/plugin"
 	"github.com/tnunamak/clawmeter/internal/provider/synthetic"
 	"github.com/tnunamak/clawmeter/internal/provider/xai"
 	"github.com/tnunamak/clawmeter/internal/provider/zai"
@@ -41,6 +45,9 @@ var aliases = map[string]string{
 	"alibaba-token-plan": "alibaba_token",
 	"alibaba-token":      "alibaba_token",
 	"bailian-token-plan": "alibaba_token",
+	"anthropic-api":      "anthropic_api",
+	"claude-api":         "anthropic_api",
+	"anthropic-console":  "anthropic_api",
 }
 
 type registration struct {
@@ -64,6 +71,10 @@ var registrations = []registration{
 	{name: "xai", new: func(cfg config.ProviderConfig) provider.Provider { return xai.New(cfg) }},
 	{name: "zai", new: func(cfg config.ProviderConfig) provider.Provider { return zai.New(cfg) }},
 	{name: "claude", new: func(cfg config.ProviderConfig) provider.Provider { return anthropic.New(cfg) }},
+	{name: "anthropic_api", new: func(cfg config.ProviderConfig) provider.Provider { return anthropicapi.New(cfg) }},
+	{name: "litellm", new: func(cfg config.ProviderConfig) provider.Provider { return litellm.New(cfg) }},
+	{name: "custom", new: func(cfg config.ProviderConfig) provider.Provider { return custom.New(cfg) }},
+	{name: "plugin", new: func(cfg config.ProviderConfig) provider.Provider { return plugin.New(cfg) }},
 }
 
 // Register registers all known providers with the given registry and wires
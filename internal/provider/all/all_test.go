@@ -54,8 +54,8 @@ func TestRegisterInjectsResolverIntoEveryEnvCredentialProvider(t *testing.T) {
 	Register(registry, config.DefaultConfig(), resolver)
 
 	want := map[string]bool{
-		"alibaba": true, "alibaba_token": true, "antigravity": true, "claude": true, "copilot": true,
-		"kimi": true, "kimik2": true, "openrouter": true, "synthetic": true,
+		"alibaba": true, "alibaba_token": true, "anthropic_api": true, "antigravity": true, "claude": true, "copilot": true,
+		"kimi": true, "kimik2": true, "litellm": true, "openrouter": true, "synthetic": true,
 		"xai": true, "zai": true,
 	}
 	for name := range want {
@@ -0,0 +1,269 @@
+// Package anthropicapi implements month-to-date Anthropic API spend from the
+// Admin API cost report. It reports organization API billing only; Claude
+// subscription windows belong to the claude provider and are never combined
+// with it.
+package anthropicapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const (
+	costReportURL = "https://api.anthropic.com/v1/organizations/cost_report"
+	apiVersion    = "2023-06-01"
+	maxBody       = 1 << 20
+	// maxPages bounds pagination; a month of daily buckets fits in one page.
+	maxPages = 4
+	timeout  = 10 * time.Second
+)
+
+type Provider struct {
+	cfg                        config.ProviderConfig
+	client                     *http.Client
+	costReportURL              string
+	now                        func() time.Time
+	sessionEnvironmentResolver provider.SessionEnvironmentResolver
+	sourceID, sourceLabel      string
+	sourceCredential           string
+	enrolledSource             bool
+}
+
+type apiError int
+
+func (e apiError) Error() string { return fmt.Sprintf("API returned %d", int(e)) }
+
+func New(cfg config.ProviderConfig) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: timeout}, costReportURL: costReportURL, now: time.Now}
+}
+
+func (p *Provider) SetSessionEnvironmentResolver(r provider.SessionEnvironmentResolver) {
+	p.sessionEnvironmentResolver = r
+}
+func (p *Provider) Name() string        { return "anthropic_api" }
+func (p *Provider) DisplayName() string { return "Anthropic API" }
+func (p *Provider) Description() string { return "Anthropic API month-to-date spend (Admin API)" }
+func (p *Provider) DashboardURL() string {
+	return "https://console.anthropic.com/settings/cost"
+}
+
+// SafeForAutoPolling is false: an Admin API key reads organization billing,
+// so using one waits for an explicit enable.
+func (p *Provider) SafeForAutoPolling() bool { return false }
+func (p *Provider) IsConfigured() bool       { return p.apiKey() != "" }
+
+// CacheTTL is long because the cost report is only updated every few minutes.
+func (p *Provider) CacheTTL() time.Duration { return 10 * time.Minute }
+
+type sourceCapability struct{}
+
+func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
+func (*Provider) DefaultSource() (config.SourceConfig, bool) {
+	return (sourceCapability{}).DefaultSource()
+}
+func (*Provider) ValidateSource(s config.SourceConfig) error {
+	return (sourceCapability{}).ValidateSource(s)
+}
+func (*Provider) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	return (sourceCapability{}).NewSource(cfg, s)
+}
+func (sourceCapability) SourceKinds() []provider.SourceKind {
+	return []provider.SourceKind{
+		{Kind: "native", Summary: "Anthropic Admin API key from config or ANTHROPIC_ADMIN_API_KEY"},
+		{Kind: "env-name", Summary: "Anthropic Admin API key environment variable name", RefUsage: "ANTHROPIC_ADMIN_API_KEY", RefRequired: true, RefCaseInsensitive: true},
+	}
+}
+func (sourceCapability) DefaultSource() (config.SourceConfig, bool) {
+	return config.SourceConfig{ID: "default", Label: "Default", Credential: config.CredentialRef{Kind: "native"}}, true
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (sourceCapability) ValidateSource(s config.SourceConfig) error {
+	kind, ref := strings.TrimSpace(s.Credential.Kind), strings.TrimSpace(s.Credential.Ref)
+	switch kind {
+	case "native":
+		if strings.TrimSpace(s.ID) != "default" || ref != "" {
+			return fmt.Errorf("provider %q source %q cannot use native credentials", "anthropic_api", s.ID)
+		}
+	case "env-name":
+		if !envNamePattern.MatchString(ref) {
+			return fmt.Errorf("provider %q source %q has invalid environment variable name", "anthropic_api", s.ID)
+		}
+	default:
+		return fmt.Errorf("provider %q source %q has unsupported credential kind %q", "anthropic_api", s.ID, kind)
+	}
+	return nil
+}
+func (sourceCapability) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	if err := (sourceCapability{}).ValidateSource(s); err != nil {
+		return nil, err
+	}
+	p := New(cfg)
+	p.sourceID, p.sourceLabel, p.sourceCredential = strings.TrimSpace(s.ID), strings.TrimSpace(s.Label), strings.TrimSpace(s.Credential.Ref)
+	p.enrolledSource = true
+	if s.Credential.Kind == "native" {
+		p.sourceCredential = ""
+	}
+	return p, nil
+}
+func (p *Provider) SourceID() string {
+	if p.sourceID == "" {
+		return "default"
+	}
+	return p.sourceID
+}
+func (p *Provider) SourceLabel() string    { return p.sourceLabel }
+func (p *Provider) IsEnrolledSource() bool { return p.enrolledSource }
+func (p *Provider) SourceRevision() string {
+	if p.sourceCredential == "" {
+		return ""
+	}
+	return provider.CredentialSourceRevision("env-name\x00"+p.sourceCredential, p.apiKey())
+}
+
+func (p *Provider) apiKey() string {
+	if p.sourceCredential != "" {
+		return p.envValue(p.sourceCredential)
+	}
+	if key := strings.TrimSpace(p.cfg.APIKey); key != "" {
+		return key
+	}
+	return p.envValue("ANTHROPIC_ADMIN_API_KEY")
+}
+func (p *Provider) envValue(name string) string {
+	if p.sessionEnvironmentResolver != nil {
+		values := p.sessionEnvironmentResolver.ResolveSessionEnvironment(provider.SessionEnvironmentRequest{EnvNames: []string{name}, AllowSessionEnvironmentFallback: true})
+		return strings.TrimSpace(values[name])
+	}
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+// budget is the source's monthly limit from providers.anthropic_api.budgets,
+// or zero when none is declared.
+func (p *Provider) budget() float64 {
+	b := p.cfg.Budgets[p.SourceID()]
+	if b <= 0 || math.IsNaN(b) || math.IsInf(b, 0) {
+		return 0
+	}
+	return b
+}
+
+type costReport struct {
+	Data []struct {
+		Results []struct {
+			// Amount is a decimal string in cents.
+			Amount   string `json:"amount"`
+			Currency string `json:"currency"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+func (p *Provider) FetchUsage(ctx context.Context) (*provider.UsageData, error) {
+	key := p.apiKey()
+	if key == "" {
+		return nil, fmt.Errorf("credentials: no API key found")
+	}
+	data := &provider.UsageData{Provider: p.Name(), SourceID: p.SourceID(), SourceLabel: p.SourceLabel(), FetchedAt: p.now()}
+	now := p.now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	spend, err := p.monthToDate(ctx, key, monthStart)
+	if err != nil {
+		var status apiError
+		if errors.As(err, &status) && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+			data.IsExpired, data.InvalidatesPriorUsage, data.Error = true, true, "Anthropic Admin API key expired or unauthorized"
+			return data, nil
+		}
+		return nil, err
+	}
+	budget := p.budget()
+	if budget == 0 {
+		data.Warning = fmt.Sprintf("$%.2f spent this month; set providers.anthropic_api.budgets.%s to track it", spend, p.SourceID())
+		return data, nil
+	}
+	data.Windows = append(data.Windows, provider.UsageWindow{
+		Name:        "monthly",
+		DisplayName: "API spend",
+		Utilization: math.Min(100, spend/budget*100),
+		ResetsAt:    monthStart.AddDate(0, 1, 0),
+		Limit:       int(budget),
+		Used:        int(spend),
+	})
+	return data, nil
+}
+
+// monthToDate sums the cost report's daily buckets since monthStart, in
+// dollars. The report is USD-only.
+func (p *Provider) monthToDate(ctx context.Context, key string, monthStart time.Time) (float64, error) {
+	query := url.Values{}
+	query.Set("starting_at", monthStart.Format(time.RFC3339))
+	query.Set("bucket_width", "1d")
+	query.Set("limit", "31")
+	cents := 0.0
+	for page := 0; page < maxPages; page++ {
+		var report costReport
+		if err := p.request(ctx, p.costReportURL+"?"+query.Encode(), key, &report); err != nil {
+			return 0, err
+		}
+		if report.Data == nil {
+			return 0, fmt.Errorf("decode response: missing data")
+		}
+		for _, bucket := range report.Data {
+			for _, result := range bucket.Results {
+				if result.Currency != "" && !strings.EqualFold(result.Currency, "USD") {
+					return 0, fmt.Errorf("decode response: unsupported currency")
+				}
+				amount, err := strconv.ParseFloat(strings.TrimSpace(result.Amount), 64)
+				if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+					return 0, fmt.Errorf("decode response: invalid amount")
+				}
+				cents += amount
+			}
+		}
+		if !report.HasMore || report.NextPage == "" {
+			return math.Max(0, cents/100), nil
+		}
+		query.Set("page", report.NextPage)
+	}
+	return 0, fmt.Errorf("decode response: cost report has too many pages")
+}
+
+func (p *Provider) request(ctx context.Context, url, key string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", key)
+	req.Header.Set("anthropic-version", apiVersion)
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBody)).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+var _ provider.SourceCapability = (*Provider)(nil)
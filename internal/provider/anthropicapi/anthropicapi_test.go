@@ -0,0 +1,100 @@
+package anthropicapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func adminServer(t *testing.T, cfg config.ProviderConfig, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg.APIKey = "sk-ant-admin-secret"
+	p := New(cfg)
+	p.client, p.costReportURL = server.Client(), server.URL+"/v1/organizations/cost_report"
+	p.now = func() time.Time { return time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC) }
+	return p
+}
+
+func TestFetchSumsMonthToDateAgainstBudget(t *testing.T) {
+	p := adminServer(t, config.ProviderConfig{Budgets: map[string]float64{"default": 500}}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-ant-admin-secret" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if got := r.URL.Query().Get("starting_at"); got != "2026-10-01T00:00:00Z" {
+			t.Errorf("starting_at = %q", got)
+		}
+		if r.URL.Query().Get("page") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"results":[{"currency":"USD","amount":"5000.5"},{"currency":"USD","amount":"2500"}]}],"has_more":true,"next_page":"p2"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"results":[{"currency":"USD","amount":"4999.5"}]},{"results":[]}],"has_more":false}`))
+	})
+	data, err := p.FetchUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Windows) != 1 || len(data.Balances) != 0 {
+		t.Fatalf("data = %+v", data)
+	}
+	w := data.Windows[0]
+	if w.Name != "monthly" || w.Utilization != 25 || w.Used != 125 || w.Limit != 500 || !w.ResetsAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("window = %+v", w)
+	}
+}
+
+func TestFetchWithoutBudgetReportsSpendOnly(t *testing.T) {
+	p := adminServer(t, config.ProviderConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"results":[{"currency":"USD","amount":"1234"}]}],"has_more":false}`))
+	})
+	data, err := p.FetchUsage(context.Background())
+	if err != nil || len(data.Windows) != 0 || !strings.HasPrefix(data.Warning, "$12.34 spent this month") {
+		t.Fatalf("data = %+v, err = %v", data, err)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	status, body := http.StatusOK, `{"data":[{"results":[{"currency":"USD","amount":"lots"}]}]}`
+	p := adminServer(t, config.ProviderConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	if _, err := p.FetchUsage(context.Background()); provider.SafeFetchError(err) != "provider response unavailable" {
+		t.Fatalf("bad amount = %v", err)
+	}
+	body = `{"data":[{"results":[{"currency":"EUR","amount":"1"}]}]}`
+	if _, err := p.FetchUsage(context.Background()); err == nil {
+		t.Fatal("non-USD cost accepted")
+	}
+	status = http.StatusForbidden
+	data, err := p.FetchUsage(context.Background())
+	if err != nil || !data.IsExpired || !data.InvalidatesPriorUsage {
+		t.Fatalf("forbidden = %+v, %v", data, err)
+	}
+}
+
+func TestSourcesUseTheirOwnKeyAndBudget(t *testing.T) {
+	t.Setenv("ANTHROPIC_ADMIN_API_KEY", "default-key")
+	t.Setenv("ANTHROPIC_RESEARCH_ADMIN_KEY", "research-key")
+	cfg := config.ProviderConfig{Budgets: map[string]float64{"default": 100, "research": 250}}
+	sourced, err := (sourceCapability{}).NewSource(cfg, config.SourceConfig{ID: "research", Credential: config.CredentialRef{Kind: "env-name", Ref: "ANTHROPIC_RESEARCH_ADMIN_KEY"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := sourced.(*Provider)
+	if p.apiKey() != "research-key" || p.budget() != 250 {
+		t.Fatalf("key = %q budget = %v", p.apiKey(), p.budget())
+	}
+	revision := p.SourceRevision()
+	t.Setenv("ANTHROPIC_RESEARCH_ADMIN_KEY", "rotated-key")
+	if revision == "" || p.SourceRevision() == revision {
+		t.Fatal("revision did not change with the key")
+	}
+}
@@ -0,0 +1,411 @@
+// Package custom implements a provider declared entirely in config: each
+// enrolled source names a JSON usage endpoint and path expressions that map
+// its response into windows and balances, so a new backend needs no release.
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const (
+	maxBody = 1 << 20
+	timeout = 10 * time.Second
+)
+
+type Provider struct {
+	cfg                        config.ProviderConfig
+	client                     *http.Client
+	sessionEnvironmentResolver provider.SessionEnvironmentResolver
+	sourceID, sourceLabel      string
+	sourceCredential           string
+	enrolledSource             bool
+	endpoint                   *endpoint
+}
+
+// endpoint is a validated config.CustomEndpoint.
+type endpoint struct {
+	displayName  string
+	url          string
+	dashboardURL string
+	authHeader   string
+	authPrefix   string
+	windows      []windowMapping
+	balances     []balanceMapping
+}
+
+type windowMapping struct {
+	name, displayName, resetPolicy     string
+	utilization, used, limit, resetsAt path
+}
+
+type balanceMapping struct {
+	name, displayName      string
+	total, used, remaining path
+}
+
+func New(cfg config.ProviderConfig) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *Provider) SetSessionEnvironmentResolver(r provider.SessionEnvironmentResolver) {
+	p.sessionEnvironmentResolver = r
+}
+func (p *Provider) Name() string { return "custom" }
+func (p *Provider) DisplayName() string {
+	if p.endpoint != nil && p.endpoint.displayName != "" {
+		return p.endpoint.displayName
+	}
+	return "Custom"
+}
+func (p *Provider) Description() string { return "Usage endpoint declared in config" }
+func (p *Provider) DashboardURL() string {
+	if p.endpoint != nil {
+		return p.endpoint.dashboardURL
+	}
+	return ""
+}
+func (p *Provider) SafeForAutoPolling() bool { return true }
+
+// IsConfigured needs an endpoint and, for env-name sources, a credential.
+func (p *Provider) IsConfigured() bool {
+	return p.endpoint != nil && (p.sourceCredential == "" || p.apiKey() != "")
+}
+
+type sourceCapability struct{}
+
+func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
+func (*Provider) DefaultSource() (config.SourceConfig, bool) {
+	return (sourceCapability{}).DefaultSource()
+}
+func (*Provider) ValidateSource(s config.SourceConfig) error {
+	return (sourceCapability{}).ValidateSource(s)
+}
+func (*Provider) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	return (sourceCapability{}).NewSource(cfg, s)
+}
+func (sourceCapability) SourceKinds() []provider.SourceKind {
+	return []provider.SourceKind{
+		{Kind: "native", Summary: "Endpoint that needs no credential"},
+		{Kind: "env-name", Summary: "Credential environment variable name", RefUsage: "GATEWAY_API_KEY", RefRequired: true, RefCaseInsensitive: true},
+	}
+}
+
+// DefaultSource is absent: every custom source is declared explicitly.
+func (sourceCapability) DefaultSource() (config.SourceConfig, bool) {
+	return config.SourceConfig{}, false
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (sourceCapability) ValidateSource(s config.SourceConfig) error {
+	kind, ref := strings.TrimSpace(s.Credential.Kind), strings.TrimSpace(s.Credential.Ref)
+	switch kind {
+	case "native":
+		if ref != "" {
+			return fmt.Errorf("provider %q source %q native credentials take no reference", "custom", s.ID)
+		}
+	case "env-name":
+		if !envNamePattern.MatchString(ref) {
+			return fmt.Errorf("provider %q source %q has invalid environment variable name", "custom", s.ID)
+		}
+	default:
+		return fmt.Errorf("provider %q source %q has unsupported credential kind %q", "custom", s.ID, kind)
+	}
+	return nil
+}
+
+// NewSource binds a source to its endpoint. A source without one still
+// registers, so it stays visible and reports the missing endpoint.
+func (sourceCapability) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	if err := (sourceCapability{}).ValidateSource(s); err != nil {
+		return nil, err
+	}
+	p := New(cfg)
+	p.sourceID, p.sourceLabel, p.sourceCredential = strings.TrimSpace(s.ID), strings.TrimSpace(s.Label), strings.TrimSpace(s.Credential.Ref)
+	p.enrolledSource = true
+	if s.Credential.Kind == "native" {
+		p.sourceCredential = ""
+	}
+	if spec, ok := cfg.Endpoints[p.sourceID]; ok {
+		e, err := compileEndpoint(spec)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint: %w", err)
+		}
+		p.endpoint = e
+	}
+	return p, nil
+}
+func (p *Provider) SourceID() string {
+	if p.sourceID == "" {
+		return "default"
+	}
+	return p.sourceID
+}
+func (p *Provider) SourceLabel() string    { return p.sourceLabel }
+func (p *Provider) IsEnrolledSource() bool { return p.enrolledSource }
+
+// SourceRevision covers the endpoint URL as well as the credential, so
+// pointing a source at another backend invalidates its cached reading.
+func (p *Provider) SourceRevision() string {
+	route := "native"
+	if p.sourceCredential != "" {
+		route = "env-name\x00" + p.sourceCredential
+	}
+	if p.endpoint != nil {
+		route += "\x00" + p.endpoint.url
+	}
+	return provider.CredentialSourceRevision(route, p.apiKey())
+}
+
+func (p *Provider) apiKey() string {
+	if p.sourceCredential == "" {
+		return ""
+	}
+	names := []string{p.sourceCredential}
+	if p.sessionEnvironmentResolver != nil {
+		values := p.sessionEnvironmentResolver.ResolveSessionEnvironment(provider.SessionEnvironmentRequest{EnvNames: names, AllowSessionEnvironmentFallback: true})
+		return strings.TrimSpace(values[p.sourceCredential])
+	}
+	return strings.TrimSpace(os.Getenv(p.sourceCredential))
+}
+
+func compileEndpoint(spec config.CustomEndpoint) (*endpoint, error) {
+	u, err := url.Parse(strings.TrimSpace(spec.URL))
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("url must not embed credentials; use an env-name source")
+	}
+	if u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		return nil, fmt.Errorf("url must use https unless the host is loopback")
+	}
+	e := &endpoint{
+		displayName:  strings.TrimSpace(spec.DisplayName),
+		url:          u.String(),
+		dashboardURL: strings.TrimSpace(spec.DashboardURL),
+		authHeader:   strings.TrimSpace(spec.AuthHeader),
+	}
+	if e.authHeader == "" {
+		e.authHeader = "Authorization"
+	}
+	switch scheme := strings.TrimSpace(spec.AuthScheme); {
+	case strings.EqualFold(scheme, "none"):
+	case scheme != "":
+		e.authPrefix = scheme + " "
+	case strings.EqualFold(e.authHeader, "Authorization"):
+		e.authPrefix = "Bearer "
+	}
+	if len(spec.Windows) == 0 && len(spec.Balances) == 0 {
+		return nil, fmt.Errorf("declare at least one window or balance")
+	}
+	for _, w := range spec.Windows {
+		m := windowMapping{name: strings.TrimSpace(w.Name), displayName: strings.TrimSpace(w.DisplayName), resetPolicy: strings.TrimSpace(w.ResetPolicy)}
+		if m.name == "" {
+			return nil, fmt.Errorf("window needs a name")
+		}
+		if w.Utilization == "" && (w.Used == "" || w.Limit == "") {
+			return nil, fmt.Errorf("window %q needs utilization or used and limit", m.name)
+		}
+		for _, field := range []struct {
+			expr string
+			dst  *path
+		}{{w.Utilization, &m.utilization}, {w.Used, &m.used}, {w.Limit, &m.limit}, {w.ResetsAt, &m.resetsAt}} {
+			if field.expr == "" {
+				continue
+			}
+			if *field.dst, err = compilePath(field.expr); err != nil {
+				return nil, fmt.Errorf("window %q: %w", m.name, err)
+			}
+		}
+		e.windows = append(e.windows, m)
+	}
+	for _, b := range spec.Balances {
+		m := balanceMapping{name: strings.TrimSpace(b.Name), displayName: strings.TrimSpace(b.DisplayName)}
+		if m.name == "" {
+			return nil, fmt.Errorf("balance needs a name")
+		}
+		set := 0
+		for _, field := range []struct {
+			expr string
+			dst  *path
+		}{{b.Total, &m.total}, {b.Used, &m.used}, {b.Remaining, &m.remaining}} {
+			if field.expr == "" {
+				continue
+			}
+			if *field.dst, err = compilePath(field.expr); err != nil {
+				return nil, fmt.Errorf("balance %q: %w", m.name, err)
+			}
+			set++
+		}
+		if set < 2 && m.remaining == nil {
+			return nil, fmt.Errorf("balance %q needs remaining or two of total, used, and remaining", m.name)
+		}
+		e.balances = append(e.balances, m)
+	}
+	return e, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// FetchUsage errors never include the endpoint URL or response body; they
+// pass through provider.SafeFetchError before reaching output or the cache.
+func (p *Provider) FetchUsage(ctx context.Context) (*provider.UsageData, error) {
+	data := &provider.UsageData{Provider: p.Name(), SourceID: p.SourceID(), SourceLabel: p.SourceLabel(), FetchedAt: time.Now()}
+	if p.endpoint == nil {
+		data.Error = fmt.Sprintf("no endpoint configured; add providers.custom.endpoints.%s to config", p.SourceID())
+		return data, nil
+	}
+	key := p.apiKey()
+	if p.sourceCredential != "" && key == "" {
+		return nil, fmt.Errorf("credentials: no API key found")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed")
+	}
+	if key != "" {
+		req.Header.Set(p.endpoint.authHeader, p.endpoint.authPrefix+key)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// url.Error carries the URL; keep only the transport cause.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		data.IsExpired, data.InvalidatesPriorUsage, data.Error = true, true, "credential expired or unauthorized"
+		return data, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("endpoint returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(body) > maxBody {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxBody)
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("decode response: invalid JSON")
+	}
+	if err := p.endpoint.apply(doc, data); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return data, nil
+}
+
+// apply maps doc into data. A mapping whose values are absent or null is
+// skipped, e.g. a budget with no limit set; a mapping whose values have the
+// wrong type is an error.
+func (e *endpoint) apply(doc any, data *provider.UsageData) error {
+	for _, m := range e.windows {
+		w := provider.UsageWindow{Name: m.name, DisplayName: m.displayName, ResetPolicy: m.resetPolicy}
+		if m.utilization != nil {
+			pct, ok, err := number(m.utilization.lookup(doc))
+			if err != nil {
+				return fmt.Errorf("window %q utilization: %w", m.name, err)
+			}
+			if !ok {
+				continue
+			}
+			w.Utilization = pct
+		}
+		if m.used != nil && m.limit != nil {
+			used, usedOK, err := number(m.used.lookup(doc))
+			if err != nil {
+				return fmt.Errorf("window %q used: %w", m.name, err)
+			}
+			limit, limitOK, err := number(m.limit.lookup(doc))
+			if err != nil {
+				return fmt.Errorf("window %q limit: %w", m.name, err)
+			}
+			if usedOK && limitOK && limit > 0 {
+				w.Used, w.Limit = int(used), int(limit)
+				if m.utilization == nil {
+					w.Utilization = used / limit * 100
+				}
+			} else if m.utilization == nil {
+				continue
+			}
+		}
+		if !finite(w.Utilization) {
+			return fmt.Errorf("window %q utilization is not finite", m.name)
+		}
+		w.Utilization = math.Max(0, w.Utilization)
+		if m.resetsAt != nil {
+			at, ok, err := timestamp(m.resetsAt.lookup(doc))
+			if err != nil {
+				return fmt.Errorf("window %q resets_at: %w", m.name, err)
+			}
+			if ok {
+				w.ResetsAt = at
+			}
+		}
+		data.Windows = append(data.Windows, w)
+	}
+	for _, m := range e.balances {
+		var values [3]float64
+		var present [3]bool
+		for i, field := range []path{m.total, m.used, m.remaining} {
+			if field == nil {
+				continue
+			}
+			v, ok, err := number(field.lookup(doc))
+			if err != nil {
+				return fmt.Errorf("balance %q: %w", m.name, err)
+			}
+			if ok && !finite(v) {
+				return fmt.Errorf("balance %q is not finite", m.name)
+			}
+			values[i], present[i] = v, ok
+		}
+		total, used, remaining := values[0], values[1], values[2]
+		switch {
+		case present[0] && present[1] && !present[2]:
+			remaining = total - used
+		case present[0] && present[2] && !present[1]:
+			used = total - remaining
+		case present[1] && present[2] && !present[0]:
+			total = used + remaining
+		case !present[2] && !(present[0] && present[1]):
+			continue
+		}
+		data.Balances = append(data.Balances, provider.UsageBalance{Name: m.name, DisplayName: m.displayName, Total: total, Used: used, Remaining: remaining})
+	}
+	if len(data.Windows) == 0 && len(data.Balances) == 0 {
+		return fmt.Errorf("no declared window or balance is present")
+	}
+	return nil
+}
+
+func finite(f float64) bool { return !math.IsNaN(f) && !math.IsInf(f, 0) }
+
+var _ provider.SourceCapability = (*Provider)(nil)
@@ -0,0 +1,202 @@
+package custom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// path is a compiled expression selecting one value from a decoded JSON
+// document. The syntax is a small gjson-style subset:
+//
+//	data.budget.spend          object keys, separated by dots
+//	windows.0.used             array index
+//	windows.#                  array length
+//	keys.#(name==team).spend   first array element whose field equals a value
+//
+// A leading "$." is accepted for JSONPath habits, and "\." escapes a dot in
+// a key.
+type path []segment
+
+type segment struct {
+	key string
+	// query selects the first array element where field equals value.
+	query *query
+}
+
+type query struct {
+	field path
+	value string
+}
+
+func compilePath(expr string) (path, error) {
+	expr = strings.TrimSpace(expr)
+	expr = strings.TrimPrefix(strings.TrimPrefix(expr, "$"), ".")
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	parts, err := splitPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	out := make(path, 0, len(parts))
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("path %q has an empty segment", expr)
+		}
+		if !strings.HasPrefix(part, "#(") {
+			out = append(out, segment{key: part})
+			continue
+		}
+		if !strings.HasSuffix(part, ")") {
+			return nil, fmt.Errorf("path %q has an unterminated query", expr)
+		}
+		field, value, ok := strings.Cut(part[2:len(part)-1], "==")
+		if !ok {
+			return nil, fmt.Errorf("path %q query needs field==value", expr)
+		}
+		fieldPath, err := compilePath(field)
+		if err != nil {
+			return nil, fmt.Errorf("path %q query: %w", expr, err)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		out = append(out, segment{query: &query{field: fieldPath, value: value}})
+	}
+	return out, nil
+}
+
+// splitPath splits on dots outside query parentheses, honouring "\.".
+func splitPath(expr string) ([]string, error) {
+	var parts []string
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\\' && i+1 < len(expr):
+			i++
+			b.WriteByte(expr[i])
+		case c == '(':
+			depth++
+			b.WriteByte(c)
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("path %q has unbalanced parentheses", expr)
+			}
+			depth--
+			b.WriteByte(c)
+		case c == '.' && depth == 0:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("path %q has unbalanced parentheses", expr)
+	}
+	return append(parts, b.String()), nil
+}
+
+// lookup returns the selected value, or nil when any segment is missing.
+func (p path) lookup(doc any) any {
+	v := doc
+	for _, seg := range p {
+		switch node := v.(type) {
+		case map[string]any:
+			if seg.query != nil {
+				return nil
+			}
+			v = node[seg.key]
+		case []any:
+			v = seg.selectElement(node)
+		default:
+			return nil
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+func (s segment) selectElement(items []any) any {
+	if s.query != nil {
+		for _, item := range items {
+			if field := s.query.field.lookup(item); field != nil && scalarString(field) == s.query.value {
+				return item
+			}
+		}
+		return nil
+	}
+	if s.key == "#" {
+		return float64(len(items))
+	}
+	i, err := strconv.Atoi(s.key)
+	if err != nil || i < 0 || i >= len(items) {
+		return nil
+	}
+	return items[i]
+}
+
+func scalarString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// number reads a JSON number or numeric string. Absent and null values
+// report ok=false without an error.
+func number(v any) (f float64, ok bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return v, true, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("not a number")
+		}
+		return f, true, nil
+	default:
+		return 0, false, fmt.Errorf("not a number")
+	}
+}
+
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// timestamp reads an RFC 3339 string, a zone-less date and time (taken as
+// UTC), or Unix seconds; values too large for seconds are milliseconds.
+func timestamp(v any) (t time.Time, ok bool, err error) {
+	if s, isString := v.(string); isString {
+		s = strings.TrimSpace(s)
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true, nil
+			}
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return time.Time{}, false, fmt.Errorf("not a timestamp")
+		}
+	}
+	f, ok, err := number(v)
+	if !ok || err != nil {
+		return time.Time{}, ok, err
+	}
+	if f > 1e12 {
+		return time.UnixMilli(int64(f)), true, nil
+	}
+	return time.Unix(int64(f), 0), true, nil
+}
@@ -49,6 +49,9 @@ func (p *Provider) DashboardURL() string     { return "https://platform.deepseek
 func (p *Provider) SafeForAutoPolling() bool { return true }
 func (p *Provider) IsConfigured() bool       { return p.apiKey() != "" }
 
+// CacheTTL is long because the balance only moves as requests are billed.
+func (p *Provider) CacheTTL() time.Duration { return 10 * time.Minute }
+
 type sourceCapability struct{}
 
 func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
@@ -0,0 +1,321 @@
+// Package litellm implements key and team budgets from a self-hosted LiteLLM
+// proxy, read through its /key/info and /team/info endpoints.
+package litellm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+const (
+	// defaultBaseURL is where `litellm` serves the proxy unless told otherwise.
+	defaultBaseURL = "http://localhost:4000"
+	timeout        = 10 * time.Second
+	maxBody        = 1 << 20
+)
+
+type Provider struct {
+	cfg                        config.ProviderConfig
+	client                     *http.Client
+	sessionEnvironmentResolver provider.SessionEnvironmentResolver
+	sourceID, sourceLabel      string
+	sourceCredential           string
+	enrolledSource             bool
+}
+
+type apiError int
+
+func (e apiError) Error() string { return fmt.Sprintf("API returned %d", int(e)) }
+
+func New(cfg config.ProviderConfig) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *Provider) SetSessionEnvironmentResolver(r provider.SessionEnvironmentResolver) {
+	p.sessionEnvironmentResolver = r
+}
+func (p *Provider) Name() string        { return "litellm" }
+func (p *Provider) DisplayName() string { return "LiteLLM" }
+func (p *Provider) Description() string { return "LiteLLM proxy key and team budgets" }
+func (p *Provider) DashboardURL() string {
+	base, err := p.baseURL()
+	if err != nil {
+		return ""
+	}
+	return base + "/ui"
+}
+
+// SafeForAutoPolling is false: the proxy is the user's own infrastructure,
+// so polling it waits for an explicit enable.
+func (p *Provider) SafeForAutoPolling() bool { return false }
+func (p *Provider) IsConfigured() bool       { return p.apiKey() != "" }
+
+// CacheTTL is longer than the default because spend only moves as requests
+// are billed.
+func (p *Provider) CacheTTL() time.Duration { return 5 * time.Minute }
+
+type sourceCapability struct{}
+
+func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
+func (*Provider) DefaultSource() (config.SourceConfig, bool) {
+	return (sourceCapability{}).DefaultSource()
+}
+func (*Provider) ValidateSource(s config.SourceConfig) error {
+	return (sourceCapability{}).ValidateSource(s)
+}
+func (*Provider) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	return (sourceCapability{}).NewSource(cfg, s)
+}
+func (sourceCapability) SourceKinds() []provider.SourceKind {
+	return []provider.SourceKind{
+		{Kind: "native", Summary: "LiteLLM virtual key from config or LITELLM_API_KEY"},
+		{Kind: "env-name", Summary: "LiteLLM virtual key environment variable name", RefUsage: "LITELLM_API_KEY", RefRequired: true, RefCaseInsensitive: true},
+	}
+}
+func (sourceCapability) DefaultSource() (config.SourceConfig, bool) {
+	return config.SourceConfig{ID: "default", Label: "Default", Credential: config.CredentialRef{Kind: "native"}}, true
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (sourceCapability) ValidateSource(s config.SourceConfig) error {
+	kind, ref := strings.TrimSpace(s.Credential.Kind), strings.TrimSpace(s.Credential.Ref)
+	switch kind {
+	case "native":
+		if strings.TrimSpace(s.ID) != "default" || ref != "" {
+			return fmt.Errorf("provider %q source %q cannot use native credentials", "litellm", s.ID)
+		}
+	case "env-name":
+		if !envNamePattern.MatchString(ref) {
+			return fmt.Errorf("provider %q source %q has invalid environment variable name", "litellm", s.ID)
+		}
+	default:
+		return fmt.Errorf("provider %q source %q has unsupported credential kind %q", "litellm", s.ID, kind)
+	}
+	return nil
+}
+func (sourceCapability) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	if err := (sourceCapability{}).ValidateSource(s); err != nil {
+		return nil, err
+	}
+	p := New(cfg)
+	p.sourceID, p.sourceLabel, p.sourceCredential = strings.TrimSpace(s.ID), strings.TrimSpace(s.Label), strings.TrimSpace(s.Credential.Ref)
+	p.enrolledSource = true
+	if s.Credential.Kind == "native" {
+		p.sourceCredential = ""
+	}
+	return p, nil
+}
+func (p *Provider) SourceID() string {
+	if p.sourceID == "" {
+		return "default"
+	}
+	return p.sourceID
+}
+func (p *Provider) SourceLabel() string    { return p.sourceLabel }
+func (p *Provider) IsEnrolledSource() bool { return p.enrolledSource }
+func (p *Provider) SourceRevision() string {
+	if p.sourceCredential == "" {
+		return ""
+	}
+	base, _ := p.baseURL()
+	return provider.CredentialSourceRevision("env-name\x00"+p.sourceCredential+"\x00"+base, p.apiKey())
+}
+
+func (p *Provider) apiKey() string {
+	if p.sourceCredential != "" {
+		return p.envValue(p.sourceCredential)
+	}
+	if key := strings.TrimSpace(p.cfg.APIKey); key != "" {
+		return key
+	}
+	return p.envValue("LITELLM_API_KEY")
+}
+func (p *Provider) envValue(name string) string {
+	if p.sessionEnvironmentResolver != nil {
+		values := p.sessionEnvironmentResolver.ResolveSessionEnvironment(provider.SessionEnvironmentRequest{EnvNames: []string{name}, AllowSessionEnvironmentFallback: true})
+		return strings.TrimSpace(values[name])
+	}
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+// baseURL is the proxy address from extra.base_url, else LITELLM_BASE_URL,
+// else the proxy's default. Keys only travel over HTTPS or to loopback.
+func (p *Provider) baseURL() (string, error) {
+	raw := ""
+	if p.cfg.Extra != nil {
+		if v, ok := p.cfg.Extra["base_url"].(string); ok {
+			raw = strings.TrimSpace(v)
+		}
+	}
+	if raw == "" {
+		raw = p.envValue("LITELLM_BASE_URL")
+	}
+	if raw == "" {
+		raw = defaultBaseURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil || u.RawQuery != "" {
+		return "", fmt.Errorf("base_url must be an http(s) URL without credentials or query")
+	}
+	if u.Scheme == "http" && !isLoopback(u.Hostname()) {
+		return "", fmt.Errorf("base_url must use https unless the host is loopback")
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// budget is the part of a LiteLLM key or team record clawmeter reads.
+type budget struct {
+	Spend          *float64 `json:"spend"`
+	MaxBudget      *float64 `json:"max_budget"`
+	BudgetDuration string   `json:"budget_duration"`
+	BudgetResetAt  string   `json:"budget_reset_at"`
+}
+
+type keyInfoResponse struct {
+	Info struct {
+		budget
+		TeamID string `json:"team_id"`
+	} `json:"info"`
+}
+
+type teamInfoResponse struct {
+	TeamInfo struct {
+		budget
+		TeamAlias string `json:"team_alias"`
+	} `json:"team_info"`
+}
+
+func (p *Provider) FetchUsage(ctx context.Context) (*provider.UsageData, error) {
+	key := p.apiKey()
+	if key == "" {
+		return nil, fmt.Errorf("credentials: no API key found")
+	}
+	base, err := p.baseURL()
+	if err != nil {
+		return nil, err
+	}
+	data := &provider.UsageData{Provider: p.Name(), SourceID: p.SourceID(), SourceLabel: p.SourceLabel(), FetchedAt: time.Now()}
+	var keyInfo keyInfoResponse
+	if err := p.request(ctx, base+"/key/info", key, &keyInfo); err != nil {
+		var status apiError
+		if errors.As(err, &status) && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+			data.IsExpired, data.InvalidatesPriorUsage, data.Error = true, true, "LiteLLM key expired or unauthorized"
+			return data, nil
+		}
+		return nil, err
+	}
+	if err := applyBudget(data, "key", "Key budget", keyInfo.Info.budget); err != nil {
+		return nil, fmt.Errorf("decode key info: %w", err)
+	}
+
+	if teamID := strings.TrimSpace(keyInfo.Info.TeamID); teamID != "" {
+		var teamInfo teamInfoResponse
+		err := p.request(ctx, base+"/team/info?team_id="+url.QueryEscape(teamID), key, &teamInfo)
+		if err == nil {
+			display := "Team budget"
+			if alias := strings.TrimSpace(teamInfo.TeamInfo.TeamAlias); alias != "" && len(alias) <= 40 {
+				display = alias + " budget"
+			}
+			err = applyBudget(data, "team", display, teamInfo.TeamInfo.budget)
+		}
+		if err != nil {
+			// Key-scoped virtual keys often may not read their team; the key
+			// budget still stands on its own.
+			data.Warning = "team budget unavailable"
+		}
+	}
+	if len(data.Windows) == 0 && len(data.Balances) == 0 && data.Warning == "" {
+		data.Warning = "no LiteLLM budget set for this key or its team"
+	}
+	return data, nil
+}
+
+// applyBudget adds a window for a budget that resets and a balance for one
+// that does not. A record without max_budget has no limit to show.
+func applyBudget(data *provider.UsageData, name, display string, b budget) error {
+	if b.MaxBudget == nil || *b.MaxBudget <= 0 {
+		return nil
+	}
+	if b.Spend == nil {
+		return fmt.Errorf("missing spend")
+	}
+	limit, spend := *b.MaxBudget, math.Max(0, *b.Spend)
+	if math.IsNaN(spend) || math.IsInf(spend, 0) || math.IsInf(limit, 0) {
+		return fmt.Errorf("invalid spend")
+	}
+	resetsAt, err := parseResetAt(b.BudgetResetAt)
+	if err != nil {
+		return err
+	}
+	if resetsAt.IsZero() && b.BudgetDuration == "" {
+		data.Balances = append(data.Balances, provider.UsageBalance{Name: name, DisplayName: display, Total: limit, Used: spend, Remaining: math.Max(0, limit-spend)})
+		return nil
+	}
+	w := provider.UsageWindow{Name: name, DisplayName: display, Utilization: math.Min(100, spend/limit*100), ResetsAt: resetsAt, Limit: int(limit), Used: int(spend)}
+	if resetsAt.IsZero() {
+		w.ResetPolicy = "every " + b.BudgetDuration
+	}
+	data.Windows = append(data.Windows, w)
+	return nil
+}
+
+// parseResetAt reads LiteLLM's budget_reset_at, which is ISO 8601 with or
+// without a zone; zone-less values are UTC.
+func parseResetAt(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid budget_reset_at")
+}
+
+func (p *Provider) request(ctx context.Context, url, key string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBody)).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+var _ provider.SourceCapability = (*Provider)(nil)
@@ -26,6 +26,10 @@ var experimentalProviderByName = map[string]bool{
 	"jetbrains":     true,
 	"synthetic":     true,
 	"zai":           true,
+	"anthropic_api": true,
+	"litellm":       true,
+	"custom":        true,
+	"plugin":        true,
 }
 
 // GetMaturity returns the conservative audit classification for a known
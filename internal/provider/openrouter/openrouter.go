@@ -78,6 +78,10 @@ func (p *Provider) DashboardURL() string     { return "https://openrouter.ai/cre
 func (p *Provider) SafeForAutoPolling() bool { return false }
 func (p *Provider) IsConfigured() bool       { return p.standardKey() != "" || p.managementAPIKey() != "" }
 
+// CacheTTL is longer than the default because credits and key limits change
+// only as requests are billed.
+func (p *Provider) CacheTTL() time.Duration { return 5 * time.Minute }
+
 type sourceCapability struct{}
 
 func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
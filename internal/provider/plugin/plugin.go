@@ -0,0 +1,451 @@
+// Package plugin runs external quota plugins: executables that speak a small
+// JSON protocol over stdin and stdout and report usage in the status-v1
+// shape. The exchange mirrors the Codex app-server client in package openai:
+// one JSON object per line, requests with an id, responses echoing it.
+//
+//	-> {"id":1,"method":"initialize","params":{"protocolVersion":1,"clientInfo":{"name":"clawmeter"},"source":{"id":"sso"}}}
+//	<- {"id":1,"result":{"protocolVersion":1,"name":"SSO quota","dashboardUrl":"https://quota.example"}}
+//	-> {"id":2,"method":"usage/read","params":{}}
+//	<- {"id":2,"result":{"usage":{"windows":[{"name":"monthly","utilization":42,"resets_at":"2026-11-01T00:00:00Z"}]}}}
+//
+// Clawmeter then closes stdin and expects the plugin to exit. The full
+// contract is in docs/plugin-protocol.md.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+// ProtocolVersion is the plugin protocol this build speaks.
+const ProtocolVersion = 1
+
+const (
+	// defaultTimeout keeps a plugin well under the tray's 30-second refresh
+	// deadline; maxTimeout is the most config may ask for.
+	defaultTimeout = 15 * time.Second
+	maxTimeout     = 25 * time.Second
+	maxLine        = 1 << 20
+	// waitDelay bounds how long Wait lets a killed plugin's children hold
+	// its pipes open.
+	waitDelay  = time.Second
+	maxWarning = 120
+	// BinaryPrefix names plugins found on PATH: clawmeter-plugin-<id>.
+	BinaryPrefix = "clawmeter-plugin-"
+)
+
+var errNoResponse = errors.New("plugin exited without a response")
+
+type Provider struct {
+	cfg                        config.ProviderConfig
+	sessionEnvironmentResolver provider.SessionEnvironmentResolver
+	sourceID, sourceLabel      string
+	execPath                   string
+	enrolledSource             bool
+
+	mu           sync.Mutex
+	displayName  string
+	dashboardURL string
+}
+
+func New(cfg config.ProviderConfig) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+func (p *Provider) SetSessionEnvironmentResolver(r provider.SessionEnvironmentResolver) {
+	p.sessionEnvironmentResolver = r
+}
+func (p *Provider) Name() string { return "plugin" }
+
+// DisplayName is the name the plugin reported at its last initialize.
+func (p *Provider) DisplayName() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.displayName != "" {
+		return p.displayName
+	}
+	return "Plugin"
+}
+func (p *Provider) Description() string { return "External quota plugin" }
+func (p *Provider) DashboardURL() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dashboardURL
+}
+func (p *Provider) SafeForAutoPolling() bool { return true }
+func (p *Provider) IsConfigured() bool {
+	_, err := p.executable()
+	return p.enrolledSource && err == nil
+}
+
+type sourceCapability struct{}
+
+func (*Provider) SourceKinds() []provider.SourceKind { return (sourceCapability{}).SourceKinds() }
+func (*Provider) DefaultSource() (config.SourceConfig, bool) {
+	return (sourceCapability{}).DefaultSource()
+}
+func (*Provider) ValidateSource(s config.SourceConfig) error {
+	return (sourceCapability{}).ValidateSource(s)
+}
+func (*Provider) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	return (sourceCapability{}).NewSource(cfg, s)
+}
+func (sourceCapability) SourceKinds() []provider.SourceKind {
+	return []provider.SourceKind{
+		{Kind: "native", Summary: "Plugin named by the source id, from the plugins directory or " + BinaryPrefix + "<id> on PATH"},
+		{Kind: "exec-path", Summary: "Absolute path to a plugin executable", RefUsage: "/path/to/plugin", RefRequired: true, RefIsPath: true},
+	}
+}
+
+// DefaultSource is absent: every plugin is enrolled explicitly.
+func (sourceCapability) DefaultSource() (config.SourceConfig, bool) {
+	return config.SourceConfig{}, false
+}
+
+func (sourceCapability) ValidateSource(s config.SourceConfig) error {
+	kind, ref := strings.TrimSpace(s.Credential.Kind), strings.TrimSpace(s.Credential.Ref)
+	switch kind {
+	case "native":
+		if ref != "" {
+			return fmt.Errorf("provider %q source %q native plugins take no reference", "plugin", s.ID)
+		}
+	case "exec-path":
+		if !filepath.IsAbs(ref) {
+			return fmt.Errorf("provider %q source %q requires an absolute executable path", "plugin", s.ID)
+		}
+	default:
+		return fmt.Errorf("provider %q source %q has unsupported credential kind %q", "plugin", s.ID, kind)
+	}
+	return nil
+}
+func (sourceCapability) NewSource(cfg config.ProviderConfig, s config.SourceConfig) (provider.Provider, error) {
+	if err := (sourceCapability{}).ValidateSource(s); err != nil {
+		return nil, err
+	}
+	p := New(cfg)
+	p.sourceID, p.sourceLabel = strings.TrimSpace(s.ID), strings.TrimSpace(s.Label)
+	p.enrolledSource = true
+	if s.Credential.Kind == "exec-path" {
+		p.execPath = filepath.Clean(strings.TrimSpace(s.Credential.Ref))
+	}
+	pc := cfg.Plugins[p.sourceID]
+	for _, name := range pc.Env {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("plugin env has invalid environment variable name")
+		}
+	}
+	if _, err := parseTimeout(pc.Timeout); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+func (p *Provider) SourceID() string {
+	if p.sourceID == "" {
+		return "default"
+	}
+	return p.sourceID
+}
+func (p *Provider) SourceLabel() string    { return p.sourceLabel }
+func (p *Provider) IsEnrolledSource() bool { return p.enrolledSource }
+
+// SourceRevision fingerprints the executable route and the values of the
+// environment passed through, so a rotated plugin credential invalidates the
+// cached reading.
+func (p *Provider) SourceRevision() string {
+	route := "native\x00" + p.sourceID
+	if p.execPath != "" {
+		route = "exec-path\x00" + p.execPath
+	}
+	names := p.envNames()
+	values := p.resolveEnv(names)
+	secrets := make([]string, len(names))
+	for i, name := range names {
+		secrets[i] = name + "=" + values[name]
+	}
+	return provider.CredentialSourceRevision(route, strings.Join(secrets, "\x00"))
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseTimeout(value string) (time.Duration, error) {
+	if strings.TrimSpace(value) == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || d <= 0 || d > maxTimeout {
+		return 0, fmt.Errorf("plugin timeout must be a duration up to %s", maxTimeout)
+	}
+	return d, nil
+}
+
+func (p *Provider) envNames() []string { return p.cfg.Plugins[p.sourceID].Env }
+
+func (p *Provider) resolveEnv(names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	if p.sessionEnvironmentResolver != nil {
+		return p.sessionEnvironmentResolver.ResolveSessionEnvironment(provider.SessionEnvironmentRequest{EnvNames: names, AllowSessionEnvironmentFallback: true})
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// baseEnv is what every plugin inherits: enough to run a program and find
+// the user's files, and nothing that usually carries a credential.
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "LC_CTYPE", "TZ", "TMPDIR",
+	"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_RUNTIME_DIR",
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA",
+}
+
+// subprocessEnv is the plugin's whole environment: the base, the names the
+// user configured for this source, and protocol markers.
+func (p *Provider) subprocessEnv() []string {
+	env := make([]string, 0, len(baseEnv)+len(p.envNames())+2)
+	for _, name := range baseEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	names := p.envNames()
+	values := p.resolveEnv(names)
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return append(env, "NO_COLOR=1", fmt.Sprintf("CLAWMETER_PLUGIN_PROTOCOL=%d", ProtocolVersion))
+}
+
+// executable resolves the plugin: the exec-path ref, else <id> in the
+// plugins directory, else clawmeter-plugin-<id> on PATH.
+func (p *Provider) executable() (string, error) {
+	if p.execPath != "" {
+		return exec.LookPath(p.execPath)
+	}
+	if p.sourceID == "" {
+		return "", exec.ErrNotFound
+	}
+	if dir, err := config.PluginDir(); err == nil {
+		if path, err := exec.LookPath(filepath.Join(dir, p.sourceID)); err == nil {
+			return path, nil
+		}
+	}
+	return exec.LookPath(BinaryPrefix + p.sourceID)
+}
+
+type rpcResponse struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type initializeResult struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name"`
+	DashboardURL    string `json:"dashboardUrl"`
+}
+
+type usageResult struct {
+	Usage *provider.UsageData `json:"usage"`
+}
+
+// FetchUsage runs the plugin once. Errors name the protocol stage but never
+// carry the plugin's stderr or error text, and they pass through
+// provider.SafeFetchError before reaching output or the cache.
+func (p *Provider) FetchUsage(ctx context.Context) (*provider.UsageData, error) {
+	data := &provider.UsageData{Provider: p.Name(), SourceID: p.SourceID(), SourceLabel: p.SourceLabel(), FetchedAt: time.Now()}
+	path, err := p.executable()
+	if err != nil {
+		if p.execPath != "" {
+			data.Error = "plugin executable not found"
+		} else {
+			data.Error = fmt.Sprintf("plugin not found; install %s%s on PATH or in the plugins directory", BinaryPrefix, p.SourceID())
+		}
+		return data, nil
+	}
+	timeout, err := parseTimeout(p.cfg.Plugins[p.sourceID].Timeout)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.WaitDelay = waitDelay
+	hideSubprocessWindow(cmd)
+	cmd.Env = p.subprocessEnv()
+	cmd.Dir = filepath.Dir(path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin failed")
+	}
+	defer func() {
+		stdin.Close()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	// Killing the plugin does not end a read while a child it started still
+	// holds stdout, so the deadline closes our end of the pipe as well.
+	stopClose := context.AfterFunc(ctx, func() { stdout.Close() })
+	defer stopClose()
+	fail := func(stage string, err error) (*provider.UsageData, error) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return nil, fmt.Errorf("plugin %s: %w", stage, err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+
+	if err := writeJSON(stdin, map[string]any{
+		"id":     1,
+		"method": "initialize",
+		"params": map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"clientInfo":      map[string]any{"name": "clawmeter"},
+			"source":          map[string]any{"id": p.SourceID(), "label": p.SourceLabel()},
+		},
+	}); err != nil {
+		return fail("send initialize", err)
+	}
+	var init initializeResult
+	if err := readResult(scanner, 1, &init); err != nil {
+		return fail("initialize", err)
+	}
+	if init.ProtocolVersion != ProtocolVersion {
+		return nil, fmt.Errorf("plugin initialize: unsupported protocol version %d", init.ProtocolVersion)
+	}
+	p.mu.Lock()
+	p.displayName = sanitizeText(init.Name, 40)
+	p.dashboardURL = ""
+	if strings.HasPrefix(init.DashboardURL, "https://") || strings.HasPrefix(init.DashboardURL, "http://") {
+		p.dashboardURL = init.DashboardURL
+	}
+	p.mu.Unlock()
+
+	if err := writeJSON(stdin, map[string]any{"id": 2, "method": "usage/read", "params": map[string]any{}}); err != nil {
+		return fail("send usage/read", err)
+	}
+	var result usageResult
+	if err := readResult(scanner, 2, &result); err != nil {
+		return fail("usage/read", err)
+	}
+	if result.Usage == nil {
+		return nil, fmt.Errorf("plugin usage/read: decode response: missing usage")
+	}
+	if err := validateUsage(result.Usage); err != nil {
+		return nil, fmt.Errorf("plugin usage/read: decode response: %w", err)
+	}
+	return p.adopt(result.Usage, data), nil
+}
+
+// adopt copies the plugin's reading into data, keeping clawmeter's own
+// identity fields and reducing free text to what is safe to show and cache.
+func (p *Provider) adopt(usage, data *provider.UsageData) *provider.UsageData {
+	if !usage.FetchedAt.IsZero() && usage.FetchedAt.Before(data.FetchedAt) {
+		data.FetchedAt = usage.FetchedAt
+	}
+	data.Windows, data.Balances, data.ResetCredits = usage.Windows, usage.Balances, usage.ResetCredits
+	data.IsExpired, data.InvalidatesPriorUsage = usage.IsExpired, usage.IsExpired
+	if usage.Error != "" {
+		data.Error = provider.SafeFetchError(errors.New(usage.Error))
+	}
+	data.Warning = sanitizeText(usage.Warning, maxWarning)
+	return data
+}
+
+func validateUsage(u *provider.UsageData) error {
+	for _, w := range u.Windows {
+		if strings.TrimSpace(w.Name) == "" {
+			return fmt.Errorf("window without a name")
+		}
+		if math.IsNaN(w.Utilization) || math.IsInf(w.Utilization, 0) || w.Utilization < 0 {
+			return fmt.Errorf("window %q has invalid utilization", w.Name)
+		}
+	}
+	for _, b := range u.Balances {
+		if strings.TrimSpace(b.Name) == "" {
+			return fmt.Errorf("balance without a name")
+		}
+	}
+	return nil
+}
+
+// sanitizeText keeps plugin-supplied display text to one short line.
+func sanitizeText(s string, max int) string {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }), " ")
+	if runes := []rune(s); len(runes) > max {
+		s = string(runes[:max-1]) + "…"
+	}
+	return s
+}
+
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// readResult reads lines until the response with id, skipping blank lines,
+// notifications, and anything that is not JSON. A plugin error response
+// becomes an error without its message, which the plugin controls.
+func readResult(scanner *bufio.Scanner, id int, result any) error {
+	for scanner.Scan() {
+		var resp rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil || resp.ID == nil || *resp.ID != id {
+			continue
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("plugin returned error code %d", resp.Error.Code)
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errNoResponse
+}
+
+var _ provider.SourceCapability = (*Provider)(nil)
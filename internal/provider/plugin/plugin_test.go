@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+type mapResolver map[string]string
+
+func (r mapResolver) ResolveSessionEnvironment(request provider.SessionEnvironmentRequest) map[string]string {
+	values := map[string]string{}
+	for _, name := range request.EnvNames {
+		if value, ok := r[name]; ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// writePlugin installs script as an exec-path plugin source named sso.
+func writePlugin(t *testing.T, script string, pc config.PluginConfig) *Provider {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin fixtures are POSIX shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "sso-plugin")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sourced, err := (sourceCapability{}).NewSource(
+		config.ProviderConfig{Plugins: map[string]config.PluginConfig{"sso": pc}},
+		config.SourceConfig{ID: "sso", Label: "SSO", Credential: config.CredentialRef{Kind: "exec-path", Ref: path}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sourced.(*Provider)
+}
+
+const respond = `while IFS= read -r line; do
+  case "$line" in
+    *'"method":"initialize"'*) printf '{"method":"log","params":{}}\nnot json\n{"id":1,"result":{"protocolVersion":1,"name":"SSO quota","dashboardUrl":"https://quota.example"}}\n' ;;
+    *'"method":"usage/read"'*) printf '%s\n' "$USAGE" ;;
+  esac
+done
+`
+
+func TestFetchSpeaksProtocolWithSandboxedEnv(t *testing.T) {
+	t.Setenv("AMBIENT_SECRET", "leaked")
+	p := writePlugin(t, `env > "$(dirname "$0")/env"
+USAGE='{"id":2,"result":{"usage":{"windows":[{"name":"monthly","utilization":42,"resets_at":"2026-11-01T00:00:00Z"}],"warning":"budget\nnearly spent","provider":"spoofed"}}}'
+`+respond, config.PluginConfig{Env: []string{"SSO_TOKEN"}})
+	p.SetSessionEnvironmentResolver(mapResolver{"SSO_TOKEN": "session-token"})
+
+	data, err := p.FetchUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Provider != "plugin" || data.SourceID != "sso" || len(data.Windows) != 1 || data.Windows[0].Utilization != 42 {
+		t.Fatalf("data = %+v", data)
+	}
+	if data.Warning != "budget nearly spent" {
+		t.Fatalf("warning = %q", data.Warning)
+	}
+	if p.DisplayName() != "SSO quota" || p.DashboardURL() != "https://quota.example" {
+		t.Fatalf("identity = %q %q", p.DisplayName(), p.DashboardURL())
+	}
+	env, err := os.ReadFile(filepath.Join(filepath.Dir(p.execPath), "env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(env), "SSO_TOKEN=session-token") || !strings.Contains(string(env), "CLAWMETER_PLUGIN_PROTOCOL=1") {
+		t.Fatalf("plugin env is missing configured values:\n%s", env)
+	}
+	if strings.Contains(string(env), "AMBIENT_SECRET") {
+		t.Fatal("plugin inherited an unrequested variable")
+	}
+}
+
+func TestFetchRedactsPluginErrors(t *testing.T) {
+	tests := map[string]struct {
+		script, want string
+	}{
+		"rpc error":    {`USAGE='{"id":2,"error":{"code":-1,"message":"token sk-live-secret rejected"}}'` + "\n" + respond, "provider request failed"},
+		"usage error":  {`USAGE='{"id":2,"result":{"usage":{"windows":[],"error":"upstream said sk-live-secret"}}}'` + "\n" + respond, ""},
+		"bad window":   {`USAGE='{"id":2,"result":{"usage":{"windows":[{"name":"","utilization":1}]}}}'` + "\n" + respond, "provider response unavailable"},
+		"old protocol": {`read -r line; echo '{"id":1,"result":{"protocolVersion":0}}'` + "\n", "provider request failed"},
+		"exits silent": {"echo sk-live-secret >&2\n", "provider request failed"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := writePlugin(t, tt.script, config.PluginConfig{})
+			data, err := p.FetchUsage(context.Background())
+			if tt.want == "" {
+				if err != nil || data.Error != "provider request failed" {
+					t.Fatalf("data = %+v, err = %v", data, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("data = %+v", data)
+			}
+			if strings.Contains(err.Error(), "sk-live-secret") {
+				t.Fatalf("error leaks plugin text: %v", err)
+			}
+			if got := provider.SafeFetchError(err); got != tt.want {
+				t.Fatalf("safe error = %q, want %q (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFetchTimesOut(t *testing.T) {
+	p := writePlugin(t, "exec sleep 5\n", config.PluginConfig{Timeout: "200ms"})
+	_, err := p.FetchUsage(context.Background())
+	if got := provider.SafeFetchError(err); got != "connection timed out" {
+		t.Fatalf("safe error = %q (%v)", got, err)
+	}
+}
+
+func TestFetchTimesOutWhenAChildHoldsStdout(t *testing.T) {
+	p := writePlugin(t, "sleep 5 &\nexec sleep 5\n", config.PluginConfig{Timeout: "200ms"})
+	start := time.Now()
+	_, err := p.FetchUsage(context.Background())
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("fetch took %s after the timeout", elapsed)
+	}
+	if got := provider.SafeFetchError(err); got != "connection timed out" {
+		t.Fatalf("safe error = %q (%v)", got, err)
+	}
+}
+
+func TestNativeSourceFindsPluginByID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin fixtures are POSIX shell scripts")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	sourced, err := (sourceCapability{}).NewSource(config.ProviderConfig{}, config.SourceConfig{ID: "sso", Credential: config.CredentialRef{Kind: "native"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourced.IsConfigured() {
+		t.Fatal("missing plugin is configured")
+	}
+	data, err := sourced.FetchUsage(context.Background())
+	if err != nil || !strings.Contains(data.Error, BinaryPrefix+"sso") {
+		t.Fatalf("data = %+v, err = %v", data, err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, BinaryPrefix+"sso"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if !sourced.IsConfigured() {
+		t.Fatal("plugin on PATH is not configured")
+	}
+}
+
+func TestNewSourceRejectsBadPluginConfig(t *testing.T) {
+	source := config.SourceConfig{ID: "sso", Credential: config.CredentialRef{Kind: "native"}}
+	for _, pc := range []config.PluginConfig{{Env: []string{"NOT-A-NAME"}}, {Timeout: "1m"}, {Timeout: "soon"}} {
+		if _, err := (sourceCapability{}).NewSource(config.ProviderConfig{Plugins: map[string]config.PluginConfig{"sso": pc}}, source); err == nil {
+			t.Errorf("%+v accepted", pc)
+		}
+	}
+	if err := (sourceCapability{}).ValidateSource(config.SourceConfig{ID: "sso", Credential: config.CredentialRef{Kind: "exec-path", Ref: "relative/plugin"}}); err == nil {
+		t.Error("relative exec-path accepted")
+	}
+}
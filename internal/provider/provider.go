@@ -369,6 +369,15 @@ type UsageData struct {
 	InvalidatesPriorUsage bool `json:"-"`
 }
 
+// SourceKey returns the registry key of the source that produced u, matching
+// SourceKey for its provider.
+func (u *UsageData) SourceKey() string {
+	if u.SourceID == "" || u.SourceID == "default" {
+		return u.Provider
+	}
+	return u.Provider + ":" + u.SourceID
+}
+
 // Clone returns a deep-enough copy for UI/cache fallback paths.
 func (u *UsageData) Clone() *UsageData {
 	if u == nil {
@@ -715,6 +724,22 @@ func SafeForAutoPolling(p Provider) bool {
 	return true
 }
 
+// CacheTTLCapability declares how long a provider's readings stay fresh in
+// the shared cache. A balance that barely moves can be cached far longer than
+// a five-hour window.
+type CacheTTLCapability interface {
+	CacheTTL() time.Duration
+}
+
+// CacheTTL returns the provider's declared cache TTL, or zero for the cache
+// default.
+func CacheTTL(p Provider) time.Duration {
+	if capability, ok := p.(CacheTTLCapability); ok {
+		return capability.CacheTTL()
+	}
+	return 0
+}
+
 // GetConfigured returns providers that should be polled: those with
 // credentials AND not explicitly disabled by the registry's configured
 // EnabledFilter. Order is deterministic.
@@ -0,0 +1,299 @@
+// Package server publishes Clawmeter's status-v1 and diagnose-v1 documents to
+// local clients over a Unix socket or loopback HTTP. A single shared poller
+// refreshes the documents, so any number of clients cost one round of provider
+// requests per poll instead of one per client.
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cache"
+	"github.com/tnunamak/clawmeter/internal/cli"
+	"github.com/tnunamak/clawmeter/internal/diagnose"
+	"github.com/tnunamak/clawmeter/internal/metrics"
+)
+
+// Snapshot is the set of documents published from one poll.
+type Snapshot struct {
+	Status   cli.JSONOutput
+	Diagnose diagnose.Output
+	// Providers are the per-source readings behind Status, rendered as
+	// Prometheus metrics at scrape time so reset countdowns stay current.
+	Providers []cli.ProviderFormatter
+}
+
+// PollFunc collects a fresh Snapshot.
+type PollFunc func(ctx context.Context) (*Snapshot, error)
+
+// Poller owns every provider fetch made on behalf of served clients.
+type Poller struct {
+	poll     PollFunc
+	interval time.Duration
+
+	refreshMu sync.Mutex // serializes polls
+	mu        sync.RWMutex
+	current   *Snapshot
+	lastErr   error
+}
+
+// NewPoller returns a poller that calls poll every interval once Run starts.
+func NewPoller(poll PollFunc, interval time.Duration) *Poller {
+	return &Poller{poll: poll, interval: interval}
+}
+
+// Refresh polls once. A failed poll keeps serving the previous snapshot.
+func (p *Poller) Refresh(ctx context.Context) error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	snapshot, err := p.poll(ctx)
+	if err == nil && snapshot == nil {
+		err = errors.New("poll returned no data")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err
+	if err == nil {
+		p.current = snapshot
+	}
+	return err
+}
+
+// Run polls every interval until ctx is cancelled. Callers normally Refresh
+// once before serving so the first request does not race the first poll.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = p.Refresh(ctx)
+		}
+	}
+}
+
+// Snapshot returns the latest successful poll, or nil and the last error
+// before the first one succeeds.
+func (p *Poller) Snapshot() (*Snapshot, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.current == nil {
+		err := p.lastErr
+		if err == nil {
+			err = errors.New("usage has not been collected yet")
+		}
+		return nil, err
+	}
+	return p.current, nil
+}
+
+// Handler serves the poller's documents:
+//
+//	GET /status           status-v1 for every provider
+//	GET /providers/{key}  status-v1 narrowed to one family or family:source
+//	GET /diagnose         diagnose-v1 built from the last poll (no live probe)
+//	GET /metrics          Prometheus text exposition of the last poll
+//
+// JSON responses carry a strong ETag; a matching If-None-Match returns 304.
+func Handler(p *Poller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := currentSnapshot(w, p)
+		if !ok {
+			return
+		}
+		writeJSON(w, r, http.StatusOK, snapshot.Status)
+	})
+	mux.HandleFunc("GET /providers/{key}", func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := currentSnapshot(w, p)
+		if !ok {
+			return
+		}
+		key := r.PathValue("key")
+		doc, ok := ProviderDocument(snapshot.Status, key)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("provider %q is not being polled", key))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, doc)
+	})
+	mux.HandleFunc("GET /diagnose", func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := currentSnapshot(w, p)
+		if !ok {
+			return
+		}
+		writeJSON(w, r, http.StatusOK, snapshot.Diagnose)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := currentSnapshot(w, p)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", metrics.ContentType)
+		_ = metrics.Write(w, snapshot.Providers, time.Now())
+	})
+	return mux
+}
+
+// ProviderDocument narrows a status-v1 document to one provider. key is a
+// family ("claude") or a family and enrolled source ("claude:work"); a source
+// is returned in the single-source shape under its family key.
+func ProviderDocument(status cli.JSONOutput, key string) (cli.JSONOutput, bool) {
+	family, source, _ := strings.Cut(strings.ToLower(strings.TrimSpace(key)), ":")
+	providerOut, ok := status.Providers[family]
+	if !ok || providerOut == nil {
+		return cli.JSONOutput{}, false
+	}
+	narrowed := status
+	narrowed.Providers = map[string]*cli.ProviderJSONOutput{family: providerOut}
+	if source == "" {
+		return narrowed, true
+	}
+	for _, candidate := range providerOut.Sources {
+		if candidate.Source.ID == source {
+			narrowed.Providers[family] = &cli.ProviderJSONOutput{
+				Usage:    candidate.Usage,
+				Forecast: candidate.Forecast,
+				Status:   candidate.Status,
+				Maturity: providerOut.Maturity,
+			}
+			return narrowed, true
+		}
+	}
+	if len(providerOut.Sources) == 0 && providerOut.Usage != nil {
+		id := providerOut.Usage.SourceID
+		if id == source || (id == "" && source == "default") {
+			return narrowed, true
+		}
+	}
+	return cli.JSONOutput{}, false
+}
+
+func currentSnapshot(w http.ResponseWriter, p *Poller) (*Snapshot, bool) {
+	snapshot, err := p.Snapshot()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "usage is not available yet")
+		return nil, false
+	}
+	return snapshot, true
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encode response")
+		return
+	}
+	body = append(body, '\n')
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// etagMatches implements If-None-Match's weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultSocketPath returns the Unix socket `clawmeter serve` listens on when
+// no address is given.
+func DefaultSocketPath() (string, error) {
+	dir, err := cache.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clawmeter.sock"), nil
+}
+
+// ListenUnix listens on a socket only the current user can connect to. A
+// leftover socket from a crashed server is replaced; a live one is an error.
+func ListenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create socket dir: %w", err)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("another clawmeter server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("restrict socket: %w", err)
+	}
+	return ln, nil
+}
+
+// ListenLoopback listens on a TCP address that must resolve to loopback.
+// Usage data is private, so the server never binds a public interface.
+func ListenLoopback(address string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("refusing to listen on non-loopback address %q", address)
+		}
+	}
+	return net.Listen("tcp", address)
+}
+
+// Serve serves handler on ln until ctx is cancelled.
+func Serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tnunamak/clawmeter/internal/cli"
+	"github.com/tnunamak/clawmeter/internal/diagnose"
+	"github.com/tnunamak/clawmeter/internal/provider"
+)
+
+func testSnapshot(pct float64) *Snapshot {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	usage := func(id string, pct float64) *provider.UsageData {
+		return &provider.UsageData{Provider: "claude", SourceID: id, FetchedAt: now, Windows: []provider.UsageWindow{{Name: "5h", Utilization: pct, ResetsAt: now.Add(time.Hour)}}}
+	}
+	return &Snapshot{
+		Status: cli.JSONOutput{
+			SchemaVersion: cli.JSONSchemaVersion,
+			FetchedAt:     now,
+			Providers: map[string]*cli.ProviderJSONOutput{
+				"openai": {Usage: &provider.UsageData{Provider: "openai", FetchedAt: now, Windows: []provider.UsageWindow{{Name: "7d", Utilization: pct}}}},
+				"claude": {
+					Usage: usage("", 10),
+					Sources: []cli.JSONSourceOutput{
+						{Source: cli.JSONSourceIdentity{ID: "default"}, Usage: usage("default", 10)},
+						{Source: cli.JSONSourceIdentity{ID: "work"}, Usage: usage("work", 55)},
+					},
+				},
+			},
+		},
+		Diagnose: diagnose.Output{SchemaVersion: diagnose.SchemaVersion, GeneratedAt: now},
+	}
+}
+
+func TestPollerServesLastGoodSnapshot(t *testing.T) {
+	var calls atomic.Int32
+	poller := NewPoller(func(context.Context) (*Snapshot, error) {
+		if calls.Add(1) == 2 {
+			return nil, errors.New("fetch failed")
+		}
+		return testSnapshot(40), nil
+	}, time.Minute)
+
+	if _, err := poller.Snapshot(); err == nil {
+		t.Fatal("Snapshot before the first poll should fail")
+	}
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.Refresh(context.Background()); err == nil {
+		t.Fatal("second Refresh should report the poll error")
+	}
+	if snapshot, err := poller.Snapshot(); err != nil || snapshot == nil {
+		t.Fatalf("Snapshot after a failed poll = %v, %v; want the last good snapshot", snapshot, err)
+	}
+}
+
+func TestHandlerReturnsUnavailableBeforeFirstPoll(t *testing.T) {
+	poller := NewPoller(func(context.Context) (*Snapshot, error) { return nil, errors.New("offline") }, time.Minute)
+	_ = poller.Refresh(context.Background())
+
+	rec := httptest.NewRecorder()
+	Handler(poller).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+}
+
+func TestHandlerHonorsIfNoneMatch(t *testing.T) {
+	pct := 40.0
+	poller := NewPoller(func(context.Context) (*Snapshot, error) { return testSnapshot(pct), nil }, time.Minute)
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler(poller)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("first response = %d %v", rec.Code, rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("matching If-None-Match = %d with %d bytes, want empty 304", rec.Code, rec.Body.Len())
+	}
+
+	pct = 45
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("changed data = %d etag %q, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestProviderRouteNarrowsToFamilyOrSource(t *testing.T) {
+	poller := NewPoller(func(context.Context) (*Snapshot, error) { return testSnapshot(40), nil }, time.Minute)
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler(poller)
+
+	get := func(path string) (int, cli.JSONOutput) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var out cli.JSONOutput
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, out
+	}
+
+	code, out := get("/providers/claude")
+	if code != http.StatusOK || len(out.Providers) != 1 || len(out.Providers["claude"].Sources) != 2 {
+		t.Fatalf("/providers/claude = %d %#v", code, out.Providers)
+	}
+	code, out = get("/providers/claude:work")
+	if code != http.StatusOK || out.Providers["claude"].Usage.Windows[0].Utilization != 55 || out.Providers["claude"].Sources != nil {
+		t.Fatalf("/providers/claude:work = %d %#v", code, out.Providers["claude"])
+	}
+	code, out = get("/providers/openai:default")
+	if code != http.StatusOK || out.Providers["openai"] == nil {
+		t.Fatalf("/providers/openai:default = %d %#v", code, out.Providers)
+	}
+	if code, _ = get("/providers/claude:missing"); code != http.StatusNotFound {
+		t.Fatalf("/providers/claude:missing = %d, want 404", code)
+	}
+	if code, _ = get("/providers/gemini"); code != http.StatusNotFound {
+		t.Fatalf("/providers/gemini = %d, want 404", code)
+	}
+}
+
+func TestHandlerServesMetricsFromSnapshot(t *testing.T) {
+	snapshot := testSnapshot(40)
+	snapshot.Providers = []cli.ProviderFormatter{{Name: "openai", Family: "openai", Data: snapshot.Status.Providers["openai"].Usage}}
+	poller := NewPoller(func(context.Context) (*Snapshot, error) { return snapshot, nil }, time.Minute)
+	if err := poller.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(poller).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("/metrics = %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `clawmeter_window_utilization_percent{source="openai",provider="openai",window="7d"} 40`) {
+		t.Fatalf("/metrics body:\n%s", rec.Body.String())
+	}
+}
+
+func TestListenUnixReplacesStaleSocketAndRestrictsAccess(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "s.sock")
+
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := ListenUnix(path)
+	if err != nil {
+		t.Fatalf("ListenUnix over a stale socket: %v", err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("socket mode = %v, want 0600", perm)
+	}
+	if _, err := ListenUnix(path); err == nil {
+		t.Fatal("ListenUnix should refuse a socket another server is using")
+	}
+}
+
+func TestListenLoopbackRefusesPublicAddresses(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:0", ":0", "192.0.2.1:0"} {
+		if ln, err := ListenLoopback(address); err == nil {
+			_ = ln.Close()
+			t.Fatalf("ListenLoopback(%q) succeeded, want refusal", address)
+		}
+	}
+	ln, err := ListenLoopback("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ln.Close()
+}
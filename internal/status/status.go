@@ -81,6 +81,10 @@ var StatusPages = map[string]statusPageConfig{
 		BaseURL:    "https://status.anthropic.com",
 		Components: []string{"Claude API (api.anthropic.com)", "Claude Code"},
 	},
+	"anthropic_api": {
+		BaseURL:    "https://status.anthropic.com",
+		Components: []string{"Claude API (api.anthropic.com)"},
+	},
 	"openai": {
 		BaseURL:    "https://status.openai.com",
 		Components: []string{"Chat Completions", "Codex", "Responses"},
@@ -124,6 +124,13 @@ type framePoint struct{ x, y float64 }
 // renderProviderFrameIcon implements the native 22px/32px Claw Frame V10
 // geometry. Other requested sizes use the nearest intended native rendition,
 // because the operating-system tray selects from the supplied pixmaps.
+// SupportsDualLayout reports whether the provider's icon is a meter frame that
+// can carry the dual layout's second window. Other providers show their logo.
+func SupportsDualLayout(providerName string) bool {
+	_, ok := frameProviderAsset[providerName]
+	return ok
+}
+
 func renderProviderFrameIcon(providerName string, meter MeterState, size int, theme frameTheme) image.Image {
 	if _, ok := frameProviderAsset[providerName]; !ok {
 		return resize(decodeProviderLogo(ProviderLogos[providerName]), size)
@@ -158,7 +165,13 @@ func renderV10NativeFrame(providerName string, meter MeterState, size int, theme
 	}
 	draw.Draw(canvas, canvas.Bounds(), meterImage, meterImage.Bounds().Min, draw.Src)
 	v10ProviderMark(canvas, providerName, size, theme)
-	v10WindowLabel(canvas, frameDisplayLabel(meter.Label), size, theme)
+	if meter.Secondary.Show {
+		// The bar is labelled with its own window; the frame shows the
+		// selected window the single layout would have labelled here.
+		frameSecondaryBar(canvas, meter.Secondary, size, theme)
+	} else {
+		v10WindowLabel(canvas, frameDisplayLabel(meter.Label), size, theme)
+	}
 	if meter.UpdateAvailable {
 		box := frameGeometries[size].update
 		fill := frameBlue
@@ -329,13 +342,99 @@ func renderNativeFrame(providerName string, meter MeterState, size int) *image.R
 	dst := image.NewRGBA(image.Rect(0, 0, size, size))
 	xdraw.CatmullRom.Scale(dst, dst.Bounds(), high, high.Bounds(), draw.Over, nil)
 	frameProviderMark(dst, providerName, size, g)
-	frameWindowLabel(dst, frameDisplayLabel(meter.Label), g)
+	if meter.Secondary.Show {
+		frameSecondaryBar(dst, meter.Secondary, size, frameThemeDark)
+	} else {
+		frameWindowLabel(dst, frameDisplayLabel(meter.Label), g)
+	}
 	if meter.UpdateAvailable {
 		draw.Draw(dst, g.update, image.NewUniform(frameBlue), image.Point{}, draw.Over)
 	}
 	return dst
 }
 
+// frameBarGeometry places the dual layout's secondary bar in the label row,
+// clear of the provider mark and the update badge. A labelled bar starts
+// after its window label, which is drawn from labelX at labelY.
+type frameBarGeometry struct {
+	left, right, y          float64
+	trackWidth, activeWidth float64
+	tickLength              float64
+	labelX, labelY          int
+}
+
+var frameBarGeometries = map[int]frameBarGeometry{
+	22: {5.0, 16.0, 18.5, 1.35, 2.0, 3.0, 0, 16},
+	32: {5.0, 26.0, 27.0, 2.05, 3.0, 3.5, 2, 25},
+}
+
+type frameBarPalette struct {
+	track, common, tick, tickHalo, label color.NRGBA
+}
+
+func frameBarPaletteFor(theme frameTheme) frameBarPalette {
+	if theme == frameThemeLight {
+		return frameBarPalette{
+			track:    color.NRGBA{R: 170, G: 177, B: 185, A: 242},
+			common:   color.NRGBA{R: 72, G: 79, B: 88, A: 255},
+			tick:     frameTickHalo,
+			tickHalo: frameTick,
+			label:    color.NRGBA{R: 72, G: 79, B: 88, A: 255},
+		}
+	}
+	return frameBarPalette{track: frameTrack, common: frameCommon, tick: frameTick, tickHalo: frameTickHalo, label: frameLabel}
+}
+
+// frameSecondaryBar draws a second window as a straight meter using the same
+// channels as the frame: neutral fill up to the smaller of usage and pace, red
+// or green for the gap between them, and a tick at the expected pace. The
+// bar's window label sits at its left so the icon says which window is which.
+func frameSecondaryBar(dst draw.Image, bar WindowMeter, size int, theme frameTheme) {
+	g, ok := frameBarGeometries[size]
+	if !ok {
+		return
+	}
+	palette := frameBarPaletteFor(theme)
+	if label := frameDisplayLabel(bar.Label); label != "" {
+		layer := image.NewRGBA(image.Rect(0, 0, size, size))
+		frameGlyphText(layer, label, g.labelX, g.labelY, palette.label)
+		draw.Draw(dst, dst.Bounds(), layer, image.Point{}, draw.Over)
+		g.left = max(g.left, float64(g.labelX+frameGlyphWidth(label))+1.5)
+	}
+	frame := frameGeometries[size]
+	scale := float64(frame.supersample)
+	high := image.NewRGBA(image.Rect(0, 0, size*frame.supersample, size*frame.supersample))
+	path := []framePoint{{g.left, g.y}, {g.right, g.y}}
+
+	frameStroke(high, path, scale, palette.track, g.trackWidth)
+	usage := bar.UsagePct / 100
+	expected := usage
+	if bar.ShowExpected {
+		expected = bar.ExpectedPct / 100
+	}
+	lower, upper := min(usage, expected), max(usage, expected)
+	if lower > 0 {
+		frameStroke(high, frameSubpath(path, 0, lower), scale, palette.common, g.activeWidth)
+	}
+	status := palette.common
+	if bar.ShowExpected && usage < expected {
+		status = frameGreen
+	}
+	if bar.ShowExpected && usage > expected {
+		status = frameRed
+	}
+	if upper > lower {
+		frameStroke(high, frameSubpath(path, lower, upper), scale, status, g.activeWidth)
+	}
+	if bar.ShowExpected {
+		x := (g.left + (g.right-g.left)*expected) * scale
+		top, bottom := (g.y-g.tickLength/2)*scale, (g.y+g.tickLength/2)*scale
+		drawThickLine(high, x, top, x, bottom, frame.expectedHaloWidth*scale/2, palette.tickHalo)
+		drawThickLine(high, x, top, x, bottom, frame.expectedTickWidth*scale/2, palette.tick)
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), high, high.Bounds(), draw.Over, nil)
+}
+
 func decodeProviderLogo(data []byte) image.Image {
 	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
@@ -379,6 +478,10 @@ func frameWindowLabel(dst *image.RGBA, label string, g frameGeometry) {
 	if label == "" {
 		return
 	}
+	frameGlyphText(dst, label, int(math.Round(g.providerX))-frameGlyphWidth(label)/2, g.labelY, frameLabel)
+}
+
+func frameGlyphWidth(label string) int {
 	width := 0
 	for i, r := range label {
 		if i > 0 {
@@ -386,13 +489,16 @@ func frameWindowLabel(dst *image.RGBA, label string, g frameGeometry) {
 		}
 		width += len(frameGlyphs[r][0])
 	}
-	x := int(math.Round(g.providerX)) - width/2
+	return width
+}
+
+func frameGlyphText(dst *image.RGBA, label string, x, y int, fill color.NRGBA) {
 	for _, r := range label {
 		glyph := frameGlyphs[r]
-		for y, row := range glyph {
+		for dy, row := range glyph {
 			for col, on := range row {
 				if on == '1' {
-					blendNRGBA(dst, x+col, g.labelY+y, frameLabel)
+					blendNRGBA(dst, x+col, y+dy, fill)
 				}
 			}
 		}
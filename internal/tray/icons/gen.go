@@ -48,6 +48,10 @@ var (
 	ProviderAlibaba []byte
 	//go:embed provider-deepseek.png
 	ProviderDeepSeek []byte
+	// ProviderCustom is Clawmeter's own neutral gauge, for config-declared
+	// backends, plugins, and self-hosted gateways without a mark of their own.
+	//go:embed provider-custom.png
+	ProviderCustom []byte
 )
 
 // ProviderLogos maps provider name to its embedded logo PNG.
@@ -69,6 +73,10 @@ var ProviderLogos = map[string][]byte{
 	"alibaba":       ProviderAlibaba,
 	"alibaba_token": ProviderAlibaba,
 	"deepseek":      ProviderDeepSeek,
+	"anthropic_api": ProviderClaude,
+	"litellm":       ProviderCustom,
+	"custom":        ProviderCustom,
+	"plugin":        ProviderCustom,
 }
 
 type logoTreatment struct {
@@ -113,6 +121,19 @@ type MeterState struct {
 	ShowExpected    bool
 	Label           string
 	UpdateAvailable bool
+	// Secondary is a second quota window drawn as a bar beneath the frame in
+	// place of the window label.
+	Secondary WindowMeter
+}
+
+// WindowMeter is the usage and expected pace of a secondary quota window.
+// Label names the window in the same form as MeterState.Label.
+type WindowMeter struct {
+	Show         bool
+	UsagePct     float64
+	ExpectedPct  float64
+	ShowExpected bool
+	Label        string
 }
 
 // TrayPalette selects the V10 artwork's supplied appearance palette.
@@ -373,6 +394,8 @@ func normalizeMeterState(meter MeterState) MeterState {
 	if meter.RiskPct < 0 {
 		meter.RiskPct = 0
 	}
+	meter.Secondary.UsagePct = clampPct(meter.Secondary.UsagePct)
+	meter.Secondary.ExpectedPct = clampPct(meter.Secondary.ExpectedPct)
 	return meter
 }
 
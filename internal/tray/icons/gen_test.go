@@ -180,6 +180,85 @@ func TestV10VisualChannelsNeverOccludeEachOther(t *testing.T) {
 	}
 }
 
+func TestSecondaryBarNeverOccludesFrameChannels(t *testing.T) {
+	for _, size := range []int{22, 32} {
+		for _, theme := range []frameTheme{frameThemeDark, frameThemeLight} {
+			meter, err := v10MeterRaster(size, theme, MeterState{
+				UsagePct: 100, ExpectedPct: 100, ShowExpected: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, label := range []string{"", "5H", "7D", "MO"} {
+				barLayer := image.NewNRGBA(image.Rect(0, 0, size, size))
+				frameSecondaryBar(barLayer, WindowMeter{Show: true, UsagePct: 100, ExpectedPct: 100, ShowExpected: true, Label: label}, size, theme)
+				updateLayer := image.NewNRGBA(image.Rect(0, 0, size, size))
+				draw.Draw(updateLayer, frameGeometries[size].update, image.NewUniform(color.Opaque), image.Point{}, draw.Src)
+				if layersOverlap(barLayer, meter) || layersOverlap(barLayer, updateLayer) {
+					t.Fatalf("%dpx %s %q: secondary bar occludes the frame or update badge", size, theme, label)
+				}
+				for providerName := range frameProviderAsset {
+					providerLayer := image.NewNRGBA(image.Rect(0, 0, size, size))
+					v10ProviderMark(providerLayer, providerName, size, theme)
+					if layersOverlap(barLayer, providerLayer) {
+						t.Fatalf("%dpx %s %q: secondary bar occludes the %s mark", size, theme, label, providerName)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSecondaryBarShowsItsOwnPace(t *testing.T) {
+	primary := MeterState{UsagePct: 40, ExpectedPct: 40, ShowExpected: true, Label: "5h"}
+	ahead, behind := primary, primary
+	ahead.Secondary = WindowMeter{Show: true, UsagePct: 80, ExpectedPct: 30, ShowExpected: true}
+	behind.Secondary = WindowMeter{Show: true, UsagePct: 20, ExpectedPct: 70, ShowExpected: true}
+	for _, size := range []int{22, 32} {
+		base := renderV10NativeFrame("claude", primary, size, frameThemeDark)
+		aheadImg := renderV10NativeFrame("claude", ahead, size, frameThemeDark)
+		behindImg := renderV10NativeFrame("claude", behind, size, frameThemeDark)
+		if countRedDominantPixels(aheadImg) <= countRedDominantPixels(base) {
+			t.Fatalf("%dpx: secondary window ahead of pace is not red", size)
+		}
+		if countGreenDominantPixels(behindImg) <= countGreenDominantPixels(base) {
+			t.Fatalf("%dpx: secondary window behind pace is not green", size)
+		}
+	}
+}
+
+func TestSecondaryBarNamesItsWindow(t *testing.T) {
+	for _, size := range []int{22, 32} {
+		for _, theme := range []frameTheme{frameThemeDark, frameThemeLight} {
+			bar := WindowMeter{Show: true, UsagePct: 40, ExpectedPct: 40, ShowExpected: true}
+			unlabelled := image.NewNRGBA(image.Rect(0, 0, size, size))
+			frameSecondaryBar(unlabelled, bar, size, theme)
+			bar.Label = "7D"
+			weekly := image.NewNRGBA(image.Rect(0, 0, size, size))
+			frameSecondaryBar(weekly, bar, size, theme)
+			bar.Label = "5H"
+			session := image.NewNRGBA(image.Rect(0, 0, size, size))
+			frameSecondaryBar(session, bar, size, theme)
+			g := frameBarGeometries[size]
+			labelBox := image.Rect(g.labelX, g.labelY, g.labelX+frameGlyphWidth("7d"), g.labelY+len(frameGlyphs['7']))
+			if !labelPixelsDiffer(unlabelled, weekly, labelBox) || !labelPixelsDiffer(weekly, session, labelBox) {
+				t.Fatalf("%dpx %s: secondary bar does not name its window", size, theme)
+			}
+		}
+	}
+}
+
+func labelPixelsDiffer(a, b *image.NRGBA, box image.Rectangle) bool {
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if a.NRGBAAt(x, y) != b.NRGBAAt(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func TestProviderIconsIncludeUpdateBadgeAtTraySize(t *testing.T) {
 	for _, size := range []int{22, 32} {
 		t.Run(itoa(size), func(t *testing.T) {
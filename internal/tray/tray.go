@@ -6,9 +6,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -22,8 +22,10 @@ import (
 	"github.com/tnunamak/clawmeter/internal/autostart"
 	"github.com/tnunamak/clawmeter/internal/cache"
 	"github.com/tnunamak/clawmeter/internal/config"
+	"github.com/tnunamak/clawmeter/internal/engine"
 	"github.com/tnunamak/clawmeter/internal/forecast"
 	"github.com/tnunamak/clawmeter/internal/format"
+	"github.com/tnunamak/clawmeter/internal/notifier"
 	"github.com/tnunamak/clawmeter/internal/provider"
 	"github.com/tnunamak/clawmeter/internal/provider/all"
 	"github.com/tnunamak/clawmeter/internal/shellpath"
@@ -38,29 +40,20 @@ const (
 	tokenPlanConnectTarget = "token-plan"
 )
 
-func pollIntervalForConfig(seconds int) time.Duration {
-	interval := time.Duration(seconds) * time.Second
-	minimum := time.Duration(config.MinimumPollIntervalSeconds) * time.Second
-	if interval < minimum {
-		return minimum
-	}
-	return interval
-}
-
 type state struct {
 	mu                        sync.Mutex
 	lastResults               map[string]*provider.UsageData
-	lastSourceRevisions       map[string]string
-	statuses                  map[string]*status.ProviderStatus
-	failureGate               *provider.FailureGate
 	pendingRelease            *update.Release
 	currentTitle              string
 	currentTooltip            string
-	lastRefreshAt             time.Time
 	iconAutoMode              iconAutoMode
+	iconLayout                string
+	trayPrefs                 config.TrayConfig
+	trayPrefsKnown            bool
 	iconTargetOverride        iconTarget
 	iconTargetChoices         []iconTarget
 	iconTargetState           menuItemState
+	iconLayoutState           menuItemState
 	iconStateKnown            bool
 	currentIconProvider       string
 	currentIconMeter          icons.MeterState
@@ -94,6 +87,9 @@ var (
 	// every menu mutation. Keep background refreshes and click handlers from
 	// mutating the native menu concurrently.
 	trayRenderMu sync.Mutex
+	// trayEngine polls providers and dispatches alerts; the tray renders what
+	// it fetches. Nil until onReady, which windowProjection tolerates.
+	trayEngine *engine.Engine
 )
 
 func Run(ver string) int {
@@ -119,14 +115,13 @@ func configureNotificationIdentity() {
 }
 
 func onReady() {
-	s.failureGate = provider.NewFailureGate()
-
 	var err error
 	cfg, err = config.Load(all.SourceValidator())
 	if err != nil {
 		setErrorState("Config error")
 		return
 	}
+	applyTrayPreferences(cfg)
 
 	// Build the initial native menu as one transaction. On Linux, each menu
 	// mutation otherwise emits a separate D-Bus layout signal while Plasma is
@@ -148,7 +143,18 @@ func onReady() {
 
 	// Create registry and register providers
 	registry := provider.NewRegistry()
-	all.Register(registry, cfg, shellpath.NewSessionEnvironmentResolver())
+	envResolver := shellpath.NewSessionEnvironmentResolver()
+	all.Register(registry, cfg, envResolver)
+	alerts := notifier.NewDispatcher(notificationRules(cfg, envResolver))
+	alerts.ApplyConfig(cfg)
+	// Remember sent alerts and snoozes across restarts and share them with
+	// `clawmeter watch`.
+	if path, err := notifier.DefaultStatePath(); err == nil {
+		_ = alerts.UseStateFile(path)
+	}
+	trayEngine = engine.New(registry, alerts)
+	trayEngine.SetForecastMode(cfg.ForecastMode())
+	trayEngine.SetCacheTTLs(cfg)
 
 	// Build a menu group for every registered provider, ordered
 	// deterministically. The systray library can't insert menu items between
@@ -156,7 +162,8 @@ func onReady() {
 	// hides each group based on the provider's current state (configured,
 	// has data, errored, etc.) — meaning a provider that becomes available
 	// after launch (e.g. user runs `codex login` after starting the tray)
-	// appears on the next refresh without needing a restart.
+	// appears on the next refresh without needing a restart. Sources added to
+	// config.yaml while the tray runs take one of the spare groups.
 	providerMenus := make(map[string]*providerMenuItems)
 	providerConnectActions := make(chan string, 1)
 	familyCounts := make(map[string]int)
@@ -169,6 +176,20 @@ func onReady() {
 		hideProviderMenu(menu)
 		providerMenus[provider.SourceKey(p)] = menu
 	}
+	spareMenus := make([]*providerMenuItems, spareSourceMenus)
+	for i := range spareMenus {
+		spareMenus[i] = createProviderMenuItems(nil, false, nil, false)
+		hideProviderMenu(spareMenus[i])
+	}
+	detachedMenus := make(map[string]*providerMenuItems)
+	// A config reload replaces providerMenus rather than changing it, so a
+	// map returned by currentMenus is safe to range over.
+	var menusMu sync.Mutex
+	currentMenus := func() map[string]*providerMenuItems {
+		menusMu.Lock()
+		defer menusMu.Unlock()
+		return providerMenus
+	}
 
 	// Placeholder shown when no provider is in the primary UI; updateUI
 	// toggles its visibility based on whether any menu has data to render.
@@ -188,7 +209,12 @@ func onReady() {
 	mIconProvider := systray.AddMenuItem("Icon: Auto (click to cycle)", "")
 	s.iconTargetState = menuItemState{title: "Icon: Auto (click to cycle)", enabled: true, initialized: true}
 	mIconAutoMode := systray.AddMenuItem("Auto Mode: Risk", "")
+	updateIconAutoModeLabel(mIconAutoMode)
+	mIconLayout := systray.AddMenuItem(iconLayoutMenuTitle(cfg.IconLayout(), ""), "")
+	s.iconLayoutState = menuItemState{title: iconLayoutMenuTitle(cfg.IconLayout(), ""), enabled: true, initialized: true}
 	mRefresh := systray.AddMenuItem("Refresh Now", "")
+	mSnooze := systray.AddMenuItem("Snooze Notifications 1h", "")
+	mSnoozeReset := systray.AddMenuItem("Snooze Notifications Until Reset", "")
 	systray.AddSeparator()
 	iconActionCh := iconClickActions
 	if iconActionCh == nil {
@@ -215,23 +241,66 @@ func onReady() {
 	updateAutostartLabel(mAutostart)
 	mQuit := systray.AddMenuItem("Quit", "")
 
-	// Guard against concurrent refreshes
-	var refreshing sync.Mutex
+	pollInterval := engine.PollInterval(cfg.Settings.PollInterval)
+	pollIntervals := make(chan time.Duration, 1)
 
 	// reloadConfig re-reads config.yaml from disk and propagates changes
-	// to the registry filter and per-provider menu state. This is what
-	// makes `clawmeter config enable <provider>` (or any other out-of-band
-	// edit) reflect in the running tray without a restart.
-	reloadConfig := func() {
+	// to the registry, the poll interval and per-provider menu state. This
+	// is what makes `clawmeter config enable <provider>` (or any other
+	// out-of-band edit) reflect in the running tray without a restart. It
+	// reports whether the configured sources changed.
+	reloadConfig := func() bool {
 		newCfg, err := config.Load(all.SourceValidator())
 		if err != nil {
-			return
+			return false
 		}
+		sourcesChanged := !reflect.DeepEqual(newCfg.Providers, cfg.Providers)
 		cfg = newCfg
+		registry := trayEngine.Registry()
+		if sourcesChanged {
+			// The engine keeps backoff and last good results by source key,
+			// so only added and removed sources start over.
+			registry = provider.NewRegistry()
+			all.Register(registry, cfg, envResolver)
+			trayEngine.SetRegistry(registry)
+			trayRenderMu.Lock()
+			menus, missing := rebindProviderMenus(currentMenus(), detachedMenus, &spareMenus, registry.GetAll())
+			trayRenderMu.Unlock()
+			menusMu.Lock()
+			providerMenus = menus
+			menusMu.Unlock()
+			for _, key := range missing {
+				fmt.Fprintf(os.Stderr, "clawmeter: restart the tray to show source %s\n", key)
+			}
+		}
 		registry.SetEnabledFilter(cfg)
-		applyProviderEnablement(providerMenus, cfg)
+		trayRenderMu.Lock()
+		applyProviderEnablement(currentMenus(), cfg)
+		trayRenderMu.Unlock()
+		alerts.SetRules(notificationRules(cfg, envResolver))
+		alerts.ApplyConfig(cfg)
+		trayEngine.SetForecastMode(cfg.ForecastMode())
+		trayEngine.SetCacheTTLs(cfg)
+		if interval := engine.PollInterval(cfg.Settings.PollInterval); interval != pollInterval {
+			pollInterval = interval
+			select {
+			case <-pollIntervals:
+			default:
+			}
+			pollIntervals <- interval
+		}
+		if applyTrayPreferences(cfg) {
+			trayRenderMu.Lock()
+			updateIconAutoModeLabel(mIconAutoMode)
+			updateIconLayoutItem(mIconLayout)
+			trayRenderMu.Unlock()
+		}
+		return sourcesChanged
 	}
 
+	// Guard against concurrent refreshes, which would also race reloadConfig
+	var refreshing sync.Mutex
+
 	// Refresh usage only (lightweight, runs every poll cycle)
 	refresh := func(force bool) {
 		if !refreshing.TryLock() {
@@ -245,102 +314,51 @@ func onReady() {
 		// recovery before discovering configured providers so CLI-backed sources
 		// cannot disappear based on a startup race.
 		shellpath.Init()
-		configured := registry.GetConfigured()
-		currentRevisions := providerSourceRevisions(configured)
-		s.mu.Lock()
-		priorResults := resultsMatchingSourceRevisions(s.lastResults, s.lastSourceRevisions, currentRevisions)
-		toFetch, skipped := splitProvidersForRefresh(configured, s.failureGate, priorResults, force)
-		priorRevisions := cloneSourceRevisions(s.lastSourceRevisions)
-		s.mu.Unlock()
-
-		// Credential discovery may recover allowlisted variables through a login
-		// shell. Start the network deadline afterward so discovery latency cannot
-		// leave every provider with an already-expired context.
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		result := provider.FetchProvidersParallel(ctx, toFetch)
-
-		// Merge in cached data for backed-off providers
-		for name, cached := range skipped {
-			result.Results[name] = cached
-			if revision := priorRevisions[name]; revision != "" {
-				result.SourceRevisions[name] = revision
-			}
-		}
-
-		// Apply failure gate: suppress transient errors when cached data exists
-		s.mu.Lock()
-		for name, data := range result.Results {
-			if _, wasSkipped := skipped[name]; wasSkipped {
-				continue // already using cached data
-			}
-			if data == nil {
-				continue
-			}
-			if data.Error != "" {
-				log.Printf("provider refresh failed: provider=%s error=%s", name, data.Error)
-			}
-
-			if data.Error == "" && !data.IsExpired {
-				s.failureGate.RecordSuccess(name)
-				continue
-			}
-			// Provider errored — keep showing last good windows, but label them
-			// stale so the tray never turns unavailable data into a clean 0%.
-			hasPrior := false
-			if prev, ok := priorResults[name]; ok && prev != nil && prev.HasPresentableUsage() && cache.SourceRevisionMatches(priorRevisions, name, result.SourceRevisions[name]) {
-				hasPrior = true
-			}
-			if data.InvalidatesPriorUsage {
-				_ = s.failureGate.ShouldSurfaceError(name, hasPrior)
-			} else if hasPrior && !data.HasPresentableUsage() {
-				prev := priorResults[name].Clone()
-				prev.MarkStale(data.Error)
-				result.Results[name] = prev
-				_ = s.failureGate.ShouldSurfaceError(name, true)
-			} else if !s.failureGate.ShouldSurfaceError(name, hasPrior) {
-				// First failure with prior data — keep showing cache silently.
-				if prev, ok := priorResults[name]; ok && prev != nil && cache.SourceRevisionMatches(priorRevisions, name, result.SourceRevisions[name]) {
-					cached := prev.Clone()
-					cached.MarkStale(data.Error)
-					result.Results[name] = cached
-				}
-			}
+		result, ok := trayEngine.Refresh(context.Background(), force)
+		if !ok {
+			return
 		}
-		s.mu.Unlock()
-
-		_ = cache.Write(result)
 
 		now := time.Now()
 		s.mu.Lock()
 		s.lastResults = result.Results
-		s.lastSourceRevisions = result.SourceRevisions
-		s.lastRefreshAt = now
-		statuses := s.statuses // reuse last known statuses
 		s.mu.Unlock()
+		statuses := trayEngine.Statuses() // reuse last known statuses
 
-		updateUI(result.Results, statuses, providerMenus, mReauth, mIconProvider, mEmpty, mProviderSetup)
+		updateUI(result.Results, statuses, currentMenus(), mReauth, mIconProvider, mIconLayout, mEmpty, mProviderSetup)
 		trayRenderMu.Lock()
 		mRefresh.SetTitle(fmt.Sprintf("Refresh Now  (updated %s)", now.Format("15:04")))
+		updateSnoozeItems(mSnooze, mSnoozeReset, alerts.SnoozedUntil(), result.Results)
+		trayRenderMu.Unlock()
+	}
+
+	// toggleSnooze resumes notifications when snoozed, and otherwise snoozes
+	// them until the time returned by until.
+	toggleSnooze := func(until func(map[string]*provider.UsageData) (time.Time, bool)) {
+		s.mu.Lock()
+		results := s.lastResults
+		s.mu.Unlock()
+		if !alerts.SnoozedUntil().IsZero() {
+			_ = alerts.Snooze(time.Time{})
+		} else if t, ok := until(results); ok {
+			_ = alerts.Snooze(t)
+		}
+		trayRenderMu.Lock()
+		updateSnoozeItems(mSnooze, mSnoozeReset, alerts.SnoozedUntil(), results)
 		trayRenderMu.Unlock()
 	}
 
 	// Refresh status pages (heavier, runs less often)
 	refreshStatus := func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
-
 		shellpath.Init()
-		statuses := status.FetchAll(ctx, providerNames(registry.GetConfigured()))
+		statuses := trayEngine.RefreshStatus(context.Background())
 
 		s.mu.Lock()
-		s.statuses = statuses
 		lastResults := s.lastResults
 		s.mu.Unlock()
 
 		if lastResults != nil {
-			updateUI(lastResults, statuses, providerMenus, mReauth, mIconProvider, mEmpty, mProviderSetup)
+			updateUI(lastResults, statuses, currentMenus(), mReauth, mIconProvider, mIconLayout, mEmpty, mProviderSetup)
 		}
 	}
 
@@ -360,7 +378,8 @@ func onReady() {
 
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
-		rel, err := update.Check(ctx, version)
+		opts := update.Options{Channel: cfg.Settings.UpdateChannel, Pinned: cfg.Settings.PinnedVersion, BaseURL: cfg.Settings.ReleaseURL}
+		rel, err := update.Check(ctx, version, opts)
 		if err != nil {
 			return
 		}
@@ -376,7 +395,7 @@ func onReady() {
 		results := s.lastResults
 		s.mu.Unlock()
 		if results != nil {
-			displayNames := providerDisplayNames(providerMenus)
+			displayNames := providerDisplayNames(currentMenus())
 			updateTrayIcon(results)
 			updateTrayTitle(results)
 			updateTrayTooltip(results, displayNames)
@@ -404,7 +423,7 @@ func onReady() {
 			trayRenderMu.Unlock()
 			return
 		}
-		if err := update.ApplyTo(ctx, rel.URL, exe); err != nil {
+		if err := update.ApplyTo(ctx, rel, exe); err != nil {
 			trayRenderMu.Lock()
 			mUpdate.SetTitle(fmt.Sprintf("Update failed: %v", err))
 			mUpdate.Enable()
@@ -429,16 +448,15 @@ func onReady() {
 		// GetConfigured calls every provider's IsConfigured method, and some
 		// providers recover PATH through a login shell. That work belongs to the
 		// background refresh; cached rendering only needs the registered names.
-		allProviders := registry.GetAll()
-		filtered := cachedResultsForCurrentSources(cached, allProviders)
+		filtered := trayEngine.Restore(cached)
 		s.mu.Lock()
 		s.lastResults = filtered
-		s.lastSourceRevisions = providerSourceRevisions(allProviders)
-		s.lastRefreshAt = cached.FetchedAt
 		s.mu.Unlock()
-		updateUI(filtered, nil, providerMenus, mReauth, mIconProvider, mEmpty, mProviderSetup)
+		updateUI(filtered, nil, currentMenus(), mReauth, mIconProvider, mIconLayout, mEmpty, mProviderSetup)
 	}
 
+	updateSnoozeItems(mSnooze, mSnoozeReset, alerts.SnoozedUntil(), s.lastResults)
+
 	// Initial refresh in background (don't block tray UI)
 	go refresh(false)
 	go refreshStatus()
@@ -447,17 +465,40 @@ func onReady() {
 	go checkUpdate()
 
 	// Setup tickers
-	pollInterval := pollIntervalForConfig(cfg.Settings.PollInterval)
 	ticker := time.NewTicker(pollInterval)
 	statusTicker := time.NewTicker(15 * time.Minute) // status pages checked less often
 	updateTicker := time.NewTicker(updateCheckInterval)
 
+	// Apply saves to config.yaml as they happen instead of at the next poll.
+	// Refresh only when sources changed; other settings need just a redraw.
+	// Without a watch, each poll still reloads the config.
+	watchErr := config.Watch(context.Background(), func() {
+		refreshing.Lock()
+		sourcesChanged := reloadConfig()
+		refreshing.Unlock()
+		if sourcesChanged {
+			refresh(false)
+			return
+		}
+		s.mu.Lock()
+		results := s.lastResults
+		s.mu.Unlock()
+		if results != nil {
+			updateUI(results, trayEngine.Statuses(), currentMenus(), mReauth, mIconProvider, mIconLayout, mEmpty, mProviderSetup)
+		}
+	})
+	if watchErr != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: watching config: %v\n", watchErr)
+	}
+
 	// Event loop (never blocks on network I/O)
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				go refresh(false)
+			case interval := <-pollIntervals:
+				ticker.Reset(interval)
 			case <-statusTicker.C:
 				go refreshStatus()
 			case <-updateTicker.C:
@@ -467,16 +508,24 @@ func onReady() {
 				go checkUpdate()
 			case action := <-iconActionCh:
 				if action == iconClickResetAuto {
-					resetIconSelection(providerMenus, mIconProvider, mIconAutoMode)
+					resetIconSelection(currentMenus(), mIconProvider, mIconAutoMode)
 				} else {
-					cycleIconSelection(providerMenus, mIconProvider)
+					cycleIconSelection(currentMenus(), mIconProvider)
 				}
 			case <-mIconProvider.ClickedCh:
-				cycleIconSelection(providerMenus, mIconProvider)
+				cycleIconSelection(currentMenus(), mIconProvider)
 			case <-mIconAutoMode.ClickedCh:
-				toggleIconAutoMode(providerMenus, mIconProvider, mIconAutoMode)
+				toggleIconAutoMode(currentMenus(), mIconProvider, mIconAutoMode)
+			case <-mIconLayout.ClickedCh:
+				toggleIconLayout(mIconLayout)
+			case <-mSnooze.ClickedCh:
+				go toggleSnooze(func(map[string]*provider.UsageData) (time.Time, bool) {
+					return time.Now().Add(time.Hour), true
+				})
+			case <-mSnoozeReset.ClickedCh:
+				go toggleSnooze(snoozeUntilReset)
 			case providerName := <-providerConnectActions:
-				menu := providerMenus[providerName]
+				menu := currentMenus()[providerName]
 				if menu == nil || menu.connectItem == nil {
 					continue
 				}
@@ -549,14 +598,16 @@ type menuItemState struct {
 
 const maxWindowItems = 8 // pre-allocate up to 8 window slots per provider
 
+// spareSourceMenus is how many unbound provider groups are pre-allocated for
+// sources added to config.yaml while the tray runs.
+const spareSourceMenus = 4
+
+// createProviderMenuItems adds the menu group for p. A nil p adds a spare
+// group, which bindProviderMenu assigns a provider later.
 func createProviderMenuItems(p provider.Provider, explicitlyEnabled bool, connectActions chan<- string, repeated bool) *providerMenuItems {
-	displayName := p.DisplayName()
-	label := provider.SourceLabel(p)
-	if label == "" {
-		label = provider.SourceID(p)
-	}
-	if repeated && label != "" {
-		displayName += " · " + label
+	displayName := ""
+	if p != nil {
+		displayName = engine.DisplayName(p, repeated)
 	}
 	// Provider header (disabled)
 	header := systray.AddMenuItem(displayName, "")
@@ -567,7 +618,7 @@ func createProviderMenuItems(p provider.Provider, explicitlyEnabled bool, connec
 	statusItem.Disable()
 
 	var connectItem *systray.MenuItem
-	if p.Name() == tokenPlanProviderName && connectActions != nil {
+	if p != nil && p.Name() == tokenPlanProviderName && connectActions != nil {
 		connectItem = systray.AddMenuItem("Connect quota access", "")
 		go func() {
 			for range connectItem.ClickedCh {
@@ -607,15 +658,9 @@ func createProviderMenuItems(p provider.Provider, explicitlyEnabled bool, connec
 	// (or the global separator after the provider block) acts as the visual
 	// divider; we don't add a per-provider separator because there's no way
 	// to hide a separator and the provider block has variable membership.
-	dashboardItem := systray.AddMenuItem(fmt.Sprintf("Open %s Dashboard", p.DisplayName()), p.DashboardURL())
-	go func() {
-		for range dashboardItem.ClickedCh {
-			openURL(p.DashboardURL())
-		}
-	}()
+	dashboardItem := systray.AddMenuItem("", "")
 
-	return &providerMenuItems{
-		provider:          p,
+	menu := &providerMenuItems{
 		displayName:       displayName,
 		headerItem:        header,
 		statusItem:        statusItem,
@@ -629,8 +674,65 @@ func createProviderMenuItems(p provider.Provider, explicitlyEnabled bool, connec
 		connectState:      menuItemState{title: "Connect quota access", visible: true, enabled: true, initialized: connectItem != nil},
 		windowStates:      windowStates,
 		balanceStates:     balanceStates,
-		dashboardState:    menuItemState{title: fmt.Sprintf("Open %s Dashboard", p.DisplayName()), visible: true, enabled: true, initialized: true},
+		dashboardState:    menuItemState{title: "", visible: true, enabled: true, initialized: true},
+	}
+	if p != nil {
+		bindProviderMenu(menu, p)
+	}
+	return menu
+}
+
+// bindProviderMenu assigns p to a group that has none yet.
+func bindProviderMenu(menu *providerMenuItems, p provider.Provider) {
+	menu.provider = p
+	setMenuItemTitle(menu.dashboardItem, &menu.dashboardState, fmt.Sprintf("Open %s Dashboard", p.DisplayName()))
+	menu.dashboardItem.SetTooltip(p.DashboardURL())
+	go func() {
+		for range menu.dashboardItem.ClickedCh {
+			openURL(p.DashboardURL())
+		}
+	}()
+}
+
+// rebindProviderMenus returns the menu groups for providers after a config
+// change. A source already shown keeps its group, a source added back gets
+// its old group from detached, and a new source takes a spare. Groups of
+// removed sources are hidden and moved to detached. It also returns the keys
+// of sources left without a group once the spares run out. The caller holds
+// trayRenderMu.
+func rebindProviderMenus(current, detached map[string]*providerMenuItems, spares *[]*providerMenuItems, providers []provider.Provider) (map[string]*providerMenuItems, []string) {
+	displayNames := engine.DisplayNames(providers)
+	menus := make(map[string]*providerMenuItems, len(providers))
+	var missing []string
+	for _, p := range providers {
+		key := provider.SourceKey(p)
+		menu := current[key]
+		if menu == nil {
+			menu = detached[key]
+			delete(detached, key)
+		}
+		if menu == nil && len(*spares) > 0 {
+			menu = (*spares)[0]
+			*spares = (*spares)[1:]
+			bindProviderMenu(menu, p)
+		}
+		if menu == nil {
+			missing = append(missing, key)
+			continue
+		}
+		// Adding or removing a second source of a family changes how the
+		// others are labelled.
+		menu.displayName = displayNames[key]
+		setMenuItemTitle(menu.headerItem, &menu.headerState, menu.displayName)
+		menus[key] = menu
+	}
+	for key, menu := range current {
+		if menus[key] == nil {
+			hideProviderMenu(menu)
+			detached[key] = menu
+		}
 	}
+	return menus, missing
 }
 
 func hideProviderMenu(menu *providerMenuItems) {
@@ -774,7 +876,7 @@ func providerConnectFailureMessage(stdout, stderr string) string {
 	}
 }
 
-func updateUI(results map[string]*provider.UsageData, statuses map[string]*status.ProviderStatus, menus map[string]*providerMenuItems, mReauth *systray.MenuItem, mIconProvider *systray.MenuItem, mEmpty *systray.MenuItem, mProviderSetup *systray.MenuItem) {
+func updateUI(results map[string]*provider.UsageData, statuses map[string]*status.ProviderStatus, menus map[string]*providerMenuItems, mReauth *systray.MenuItem, mIconProvider *systray.MenuItem, mIconLayout *systray.MenuItem, mEmpty *systray.MenuItem, mProviderSetup *systray.MenuItem) {
 	setups := make(map[string]provider.SetupStatus, len(menus))
 	for name, menu := range menus {
 		// Only Alibaba has a setup-only menu path today. Other providers are
@@ -891,7 +993,7 @@ func updateUI(results map[string]*provider.UsageData, statuses map[string]*statu
 
 			resetStr, indicator := "reset unknown", "reset unknown"
 			if !window.ResetsAt.IsZero() {
-				proj := forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+				proj := windowProjection(data, window)
 				resetStr, indicator = format.FormatDuration(time.Until(window.ResetsAt)), proj.PaceIndicator()
 			} else if window.ResetPolicy != "" {
 				indicator = window.ResetPolicy
@@ -942,16 +1044,15 @@ func updateUI(results map[string]*provider.UsageData, statuses map[string]*statu
 
 	// Update icon and title based on worst usage (only active providers)
 	updateTrayIcon(activeResults)
+	updateIconLayoutItem(mIconLayout)
 	updateTrayTitle(activeResults)
 	updateTrayTooltip(activeResults, displayNames)
 
 	// Check notification thresholds
-	checkThresholds(activeResults, displayNames)
+	checkThresholds(activeResults, statuses, displayNames)
 }
 
 func cycleIconSelection(menus map[string]*providerMenuItems, item *systray.MenuItem) {
-	displayNames := providerDisplayNames(menus)
-
 	s.mu.Lock()
 	results := s.lastResults
 	mode := normalizedIconAutoModeLocked()
@@ -962,11 +1063,13 @@ func cycleIconSelection(menus map[string]*providerMenuItems, item *systray.MenuI
 	}
 	s.iconTargetOverride = nextIconTargetOverride(s.iconTargetOverride, choices, true)
 	s.mu.Unlock()
+	saveTrayPreferences()
 
 	trayRenderMu.Lock()
 	defer trayRenderMu.Unlock()
 	systray.BeginMenuUpdate()
 	defer systray.EndMenuUpdate()
+	displayNames := providerDisplayNames(menus)
 	updateIconTargetSelector(results, displayNames, item)
 	updateTrayIcon(results)
 	updateTrayTitle(results)
@@ -974,8 +1077,6 @@ func cycleIconSelection(menus map[string]*providerMenuItems, item *systray.MenuI
 }
 
 func resetIconSelection(menus map[string]*providerMenuItems, item *systray.MenuItem, modeItem *systray.MenuItem) {
-	displayNames := providerDisplayNames(menus)
-
 	s.mu.Lock()
 	results := s.lastResults
 	mode := normalizedIconAutoModeLocked()
@@ -988,6 +1089,7 @@ func resetIconSelection(menus map[string]*providerMenuItems, item *systray.MenuI
 	defer trayRenderMu.Unlock()
 	systray.BeginMenuUpdate()
 	defer systray.EndMenuUpdate()
+	displayNames := providerDisplayNames(menus)
 	updateIconTargetSelector(results, displayNames, item)
 	updateIconAutoModeLabel(modeItem)
 	updateTrayIcon(results)
@@ -996,8 +1098,6 @@ func resetIconSelection(menus map[string]*providerMenuItems, item *systray.MenuI
 }
 
 func toggleIconAutoMode(menus map[string]*providerMenuItems, item *systray.MenuItem, modeItem *systray.MenuItem) {
-	displayNames := providerDisplayNames(menus)
-
 	s.mu.Lock()
 	results := s.lastResults
 	current := normalizedIconAutoModeLocked()
@@ -1016,11 +1116,13 @@ func toggleIconAutoMode(menus map[string]*providerMenuItems, item *systray.MenuI
 		s.iconTargetOverride = iconTarget{}
 	}
 	s.mu.Unlock()
+	saveTrayPreferences()
 
 	trayRenderMu.Lock()
 	defer trayRenderMu.Unlock()
 	systray.BeginMenuUpdate()
 	defer systray.EndMenuUpdate()
+	displayNames := providerDisplayNames(menus)
 	updateIconTargetSelector(results, displayNames, item)
 	updateIconAutoModeLabel(modeItem)
 	updateTrayIcon(results)
@@ -1028,6 +1130,112 @@ func toggleIconAutoMode(menus map[string]*providerMenuItems, item *systray.MenuI
 	updateTrayTooltip(results, displayNames)
 }
 
+// toggleIconLayout switches between the single-window and dual-window icon
+// and saves the choice, so the next launch keeps it.
+func toggleIconLayout(item *systray.MenuItem) {
+	s.mu.Lock()
+	results := s.lastResults
+	if s.iconLayout == config.IconLayoutDual {
+		s.iconLayout = config.IconLayoutSingle
+	} else {
+		s.iconLayout = config.IconLayoutDual
+	}
+	s.mu.Unlock()
+	saveTrayPreferences()
+
+	trayRenderMu.Lock()
+	defer trayRenderMu.Unlock()
+	updateTrayIcon(results)
+	updateIconLayoutItem(item)
+}
+
+// applyTrayPreferences loads the icon layout, auto mode, and pinned target
+// from c when they differ from the last ones read from the config file, so
+// an edit to the file reaches the running tray while menu choices made since
+// are kept. Saves from the menu do not update trayPrefs: a reload that read
+// the file just before a save must not revert the choice. It reports whether
+// anything was applied.
+func applyTrayPreferences(c *config.Config) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trayPrefsKnown && s.trayPrefs == c.Settings.Tray {
+		return false
+	}
+	s.trayPrefs = c.Settings.Tray
+	s.trayPrefsKnown = true
+	s.iconLayout = c.IconLayout()
+	s.iconAutoMode = iconAutoMode(c.IconAutoMode())
+	source, window := c.Settings.Tray.IconTargetParts()
+	s.iconTargetOverride = iconTarget{Provider: source, Window: window}
+	return true
+}
+
+// saveTrayPreferences writes the current icon choices to the config file.
+// Defaults are stored as empty values so an untouched config stays minimal.
+func saveTrayPreferences() {
+	s.mu.Lock()
+	prefs := trayPreferencesLocked()
+	s.mu.Unlock()
+
+	saved, err := config.Load(all.SourceValidator())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: failed to save tray preferences: %v\n", err)
+		return
+	}
+	if saved.Settings.Tray == prefs {
+		return
+	}
+	saved.Settings.Tray = prefs
+	if err := saved.Save(all.SourceValidator()); err != nil {
+		fmt.Fprintf(os.Stderr, "clawmeter: failed to save tray preferences: %v\n", err)
+	}
+}
+
+func trayPreferencesLocked() config.TrayConfig {
+	var prefs config.TrayConfig
+	if s.iconLayout == config.IconLayoutDual {
+		prefs.IconLayout = config.IconLayoutDual
+	}
+	if mode := normalizedIconAutoModeLocked(); mode != iconAutoRisk {
+		prefs.AutoMode = string(mode)
+	}
+	if target := s.iconTargetOverride; target.Provider != "" && target.Window != "" {
+		prefs.IconTarget = target.Provider + "/" + target.Window
+	}
+	return prefs
+}
+
+// iconLayoutMenuTitle names the layout and notes when the provider in the
+// icon shows its logo, which has no room for a second window.
+func iconLayoutMenuTitle(layout, iconProvider string) string {
+	title := "Icon Layout: One Window"
+	if layout == config.IconLayoutDual {
+		title = "Icon Layout: Two Windows"
+	}
+	if iconProvider != "" && !icons.SupportsDualLayout(iconProvider) {
+		title += " (not available for this provider)"
+	}
+	return title
+}
+
+func updateIconLayoutItem(item *systray.MenuItem) {
+	if item == nil {
+		return
+	}
+	s.mu.Lock()
+	title := iconLayoutMenuTitle(s.iconLayout, s.currentIconProvider)
+	s.mu.Unlock()
+	setMenuItemTitle(item, &s.iconLayoutState, title)
+}
+
+func currentIconLayout() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.iconLayout
+}
+
+// providerDisplayNames returns the menu names by source key. The caller holds
+// trayRenderMu, which guards names changed by a config reload.
 func providerDisplayNames(menus map[string]*providerMenuItems) map[string]string {
 	displayNames := make(map[string]string, len(menus))
 	for name, menu := range menus {
@@ -1156,7 +1364,7 @@ func activeIconTargetsAllowingStale(results map[string]*provider.UsageData, mode
 		}
 		for _, window := range windows {
 			target := iconTarget{Provider: name, Window: window.Name}
-			proj := windowProjection(window)
+			proj := windowProjection(data, window)
 			score := proj.ProjectedPct
 			if mode == iconAutoRunway {
 				score = 100 - proj.ProjectedPct
@@ -1215,17 +1423,18 @@ func iconTargetRisk(data *provider.UsageData, target iconTarget) float64 {
 		return providerProjectedPct(data)
 	}
 	if window, _, ok := selectedIconWindow(data, target.Window); ok {
-		return windowProjectedPct(window)
+		return windowProjectedPct(data, window)
 	}
 	return -1
 }
 
-func windowProjectedPct(window provider.UsageWindow) float64 {
-	return windowProjection(window).ProjectedPct
+func windowProjectedPct(data *provider.UsageData, window provider.UsageWindow) float64 {
+	return windowProjection(data, window).ProjectedPct
 }
 
-func windowProjection(window provider.UsageWindow) forecast.Projection {
-	return forecast.Project(window.Utilization, window.ResetsAt, forecast.GuessWindowType(window.Name))
+func windowProjection(data *provider.UsageData, window provider.UsageWindow) forecast.Projection {
+	current := forecast.Reading{At: data.FetchedAt, Pct: window.Utilization, ResetsAt: window.ResetsAt}
+	return trayEngine.Estimator().Project(data.SourceKey(), window.Name, current, forecast.GuessWindowType(window.Name))
 }
 
 func targetInChoices(target iconTarget, choices []iconTarget) bool {
@@ -1319,6 +1528,9 @@ func updateTrayIcon(results map[string]*provider.UsageData) {
 
 	if _, data, windowName, ok := selectedTrayTarget(results); ok {
 		meter = iconMeterState(data, windowName)
+		if currentIconLayout() == config.IconLayoutDual {
+			meter.Secondary = companionWindowMeter(data, windowName)
+		}
 		worstProvider = iconProviderName(data)
 	}
 	meter.UpdateAvailable = updateAvailable()
@@ -1377,6 +1589,59 @@ func iconMeterState(data *provider.UsageData, windowName string) icons.MeterStat
 	}
 }
 
+// companionWindowMeter is the dual layout's second window: the selected
+// provider's longest other window when one outlasts the selected window (5h
+// pairs with 7d), otherwise its shortest (7d pairs with 5h).
+func companionWindowMeter(data *provider.UsageData, windowName string) icons.WindowMeter {
+	if data == nil || data.IsExpired || data.Stale || (data.Error != "" && !data.HasPresentableUsage()) {
+		return icons.WindowMeter{}
+	}
+	if !icons.SupportsDualLayout(data.Provider) {
+		return icons.WindowMeter{}
+	}
+	primary, _, ok := selectedIconWindow(data, windowName)
+	if !ok {
+		return icons.WindowMeter{}
+	}
+	companion, ok := companionWindow(data.UsableWindows(), primary)
+	if !ok {
+		return icons.WindowMeter{}
+	}
+	return icons.WindowMeter{
+		Show:         true,
+		UsagePct:     companion.Utilization,
+		ExpectedPct:  expectedUsagePct(companion.ResetsAt, forecast.GuessWindowType(companion.Name)),
+		ShowExpected: true,
+		Label:        windowBadgeLabelForWindow(companion),
+	}
+}
+
+func companionWindow(windows []provider.UsageWindow, primary provider.UsageWindow) (provider.UsageWindow, bool) {
+	primaryLen := forecast.GuessWindowType(primary.Name)
+	var longest, shortest provider.UsageWindow
+	found := false
+	for _, window := range windows {
+		if window.Name == primary.Name {
+			continue
+		}
+		windowLen := forecast.GuessWindowType(window.Name)
+		if !found || windowLen > forecast.GuessWindowType(longest.Name) {
+			longest = window
+		}
+		if !found || windowLen < forecast.GuessWindowType(shortest.Name) {
+			shortest = window
+		}
+		found = true
+	}
+	if !found {
+		return provider.UsageWindow{}, false
+	}
+	if forecast.GuessWindowType(longest.Name) > primaryLen {
+		return longest, true
+	}
+	return shortest, true
+}
+
 func expectedUsagePct(resetsAt time.Time, windowLen time.Duration) float64 {
 	if windowLen <= 0 {
 		return 0
@@ -1422,14 +1687,13 @@ func selectedIconWindow(data *provider.UsageData, windowName string) (provider.U
 			if window.Name != windowName {
 				continue
 			}
-			windowLen := forecast.GuessWindowType(window.Name)
-			return window, forecast.Project(window.Utilization, window.ResetsAt, windowLen), true
+			return window, windowProjection(data, window), true
 		}
 		return selected, selectedProj, false
 	}
 	hasSelected := false
 	for _, window := range data.UsableWindows() {
-		proj := windowProjection(window)
+		proj := windowProjection(data, window)
 		if !hasSelected || forecast.CompareRisk(proj, selectedProj) < 0 {
 			selected = window
 			selectedProj = proj
@@ -1652,55 +1916,93 @@ func compactProjectionEstimate(proj forecast.Projection) string {
 	return estimate
 }
 
-func checkThresholds(results map[string]*provider.UsageData, displayNames map[string]string) {
+// checkThresholds hands the visible results to the engine's alert
+// dispatcher, which remembers the previous observation itself and delivers
+// alerts off the render path.
+func checkThresholds(results map[string]*provider.UsageData, statuses map[string]*status.ProviderStatus, displayNames map[string]string) {
+	trayEngine.Notify(notifier.Observation{
+		Results:      results,
+		Statuses:     statuses,
+		DisplayNames: displayNames,
+	})
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lastResults = results
+	s.mu.Unlock()
+}
+
+// notificationRules returns the desktop rule, which raises threshold and pace
+// alerts but leaves expiry and outages to the menu, followed by the
+// configured sinks. Thresholds come from config per provider window.
+func notificationRules(cfg *config.Config, resolver provider.SessionEnvironmentResolver) []notifier.Rule {
+	desktop := notifier.Rule{
+		Sink:  desktopSink{},
+		Kinds: []notifier.Kind{notifier.KindWarning, notifier.KindCritical, notifier.KindPace},
+	}
+	return append([]notifier.Rule{desktop}, notifier.Rules(cfg, resolver)...)
+}
 
-	if s.lastResults == nil {
-		s.lastResults = make(map[string]*provider.UsageData)
+// updateSnoozeItems shows either a resume item, while notifications are
+// snoozed, or the two snooze items. The caller must hold trayRenderMu.
+func updateSnoozeItems(mSnooze, mSnoozeReset *systray.MenuItem, snoozedUntil time.Time, results map[string]*provider.UsageData) {
+	if !snoozedUntil.IsZero() {
+		mSnooze.SetTitle(fmt.Sprintf("Resume Notifications  (snoozed until %s)", snoozeClock(snoozedUntil)))
+		mSnoozeReset.Hide()
+		return
+	}
+	mSnooze.SetTitle("Snooze Notifications 1h")
+	if resetAt, ok := snoozeUntilReset(results); ok {
+		mSnoozeReset.SetTitle(fmt.Sprintf("Snooze Notifications Until Reset  (%s)", snoozeClock(resetAt)))
+		mSnoozeReset.Show()
+	} else {
+		mSnoozeReset.Hide()
 	}
+}
 
-	warningThreshold := 80.0
-	criticalThreshold := 95.0
-	if cfg != nil {
-		warningThreshold = cfg.Settings.NotificationThresholds.Warning
-		criticalThreshold = cfg.Settings.NotificationThresholds.Critical
+// snoozeClock formats a snooze end, adding the day when it is not today.
+func snoozeClock(t time.Time) string {
+	t, now := t.Local(), time.Now()
+	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
+		return t.Format("15:04")
 	}
+	return t.Format("Mon 15:04")
+}
 
-	for name, data := range results {
-		if data == nil || data.Error != "" || data.Stale {
+// snoozeUntilReset returns the next reset of the most-used window, which is
+// the one whose alerts a snooze is meant to silence.
+func snoozeUntilReset(results map[string]*provider.UsageData) (time.Time, bool) {
+	now := time.Now()
+	var best provider.UsageWindow
+	found := false
+	for _, data := range results {
+		if data == nil || data.Error != "" || data.IsExpired {
 			continue
 		}
-
-		oldData, hadOld := s.lastResults[name]
-
 		for _, window := range data.UsableWindows() {
-			pct := window.Utilization
-			oldPct := 0.0
-
-			if hadOld && oldData != nil {
-				if oldWindow, ok := oldData.GetWindow(window.Name); ok {
-					oldPct = oldWindow.Utilization
-				}
-			}
-
-			display := displayNames[name]
-			if display == "" {
-				display = name
+			if !window.ResetsAt.After(now) {
+				continue
 			}
-			proj := forecast.Project(pct, window.ResetsAt, forecast.GuessWindowType(window.Name))
-			message := fmt.Sprintf("%s window at %.0f%% — %s", window.Name, pct, proj.PaceIndicator())
-
-			if pct >= criticalThreshold && oldPct < criticalThreshold {
-				notify(fmt.Sprintf("%s usage critical", display), message, "critical")
-			} else if pct >= warningThreshold && oldPct < warningThreshold {
-				notify(fmt.Sprintf("%s usage warning", display), message, "normal")
+			if !found || window.Utilization > best.Utilization ||
+				(window.Utilization == best.Utilization && window.ResetsAt.Before(best.ResetsAt)) {
+				best, found = window, true
 			}
 		}
 	}
+	return best.ResetsAt, found
+}
 
-	// Update stored results
-	s.lastResults = results
+// desktopSink raises alerts as local desktop notifications.
+type desktopSink struct{}
+
+func (desktopSink) Name() string { return "desktop" }
+
+func (desktopSink) Send(_ context.Context, event notifier.Event) error {
+	urgency := "normal"
+	if event.Urgent() {
+		urgency = "critical"
+	}
+	notify(event.Title, event.Message, urgency)
+	return nil
 }
 
 func setErrorState(msg string) {
@@ -1762,72 +2064,6 @@ func notify(title, body, urgency string) {
 	_ = beeep.Notify(title, body, "")
 }
 
-func providerNames(providers []provider.Provider) []string {
-	names := make([]string, 0, len(providers))
-	for _, p := range providers {
-		names = append(names, p.Name())
-	}
-	return names
-}
-
-func providerSourceRevisions(providers []provider.Provider) map[string]string {
-	revisions := make(map[string]string)
-	for _, p := range providers {
-		if revision := provider.SourceRevision(p); revision != "" {
-			revisions[provider.SourceKey(p)] = revision
-		}
-	}
-	return revisions
-}
-
-func cloneSourceRevisions(revisions map[string]string) map[string]string {
-	cloned := make(map[string]string, len(revisions))
-	for name, revision := range revisions {
-		cloned[name] = revision
-	}
-	return cloned
-}
-
-func resultsMatchingSourceRevisions(results map[string]*provider.UsageData, previous, current map[string]string) map[string]*provider.UsageData {
-	matched := make(map[string]*provider.UsageData, len(results))
-	for name, data := range results {
-		if cache.SourceRevisionMatches(previous, name, current[name]) {
-			matched[name] = data
-		}
-	}
-	return matched
-}
-
-func cachedResultsForCurrentSources(entry *cache.Entry, providers []provider.Provider) map[string]*provider.UsageData {
-	current := providerSourceRevisions(providers)
-	results := make(map[string]*provider.UsageData)
-	for _, p := range providers {
-		name := provider.SourceKey(p)
-		if !cache.SourceRevisionMatches(entry.SourceRevisions, name, current[name]) {
-			continue
-		}
-		if data, ok := entry.ProviderData[name]; ok {
-			results[name] = data
-		}
-	}
-	return results
-}
-
-func splitProvidersForRefresh(providers []provider.Provider, gate *provider.FailureGate, lastResults map[string]*provider.UsageData, force bool) ([]provider.Provider, map[string]*provider.UsageData) {
-	toFetch := make([]provider.Provider, 0, len(providers))
-	skipped := make(map[string]*provider.UsageData)
-	for _, p := range providers {
-		name := provider.SourceKey(p)
-		prev := lastResults[name]
-		if !force && gate != nil && gate.InBackoff(name) && prev != nil && prev.EstablishesPrimaryUIHistory() {
-			skipped[name] = prev.Clone()
-			continue
-		}
-		toFetch = append(toFetch, p)
-	}
-	return toFetch, skipped
-}
-
 // sortedKeys returns provider names sorted by severity (worst first).
 // Expired > error > risk-window urgency > alphabetical.
 func sortedKeys(m map[string]*provider.UsageData) []string {
@@ -10,7 +10,6 @@ import (
 
 	"github.com/gen2brain/beeep"
 
-	"github.com/tnunamak/clawmeter/internal/cache"
 	"github.com/tnunamak/clawmeter/internal/config"
 	"github.com/tnunamak/clawmeter/internal/forecast"
 	"github.com/tnunamak/clawmeter/internal/provider"
@@ -31,29 +30,6 @@ func (p sourceMenuTestProvider) FetchUsage(context.Context) (*provider.UsageData
 	return nil, nil
 }
 
-func TestTrayCacheAndPriorResultsRequireMatchingSourceRevision(t *testing.T) {
-	data := &provider.UsageData{Provider: "claude", SourceID: "default", Windows: []provider.UsageWindow{{Name: "5h", ResetsAt: time.Now().Add(time.Hour)}}}
-	entry := &cache.Entry{
-		ProviderData:    map[string]*provider.UsageData{"claude": data},
-		SourceRevisions: map[string]string{"claude": "old-profile"},
-	}
-
-	if got := cachedResultsForCurrentSources(entry, []provider.Provider{sourceMenuTestProvider{id: "default", revision: "new-profile"}}); len(got) != 0 {
-		t.Fatalf("startup cache crossed profile revisions: %#v", got)
-	}
-	if got := cachedResultsForCurrentSources(entry, []provider.Provider{sourceMenuTestProvider{id: "default"}}); len(got) != 0 {
-		t.Fatalf("revisioned explicit cache survived switch to native default: %#v", got)
-	}
-	if got := cachedResultsForCurrentSources(entry, []provider.Provider{sourceMenuTestProvider{id: "default", revision: "old-profile"}}); got["claude"] != data {
-		t.Fatalf("matching source revision was not restored: %#v", got)
-	}
-
-	prior := map[string]*provider.UsageData{"claude": data}
-	if got := resultsMatchingSourceRevisions(prior, map[string]string{"claude": "old-profile"}, map[string]string{"claude": "new-profile"}); len(got) != 0 {
-		t.Fatalf("refresh prior data crossed profile revisions: %#v", got)
-	}
-}
-
 func TestApplyProviderEnablementUsesFamilyForEverySource(t *testing.T) {
 	menus := map[string]*providerMenuItems{
 		"claude":      {provider: sourceMenuTestProvider{id: "default"}},
@@ -72,6 +48,41 @@ func TestApplyProviderEnablementUsesFamilyForEverySource(t *testing.T) {
 	}
 }
 
+func TestRebindProviderMenusFollowsConfiguredSources(t *testing.T) {
+	defaultSource := sourceMenuTestProvider{id: "default"}
+	workSource := sourceMenuTestProvider{id: "work"}
+	defaultMenu := createProviderMenuItems(defaultSource, false, nil, false)
+	spares := []*providerMenuItems{createProviderMenuItems(nil, false, nil, false)}
+	detached := make(map[string]*providerMenuItems)
+
+	menus, missing := rebindProviderMenus(map[string]*providerMenuItems{"claude": defaultMenu}, detached, &spares,
+		[]provider.Provider{defaultSource, workSource})
+	if len(missing) != 0 || menus["claude"] != defaultMenu || menus["claude:work"] == nil || len(spares) != 0 {
+		t.Fatalf("adding a source: menus=%v missing=%v spares=%d", menus, missing, len(spares))
+	}
+	if got := menus["claude"].displayName; got != "Claude · default" {
+		t.Fatalf("default source name = %q, want it qualified once a second source exists", got)
+	}
+	workMenu := menus["claude:work"]
+
+	menus, _ = rebindProviderMenus(menus, detached, &spares, []provider.Provider{defaultSource})
+	if menus["claude:work"] != nil || detached["claude:work"] != workMenu || workMenu.headerState.visible {
+		t.Fatalf("removing a source: menus=%v detached=%v", menus, detached)
+	}
+	if got := menus["claude"].displayName; got != "Claude" {
+		t.Fatalf("default source name = %q, want Claude", got)
+	}
+
+	menus, _ = rebindProviderMenus(menus, detached, &spares, []provider.Provider{defaultSource, workSource})
+	if menus["claude:work"] != workMenu || len(detached) != 0 {
+		t.Fatalf("re-adding a source did not reuse its group: menus=%v detached=%v", menus, detached)
+	}
+	extra := sourceMenuTestProvider{id: "extra"}
+	if _, missing := rebindProviderMenus(menus, detached, &spares, []provider.Provider{defaultSource, workSource, extra}); len(missing) != 1 || missing[0] != "claude:extra" {
+		t.Fatalf("missing = %v, want the source beyond the spares", missing)
+	}
+}
+
 func TestConfigureNotificationIdentity(t *testing.T) {
 	old := beeep.AppName
 	defer func() { beeep.AppName = old }()
@@ -274,6 +285,60 @@ func TestIconMeterStateUsesSoonestBlockingWindowForProviderDefault(t *testing.T)
 	}
 }
 
+func TestCompanionWindowMeterPairsShortAndLongWindows(t *testing.T) {
+	now := time.Now()
+	data := &provider.UsageData{
+		Provider: "claude",
+		Windows: []provider.UsageWindow{
+			{Name: "5h", Utilization: 40, ResetsAt: now.Add(4 * time.Hour)},
+			{Name: "7d", Utilization: 70, ResetsAt: now.Add(3 * 24 * time.Hour)},
+			{Name: "7d_opus", Utilization: 10, ResetsAt: now.Add(3 * 24 * time.Hour)},
+		},
+	}
+
+	bar := companionWindowMeter(data, "5h")
+	if !bar.Show || bar.UsagePct != 70 || !bar.ShowExpected || bar.Label != "7D" {
+		t.Fatalf("5h companion = %+v, want the 7d window", bar)
+	}
+	if absFloat(bar.ExpectedPct-4.0/7*100) > 0.5 {
+		t.Fatalf("7d companion ExpectedPct = %.1f, want its own pace", bar.ExpectedPct)
+	}
+	if bar := companionWindowMeter(data, "7d"); bar.UsagePct != 40 {
+		t.Fatalf("7d companion = %+v, want the 5h window", bar)
+	}
+	if bar := companionWindowMeter(&provider.UsageData{
+		Provider: "claude",
+		Windows:  data.Windows[:1],
+	}, "5h"); bar.Show {
+		t.Fatalf("single-window companion = %+v, want none", bar)
+	}
+	if bar := companionWindowMeter(&provider.UsageData{
+		Provider: "claude",
+		Stale:    true,
+		Windows:  data.Windows,
+	}, "5h"); bar.Show {
+		t.Fatalf("stale companion = %+v, want none", bar)
+	}
+	if bar := companionWindowMeter(&provider.UsageData{
+		Provider: "custom",
+		Windows:  data.Windows,
+	}, "5h"); bar.Show {
+		t.Fatalf("logo-icon companion = %+v, want none", bar)
+	}
+}
+
+func TestIconLayoutMenuTitleNotesLogoIcons(t *testing.T) {
+	if got := iconLayoutMenuTitle(config.IconLayoutDual, "claude"); got != "Icon Layout: Two Windows" {
+		t.Fatalf("claude title = %q", got)
+	}
+	if got := iconLayoutMenuTitle(config.IconLayoutDual, "custom"); got != "Icon Layout: Two Windows (not available for this provider)" {
+		t.Fatalf("custom title = %q", got)
+	}
+	if got := iconLayoutMenuTitle(config.IconLayoutSingle, ""); got != "Icon Layout: One Window" {
+		t.Fatalf("no-provider title = %q", got)
+	}
+}
+
 func TestIconMeterStateKeepsUnavailableDataNeutral(t *testing.T) {
 	meter := iconMeterState(&provider.UsageData{
 		Provider: "claude",
@@ -658,6 +723,57 @@ func TestActiveIconTargetsExcludesNonForecastableFacts(t *testing.T) {
 	}
 }
 
+func TestTrayPreferencesPersistAndReload(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	s.mu.Lock()
+	s.trayPrefsKnown = false
+	s.mu.Unlock()
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.iconLayout, s.iconAutoMode, s.iconTargetOverride = "", iconAutoRisk, iconTarget{}
+		s.trayPrefs, s.trayPrefsKnown = config.TrayConfig{}, false
+		s.mu.Unlock()
+	})
+
+	c := config.DefaultConfig()
+	c.Settings.Tray = config.TrayConfig{IconLayout: "dual", IconTarget: "claude:work/7d", AutoMode: "runway"}
+	if !applyTrayPreferences(c) {
+		t.Fatal("first config load was not applied")
+	}
+	if s.iconLayout != config.IconLayoutDual || s.iconAutoMode != iconAutoRunway || s.iconTargetOverride != (iconTarget{Provider: "claude:work", Window: "7d"}) {
+		t.Fatalf("applied state = %q %q %+v", s.iconLayout, s.iconAutoMode, s.iconTargetOverride)
+	}
+
+	// A menu choice is saved, and a reload of the unchanged file keeps it.
+	s.mu.Lock()
+	s.iconAutoMode = iconAutoProjected
+	s.iconTargetOverride = iconTarget{}
+	s.mu.Unlock()
+	if applyTrayPreferences(c) {
+		t.Fatal("unchanged config reverted a menu choice")
+	}
+	saveTrayPreferences()
+	loaded, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config.TrayConfig{IconLayout: "dual", AutoMode: "projected"}
+	if loaded.Settings.Tray != want {
+		t.Fatalf("saved tray config = %+v, want %+v", loaded.Settings.Tray, want)
+	}
+
+	// An edit to the file reaches the running tray.
+	loaded.Settings.Tray = config.TrayConfig{IconTarget: "openai/5h"}
+	if !applyTrayPreferences(loaded) {
+		t.Fatal("edited config was not applied")
+	}
+	if s.iconLayout != config.IconLayoutSingle || s.iconAutoMode != iconAutoRisk || s.iconTargetOverride != (iconTarget{Provider: "openai", Window: "5h"}) {
+		t.Fatalf("reloaded state = %q %q %+v", s.iconLayout, s.iconAutoMode, s.iconTargetOverride)
+	}
+}
+
 func TestActiveIconTargetsKeepsStaleFallbackWhenNoFreshWindows(t *testing.T) {
 	now := time.Now()
 	results := map[string]*provider.UsageData{
@@ -755,82 +871,6 @@ func TestSelectedTrayTargetHonorsManualStaleOverride(t *testing.T) {
 	}
 }
 
-func TestBackedOffProviderWithoutPriorWindowsStillFetches(t *testing.T) {
-	gate := provider.NewFailureGate()
-	_ = gate.ShouldSurfaceError("openai", false)
-
-	toFetch, skipped := splitProvidersForRefresh(
-		[]provider.Provider{trayStubProvider{name: "openai"}},
-		gate,
-		map[string]*provider.UsageData{},
-		false,
-	)
-
-	if len(skipped) != 0 {
-		t.Fatalf("skipped = %v, want none", skipped)
-	}
-	if got := providerNames(toFetch); len(got) != 1 || got[0] != "openai" {
-		t.Fatalf("toFetch = %v, want [openai]", got)
-	}
-}
-
-func TestBackedOffProviderWithPriorWindowsUsesClone(t *testing.T) {
-	gate := provider.NewFailureGate()
-	_ = gate.ShouldSurfaceError("openai", true)
-	prev := &provider.UsageData{
-		Provider: "openai",
-		Windows: []provider.UsageWindow{
-			{Name: "7d", Utilization: 25, ResetsAt: time.Now().Add(24 * time.Hour)},
-		},
-	}
-
-	toFetch, skipped := splitProvidersForRefresh(
-		[]provider.Provider{trayStubProvider{name: "openai"}},
-		gate,
-		map[string]*provider.UsageData{"openai": prev},
-		false,
-	)
-
-	if len(toFetch) != 0 {
-		t.Fatalf("toFetch = %v, want none", providerNames(toFetch))
-	}
-	got := skipped["openai"]
-	if got == nil {
-		t.Fatal("skipped[openai] is nil, want cached usage")
-	}
-	if got == prev {
-		t.Fatal("skipped data aliases prior result, want clone")
-	}
-	got.Windows[0].Utilization = 99
-	if prev.Windows[0].Utilization != 25 {
-		t.Fatalf("mutating skipped clone changed prior result to %.0f", prev.Windows[0].Utilization)
-	}
-}
-
-func TestForceRefreshIgnoresBackoff(t *testing.T) {
-	gate := provider.NewFailureGate()
-	_ = gate.ShouldSurfaceError("openai", true)
-
-	toFetch, skipped := splitProvidersForRefresh(
-		[]provider.Provider{trayStubProvider{name: "openai"}},
-		gate,
-		map[string]*provider.UsageData{
-			"openai": {
-				Provider: "openai",
-				Windows:  []provider.UsageWindow{{Name: "7d", ResetsAt: time.Now().Add(24 * time.Hour)}},
-			},
-		},
-		true,
-	)
-
-	if len(skipped) != 0 {
-		t.Fatalf("skipped = %v, want none", skipped)
-	}
-	if got := providerNames(toFetch); len(got) != 1 || got[0] != "openai" {
-		t.Fatalf("toFetch = %v, want [openai]", got)
-	}
-}
-
 func TestSelectedTrayTargetHonorsQuotaOverride(t *testing.T) {
 	now := time.Now()
 	results := map[string]*provider.UsageData{
@@ -1098,21 +1138,6 @@ func TestExpectedUsagePctClampsToResetWindow(t *testing.T) {
 	}
 }
 
-func TestPollIntervalForConfigEnforcesFiveMinuteFloor(t *testing.T) {
-	tests := map[int]time.Duration{
-		0:   5 * time.Minute,
-		60:  5 * time.Minute,
-		299: 5 * time.Minute,
-		300: 5 * time.Minute,
-		600: 10 * time.Minute,
-	}
-	for configured, want := range tests {
-		if got := pollIntervalForConfig(configured); got != want {
-			t.Fatalf("pollIntervalForConfig(%d) = %s, want %s", configured, got, want)
-		}
-	}
-}
-
 func waitIconClickAction(t *testing.T, ch <-chan iconClickAction, timeout time.Duration) iconClickAction {
 	t.Helper()
 	select {
@@ -1131,30 +1156,22 @@ func absFloat(n float64) float64 {
 	return n
 }
 
-type trayStubProvider struct {
-	name string
-}
-
-func (p trayStubProvider) Name() string {
-	return p.name
-}
-
-func (p trayStubProvider) DisplayName() string {
-	return p.name
-}
-
-func (p trayStubProvider) Description() string {
-	return ""
-}
-
-func (p trayStubProvider) DashboardURL() string {
-	return ""
-}
-
-func (p trayStubProvider) IsConfigured() bool {
-	return true
-}
-
-func (p trayStubProvider) FetchUsage(context.Context) (*provider.UsageData, error) {
-	return &provider.UsageData{Provider: p.name}, nil
+func TestSnoozeUntilResetFollowsTheMostUsedWindow(t *testing.T) {
+	now := time.Now()
+	results := map[string]*provider.UsageData{
+		"claude": {Provider: "claude", Windows: []provider.UsageWindow{
+			{Name: "5h", Utilization: 40, ResetsAt: now.Add(2 * time.Hour)},
+			{Name: "7d", Utilization: 88, ResetsAt: now.Add(3 * 24 * time.Hour)},
+		}},
+		"codex": {Provider: "codex", Error: "HTTP 500", Windows: []provider.UsageWindow{
+			{Name: "5h", Utilization: 99, ResetsAt: now.Add(time.Hour)},
+		}},
+	}
+	got, ok := snoozeUntilReset(results)
+	if !ok || !got.Equal(now.Add(3*24*time.Hour)) {
+		t.Fatalf("snoozeUntilReset = %v, %v; want the 7d reset", got, ok)
+	}
+	if _, ok := snoozeUntilReset(nil); ok {
+		t.Fatal("snoozeUntilReset without results should be unavailable")
+	}
 }
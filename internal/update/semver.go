@@ -0,0 +1,91 @@
+package update
+
+import (
+	"strconv"
+	"strings"
+)
+
+// version is a parsed semantic version. Build metadata is dropped because it
+// does not affect precedence.
+type version struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+// parseVersion reads "v1.2.3", "1.2.3-rc.1", or "v1.2.3+build". It reports
+// false for anything else, including "dev".
+func parseVersion(s string) (version, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v version
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		for _, id := range v.pre {
+			if id == "" {
+				return version{}, false
+			}
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return version{}, false
+	}
+	for i, target := range []*int{&v.major, &v.minor, &v.patch} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 || (len(parts[i]) > 1 && parts[i][0] == '0') {
+			return version{}, false
+		}
+		*target = n
+	}
+	return v, true
+}
+
+// compare returns -1, 0, or 1 following semver precedence: a pre-release
+// sorts before its release, and numeric identifiers sort numerically.
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		a, aErr := strconv.Atoi(v.pre[i])
+		b, bErr := strconv.Atoi(o.pre[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], o.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(v.pre) - len(o.pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
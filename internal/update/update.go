@@ -1,7 +1,9 @@
 package update
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,43 +19,182 @@ import (
 )
 
 const (
-	repo            = "tnunamak/clawmeter"
-	defaultAPIURL   = "https://api.github.com/repos/" + repo + "/releases/latest"
+	repo = "tnunamak/clawmeter"
+	// DefaultBaseURL is GitHub's releases API for this repository. A mirror
+	// serves the same /releases JSON under its own base URL.
+	DefaultBaseURL  = "https://api.github.com/repos/" + repo
 	defaultDLPrefix = "https://github.com/" + repo + "/releases/download"
 	httpTimeout     = 15 * time.Second
 	restartHelper   = "__restart-tray"
 	restartDelay    = 750 * time.Millisecond
+	maxReleaseList  = 4 << 20
+	maxChecksums    = 64 << 10
+	maxSignature    = 4 << 10
+	maxBinary       = 256 << 20
+	// backupSuffix names the copy of the replaced binary kept for Rollback.
+	backupSuffix = ".previous"
 )
 
-// apiURL and dlPrefix are overridable by tests via the package-level
-// Check function below. They are not exported to keep the public API stable.
-var (
-	apiURL     = defaultAPIURL
-	dlPrefix   = defaultDLPrefix
-	httpClient = &http.Client{Timeout: httpTimeout}
+// Update channels. Stable skips GitHub pre-releases and semver pre-release
+// tags; prerelease offers both.
+const (
+	ChannelStable     = "stable"
+	ChannelPrerelease = "prerelease"
 )
 
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// Options selects the releases Check and Find consider.
+type Options struct {
+	// Channel is ChannelStable (the default when empty) or ChannelPrerelease.
+	Channel string
+	// Pinned, when set, is the newest version that will be offered or
+	// installed.
+	Pinned string
+	// BaseURL is a GitHub-compatible releases API base; empty means GitHub.
+	// Releases that list no assets are downloaded from <BaseURL>/download.
+	BaseURL string
+}
+
+func (o Options) endpoints() (api, dl string) {
+	base := strings.TrimRight(o.BaseURL, "/")
+	if base == "" || base == DefaultBaseURL {
+		return DefaultBaseURL, defaultDLPrefix
+	}
+	return base, base + "/download"
+}
+
+func (o Options) pinned() (version, bool, error) {
+	if o.Pinned == "" {
+		return version{}, false, nil
+	}
+	v, ok := parseVersion(o.Pinned)
+	if !ok {
+		return version{}, false, fmt.Errorf("invalid pinned version %q", o.Pinned)
+	}
+	return v, true, nil
+}
+
 type Release struct {
-	Version string
-	URL     string
+	Version     string
+	Prerelease  bool
+	PublishedAt time.Time
+	Notes       string
+	URL         string
+	// Asset is the binary's name in the release's signed checksum list.
+	Asset        string
+	ChecksumsURL string
+	SignatureURL string
+}
+
+// ErrNoReleaseKey is returned by CanApply and ApplyTo in builds that embed no
+// release key, which cannot verify a download and so install nothing.
+var ErrNoReleaseKey = errors.New("self-update is disabled in this build: it has no release signing key; download the release by hand")
+
+// CanApply reports whether this build can verify, and so install, releases.
+func CanApply() error {
+	if releasePublicKey == "" {
+		return ErrNoReleaseKey
+	}
+	return nil
 }
 
 type ghRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
+	TagName     string    `json:"tag_name"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
 		Name string `json:"name"`
 		URL  string `json:"browser_download_url"`
 	} `json:"assets"`
 }
 
-// Check queries GitHub for the latest release and returns it if newer
-// than currentVersion. Returns nil if already up to date.
-func Check(ctx context.Context, currentVersion string) (*Release, error) {
-	return checkWith(ctx, currentVersion, apiURL, dlPrefix, httpClient)
+// Check returns the newest release on opts' channel whose semantic version is
+// newer than currentVersion and not newer than opts.Pinned. Returns nil if
+// already up to date, or if currentVersion does not parse (such as a "dev"
+// build). Older releases are never offered.
+func Check(ctx context.Context, currentVersion string, opts Options) (*Release, error) {
+	return checkWith(ctx, currentVersion, opts, httpClient)
+}
+
+func checkWith(ctx context.Context, currentVersion string, opts Options, client *http.Client) (*Release, error) {
+	current, ok := parseVersion(currentVersion)
+	if !ok {
+		return nil, nil
+	}
+	pinned, isPinned, err := opts.pinned()
+	if err != nil {
+		return nil, fmt.Errorf("check update: %w", err)
+	}
+	api, dl := opts.endpoints()
+	releases, err := listReleases(ctx, client, api)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *ghRelease
+	var bestVersion version
+	for i := range releases {
+		rel := &releases[i]
+		v, ok := parseVersion(rel.TagName)
+		if !ok || rel.Draft || v.compare(current) <= 0 || (isPinned && v.compare(pinned) > 0) {
+			continue
+		}
+		if opts.Channel != ChannelPrerelease && (rel.Prerelease || len(v.pre) > 0) {
+			continue
+		}
+		if best == nil || v.compare(bestVersion) > 0 {
+			best, bestVersion = rel, v
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best.release(dl)
+}
+
+// Find returns the release tagged target for an explicit `update --to`. It
+// ignores the channel but, like Check, refuses versions that are not newer
+// than currentVersion or are newer than opts.Pinned.
+func Find(ctx context.Context, currentVersion, target string, opts Options) (*Release, error) {
+	return findWith(ctx, currentVersion, target, opts, httpClient)
 }
 
-func checkWith(ctx context.Context, currentVersion, api, dl string, client *http.Client) (*Release, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", api, nil)
+func findWith(ctx context.Context, currentVersion, target string, opts Options, client *http.Client) (*Release, error) {
+	want, ok := parseVersion(target)
+	if !ok {
+		return nil, fmt.Errorf("invalid version %q", target)
+	}
+	if current, ok := parseVersion(currentVersion); ok && want.compare(current) <= 0 {
+		if want.compare(current) == 0 {
+			return nil, fmt.Errorf("already at %s", currentVersion)
+		}
+		return nil, fmt.Errorf("%s is older than %s; use --rollback to return to the previous binary", target, currentVersion)
+	}
+	pinned, isPinned, err := opts.pinned()
+	if err != nil {
+		return nil, err
+	}
+	if isPinned && want.compare(pinned) > 0 {
+		return nil, fmt.Errorf("%s is newer than pinned_version %s", target, opts.Pinned)
+	}
+	api, dl := opts.endpoints()
+	releases, err := listReleases(ctx, client, api)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if v, ok := parseVersion(releases[i].TagName); ok && !releases[i].Draft && v.compare(want) == 0 {
+			return releases[i].release(dl)
+		}
+	}
+	return nil, fmt.Errorf("release %s not found", target)
+}
+
+func listReleases(ctx context.Context, client *http.Client, api string) ([]ghRelease, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", api+"/releases?per_page=50", nil)
 	if err != nil {
 		return nil, fmt.Errorf("check update: %w", err)
 	}
@@ -64,39 +205,43 @@ func checkWith(ctx context.Context, currentVersion, api, dl string, client *http
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("check update: GitHub API returned %d", resp.StatusCode)
+		return nil, fmt.Errorf("check update: release API returned %d", resp.StatusCode)
 	}
 
-	var rel ghRelease
-	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&rel); err != nil {
+	var releases []ghRelease
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxReleaseList)).Decode(&releases); err != nil {
 		return nil, fmt.Errorf("check update: %w", err)
 	}
+	return releases, nil
+}
 
-	if rel.TagName == "" || rel.TagName == currentVersion {
-		return nil, nil
-	}
-
-	// Simple comparison: if tags differ and current isn't "dev", it's an update
-	if currentVersion == "dev" {
-		return nil, nil
+func (rel *ghRelease) release(dl string) (*Release, error) {
+	assetName := assetNameFor(runtime.GOOS, runtime.GOARCH)
+	out := &Release{Version: rel.TagName, Prerelease: rel.Prerelease, PublishedAt: rel.PublishedAt, Notes: rel.Body, Asset: assetName}
+	for _, target := range []struct {
+		name string
+		url  *string
+	}{{assetName, &out.URL}, {checksumsAsset, &out.ChecksumsURL}, {signatureAsset, &out.SignatureURL}} {
+		*target.url = rel.assetURL(target.name, dl)
+		if *target.url == "" {
+			return nil, fmt.Errorf("check update: release %s has no asset %s", rel.TagName, target.name)
+		}
 	}
+	return out, nil
+}
 
-	assetName := assetNameFor(runtime.GOOS, runtime.GOARCH)
-	url := ""
+// assetURL finds name among the release's assets. A release that lists no
+// assets (an older API response shape) falls back to the download prefix.
+func (rel *ghRelease) assetURL(name, dl string) string {
 	for _, asset := range rel.Assets {
-		if asset.Name == assetName && asset.URL != "" {
-			url = asset.URL
-			break
+		if asset.Name == name && asset.URL != "" {
+			return asset.URL
 		}
 	}
-	if url == "" {
-		if len(rel.Assets) > 0 {
-			return nil, fmt.Errorf("check update: release %s has no asset %s", rel.TagName, assetName)
-		}
-		url = fmt.Sprintf("%s/%s/%s", strings.TrimRight(dl, "/"), rel.TagName, assetName)
+	if len(rel.Assets) > 0 {
+		return ""
 	}
-
-	return &Release{Version: rel.TagName, URL: url}, nil
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(dl, "/"), rel.TagName, name)
 }
 
 func assetNameFor(goos, goarch string) string {
@@ -128,20 +273,45 @@ func ExecutablePath() (string, error) {
 	return exe, nil
 }
 
-// Apply downloads the binary from url, verifies it, and replaces the
-// currently running executable. The caller should restart after Apply returns.
-func Apply(ctx context.Context, url string) error {
+// Apply downloads rel's binary, verifies it, and replaces the currently
+// running executable. The caller should restart after Apply returns.
+func Apply(ctx context.Context, rel *Release) error {
 	exe, err := ExecutablePath()
 	if err != nil {
 		return err
 	}
-	return ApplyTo(ctx, url, exe)
+	return ApplyTo(ctx, rel, exe)
 }
 
-func ApplyTo(ctx context.Context, url, exe string) error {
+// ApplyTo installs rel over exe. The binary must match its entry in the
+// release's SHA256SUMS.txt, and that list must carry a valid signature from
+// the embedded release key; without a key nothing is installed. The replaced
+// binary is kept beside exe for Rollback, and is restored at once if the new
+// one does not start.
+func ApplyTo(ctx context.Context, rel *Release, exe string) error {
+	if err := CanApply(); err != nil {
+		return err
+	}
 	if exe == "" {
 		return errors.New("executable path is empty")
 	}
+	if rel == nil || rel.URL == "" || rel.Asset == "" || rel.ChecksumsURL == "" || rel.SignatureURL == "" {
+		return errors.New("release is missing its signed checksums")
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	sums, err := download(ctx, client, rel.ChecksumsURL, maxChecksums)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", checksumsAsset, err)
+	}
+	signature, err := download(ctx, client, rel.SignatureURL, maxSignature)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", signatureAsset, err)
+	}
+	want, err := verifyChecksums(releasePublicKey, rel, sums, string(signature))
+	if err != nil {
+		return err
+	}
+
 	tmpDir, err := os.MkdirTemp("", "clawmeter-update-*")
 	if err != nil {
 		return fmt.Errorf("create temp dir: %w", err)
@@ -154,35 +324,16 @@ func ApplyTo(ctx context.Context, url, exe string) error {
 	}
 	tmpBin := filepath.Join(tmpDir, binName)
 
-	// Download
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	bin, err := download(ctx, client, rel.URL, maxBinary)
 	if err != nil {
 		return fmt.Errorf("download: %w", err)
 	}
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("download: %w", err)
+	if got := sha256.Sum256(bin); !bytes.Equal(got[:], want) {
+		return fmt.Errorf("verify binary: %s does not match %s", rel.Asset, checksumsAsset)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download: HTTP %d", resp.StatusCode)
-	}
-
-	f, err := os.Create(tmpBin)
-	if err != nil {
-		return fmt.Errorf("create temp file: %w", err)
-	}
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		f.Close()
+	if err := os.WriteFile(tmpBin, bin, 0755); err != nil {
 		return fmt.Errorf("write binary: %w", err)
 	}
-	f.Close()
-
-	if err := os.Chmod(tmpBin, 0755); err != nil {
-		return fmt.Errorf("chmod: %w", err)
-	}
 
 	// macOS quarantine
 	if runtime.GOOS == "darwin" {
@@ -194,10 +345,69 @@ func ApplyTo(ctx context.Context, url, exe string) error {
 		return fmt.Errorf("verify binary: %w", err)
 	}
 
-	// Replace the running binary.
-	// On Windows, you can't delete or overwrite a running exe, but you CAN
-	// rename it. So: rename current → .old, then move new into place.
-	// On Linux/macOS, unlink works on a running binary.
+	backup := exe + backupSuffix
+	if err := copyFile(exe, backup); err != nil {
+		return fmt.Errorf("keep previous binary: %w", err)
+	}
+	if err := replaceBinary(tmpBin, exe); err != nil {
+		return err
+	}
+	if err := exec.Command(exe, "version").Run(); err != nil {
+		if restoreErr := replaceBinary(backup, exe); restoreErr != nil {
+			return fmt.Errorf("new binary failed to start, and restoring the previous one failed: %w", restoreErr)
+		}
+		return fmt.Errorf("new binary failed to start; previous version restored: %w", err)
+	}
+	return nil
+}
+
+// Rollback restores the binary that the last update replaced. The backup is
+// consumed, so a second Rollback has nothing to restore.
+func Rollback(exe string) error {
+	if exe == "" {
+		return errors.New("executable path is empty")
+	}
+	backup := exe + backupSuffix
+	if _, err := os.Stat(backup); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("no previous version to roll back to")
+		}
+		return fmt.Errorf("rollback: %w", err)
+	}
+	if err := exec.Command(backup, "version").Run(); err != nil {
+		return fmt.Errorf("previous binary does not start: %w", err)
+	}
+	return replaceBinary(backup, exe)
+}
+
+func download(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return body, nil
+}
+
+// replaceBinary moves src over exe, which may be running.
+// On Windows, you can't delete or overwrite a running exe, but you CAN
+// rename it. So: rename current → .old, then move new into place.
+// On Linux/macOS, unlink works on a running binary.
+func replaceBinary(src, exe string) error {
 	oldExe := exe + ".old"
 	os.Remove(oldExe) // clean up any previous .old
 
@@ -206,21 +416,21 @@ func ApplyTo(ctx context.Context, url, exe string) error {
 		if err := os.Rename(exe, oldExe); err != nil {
 			return fmt.Errorf("rename current binary: %w", err)
 		}
-		if err := os.Rename(tmpBin, exe); err != nil {
+		if err := os.Rename(src, exe); err != nil {
 			// Rollback
 			os.Rename(oldExe, exe)
 			return fmt.Errorf("replace binary: %w", err)
 		}
 		// .old can't be deleted while the old process runs; CleanupOld() handles it next launch
-	} else {
-		os.Remove(exe)
-		if err := os.Rename(tmpBin, exe); err != nil {
-			if err := copyFile(tmpBin, exe); err != nil {
-				return fmt.Errorf("replace binary: %w", err)
-			}
+		return nil
+	}
+	os.Remove(exe)
+	if err := os.Rename(src, exe); err != nil {
+		if err := copyFile(src, exe); err != nil {
+			return fmt.Errorf("replace binary: %w", err)
 		}
+		os.Remove(src)
 	}
-
 	return nil
 }
 
@@ -1,50 +1,59 @@
 package update
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 )
 
-// newFakeGitHub returns a test server that responds with the given tag_name
-// and a download-prefix to substitute for the real github.com URL.
-func newFakeGitHub(t *testing.T, tag string) (api, dl string) {
+// newFakeReleases returns options pointing at a test server that serves
+// releases as the JSON body of its /releases list.
+func newFakeReleases(t *testing.T, releases string) Options {
 	t.Helper()
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases" {
+			http.NotFound(w, r)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"tag_name":%q}`, tag)
+		fmt.Fprint(w, releases)
 	}))
 	t.Cleanup(srv.Close)
-	return srv.URL, srv.URL + "/download"
+	return Options{BaseURL: srv.URL}
 }
 
-func newFakeGitHubWithAssets(t *testing.T, tag string, assets map[string]string) (api, dl string) {
+// newFakeGitHub serves one release with the given tag_name and no assets, so
+// downloads fall back to the mirror's /download prefix.
+func newFakeGitHub(t *testing.T, tag string) Options {
 	t.Helper()
-	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"tag_name":%q,"assets":[`, tag)
-		first := true
-		for name, url := range assets {
-			if !first {
-				fmt.Fprint(w, ",")
-			}
-			first = false
-			fmt.Fprintf(w, `{"name":%q,"browser_download_url":%q}`, name, url)
-		}
-		fmt.Fprint(w, `]}`)
-	}))
-	t.Cleanup(srv.Close)
-	return srv.URL, srv.URL + "/download"
+	return newFakeReleases(t, fmt.Sprintf(`[{"tag_name":%q}]`, tag))
+}
+
+func newFakeGitHubWithAssets(t *testing.T, tag string, assets map[string]string) Options {
+	t.Helper()
+	var list []string
+	for name, url := range assets {
+		list = append(list, fmt.Sprintf(`{"name":%q,"browser_download_url":%q}`, name, url))
+	}
+	return newFakeReleases(t, fmt.Sprintf(`[{"tag_name":%q,"assets":[%s]}]`, tag, strings.Join(list, ",")))
 }
 
 func TestCheck_findsUpdate(t *testing.T) {
-	api, dl := newFakeGitHub(t, "v9.9.9")
-	rel, err := checkWith(context.Background(), "v0.0.1", api, dl, http.DefaultClient)
+	opts := newFakeGitHub(t, "v9.9.9")
+	rel, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient)
 	if err != nil {
 		t.Fatalf("Check error: %v", err)
 	}
@@ -69,26 +78,71 @@ func TestCheck_findsUpdate(t *testing.T) {
 func TestCheck_usesReleaseAssetURL(t *testing.T) {
 	asset := assetNameFor(runtime.GOOS, runtime.GOARCH)
 	wantURL := "https://download.example/clawmeter"
-	api, dl := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
-		asset: wantURL,
+	opts := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
+		asset:          wantURL,
+		checksumsAsset: "https://download.example/sums",
+		signatureAsset: "https://download.example/sums.minisig",
 	})
-	rel, err := checkWith(context.Background(), "v0.0.1", api, dl, http.DefaultClient)
+	rel, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient)
 	if err != nil {
 		t.Fatalf("Check error: %v", err)
 	}
 	if rel == nil {
 		t.Fatal("expected update, got nil")
 	}
-	if rel.URL != wantURL {
-		t.Fatalf("URL = %q, want %q", rel.URL, wantURL)
+	if rel.URL != wantURL || rel.Asset != asset || rel.SignatureURL != "https://download.example/sums.minisig" {
+		t.Fatalf("release = %+v, want asset URL %q", rel, wantURL)
+	}
+}
+
+func TestCheck_waitsForSignature(t *testing.T) {
+	opts := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
+		assetNameFor(runtime.GOOS, runtime.GOARCH): "https://download.example/clawmeter",
+		checksumsAsset: "https://download.example/sums",
+	})
+	if _, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient); err == nil || !strings.Contains(err.Error(), signatureAsset) {
+		t.Fatalf("err = %v, want missing signature", err)
+	}
+}
+
+func TestCheck_waitsForChecksums(t *testing.T) {
+	opts := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
+		assetNameFor(runtime.GOOS, runtime.GOARCH): "https://download.example/clawmeter",
+	})
+	if _, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient); err == nil || !strings.Contains(err.Error(), checksumsAsset) {
+		t.Fatalf("err = %v, want missing checksums", err)
+	}
+}
+
+func TestCheck_comparesSemanticVersions(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		update          bool
+	}{
+		{"v1.9.0", "v1.10.0", true},
+		{"v1.10.0", "v1.9.0", false},
+		{"v2.0.0-rc.1", "v2.0.0", true},
+		{"v2.0.0", "v2.0.0-rc.2", false},
+		{"v1.2.3", "1.2.3", false},
+		{"v1.2.3", "nightly", false},
+	}
+	for _, tt := range tests {
+		opts := newFakeGitHub(t, tt.latest)
+		rel, err := checkWith(context.Background(), tt.current, opts, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("%s -> %s: %v", tt.current, tt.latest, err)
+		}
+		if (rel != nil) != tt.update {
+			t.Errorf("%s -> %s: update = %+v, want %v", tt.current, tt.latest, rel, tt.update)
+		}
 	}
 }
 
 func TestCheck_waitsForCurrentPlatformAsset(t *testing.T) {
-	api, dl := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
+	opts := newFakeGitHubWithAssets(t, "v9.9.9", map[string]string{
 		"clawmeter-plan9-mips": "https://download.example/wrong",
 	})
-	_, err := checkWith(context.Background(), "v0.0.1", api, dl, http.DefaultClient)
+	_, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient)
 	if err == nil {
 		t.Fatal("expected error for missing current-platform asset")
 	}
@@ -97,9 +151,69 @@ func TestCheck_waitsForCurrentPlatformAsset(t *testing.T) {
 	}
 }
 
+const channelReleases = `[
+	{"tag_name":"v1.3.0-rc.1","prerelease":true},
+	{"tag_name":"v1.1.0"},
+	{"tag_name":"v1.2.0","body":"Adds channels.","published_at":"2026-10-01T00:00:00Z"},
+	{"tag_name":"v1.4.0","draft":true}
+]`
+
+func TestCheck_followsChannelAndPin(t *testing.T) {
+	tests := []struct {
+		channel, pinned, want string
+	}{
+		{"", "", "v1.2.0"},
+		{ChannelStable, "", "v1.2.0"},
+		{ChannelPrerelease, "", "v1.3.0-rc.1"},
+		{ChannelPrerelease, "v1.2.5", "v1.2.0"},
+		{"", "v1.1.0", "v1.1.0"},
+		{"", "v1.0.0", ""},
+	}
+	for _, tt := range tests {
+		opts := newFakeReleases(t, channelReleases)
+		opts.Channel, opts.Pinned = tt.channel, tt.pinned
+		rel, err := checkWith(context.Background(), "v1.0.0", opts, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		got := ""
+		if rel != nil {
+			got = rel.Version
+		}
+		if got != tt.want {
+			t.Errorf("channel %q pinned %q: got %q, want %q", tt.channel, tt.pinned, got, tt.want)
+		}
+		if got == "v1.2.0" && (rel.Notes != "Adds channels." || rel.PublishedAt.IsZero()) {
+			t.Errorf("release notes not carried: %+v", rel)
+		}
+	}
+}
+
+func TestFind_installsOnlyNewerUnpinnedPublishedVersions(t *testing.T) {
+	opts := newFakeReleases(t, channelReleases)
+	rel, err := findWith(context.Background(), "v1.0.0", "1.3.0-rc.1", opts, http.DefaultClient)
+	if err != nil || rel.Version != "v1.3.0-rc.1" || !rel.Prerelease {
+		t.Fatalf("find rc = %+v, %v", rel, err)
+	}
+	for target, want := range map[string]string{
+		"v1.4.0": "not found",
+		"v0.9.0": "older",
+		"v1.0.0": "already",
+		"v1.x":   "invalid",
+	} {
+		if _, err := findWith(context.Background(), "v1.0.0", target, opts, http.DefaultClient); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("find %s: err = %v, want %q", target, err, want)
+		}
+	}
+	opts.Pinned = "v1.1.0"
+	if _, err := findWith(context.Background(), "v1.0.0", "v1.2.0", opts, http.DefaultClient); err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Fatalf("find past pin: err = %v", err)
+	}
+}
+
 func TestCheck_devSkipped(t *testing.T) {
-	api, dl := newFakeGitHub(t, "v9.9.9")
-	rel, err := checkWith(context.Background(), "dev", api, dl, http.DefaultClient)
+	opts := newFakeGitHub(t, "v9.9.9")
+	rel, err := checkWith(context.Background(), "dev", opts, http.DefaultClient)
 	if err != nil {
 		t.Fatalf("Check error: %v", err)
 	}
@@ -109,8 +223,8 @@ func TestCheck_devSkipped(t *testing.T) {
 }
 
 func TestCheck_currentVersionUpToDate(t *testing.T) {
-	api, dl := newFakeGitHub(t, "v1.2.3")
-	rel, err := checkWith(context.Background(), "v1.2.3", api, dl, http.DefaultClient)
+	opts := newFakeGitHub(t, "v1.2.3")
+	rel, err := checkWith(context.Background(), "v1.2.3", opts, http.DefaultClient)
 	if err != nil {
 		t.Fatalf("Check error: %v", err)
 	}
@@ -120,8 +234,8 @@ func TestCheck_currentVersionUpToDate(t *testing.T) {
 }
 
 func TestCheck_emptyTag(t *testing.T) {
-	api, dl := newFakeGitHub(t, "")
-	rel, err := checkWith(context.Background(), "v0.0.1", api, dl, http.DefaultClient)
+	opts := newFakeGitHub(t, "")
+	rel, err := checkWith(context.Background(), "v0.0.1", opts, http.DefaultClient)
 	if err != nil {
 		t.Fatalf("Check error: %v", err)
 	}
@@ -135,7 +249,7 @@ func TestCheck_serverError(t *testing.T) {
 		http.Error(w, "boom", http.StatusInternalServerError)
 	}))
 	defer srv.Close()
-	_, err := checkWith(context.Background(), "v0.0.1", srv.URL, srv.URL, http.DefaultClient)
+	_, err := checkWith(context.Background(), "v0.0.1", Options{BaseURL: srv.URL}, http.DefaultClient)
 	if err == nil {
 		t.Fatal("expected error for 500 response")
 	}
@@ -168,13 +282,159 @@ func TestParseRestartHelperArgsRejectsBadInput(t *testing.T) {
 	}
 }
 
+// releaseFixture serves a signed release for the current platform and points
+// the embedded release key at the fixture's signing key.
+type releaseFixture struct {
+	rel               *Release
+	binary, sums, sig []byte
+}
+
+func newReleaseFixture(t *testing.T, version, script string) *releaseFixture {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("release fixtures are POSIX shell scripts")
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte("testkey1")
+	prev := releasePublicKey
+	releasePublicKey = "untrusted comment: test key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+	t.Cleanup(func() { releasePublicKey = prev })
+
+	f := &releaseFixture{binary: []byte("#!/bin/sh\n" + script)}
+	asset := assetNameFor(runtime.GOOS, runtime.GOARCH)
+	sum := sha256.Sum256(f.binary)
+	f.sums = []byte(fmt.Sprintf("%x  ClawmeterSetup.exe\n%x  %s\n", sha256.Sum256(nil), sum, asset))
+	f.sig = []byte(minisign(priv, keyID, f.sums, "clawmeter "+version))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case asset:
+			w.Write(f.binary)
+		case checksumsAsset:
+			w.Write(f.sums)
+		case signatureAsset:
+			w.Write(f.sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	f.rel = &Release{Version: version, URL: srv.URL + "/" + asset, Asset: asset, ChecksumsURL: srv.URL + "/" + checksumsAsset, SignatureURL: srv.URL + "/" + signatureAsset}
+	return f
+}
+
+func minisign(priv ed25519.PrivateKey, keyID, message []byte, comment string) string {
+	sig := ed25519.Sign(priv, message)
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+	return "untrusted comment: signature\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), sig...)) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n"
+}
+
+func installedBinary(t *testing.T) string {
+	t.Helper()
+	exe := filepath.Join(t.TempDir(), "clawmeter")
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\n# previous\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func TestEmbeddedReleaseKeyParses(t *testing.T) {
+	if releasePublicKey == "" {
+		t.Skip("no release key embedded yet")
+	}
+	if _, err := parseMinisignKey(releasePublicKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyTo_refusesEverythingWithoutAReleaseKey(t *testing.T) {
+	f := newReleaseFixture(t, "v9.9.9", "# v9.9.9\n")
+	releasePublicKey = ""
+	exe := installedBinary(t)
+	if err := ApplyTo(context.Background(), f.rel, exe); !errors.Is(err, ErrNoReleaseKey) {
+		t.Fatalf("err = %v, want ErrNoReleaseKey", err)
+	}
+	if got, _ := os.ReadFile(exe); !strings.Contains(string(got), "# previous") {
+		t.Fatalf("installed binary changed to %q", got)
+	}
+}
+
+func TestApplyTo_installsVerifiedBinaryAndRollsBack(t *testing.T) {
+	f := newReleaseFixture(t, "v9.9.9", "# v9.9.9\n")
+	exe := installedBinary(t)
+	if err := ApplyTo(context.Background(), f.rel, exe); err != nil {
+		t.Fatalf("ApplyTo: %v", err)
+	}
+	if got, _ := os.ReadFile(exe); !bytes.Equal(got, f.binary) {
+		t.Fatalf("installed = %q", got)
+	}
+	if err := Rollback(exe); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if got, _ := os.ReadFile(exe); !strings.Contains(string(got), "# previous") {
+		t.Fatalf("rolled back = %q", got)
+	}
+	if err := Rollback(exe); err == nil {
+		t.Fatal("second rollback succeeded without a backup")
+	}
+}
+
+func TestApplyTo_refusesUnverifiedReleases(t *testing.T) {
+	tests := map[string]func(*releaseFixture){
+		"tampered binary":   func(f *releaseFixture) { f.binary = append(f.binary, "# extra\n"...) },
+		"tampered sums":     func(f *releaseFixture) { f.sums = append(f.sums, '\n') },
+		"other release":     func(f *releaseFixture) { f.rel.Version = "v9.9.10" },
+		"missing signature": func(f *releaseFixture) { f.sig = nil },
+		"unsigned release":  func(f *releaseFixture) { f.rel.SignatureURL = "" },
+		"unknown key": func(f *releaseFixture) {
+			_, other, _ := ed25519.GenerateKey(rand.Reader)
+			f.sig = []byte(minisign(other, []byte("testkey1"), f.sums, "clawmeter v9.9.9"))
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newReleaseFixture(t, "v9.9.9", "# v9.9.9\n")
+			tamper(f)
+			exe := installedBinary(t)
+			if err := ApplyTo(context.Background(), f.rel, exe); err == nil {
+				t.Fatal("ApplyTo accepted an unverified release")
+			}
+			if got, _ := os.ReadFile(exe); !strings.Contains(string(got), "# previous") {
+				t.Fatalf("installed binary changed to %q", got)
+			}
+			if _, err := os.Stat(exe + backupSuffix); err == nil {
+				t.Fatal("backup written for a refused release")
+			}
+		})
+	}
+}
+
+func TestApplyTo_restoresPreviousWhenNewBinaryFailsToStart(t *testing.T) {
+	f := newReleaseFixture(t, "v9.9.9", `[ "$1" = version ] && exit 1
+exit 0
+`)
+	exe := installedBinary(t)
+	err := ApplyTo(context.Background(), f.rel, exe)
+	if err == nil || !strings.Contains(err.Error(), "previous version restored") {
+		t.Fatalf("err = %v", err)
+	}
+	if got, _ := os.ReadFile(exe); !strings.Contains(string(got), "# previous") {
+		t.Fatalf("binary after failed start = %q", got)
+	}
+}
+
 // TestCheck_live is gated behind CLAWMETER_LIVE_UPDATE_CHECK=1 so normal
 // unit runs don't hit the real GitHub API.
 func TestCheck_live(t *testing.T) {
 	if os.Getenv("CLAWMETER_LIVE_UPDATE_CHECK") != "1" {
 		t.Skip("set CLAWMETER_LIVE_UPDATE_CHECK=1 to run live GitHub check")
 	}
-	rel, err := Check(context.Background(), "v0.0.1")
+	rel, err := Check(context.Background(), "v0.0.1", Options{})
 	if err != nil {
 		t.Fatalf("live Check error: %v", err)
 	}